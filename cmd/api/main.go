@@ -3,9 +3,11 @@ package main
 import (
 	"log"
 	"os"
+	"time"
 
 	"split-go/internal/config"
 	"split-go/internal/database"
+	"split-go/internal/handlers"
 	"split-go/internal/routes"
 
 	"github.com/gofiber/fiber/v2"
@@ -69,14 +71,20 @@ func main() {
 	// 中介軟體
 	app.Use(logger.New())
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowMethods: "GET,POST,HEAD,PUT,DELETE,PATCH,OPTIONS",
-		AllowHeaders: "Origin,Content-Type,Accept,Authorization",
+		AllowOrigins:  "*",
+		AllowMethods:  "GET,POST,HEAD,PUT,DELETE,PATCH,OPTIONS",
+		AllowHeaders:  "Origin,Content-Type,Accept,Authorization,If-Match,Idempotency-Key",
+		ExposeHeaders: "ETag,Idempotent-Replayed",
 	}))
 
 	// 路由設定
 	routes.Setup(app, db, cfg)
 
+	// 啟動定期交易排程
+	recurringHandler := handlers.NewRecurringTransactionHandler(db)
+	recurringHandler.SetMaxPerRun(cfg.RecurringMaxPerRun)
+	go runRecurringScheduler(recurringHandler, cfg.RecurringInterval)
+
 	// 啟動伺服器
 	port := os.Getenv("APP_PORT")
 	if port == "" {
@@ -86,3 +94,21 @@ func main() {
 	log.Printf("伺服器運行在埠口 %s", port)
 	log.Fatal(app.Listen(":" + port))
 }
+
+// runRecurringScheduler 定期產生已到期的定期交易
+// 排程進度保存在資料庫中，重新啟動後會從上次處理的位置繼續
+func runRecurringScheduler(recurringHandler *handlers.RecurringTransactionHandler, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		created, err := recurringHandler.ProcessDueRecurringTransactions(time.Now())
+		if err != nil {
+			log.Println("定期交易排程執行失敗:", err)
+		} else if created > 0 {
+			log.Printf("已產生 %d 筆定期交易", created)
+		}
+
+		<-ticker.C
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"split-go/internal/config"
+	"split-go/internal/models"
+	"split-go/internal/services"
+	"strings"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func main() {
+	var (
+		file   = flag.String("file", "", "匯率檔案路徑 (CSV 或 ECB XML)")
+		format = flag.String("format", "", "檔案格式: csv, ecb (可選，預設依副檔名判斷)")
+		source = flag.String("source", "csv", "CSV 匯率來源名稱")
+		dbURL  = flag.String("db", "", "資料庫連接字符串 (可選，將使用環境變數)")
+	)
+	flag.Parse()
+
+	if *file == "" {
+		fmt.Println("用法: import-rates -file <路徑> [-format csv|ecb] [-source 名稱] [-db 連接字符串]")
+		fmt.Println("  CSV 格式: date,base,quote,rate (例如 2024-01-02,JPY,TWD,0.2134)")
+		fmt.Println("  ECB 格式: 歐洲央行 eurofxref XML (以 EUR 為基準)")
+		os.Exit(1)
+	}
+
+	// 依副檔名判斷格式
+	if *format == "" {
+		if strings.EqualFold(filepath.Ext(*file), ".xml") {
+			*format = "ecb"
+		} else {
+			*format = "csv"
+		}
+	}
+
+	// 解析匯率檔案
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatal("開啟檔案失敗:", err)
+	}
+	defer f.Close()
+
+	var rates []models.ExchangeRate
+	switch *format {
+	case "csv":
+		rates, err = services.ParseExchangeRatesCSV(f, *source)
+	case "ecb":
+		rates, err = services.ParseECBXML(f)
+	default:
+		log.Fatalf("未知格式: %s (可用格式: csv, ecb)", *format)
+	}
+	if err != nil {
+		log.Fatal("解析匯率檔案失敗:", err)
+	}
+
+	fmt.Printf("解析完成，共 %d 筆匯率\n", len(rates))
+
+	// 初始化配置
+	cfg := config.Load()
+
+	// 使用指定的資料庫 URL 或配置文件中的 URL
+	databaseURL := cfg.DatabaseURL
+	if *dbURL != "" {
+		databaseURL = *dbURL
+	}
+
+	// 連接資料庫
+	db, err := gorm.Open(postgres.Open(databaseURL), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Warn),
+	})
+	if err != nil {
+		log.Fatal("資料庫連接失敗:", err)
+	}
+
+	if err := db.AutoMigrate(&models.ExchangeRate{}); err != nil {
+		log.Fatal("遷移匯率表失敗:", err)
+	}
+
+	// 匯入匯率（相同日期與幣別組合會覆寫）
+	count, err := services.NewExchangeRateService(db).Import(rates)
+	if err != nil {
+		log.Fatal("匯入匯率失敗:", err)
+	}
+
+	fmt.Printf("✅ 匯率匯入完成，共 %d 筆\n", count)
+}
@@ -7,6 +7,7 @@ import (
 	"split-go/internal/config"
 	"split-go/internal/database"
 	"split-go/internal/models"
+	"split-go/internal/services"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -15,7 +16,7 @@ import (
 
 func main() {
 	var (
-		action = flag.String("action", "migrate", "執行動作: migrate, reset, seed")
+		action = flag.String("action", "migrate", "執行動作: migrate, reset, seed, check-balances, rebuild-balances")
 		dbURL  = flag.String("db", "", "資料庫連接字符串 (可選，將使用環境變數)")
 	)
 	flag.Parse()
@@ -70,8 +71,20 @@ func main() {
 
 		// 刪除所有表 (按相反順序)
 		tables := []interface{}{
+			&models.IdempotencyKey{},
 			&models.SecurityEvent{},
+			&models.ExchangeRate{},
+			&models.Posting{},
+			&models.JournalEntry{},
+			&models.MemberBalance{},
+			&models.SettlementPayment{},
+			&models.SettlementEvent{},
 			&models.Settlement{},
+			&models.RecurringTransaction{},
+			&models.TransactionRevision{},
+			"transaction_item_consumers",
+			&models.TransactionItem{},
+			&models.TransactionPayment{},
 			&models.TransactionSplit{},
 			&models.Transaction{},
 			&models.GroupMember{},
@@ -146,11 +159,39 @@ func main() {
 		fmt.Println("   2. 日本旅遊 (Bob, Diana, Eve)")
 		fmt.Println("   3. 公司聚餐 (創建者: Alice)")
 
+	case "check-balances":
+		fmt.Println("開始比對平衡表與日記帳過帳加總...")
+		discrepancies, err := services.NewBalanceService(db).CheckAllLedgers()
+		if err != nil {
+			log.Fatal("比對平衡表失敗:", err)
+		}
+		if len(discrepancies) == 0 {
+			fmt.Println("✅ 平衡表與日記帳一致")
+			return
+		}
+		for _, d := range discrepancies {
+			fmt.Printf("群組 %d 用戶 %d: 平衡表 %d (付 %d / 欠 %d)，應為 %d (付 %d / 欠 %d)\n",
+				d.GroupID, d.UserID,
+				d.Stored.Balance, d.Stored.Paid, d.Stored.Owed,
+				d.Expected.Balance, d.Expected.Paid, d.Expected.Owed)
+		}
+		log.Fatalf("發現 %d 筆不一致，請執行 -action=rebuild-balances 重建", len(discrepancies))
+
+	case "rebuild-balances":
+		fmt.Println("開始補登分錄並重建平衡表...")
+		count, err := services.NewBalanceService(db).RebuildAllLedgers()
+		if err != nil {
+			log.Fatal("重建平衡表失敗:", err)
+		}
+		fmt.Printf("✅ 已重建 %d 個群組的平衡表\n", count)
+
 	default:
 		fmt.Printf("未知動作: %s\n", *action)
 		fmt.Println("可用動作:")
 		fmt.Println("  migrate   - 執行資料庫遷移和基本分類")
 		fmt.Println("  reset     - 重置資料庫 (刪除所有資料)")
 		fmt.Println("  seed      - 建立完整測試資料 (用戶、群組、交易)")
+		fmt.Println("  check-balances   - 比對平衡表與完整重新計算的結果")
+		fmt.Println("  rebuild-balances - 以完整重新計算重建所有群組的平衡表")
 	}
 }
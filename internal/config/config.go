@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"time"
 )
 
@@ -18,6 +19,10 @@ type Config struct {
 	AppEnv               string
 	FirebaseProjectID    string
 	FirebaseCredPath     string
+	RecurringInterval    time.Duration // 定期交易排程的檢查間隔
+	RecurringMaxPerRun   int           // 每次排程每個定期交易最多補產生的次數
+	TransactionRetention time.Duration // 已刪除的交易可以還原的期限
+	IdempotencyKeyTTL    time.Duration // Idempotency-Key 保存回應的期限
 }
 
 func Load() *Config {
@@ -34,6 +39,10 @@ func Load() *Config {
 		AppEnv:               getEnv("APP_ENV", "development"),
 		FirebaseProjectID:    getEnv("FIREBASE_PROJECT_ID", ""),
 		FirebaseCredPath:     getEnv("FIREBASE_CREDENTIALS_PATH", ""),
+		RecurringInterval:    getDurationEnv("RECURRING_INTERVAL", "1m"),
+		RecurringMaxPerRun:   getIntEnv("RECURRING_MAX_PER_RUN", 100),
+		TransactionRetention: getDurationEnv("TRANSACTION_RETENTION", "720h"), // 30天
+		IdempotencyKeyTTL:    getDurationEnv("IDEMPOTENCY_KEY_TTL", "24h"),
 	}
 }
 
@@ -58,3 +67,11 @@ func getDurationEnv(key string, defaultValue string) time.Duration {
 	// 如果都失敗，返回 5 分鐘作為最後的預設值
 	return 5 * time.Minute
 }
+
+// getIntEnv 從環境變量獲取整數配置，解析失敗時使用預設值
+func getIntEnv(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"split-go/internal/models"
+	"split-go/internal/money"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -28,17 +29,38 @@ func Init(databaseURL string) (*gorm.DB, error) {
 
 // AutoMigrate 執行資料庫遷移
 func AutoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	// 先將舊版浮點數金額欄位轉換為最小貨幣單位
+	if err := MigrateMoneyColumns(db); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(
 		&models.User{},
 		&models.Group{},
 		&models.GroupMember{},
 		&models.Category{},
 		&models.Transaction{},
 		&models.TransactionSplit{},
+		&models.TransactionPayment{},
+		&models.TransactionItem{},
+		&models.TransactionRevision{},
+		&models.RecurringTransaction{},
 		&models.Settlement{},
+		&models.SettlementEvent{},
+		&models.SettlementPayment{},
+		&models.MemberBalance{},
+		&models.JournalEntry{},
+		&models.Posting{},
+		&models.ExchangeRate{},
 		&models.UserSession{},
 		&models.SecurityEvent{},
-	)
+		&models.IdempotencyKey{},
+	); err != nil {
+		return err
+	}
+
+	// 將舊版結算狀態轉換為新的狀態名稱
+	return MigrateSettlementStatuses(db)
 }
 
 // SeedAll 執行所有 seed 操作
@@ -282,7 +304,7 @@ func SeedTransactions(db *gorm.DB) error {
 		{
 			GroupID:     groups[0].ID,
 			Description: "便利商店買日用品",
-			Amount:      450.0,
+			Amount:      money.FromFloat(450, "TWD"),
 			Currency:    "TWD",
 			CategoryID:  categories[4].ID, // 購物
 			PaidBy:      users[0].ID,      // Alice
@@ -292,7 +314,7 @@ func SeedTransactions(db *gorm.DB) error {
 		{
 			GroupID:     groups[0].ID,
 			Description: "週末聚餐",
-			Amount:      1200.0,
+			Amount:      money.FromFloat(1200, "TWD"),
 			Currency:    "TWD",
 			CategoryID:  categories[0].ID, // 餐飲
 			PaidBy:      users[1].ID,      // Bob
@@ -302,7 +324,7 @@ func SeedTransactions(db *gorm.DB) error {
 		{
 			GroupID:     groups[0].ID,
 			Description: "電費分攤",
-			Amount:      2400.0,
+			Amount:      money.FromFloat(2400, "TWD"),
 			Currency:    "TWD",
 			CategoryID:  categories[7].ID, // 其他
 			PaidBy:      users[2].ID,      // Charlie
@@ -343,16 +365,22 @@ func createTransactionSplits(db *gorm.DB, transaction models.Transaction) error
 		return nil
 	}
 
-	// 平均分攤
-	amountPerPerson := transaction.Amount / float64(len(members))
-	percentagePerPerson := 100.0 / float64(len(members))
+	// 平均分攤（最大餘數法確保總和等於交易金額）
+	amounts, err := money.SplitEvenly(transaction.Amount, len(members))
+	if err != nil {
+		return err
+	}
+	basisPoints, err := money.SplitEvenly(100*100, len(members))
+	if err != nil {
+		return err
+	}
 
-	for _, member := range members {
+	for i, member := range members {
 		split := models.TransactionSplit{
 			TransactionID: transaction.ID,
 			UserID:        member.UserID,
-			Amount:        amountPerPerson,
-			Percentage:    percentagePerPerson,
+			Amount:        amounts[i],
+			Percentage:    float64(basisPoints[i]) / 100,
 			SplitType:     models.SplitEqual,
 		}
 
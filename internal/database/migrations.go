@@ -0,0 +1,153 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"split-go/internal/models"
+	"split-go/internal/money"
+
+	"gorm.io/gorm"
+)
+
+// moneyColumn 需要從浮點數轉換為最小貨幣單位的金額欄位
+type moneyColumn struct {
+	model    interface{}
+	table    string
+	column   string
+	currency string // 取得幣別的 SQL 表達式
+	from     string // 取得幣別所需的額外 FROM/WHERE 子句
+}
+
+// moneyColumns 舊版以 float64 儲存的金額欄位
+var moneyColumns = []moneyColumn{
+	{
+		model:    &models.Transaction{},
+		table:    "transactions",
+		column:   "amount",
+		currency: "transactions.currency",
+	},
+	{
+		model:    &models.TransactionSplit{},
+		table:    "transaction_splits",
+		column:   "amount",
+		currency: "transactions.currency",
+		from:     "FROM transactions WHERE transactions.id = transaction_splits.transaction_id",
+	},
+	{
+		model:    &models.Settlement{},
+		table:    "settlements",
+		column:   "amount",
+		currency: "settlements.currency",
+	},
+}
+
+// MigrateMoneyColumns 將舊的浮點數金額欄位轉換為以最小貨幣單位儲存的整數
+// 已經是整數型別的欄位會被略過，因此可以重複執行
+func MigrateMoneyColumns(db *gorm.DB) error {
+	for _, mc := range moneyColumns {
+		needed, err := needsMoneyMigration(db, mc)
+		if err != nil {
+			return err
+		}
+		if !needed {
+			continue
+		}
+
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return migrateMoneyColumn(tx, mc)
+		}); err != nil {
+			return fmt.Errorf("轉換 %s.%s 失敗: %w", mc.table, mc.column, err)
+		}
+	}
+
+	return nil
+}
+
+// needsMoneyMigration 檢查欄位是否仍為浮點數型別
+func needsMoneyMigration(db *gorm.DB, mc moneyColumn) (bool, error) {
+	if !db.Migrator().HasTable(mc.model) {
+		return false, nil
+	}
+
+	columnTypes, err := db.Migrator().ColumnTypes(mc.model)
+	if err != nil {
+		return false, err
+	}
+
+	for _, columnType := range columnTypes {
+		if columnType.Name() != mc.column {
+			continue
+		}
+		switch strings.ToLower(columnType.DatabaseTypeName()) {
+		case "float4", "float8", "real", "double precision", "numeric", "decimal":
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// migrateMoneyColumn 以暫存欄位轉換單一金額欄位
+func migrateMoneyColumn(tx *gorm.DB, mc moneyColumn) error {
+	tempColumn := mc.column + "_minor"
+
+	statements := []string{
+		fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s BIGINT", mc.table, tempColumn),
+		fmt.Sprintf("UPDATE %s SET %s = ROUND(%s.%s * POWER(10, %s)) %s",
+			mc.table, tempColumn, mc.table, mc.column, exponentCaseSQL(mc.currency), mc.from),
+		fmt.Sprintf("UPDATE %s SET %s = 0 WHERE %s IS NULL", mc.table, tempColumn, tempColumn),
+		fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", mc.table, mc.column),
+		fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", mc.table, tempColumn, mc.column),
+		fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET NOT NULL", mc.table, mc.column),
+	}
+
+	for _, statement := range statements {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exponentCaseSQL 產生依幣別取得小數位數的 CASE 表達式
+func exponentCaseSQL(currencyExpr string) string {
+	exponents := money.Exponents()
+	codes := make([]string, 0, len(exponents))
+	for code := range exponents {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "CASE UPPER(%s)", currencyExpr)
+	for _, code := range codes {
+		fmt.Fprintf(&builder, " WHEN '%s' THEN %d", code, exponents[code])
+	}
+	fmt.Fprintf(&builder, " ELSE %d END", money.Exponent(""))
+
+	return builder.String()
+}
+
+// legacySettlementStatuses 舊版結算狀態與新狀態的對應
+var legacySettlementStatuses = map[string]models.SettlementStatus{
+	"paid":     models.SettlementConfirmed,
+	"declined": models.SettlementRejected,
+}
+
+// MigrateSettlementStatuses 將舊版的結算狀態轉換為新的狀態名稱
+// 只更新仍使用舊名稱的記錄，因此可以重複執行
+func MigrateSettlementStatuses(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for legacy, status := range legacySettlementStatuses {
+			if err := tx.Model(&models.Settlement{}).Unscoped().
+				Where("status = ?", legacy).
+				Update("status", status).Error; err != nil {
+				return fmt.Errorf("遷移結算狀態 %s 失敗: %w", legacy, err)
+			}
+		}
+		return nil
+	})
+}
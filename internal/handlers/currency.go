@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"split-go/internal/money"
+	"split-go/internal/responses"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type CurrencyHandler struct{}
+
+func NewCurrencyHandler() *CurrencyHandler {
+	return &CurrencyHandler{}
+}
+
+// GetCurrencies 獲取支援的幣別
+// @Summary 獲取幣別列表
+// @Description 列出所有支援的 ISO 4217 幣別及其小數位數，分帳與結算建議皆依小數位數進位
+// @Tags 幣別
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} object{error=bool,data=[]object{code=string,numeric_code=string,exponent=int,symbol=string}} "幣別列表"
+// @Failure 401 {object} object{error=bool,message=string} "未授權"
+// @Router /currencies [get]
+func (h *CurrencyHandler) GetCurrencies(c *fiber.Ctx) error {
+	currencyResponses := responses.NewCurrencyResponseList(money.Currencies())
+
+	return c.JSON(responses.SuccessResponse(currencyResponses))
+}
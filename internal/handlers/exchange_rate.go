@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"split-go/internal/money"
+	"split-go/internal/responses"
+	"split-go/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type ExchangeRateHandler struct {
+	db                  *gorm.DB
+	exchangeRateService *services.ExchangeRateService
+}
+
+func NewExchangeRateHandler(db *gorm.DB) *ExchangeRateHandler {
+	return &ExchangeRateHandler{
+		db:                  db,
+		exchangeRateService: services.NewExchangeRateService(db),
+	}
+}
+
+// GetExchangeRate 查詢匯率
+// @Summary 查詢匯率
+// @Description 查詢指定日期的匯率（當天沒有資料時使用最近的前一天），可提供金額預覽換算結果
+// @Tags 匯率
+// @Produce json
+// @Security BearerAuth
+// @Param base query string true "基準幣別，例如 JPY"
+// @Param quote query string true "報價幣別，例如 TWD"
+// @Param date query string false "日期 (YYYY-MM-DD)，預設為今天"
+// @Param amount query string false "以基準幣別計的金額，提供時回傳換算後金額"
+// @Success 200 {object} object{error=bool,data=object{base=string,quote=string,rate=number,date=string,source=string,amount=number,converted_amount=number}} "匯率資訊"
+// @Failure 400 {object} object{error=bool,message=string} "參數錯誤"
+// @Failure 401 {object} object{error=bool,message=string} "未授權"
+// @Failure 404 {object} object{error=bool,message=string} "找不到匯率"
+// @Failure 500 {object} object{error=bool,message=string} "服務器內部錯誤"
+// @Router /exchange-rates [get]
+func (h *ExchangeRateHandler) GetExchangeRate(c *fiber.Ctx) error {
+	// 1. 解析查詢參數
+	base := strings.ToUpper(c.Query("base"))
+	quote := strings.ToUpper(c.Query("quote"))
+	if base == "" || quote == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse("必須提供 base 與 quote 幣別"),
+		)
+	}
+
+	date := time.Now()
+	if dateParam := c.Query("date"); dateParam != "" {
+		parsed, err := time.Parse("2006-01-02", dateParam)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(
+				responses.ErrorResponse("無效的日期格式，請使用 YYYY-MM-DD"),
+			)
+		}
+		date = parsed
+	}
+
+	// 2. 查詢匯率
+	rate, err := h.exchangeRateService.Resolve(base, quote, date)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(
+				responses.ErrorResponse("找不到匯率"),
+			)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("查詢匯率失敗"),
+		)
+	}
+
+	rateResponse := responses.NewExchangeRateResponse(*rate)
+
+	// 3. 換算預覽
+	if amountParam := c.Query("amount"); amountParam != "" {
+		amount, err := money.Parse(amountParam, base)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(
+				responses.ErrorResponse(err.Error()),
+			)
+		}
+		rateResponse.Amount = amount.Decimal(base)
+		rateResponse.ConvertedAmount = money.Convert(amount, base, quote, rate.Rate).Decimal(quote)
+	}
+
+	return c.JSON(responses.SuccessResponse(rateResponse))
+}
@@ -5,6 +5,7 @@ import (
 
 	"split-go/internal/middleware"
 	"split-go/internal/models"
+	"split-go/internal/money"
 	"split-go/internal/responses"
 
 	"github.com/gofiber/fiber/v2"
@@ -61,8 +62,9 @@ func (h *GroupHandler) GetUserGroups(c *fiber.Ctx) error {
 
 // CreateGroupRequest 創建群組請求結構
 type CreateGroupRequest struct {
-	Name        string `json:"name" validate:"required,min=1,max=50"`
-	Description string `json:"description" validate:"max=200"`
+	Name         string `json:"name" validate:"required,min=1,max=50"`
+	Description  string `json:"description" validate:"max=200"`
+	BaseCurrency string `json:"base_currency" validate:"omitempty,iso4217"` // 群組基準幣別，預設為 TWD
 }
 
 // CreateGroup 創建新群組
@@ -72,8 +74,8 @@ type CreateGroupRequest struct {
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param request body object{name=string,description=string} true "群組資料"
-// @Success 201 {object} object{error=bool,message=string,data=object{id=int,name=string,description=string,created_by=int,creator=object{id=int,name=string,username=string},created_at=string,updated_at=string}} "群組創建成功"
+// @Param request body object{name=string,description=string,base_currency=string} true "群組資料"
+// @Success 201 {object} object{error=bool,message=string,data=object{id=int,name=string,description=string,base_currency=string,created_by=int,creator=object{id=int,name=string,username=string},created_at=string,updated_at=string}} "群組創建成功"
 // @Failure 400 {object} object{error=bool,message=string} "請求格式錯誤或群組名稱為空"
 // @Failure 401 {object} object{error=bool,message=string} "未授權"
 // @Failure 500 {object} object{error=bool,message=string} "服務器內部錯誤"
@@ -108,13 +110,26 @@ func (h *GroupHandler) CreateGroup(c *fiber.Ctx) error {
 		}
 	}()
 
+	// 設定群組基準幣別
+	baseCurrency := money.DefaultCurrency
+	if req.BaseCurrency != "" {
+		baseCurrency, err = money.NormalizeCurrency(req.BaseCurrency)
+		if err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusBadRequest).JSON(
+				responses.ErrorResponse(err.Error()),
+			)
+		}
+	}
+
 	// 創建群組
 	group := models.Group{
-		Name:        req.Name,
-		Description: req.Description,
-		CreatedBy:   authUser.UserID,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		Name:         req.Name,
+		Description:  req.Description,
+		BaseCurrency: baseCurrency,
+		CreatedBy:    authUser.UserID,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
 	}
 
 	if err := tx.Create(&group).Error; err != nil {
@@ -166,6 +181,7 @@ func (h *GroupHandler) CreateGroup(c *fiber.Ctx) error {
 // @Security BearerAuth
 // @Param id path int true "群組ID"
 // @Success 200 {object} object{error=bool,data=object{group=object{id=int,name=string,description=string,created_by=int,creator=object{id=int,name=string,username=string},created_at=string,updated_at=string},members=[]object{id=int,name=string,username=string,avatar=string},current_user_role=string}} "群組詳細資訊"
+// @Header 200 {string} ETag "群組目前的版本"
 // @Failure 401 {object} object{error=bool,message=string} "未授權"
 // @Failure 403 {object} object{error=bool,message=string} "不是群組成員"
 // @Failure 404 {object} object{error=bool,message=string} "群組不存在"
@@ -219,7 +235,8 @@ func (h *GroupHandler) GetGroup(c *fiber.Ctx) error {
 		)
 	}
 
-	// 創建詳細回應
+	// 創建詳細回應（ETag 為目前的版本）
+	middleware.SetETag(c, group.Version)
 	groupDetail := responses.NewGroupDetailResponse(group, members, authUser.UserID, currentMember.Role)
 
 	return c.JSON(responses.SuccessWithMessageResponse("成功獲取群組資訊", groupDetail))
@@ -227,24 +244,29 @@ func (h *GroupHandler) GetGroup(c *fiber.Ctx) error {
 
 // UpdateGroupRequest 更新群組請求結構
 type UpdateGroupRequest struct {
-	Name        string `json:"name" validate:"required,min=1,max=50"`
-	Description string `json:"description" validate:"max=200"`
+	Name         string `json:"name" validate:"required,min=1,max=50"`
+	Description  string `json:"description" validate:"max=200"`
+	BaseCurrency string `json:"base_currency" validate:"omitempty,iso4217"` // 只有在群組尚無交易與結算時可變更
+	Version      uint   `json:"version"`                                    // 修改所依據的版本，未提供 If-Match 標頭時使用
 }
 
 // UpdateGroup 更新群組資訊（需要管理員權限）
 // @Summary 更新群組資訊
-// @Description 更新群組的名稱和描述，需要管理員權限
+// @Description 更新群組的名稱和描述，需要管理員權限。需以 If-Match 標頭或 version 欄位提供修改所依據的版本，版本已過期時回傳 409
 // @Tags 群組
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "群組ID"
-// @Param request body object{name=string,description=string} true "更新資料"
-// @Success 200 {object} object{error=bool,message=string,data=object{id=int,name=string,description=string,created_by=int,creator=object{id=int,name=string,username=string},created_at=string,updated_at=string}} "群組更新成功"
+// @Param If-Match header string false "GET 回傳的 ETag（未提供時需在請求內容帶 version）"
+// @Param request body object{version=int,name=string,description=string,base_currency=string} true "更新資料"
+// @Success 200 {object} object{error=bool,message=string,data=object{id=int,name=string,description=string,base_currency=string,created_by=int,creator=object{id=int,name=string,username=string},created_at=string,updated_at=string}} "群組更新成功"
 // @Failure 400 {object} object{error=bool,message=string} "請求格式錯誤或群組名稱為空"
 // @Failure 401 {object} object{error=bool,message=string} "未授權"
 // @Failure 403 {object} object{error=bool,message=string} "沒有管理員權限"
 // @Failure 404 {object} object{error=bool,message=string} "群組不存在"
+// @Failure 409 {object} object{error=bool,message=string,data=object{id=int,version=int}} "版本已過期，data 為目前的群組資訊"
+// @Failure 428 {object} object{error=bool,message=string} "未提供 If-Match 或 version"
 // @Failure 500 {object} object{error=bool,message=string} "服務器內部錯誤"
 // @Router /groups/{id} [put]
 func (h *GroupHandler) UpdateGroup(c *fiber.Ctx) error {
@@ -275,9 +297,15 @@ func (h *GroupHandler) UpdateGroup(c *fiber.Ctx) error {
 		)
 	}
 
+	// 檢查修改所依據的版本
+	expectedVersion, err := middleware.RequireVersion(c, req.Version)
+	if err != nil {
+		return err
+	}
+
 	// 查詢群組
 	var group models.Group
-	if err := h.db.First(&group, groupID).Error; err != nil {
+	if err := h.db.Preload("Creator").First(&group, groupID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(fiber.StatusNotFound).JSON(
 				responses.ErrorResponse("群組不存在"),
@@ -287,17 +315,65 @@ func (h *GroupHandler) UpdateGroup(c *fiber.Ctx) error {
 			responses.ErrorResponse("獲取群組資訊失敗"),
 		)
 	}
+	if group.Version != expectedVersion {
+		return groupVersionConflict(c, group)
+	}
 
-	// 更新群組資訊
-	group.Name = req.Name
-	group.Description = req.Description
-	group.UpdatedAt = time.Now()
-
-	if err := h.db.Save(&group).Error; err != nil {
+	// 變更基準幣別會使已鎖定的匯率失效，因此只允許在沒有帳務記錄時變更
+	baseCurrency := group.BaseCurrency
+	if req.BaseCurrency != "" {
+		baseCurrency, err = money.NormalizeCurrency(req.BaseCurrency)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(
+				responses.ErrorResponse(err.Error()),
+			)
+		}
+	}
+	if baseCurrency != group.BaseCurrency {
+		// 垃圾桶中的記錄仍可還原，因此一併計算
+		var transactionCount, settlementCount int64
+		if err := h.db.Unscoped().Model(&models.Transaction{}).Where("group_id = ?", groupID).
+			Count(&transactionCount).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(
+				responses.ErrorResponse("檢查群組交易記錄失敗"),
+			)
+		}
+		if err := h.db.Unscoped().Model(&models.Settlement{}).Where("group_id = ?", groupID).
+			Count(&settlementCount).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(
+				responses.ErrorResponse("檢查群組結算記錄失敗"),
+			)
+		}
+		if transactionCount > 0 || settlementCount > 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(
+				responses.ErrorResponse("群組已有交易或結算記錄，無法變更基準幣別"),
+			)
+		}
+		group.BaseCurrency = baseCurrency
+	}
+
+	// 以條件更新群組資訊並遞增版本，同時送出的修改只有一個會成功
+	result := h.db.Model(&models.Group{}).Where("id = ? AND version = ?", groupID, expectedVersion).
+		Updates(map[string]interface{}{
+			"name":          req.Name,
+			"description":   req.Description,
+			"base_currency": group.BaseCurrency,
+			"version":       gorm.Expr("version + 1"),
+			"updated_at":    time.Now(),
+		})
+	if result.Error != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(
 			responses.ErrorResponse("更新群組失敗"),
 		)
 	}
+	if result.RowsAffected == 0 {
+		if err := h.db.Preload("Creator").First(&group, groupID).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(
+				responses.ErrorResponse("獲取群組資訊失敗"),
+			)
+		}
+		return groupVersionConflict(c, group)
+	}
 
 	// 重新查詢包含創建者資訊
 	if err := h.db.Preload("Creator").First(&group, group.ID).Error; err != nil {
@@ -306,9 +382,18 @@ func (h *GroupHandler) UpdateGroup(c *fiber.Ctx) error {
 		)
 	}
 
+	middleware.SetETag(c, group.Version)
 	return c.JSON(responses.SuccessWithMessageResponse("群組更新成功", responses.NewGroupResponse(group)))
 }
 
+// groupVersionConflict 回傳 409 與群組目前的資訊，讓客戶端以最新版本重新修改
+func groupVersionConflict(c *fiber.Ctx, group models.Group) error {
+	middleware.SetETag(c, group.Version)
+	return c.Status(fiber.StatusConflict).JSON(
+		responses.ErrorWithDataResponse("群組已被其他人修改，請以最新內容重新編輯", responses.NewGroupResponse(group)),
+	)
+}
+
 // DeleteGroup 刪除群組（只有創建者可以刪除）
 // @Summary 刪除群組
 // @Description 刪除群組及其所有相關資料，只有創建者可以執行此操作
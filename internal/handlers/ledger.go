@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"errors"
+
+	"split-go/internal/middleware"
+	"split-go/internal/responses"
+	"split-go/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type LedgerHandler struct {
+	db             *gorm.DB
+	balanceService *services.BalanceService
+}
+
+func NewLedgerHandler(db *gorm.DB) *LedgerHandler {
+	return &LedgerHandler{
+		db:             db,
+		balanceService: services.NewBalanceService(db),
+	}
+}
+
+// GetTrialBalance 獲取群組試算表
+// @Summary 獲取群組試算表
+// @Description 彙總群組日記帳中每位成員各幣別帳戶的借方與貸方，並檢查每筆分錄借貸是否相等
+// @Tags 帳簿
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "群組ID"
+// @Success 200 {object} object{error=bool,data=object{base_currency=string,accounts=[]object{user_id=int,currency=string,debit=number,credit=number,balance=number},totals=[]object{currency=string,debit=number,credit=number},unbalanced_entries=[]int,balanced=bool}} "試算表"
+// @Failure 401 {object} object{error=bool,message=string} "未授權"
+// @Failure 403 {object} object{error=bool,message=string} "不是群組成員"
+// @Failure 404 {object} object{error=bool,message=string} "群組不存在"
+// @Failure 500 {object} object{error=bool,message=string} "服務器內部錯誤"
+// @Router /groups/{id}/ledger [get]
+func (h *LedgerHandler) GetTrialBalance(c *fiber.Ctx) error {
+	// 1. 解析群組 ID
+	groupID, err := middleware.ParseGroupIDFromParams(c)
+	if err != nil {
+		return err
+	}
+
+	// 2. 驗證用戶是群組成員
+	_, err = middleware.RequireGroupMember(c, h.db, groupID)
+	if err != nil {
+		return err
+	}
+
+	// 3. 彙總日記帳
+	trialBalance, err := h.balanceService.TrialBalance(groupID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("產生試算表失敗"),
+		)
+	}
+
+	return c.JSON(responses.SuccessResponse(responses.NewTrialBalanceResponse(*trialBalance)))
+}
+
+// GetAccountStatement 獲取成員帳戶明細
+// @Summary 獲取成員帳戶明細
+// @Description 依過帳順序列出成員在群組中的所有過帳及累計平衡（已離開群組的成員也可查詢）
+// @Tags 帳簿
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "群組ID"
+// @Param userId path int true "用戶ID"
+// @Success 200 {object} object{error=bool,data=object{user_id=int,base_currency=string,lines=[]object{entry_id=int,source_type=string,source_id=int,description=string,reversal=bool,kind=string,currency=string,amount=number,base_amount=number,running_balance=number,posted_at=string},balance=number}} "帳戶明細"
+// @Failure 401 {object} object{error=bool,message=string} "未授權"
+// @Failure 403 {object} object{error=bool,message=string} "不是群組成員"
+// @Failure 404 {object} object{error=bool,message=string} "用戶在此群組沒有帳戶"
+// @Failure 500 {object} object{error=bool,message=string} "服務器內部錯誤"
+// @Router /groups/{id}/ledger/members/{userId} [get]
+func (h *LedgerHandler) GetAccountStatement(c *fiber.Ctx) error {
+	// 1. 解析群組與用戶 ID
+	groupID, err := middleware.ParseGroupIDFromParams(c)
+	if err != nil {
+		return err
+	}
+	userID, err := middleware.ParseUserIDFromParams(c)
+	if err != nil {
+		return err
+	}
+
+	// 2. 驗證用戶是群組成員
+	_, err = middleware.RequireGroupMember(c, h.db, groupID)
+	if err != nil {
+		return err
+	}
+
+	// 3. 取得帳戶明細
+	statement, err := h.balanceService.AccountStatement(groupID, userID)
+	if errors.Is(err, services.ErrLedgerAccountNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("取得帳戶明細失敗"),
+		)
+	}
+
+	return c.JSON(responses.SuccessResponse(responses.NewAccountStatementResponse(*statement)))
+}
@@ -0,0 +1,527 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"split-go/internal/middleware"
+	"split-go/internal/models"
+	"split-go/internal/responses"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// defaultRecurringMaxPerRun 每次排程每個定期交易預設最多補產生的次數
+const defaultRecurringMaxPerRun = 100
+
+type RecurringTransactionHandler struct {
+	db                 *gorm.DB
+	transactionHandler *TransactionHandler
+	maxPerRun          int // 每次排程每個定期交易最多補產生的次數
+}
+
+func NewRecurringTransactionHandler(db *gorm.DB) *RecurringTransactionHandler {
+	return &RecurringTransactionHandler{
+		db:                 db,
+		transactionHandler: NewTransactionHandler(db),
+		maxPerRun:          defaultRecurringMaxPerRun,
+	}
+}
+
+// SetMaxPerRun 設定每次排程每個定期交易最多補產生的次數
+func (h *RecurringTransactionHandler) SetMaxPerRun(maxPerRun int) {
+	if maxPerRun > 0 {
+		h.maxPerRun = maxPerRun
+	}
+}
+
+// errOccurrenceClaimed 該次發生已由其他排程程序處理
+var errOccurrenceClaimed = errors.New("定期交易已由其他程序處理")
+
+// GetRecurringTransactions 獲取群組的定期交易
+// @Summary 獲取定期交易列表
+// @Description 獲取群組內所有定期交易範本
+// @Tags 定期交易
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "群組ID"
+// @Success 200 {object} object{error=bool,data=[]object{id=int,group_id=int,description=string,amount=number,currency=string,split_type=string,frequency=string,interval=int,day_of_month=int,start_date=string,end_date=string,next_run_at=string,last_run_at=string,active=bool,last_error=string}} "定期交易列表"
+// @Failure 401 {object} object{error=bool,message=string} "未授權"
+// @Failure 403 {object} object{error=bool,message=string} "不是群組成員"
+// @Failure 500 {object} object{error=bool,message=string} "服務器內部錯誤"
+// @Router /groups/{id}/recurring [get]
+func (h *RecurringTransactionHandler) GetRecurringTransactions(c *fiber.Ctx) error {
+	// 1. 解析群組 ID
+	groupID, err := middleware.ParseGroupIDFromParams(c)
+	if err != nil {
+		return err
+	}
+
+	// 2. 驗證用戶是群組成員
+	_, err = middleware.RequireGroupMember(c, h.db, groupID)
+	if err != nil {
+		return err
+	}
+
+	// 3. 查詢群組的定期交易
+	var recurrings []models.RecurringTransaction
+	if err := h.db.Where("group_id = ?", groupID).
+		Preload("Payer").
+		Preload("Creator").
+		Preload("Category").
+		Order("next_run_at ASC").
+		Find(&recurrings).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("查詢定期交易失敗"),
+		)
+	}
+
+	return c.JSON(responses.SuccessResponse(responses.NewRecurringTransactionResponseList(recurrings)))
+}
+
+// CreateRecurringTransaction 創建定期交易
+// @Summary 創建定期交易
+// @Description 建立定期交易範本，排程器會在每次到期時自動產生交易（每次發生只會產生一筆）
+// @Tags 定期交易
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "群組ID"
+// @Param request body object{description=string,amount=number,currency=string,exchange_rate=number,split_type=string,paid_by=int,category_id=int,notes=string,splits=[]object{user_id=int,amount=number,percentage=number,shares=int,adjustment=number},payments=[]object{user_id=int,amount=number},frequency=string,interval=int,day_of_month=int,start_date=string,end_date=string} true "定期交易資料"
+// @Success 201 {object} object{error=bool,message=string,data=object{id=int,group_id=int,description=string,amount=number,currency=string,split_type=string,frequency=string,interval=int,day_of_month=int,start_date=string,end_date=string,next_run_at=string,active=bool}} "定期交易創建成功"
+// @Failure 400 {object} object{error=bool,message=string} "請求格式錯誤或參數無效"
+// @Failure 401 {object} object{error=bool,message=string} "未授權"
+// @Failure 403 {object} object{error=bool,message=string} "不是群組成員"
+// @Failure 500 {object} object{error=bool,message=string} "服務器內部錯誤"
+// @Router /groups/{id}/recurring [post]
+func (h *RecurringTransactionHandler) CreateRecurringTransaction(c *fiber.Ctx) error {
+	// 1. 解析群組 ID
+	groupID, err := middleware.ParseGroupIDFromParams(c)
+	if err != nil {
+		return err
+	}
+
+	// 2. 驗證用戶是群組成員
+	user, err := middleware.RequireGroupMember(c, h.db, groupID)
+	if err != nil {
+		return err
+	}
+
+	// 3. 解析請求資料
+	var req models.CreateRecurringTransactionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse("無效的請求格式"),
+		)
+	}
+
+	// 4. 驗證範本並計算第一次發生日期
+	recurring, err := h.buildRecurringTransaction(req, groupID, user.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	}
+
+	// 5. 創建定期交易
+	if err := h.db.Create(recurring).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("創建定期交易失敗"),
+		)
+	}
+
+	// 6. 載入完整資料回傳
+	if err := h.loadRecurringTransaction(recurring, groupID, recurring.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("載入定期交易失敗"),
+		)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(
+		responses.SuccessWithMessageResponse("定期交易創建成功", responses.NewRecurringTransactionResponse(*recurring)),
+	)
+}
+
+// GetRecurringTransaction 獲取單一定期交易
+// @Summary 獲取定期交易詳情
+// @Description 獲取群組內指定的定期交易範本
+// @Tags 定期交易
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "群組ID"
+// @Param recurringId path int true "定期交易ID"
+// @Success 200 {object} object{error=bool,data=object{id=int,group_id=int,description=string,amount=number,currency=string,split_type=string,frequency=string,interval=int,day_of_month=int,start_date=string,end_date=string,next_run_at=string,last_run_at=string,active=bool,last_error=string}} "定期交易詳情"
+// @Failure 401 {object} object{error=bool,message=string} "未授權"
+// @Failure 403 {object} object{error=bool,message=string} "不是群組成員"
+// @Failure 404 {object} object{error=bool,message=string} "定期交易不存在"
+// @Router /groups/{id}/recurring/{recurringId} [get]
+func (h *RecurringTransactionHandler) GetRecurringTransaction(c *fiber.Ctx) error {
+	recurring, _, err := h.findRecurringTransaction(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(responses.SuccessResponse(responses.NewRecurringTransactionResponse(*recurring)))
+}
+
+// UpdateRecurringTransaction 更新定期交易
+// @Summary 更新定期交易
+// @Description 以新的內容取代定期交易範本，只有創建者或付款者可以更新；更新後會清除錯誤並恢復排程（除非 active 為 false）
+// @Tags 定期交易
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "群組ID"
+// @Param recurringId path int true "定期交易ID"
+// @Param request body object{description=string,amount=number,currency=string,exchange_rate=number,split_type=string,paid_by=int,category_id=int,notes=string,splits=[]object{user_id=int,amount=number,percentage=number,shares=int,adjustment=number},payments=[]object{user_id=int,amount=number},frequency=string,interval=int,day_of_month=int,start_date=string,end_date=string,active=bool} true "定期交易資料"
+// @Success 200 {object} object{error=bool,message=string,data=object{id=int,group_id=int,description=string,amount=number,currency=string,split_type=string,frequency=string,interval=int,day_of_month=int,start_date=string,end_date=string,next_run_at=string,active=bool}} "定期交易更新成功"
+// @Failure 400 {object} object{error=bool,message=string} "請求格式錯誤或參數無效"
+// @Failure 401 {object} object{error=bool,message=string} "未授權"
+// @Failure 403 {object} object{error=bool,message=string} "沒有權限"
+// @Failure 404 {object} object{error=bool,message=string} "定期交易不存在"
+// @Failure 500 {object} object{error=bool,message=string} "服務器內部錯誤"
+// @Router /groups/{id}/recurring/{recurringId} [put]
+func (h *RecurringTransactionHandler) UpdateRecurringTransaction(c *fiber.Ctx) error {
+	// 1. 查詢定期交易並驗證群組成員
+	existing, user, err := h.findRecurringTransaction(c)
+	if err != nil {
+		return err
+	}
+
+	// 2. 檢查用戶權限（只有創建者或付款者可以編輯）
+	if existing.CreatedBy != user.UserID && existing.PaidBy != user.UserID {
+		return c.Status(fiber.StatusForbidden).JSON(
+			responses.ErrorResponse("您沒有權限編輯此定期交易"),
+		)
+	}
+
+	// 3. 解析請求資料
+	var req models.UpdateRecurringTransactionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse("無效的請求格式"),
+		)
+	}
+
+	// 4. 驗證新的範本
+	updated, err := h.buildRecurringTransaction(req.CreateRecurringTransactionRequest, existing.GroupID, existing.CreatedBy)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	}
+
+	// 5. 已產生過的發生日期不會重複產生，下次執行日期從上次執行之後開始計算
+	updated.ID = existing.ID
+	updated.CreatedAt = existing.CreatedAt
+	updated.LastRunAt = existing.LastRunAt
+	if existing.LastRunAt != nil {
+		updated.NextRunAt = updated.OccurrenceOnOrAfter(existing.LastRunAt.AddDate(0, 0, 1))
+	}
+	updated.Active = !updated.EndsBefore(updated.NextRunAt)
+	if req.Active != nil && !*req.Active {
+		updated.Active = false
+	}
+
+	if err := h.db.Save(updated).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("更新定期交易失敗"),
+		)
+	}
+
+	// 6. 載入完整資料回傳
+	if err := h.loadRecurringTransaction(updated, existing.GroupID, existing.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("載入定期交易失敗"),
+		)
+	}
+
+	return c.JSON(
+		responses.SuccessWithMessageResponse("定期交易更新成功", responses.NewRecurringTransactionResponse(*updated)),
+	)
+}
+
+// DeleteRecurringTransaction 刪除定期交易
+// @Summary 刪除定期交易
+// @Description 刪除定期交易範本，已產生的交易不受影響
+// @Tags 定期交易
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "群組ID"
+// @Param recurringId path int true "定期交易ID"
+// @Success 200 {object} object{error=bool,message=string} "定期交易刪除成功"
+// @Failure 401 {object} object{error=bool,message=string} "未授權"
+// @Failure 403 {object} object{error=bool,message=string} "沒有權限"
+// @Failure 404 {object} object{error=bool,message=string} "定期交易不存在"
+// @Failure 500 {object} object{error=bool,message=string} "服務器內部錯誤"
+// @Router /groups/{id}/recurring/{recurringId} [delete]
+func (h *RecurringTransactionHandler) DeleteRecurringTransaction(c *fiber.Ctx) error {
+	// 1. 查詢定期交易並驗證群組成員
+	recurring, user, err := h.findRecurringTransaction(c)
+	if err != nil {
+		return err
+	}
+
+	// 2. 檢查用戶權限（只有創建者或付款者可以刪除）
+	if recurring.CreatedBy != user.UserID && recurring.PaidBy != user.UserID {
+		return c.Status(fiber.StatusForbidden).JSON(
+			responses.ErrorResponse("您沒有權限刪除此定期交易"),
+		)
+	}
+
+	// 3. 軟刪除定期交易
+	if err := h.db.Delete(&models.RecurringTransaction{}, recurring.ID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("刪除定期交易失敗"),
+		)
+	}
+
+	return c.JSON(
+		responses.SuccessWithMessageResponse("定期交易已刪除", nil),
+	)
+}
+
+// ProcessDueRecurringTransactions 產生所有已到期的定期交易，回傳產生的交易筆數
+// 停機期間錯過的發生日期會依序補產生，每個定期交易每次最多補產生 maxPerRun 次，其餘於下次排程繼續；
+// 每次發生以條件更新下次執行日期並在同一個資料庫交易中寫入交易，因此多個程序同時執行或重新啟動時都不會重複產生
+func (h *RecurringTransactionHandler) ProcessDueRecurringTransactions(now time.Time) (int, error) {
+	var due []models.RecurringTransaction
+	if err := h.db.Where("active = ? AND next_run_at <= ?", true, now).
+		Order("next_run_at ASC").
+		Find(&due).Error; err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for i := range due {
+		recurring := &due[i]
+		for runs := 0; runs < h.maxPerRun && recurring.Active && !recurring.NextRunAt.After(now); runs++ {
+			if err := h.materializeOccurrence(recurring); err != nil {
+				if err != errOccurrenceClaimed {
+					log.Printf("定期交易 %d 產生失敗: %v", recurring.ID, err)
+				}
+				break
+			}
+			created++
+		}
+	}
+
+	return created, nil
+}
+
+// materializeOccurrence 將定期交易的下一次發生轉為實際交易，並推進下次執行日期
+// 範本無法產生交易時（例如成員已離開群組）會暫停排程並記錄原因，待範本更新後補產生
+func (h *RecurringTransactionHandler) materializeOccurrence(recurring *models.RecurringTransaction) error {
+	occurrence := recurring.NextRunAt
+
+	// 1. 依範本計算交易內容（匯率以發生日期查詢）
+	req, err := recurring.TransactionRequest()
+	if err != nil {
+		return h.pauseRecurringTransaction(recurring, errors.New("定期交易範本格式錯誤"))
+	}
+	prepared, err := h.transactionHandler.prepareTransaction(req, recurring.CreatedBy, occurrence)
+	if err != nil {
+		return h.pauseRecurringTransaction(recurring, err)
+	}
+	prepared.transaction.RecurringTransactionID = &recurring.ID
+	prepared.transaction.OccurrenceDate = &occurrence
+	prepared.transaction.CreatedAt = occurrence
+
+	// 2. 計算下次執行日期，超過結束日期時停止排程
+	next := recurring.NextOccurrence(occurrence)
+	active := !recurring.EndsBefore(next)
+
+	tx := h.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 3. 以目前的下次執行日期為條件推進排程，確保只有一個程序能處理此次發生
+	result := tx.Model(&models.RecurringTransaction{}).
+		Where("id = ? AND next_run_at = ? AND active = ?", recurring.ID, occurrence, true).
+		Updates(map[string]interface{}{
+			"next_run_at": next,
+			"last_run_at": occurrence,
+			"active":      active,
+			"last_error":  "",
+		})
+	if result.Error != nil {
+		tx.Rollback()
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return errOccurrenceClaimed
+	}
+
+	// 4. 寫入交易、付款與分帳記錄
+	if err := h.transactionHandler.savePreparedTransaction(tx, prepared); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	recurring.NextRunAt = next
+	recurring.LastRunAt = &occurrence
+	recurring.Active = active
+	return nil
+}
+
+// pauseRecurringTransaction 暫停定期交易並記錄失敗原因
+func (h *RecurringTransactionHandler) pauseRecurringTransaction(recurring *models.RecurringTransaction, cause error) error {
+	if err := h.db.Model(&models.RecurringTransaction{}).
+		Where("id = ? AND next_run_at = ?", recurring.ID, recurring.NextRunAt).
+		Updates(map[string]interface{}{
+			"active":     false,
+			"last_error": cause.Error(),
+		}).Error; err != nil {
+		return err
+	}
+
+	recurring.Active = false
+	recurring.LastError = cause.Error()
+	return cause
+}
+
+// buildRecurringTransaction 驗證請求並建立定期交易範本
+// 範本會以開始日期試算一次交易，確保分帳與付款設定有效
+func (h *RecurringTransactionHandler) buildRecurringTransaction(req models.CreateRecurringTransactionRequest, groupID, createdBy uint) (*models.RecurringTransaction, error) {
+	// 1. 驗證排程設定
+	switch req.Frequency {
+	case models.RecurrenceMonthly, models.RecurrenceWeekly, models.RecurrenceCustom:
+	default:
+		return nil, errors.New("無效的重複方式，請使用 monthly、weekly 或 custom")
+	}
+	if req.Interval < 0 {
+		return nil, errors.New("重複間隔必須大於 0")
+	}
+	if req.Interval == 0 {
+		req.Interval = 1
+	}
+	if req.DayOfMonth < 0 || req.DayOfMonth > 31 {
+		return nil, errors.New("每月日期必須介於 1 到 31")
+	}
+
+	startDate, err := time.Parse("2006-01-02", req.StartDate)
+	if err != nil {
+		return nil, errors.New("無效的開始日期格式，請使用 YYYY-MM-DD")
+	}
+
+	var endDate *time.Time
+	if req.EndDate != "" {
+		parsed, err := time.Parse("2006-01-02", req.EndDate)
+		if err != nil {
+			return nil, errors.New("無效的結束日期格式，請使用 YYYY-MM-DD")
+		}
+		if parsed.Before(startDate) {
+			return nil, errors.New("結束日期不能早於開始日期")
+		}
+		endDate = &parsed
+	}
+
+	if req.Frequency == models.RecurrenceMonthly && req.DayOfMonth == 0 {
+		req.DayOfMonth = startDate.Day()
+	}
+	if req.Frequency != models.RecurrenceMonthly {
+		req.DayOfMonth = 0
+	}
+
+	// 2. 試算交易以驗證分帳與付款設定
+	prepared, err := h.transactionHandler.prepareTransaction(models.CreateTransactionRequest{
+		GroupID:      groupID,
+		Description:  req.Description,
+		Amount:       req.Amount,
+		Currency:     req.Currency,
+		ExchangeRate: req.ExchangeRate,
+		CategoryID:   req.CategoryID,
+		PaidBy:       req.PaidBy,
+		Payments:     req.Payments,
+		SplitType:    req.SplitType,
+		Splits:       req.Splits,
+		Notes:        req.Notes,
+	}, createdBy, startDate)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. 保存分帳定義（每次發生時重新計算）
+	splits, err := json.Marshal(req.Splits)
+	if err != nil {
+		return nil, errors.New("無效的分帳設定")
+	}
+	var payments []byte
+	if len(req.Payments) > 0 {
+		if payments, err = json.Marshal(req.Payments); err != nil {
+			return nil, errors.New("無效的付款設定")
+		}
+	}
+
+	recurring := &models.RecurringTransaction{
+		GroupID:      groupID,
+		Description:  req.Description,
+		Amount:       prepared.transaction.Amount,
+		Currency:     prepared.transaction.Currency,
+		ExchangeRate: req.ExchangeRate,
+		CategoryID:   req.CategoryID,
+		PaidBy:       prepared.transaction.PaidBy,
+		Payments:     payments,
+		SplitType:    req.SplitType,
+		Splits:       splits,
+		Notes:        req.Notes,
+		Frequency:    req.Frequency,
+		Interval:     req.Interval,
+		DayOfMonth:   req.DayOfMonth,
+		StartDate:    startDate,
+		EndDate:      endDate,
+		CreatedBy:    createdBy,
+	}
+	recurring.NextRunAt = recurring.FirstOccurrence()
+	recurring.Active = !recurring.EndsBefore(recurring.NextRunAt)
+
+	return recurring, nil
+}
+
+// findRecurringTransaction 依 URL 參數查詢群組內的定期交易，並驗證用戶是群組成員
+func (h *RecurringTransactionHandler) findRecurringTransaction(c *fiber.Ctx) (*models.RecurringTransaction, *middleware.AuthenticatedUser, error) {
+	groupID, err := middleware.ParseGroupIDFromParams(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := middleware.RequireGroupMember(c, h.db, groupID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	recurringID, err := middleware.ParseRecurringIDFromParams(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var recurring models.RecurringTransaction
+	if err := h.loadRecurringTransaction(&recurring, groupID, recurringID); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, fiber.NewError(fiber.StatusNotFound, "定期交易不存在")
+		}
+		return nil, nil, fiber.NewError(fiber.StatusInternalServerError, "查詢定期交易失敗")
+	}
+
+	return &recurring, user, nil
+}
+
+// loadRecurringTransaction 載入定期交易及其關聯資料
+func (h *RecurringTransactionHandler) loadRecurringTransaction(recurring *models.RecurringTransaction, groupID, recurringID uint) error {
+	return h.db.Where("id = ? AND group_id = ?", recurringID, groupID).
+		Preload("Payer").
+		Preload("Creator").
+		Preload("Category").
+		First(recurring).Error
+}
@@ -1,29 +1,49 @@
 package handlers
 
 import (
-	"math"
+	"errors"
+	"fmt"
 	"time"
 
 	"split-go/internal/middleware"
 	"split-go/internal/models"
+	"split-go/internal/money"
 	"split-go/internal/responses"
 	"split-go/internal/services"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+var (
+	// errBalancesChanged 結算建議計算後群組平衡已變更
+	errBalancesChanged = errors.New("群組平衡已變更，請重新取得結算建議")
+	// errPendingSettlements 群組仍有待付款的結算記錄
+	errPendingSettlements = errors.New("群組仍有未完成的結算或請款，請先完成或取消")
+	// errNothingToSettle 群組沒有需要結算的款項
+	errNothingToSettle = errors.New("目前沒有需要結算的款項")
+	// errOverpayment 結算金額超過付款者目前應付給收款者的金額
+	errOverpayment = errors.New("結算金額超過目前應付金額")
+)
+
 type SettlementHandler struct {
-	db                *gorm.DB
-	balanceService    *services.BalanceService
-	validationService *services.ValidationService
+	db                  *gorm.DB
+	balanceService      *services.BalanceService
+	suggestionService   *services.SettlementSuggestionService
+	validationService   *services.ValidationService
+	exchangeRateService *services.ExchangeRateService
+	stateService        *services.SettlementStateService
 }
 
 func NewSettlementHandler(db *gorm.DB) *SettlementHandler {
 	return &SettlementHandler{
-		db:                db,
-		balanceService:    services.NewBalanceService(db),
-		validationService: services.NewValidationService(db),
+		db:                  db,
+		balanceService:      services.NewBalanceService(db),
+		suggestionService:   services.NewSettlementSuggestionService(db),
+		validationService:   services.NewValidationService(db),
+		exchangeRateService: services.NewExchangeRateService(db),
+		stateService:        services.NewSettlementStateService(db),
 	}
 }
 
@@ -34,9 +54,14 @@ func (h *SettlementHandler) GetSettlements(c *fiber.Ctx) error {
 		return err
 	}
 
-	// 查詢用戶相關的結算記錄（作為付款者或收款者）
+	// 查詢用戶相關的結算記錄（作為付款者或收款者），可依狀態篩選
+	query := h.db.Where("from_user_id = ? OR to_user_id = ?", user.UserID, user.UserID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
 	var settlements []models.Settlement
-	if err := h.db.Where("from_user_id = ? OR to_user_id = ?", user.UserID, user.UserID).
+	if err := query.
 		Preload("Group").
 		Preload("FromUser").
 		Preload("ToUser").
@@ -57,11 +82,37 @@ func (h *SettlementHandler) GetSettlements(c *fiber.Ctx) error {
 }
 
 type CreateSettlementRequest struct {
-	GroupID  uint    `json:"group_id" validate:"required"`
-	ToUserID uint    `json:"to_user_id" validate:"required"`
-	Amount   float64 `json:"amount" validate:"required,gt=0"`
-	Currency string  `json:"currency"`
-	Notes    string  `json:"notes"`
+	GroupID      uint          `json:"group_id" validate:"required"`
+	ToUserID     uint          `json:"to_user_id" validate:"required"`
+	Amount       money.Decimal `json:"amount"`
+	Currency     string        `json:"currency" validate:"omitempty,iso4217"` // 預設為群組基準幣別
+	ExchangeRate float64       `json:"exchange_rate"`                         // 兌換群組基準幣別的匯率，未提供時使用匯率資料
+	Notes        string        `json:"notes"`
+	Force        bool          `json:"force"` // 金額超過目前應付金額時仍建立
+}
+
+type CreatePaymentRequestRequest struct {
+	GroupID      uint          `json:"group_id" validate:"required"`
+	FromUserID   uint          `json:"from_user_id" validate:"required"` // 被請款的付款者
+	Amount       money.Decimal `json:"amount"`
+	Currency     string        `json:"currency" validate:"omitempty,iso4217"` // 預設為群組基準幣別
+	ExchangeRate float64       `json:"exchange_rate"`                         // 兌換群組基準幣別的匯率，未提供時使用匯率資料
+	Notes        string        `json:"notes"`
+	Force        bool          `json:"force"` // 金額超過目前應付金額時仍建立
+}
+
+type DeclinePaymentRequestRequest struct {
+	Reason string `json:"reason"`
+}
+
+type RecordSettlementPaymentRequest struct {
+	Amount money.Decimal `json:"amount"` // 結算幣別
+	Notes  string        `json:"notes"`
+}
+
+type CreateSettlementsFromSuggestionsRequest struct {
+	Strategy    string `json:"strategy"`                        // 與取得建議時相同的策略，預設為 minimal
+	Fingerprint string `json:"fingerprint" validate:"required"` // 取得建議時回傳的 fingerprint
 }
 
 func (h *SettlementHandler) CreateSettlement(c *fiber.Ctx) error {
@@ -79,69 +130,119 @@ func (h *SettlementHandler) CreateSettlement(c *fiber.Ctx) error {
 		)
 	}
 
-	// 驗證金額
-	if req.Amount <= 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(
-			responses.ErrorResponse("金額必須大於零"),
-		)
-	}
-
 	// 驗證用戶是群組成員
 	_, err = middleware.RequireGroupMember(c, h.db, req.GroupID)
 	if err != nil {
 		return err
 	}
 
-	// 驗證收款者是群組成員
-	if err := h.validationService.ValidateGroupMember(req.GroupID, req.ToUserID); err != nil {
+	// 驗證結算資料並鎖定匯率
+	settlement, err := h.prepareSettlement(req.GroupID, user.UserID, req.ToUserID,
+		req.Amount, req.Currency, req.ExchangeRate, req.Notes)
+	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(
 			responses.ErrorResponse(err.Error()),
 		)
 	}
 
-	// 檢查是否試圖向自己結算
-	if user.UserID == req.ToUserID {
+	// 檢查金額是否超過目前應付金額
+	projection, warning, err := h.checkOverpayment(settlement, req.Force)
+	if err != nil {
+		return overpaymentError(c, err)
+	}
+
+	// 創建結算記錄
+	settlement.Status = models.SettlementPending
+	if err := h.stateService.Create([]*models.Settlement{settlement}, user.UserID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("創建結算記錄失敗"),
+		)
+	}
+
+	// 載入關聯資料並返回
+	if err := h.db.Preload("Group").Preload("FromUser").Preload("ToUser").
+		First(settlement, settlement.ID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("載入結算記錄失敗"),
+		)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(
+		responses.SuccessWithMessageResponse("結算記錄創建成功",
+			responses.NewSettlementCreatedResponse(*settlement, *projection, warning)),
+	)
+}
+
+func (h *SettlementHandler) CreatePaymentRequest(c *fiber.Ctx) error {
+	// 1. 驗證用戶身份
+	user, err := middleware.GetCurrentUser(c, h.db)
+	if err != nil {
+		return err
+	}
+
+	// 2. 解析請求資料
+	var req CreatePaymentRequestRequest
+	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(
-			responses.ErrorResponse("不能向自己結算"),
+			responses.ErrorResponse("無效的請求格式"),
 		)
 	}
 
-	// 設定預設幣別
-	if req.Currency == "" {
-		req.Currency = "TWD"
+	// 3. 驗證用戶是群組成員
+	_, err = middleware.RequireGroupMember(c, h.db, req.GroupID)
+	if err != nil {
+		return err
+	}
+
+	// 4. 驗證請款資料並鎖定匯率（當前用戶為收款者）
+	settlement, err := h.prepareSettlement(req.GroupID, req.FromUserID, user.UserID,
+		req.Amount, req.Currency, req.ExchangeRate, req.Notes)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
 	}
 
-	// 創建結算記錄
-	settlement := models.Settlement{
-		GroupID:    req.GroupID,
-		FromUserID: user.UserID,
-		ToUserID:   req.ToUserID,
-		Amount:     req.Amount,
-		Currency:   req.Currency,
-		Status:     "pending",
-		Notes:      req.Notes,
+	// 5. 檢查請款金額是否超過付款者目前應付金額
+	projection, warning, err := h.checkOverpayment(settlement, req.Force)
+	if err != nil {
+		return overpaymentError(c, err)
 	}
 
-	if err := h.db.Create(&settlement).Error; err != nil {
+	// 6. 創建請款記錄，等待付款者回覆
+	settlement.Status = models.SettlementRequested
+	settlement.RequestedBy = &user.UserID
+	if err := h.stateService.Create([]*models.Settlement{settlement}, user.UserID); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(
-			responses.ErrorResponse("創建結算記錄失敗"),
+			responses.ErrorResponse("創建請款記錄失敗"),
 		)
 	}
 
-	// 載入關聯資料並返回
+	// 7. 載入關聯資料並返回
 	if err := h.db.Preload("Group").Preload("FromUser").Preload("ToUser").
-		First(&settlement, settlement.ID).Error; err != nil {
+		First(settlement, settlement.ID).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(
 			responses.ErrorResponse("載入結算記錄失敗"),
 		)
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(
-		responses.SuccessWithMessageResponse("結算記錄創建成功", responses.NewSettlementResponse(settlement)),
+		responses.SuccessWithMessageResponse("請款已送出",
+			responses.NewSettlementCreatedResponse(*settlement, *projection, warning)),
 	)
 }
 
-func (h *SettlementHandler) MarkAsPaid(c *fiber.Ctx) error {
+func (h *SettlementHandler) AcceptPaymentRequest(c *fiber.Ctx) error {
+	return h.respondToPaymentRequest(c, true)
+}
+
+func (h *SettlementHandler) DeclinePaymentRequest(c *fiber.Ctx) error {
+	return h.respondToPaymentRequest(c, false)
+}
+
+// respondToPaymentRequest 付款者接受或拒絕請款
+// 接受後成為一般的待付款結算，拒絕 (rejected) 後請款結束且不影響平衡
+func (h *SettlementHandler) respondToPaymentRequest(c *fiber.Ctx, accept bool) error {
 	// 驗證用戶身份
 	user, err := middleware.GetCurrentUser(c, h.db)
 	if err != nil {
@@ -154,10 +255,19 @@ func (h *SettlementHandler) MarkAsPaid(c *fiber.Ctx) error {
 		return err
 	}
 
+	// 拒絕時可附上原因
+	var req DeclinePaymentRequestRequest
+	if !accept && len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(
+				responses.ErrorResponse("無效的請求格式"),
+			)
+		}
+	}
+
 	// 查詢結算記錄
 	var settlement models.Settlement
-	if err := h.db.Preload("Group").Preload("FromUser").Preload("ToUser").
-		First(&settlement, uint(settlementID)).Error; err != nil {
+	if err := h.db.First(&settlement, settlementID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(fiber.StatusNotFound).JSON(
 				responses.ErrorResponse("結算記錄不存在"),
@@ -168,34 +278,181 @@ func (h *SettlementHandler) MarkAsPaid(c *fiber.Ctx) error {
 		)
 	}
 
-	// 檢查權限（只有收款者可以標記為已付款）
-	if settlement.ToUserID != user.UserID {
+	// 檢查權限（只有被請款的付款者可以回覆）
+	if settlement.FromUserID != user.UserID {
 		return c.Status(fiber.StatusForbidden).JSON(
-			responses.ErrorResponse("只有收款者可以標記為已付款"),
+			responses.ErrorResponse("只有被請款的付款者可以回覆請款"),
 		)
 	}
 
 	// 檢查狀態
-	if settlement.Status != "pending" {
+	if settlement.Status != models.SettlementRequested {
 		return c.Status(fiber.StatusBadRequest).JSON(
-			responses.ErrorResponse("只能標記待付款的結算記錄"),
+			responses.ErrorResponse("只能回覆尚未處理的請款"),
 		)
 	}
 
-	// 更新狀態
-	now := time.Now()
-	if err := h.db.Model(&settlement).Updates(map[string]interface{}{
-		"status":     "paid",
-		"settled_at": &now,
-	}).Error; err != nil {
+	// 更新狀態：接受後成為待付款，拒絕後結束
+	target, message := models.SettlementPending, "已接受請款"
+	if !accept {
+		target, message = models.SettlementRejected, "已拒絕請款"
+	}
+	if err := h.stateService.Transition(&settlement, target, user.UserID, req.Reason); err != nil {
+		return settlementTransitionError(c, err)
+	}
+
+	// 載入更新後的資料
+	if err := h.db.Preload("Group").Preload("FromUser").Preload("ToUser").
+		First(&settlement, settlement.ID).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(
-			responses.ErrorResponse("更新結算狀態失敗"),
+			responses.ErrorResponse("載入結算記錄失敗"),
+		)
+	}
+
+	return c.JSON(
+		responses.SuccessWithMessageResponse(message, responses.NewSettlementResponse(settlement)),
+	)
+}
+
+// prepareSettlement 驗證結算資料並鎖定匯率，回傳尚未儲存的結算記錄
+func (h *SettlementHandler) prepareSettlement(groupID, fromUserID, toUserID uint, value money.Decimal, currency string, requestedRate float64, notes string) (*models.Settlement, error) {
+	// 設定預設幣別（群組基準幣別）
+	baseCurrency, err := loadGroupBaseCurrency(h.db, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if currency == "" {
+		currency = baseCurrency
+	}
+	currency, err = money.NormalizeCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+
+	// 驗證金額
+	amount, err := value.Amount(currency)
+	if err != nil {
+		return nil, err
+	}
+	if amount <= 0 {
+		return nil, errors.New("金額必須大於零")
+	}
+
+	// 驗證付款者與收款者都是群組成員
+	for _, userID := range []uint{fromUserID, toUserID} {
+		if err := h.validationService.ValidateGroupMember(groupID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	// 檢查是否試圖向自己結算
+	if fromUserID == toUserID {
+		return nil, errors.New("不能向自己結算")
+	}
+
+	// 鎖定匯率並換算為群組基準幣別
+	exchangeRate, baseAmount, err := convertToBase(h.exchangeRateService, currency, baseCurrency, requestedRate, amount, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Settlement{
+		GroupID:      groupID,
+		FromUserID:   fromUserID,
+		ToUserID:     toUserID,
+		Amount:       amount,
+		Currency:     currency,
+		ExchangeRate: exchangeRate,
+		BaseAmount:   baseAmount,
+		Notes:        notes,
+	}, nil
+}
+
+// checkOverpayment 依目前平衡檢查結算金額是否超過付款者應付給收款者的金額
+// 超過時除非 force 否則回傳 errOverpayment；強制建立時回傳警告訊息
+func (h *SettlementHandler) checkOverpayment(settlement *models.Settlement, force bool) (*models.SettlementProjection, string, error) {
+	projection, err := h.balanceService.ProjectSettlement(*settlement)
+	if err != nil {
+		return nil, "", err
+	}
+
+	amount := settlement.AmountInBase()
+	if amount <= projection.Owed {
+		return projection, "", nil
+	}
+
+	detail := fmt.Sprintf("目前應付 %s %s", projection.Owed.String(projection.Currency), projection.Currency)
+	if projection.Pending > 0 {
+		detail += fmt.Sprintf("（已扣除未完成的結算 %s %s）", projection.Pending.String(projection.Currency), projection.Currency)
+	}
+	if !force {
+		return nil, "", fmt.Errorf("%w：%s，如確定要結算請設定 force", errOverpayment, detail)
+	}
+	return projection, fmt.Sprintf("%s：%s，結算確認後平衡將反轉", errOverpayment.Error(), detail), nil
+}
+
+// overpaymentError 將超額結算檢查的錯誤轉換為回應
+func overpaymentError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errOverpayment) {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(
+		responses.ErrorResponse("計算平衡失敗"),
+	)
+}
+
+func (h *SettlementHandler) MarkAsPaid(c *fiber.Ctx) error {
+	// 驗證用戶身份
+	user, err := middleware.GetCurrentUser(c, h.db)
+	if err != nil {
+		return err
+	}
+
+	// 獲取結算 ID
+	settlementID, err := middleware.ParseSettlementIDFromParams(c)
+	if err != nil {
+		return err
+	}
+
+	// 查詢結算記錄
+	var settlement models.Settlement
+	if err := h.db.Preload("Group").Preload("FromUser").Preload("ToUser").
+		First(&settlement, uint(settlementID)).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(
+				responses.ErrorResponse("結算記錄不存在"),
+			)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("查詢結算記錄失敗"),
+		)
+	}
+
+	// 檢查狀態（待付款、付款者已標記付款或爭議中的結算可由收款者確認）
+	if settlement.CanTransitionTo(models.SettlementConfirmed) != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse("只能標記待付款的結算記錄"),
+		)
+	}
+
+	// 跨群組抵銷的結算需整批標記，由收到淨額的一方確認
+	if settlement.LinkID != "" {
+		return h.markLinkedAsPaid(c, settlement, user.UserID)
+	}
+
+	// 檢查權限（只有收款者可以標記為已付款）
+	if settlement.ToUserID != user.UserID {
+		return c.Status(fiber.StatusForbidden).JSON(
+			responses.ErrorResponse("只有收款者可以標記為已付款"),
 		)
 	}
 
-	// 更新本地對象
-	settlement.Status = "paid"
-	settlement.SettledAt = &now
+	// 更新狀態並記錄事件
+	if err := h.stateService.Transition(&settlement, models.SettlementConfirmed, user.UserID, ""); err != nil {
+		return settlementTransitionError(c, err)
+	}
 
 	return c.JSON(
 		responses.SuccessWithMessageResponse("結算已標記為已付款", responses.NewSettlementResponse(settlement)),
@@ -235,18 +492,33 @@ func (h *SettlementHandler) CancelSettlement(c *fiber.Ctx) error {
 		)
 	}
 
-	// 檢查狀態（只能取消待付款的記錄）
-	if settlement.Status != "pending" {
+	// 檢查狀態（只能取消尚未完成的記錄，或由發起者撤回尚未回覆的請款）
+	if settlement.Status == models.SettlementRequested && settlement.ToUserID != user.UserID {
+		return c.Status(fiber.StatusForbidden).JSON(
+			responses.ErrorResponse("只有發起請款的收款者可以撤回請款，付款者請使用拒絕"),
+		)
+	}
+	if settlement.CanTransitionTo(models.SettlementCancelled) != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(
 			responses.ErrorResponse("只能取消待付款的結算記錄"),
 		)
 	}
 
-	// 軟刪除結算記錄
-	if err := h.db.Delete(&settlement).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(
-			responses.ErrorResponse("取消結算記錄失敗"),
-		)
+	// 將狀態變更為已取消並保留記錄（跨群組抵銷的結算整批取消）
+	if settlement.LinkID != "" {
+		var linked []models.Settlement
+		if err := h.db.Where("link_id = ? AND status IN ?", settlement.LinkID, models.OpenSettlementStatuses).
+			Find(&linked).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(
+				responses.ErrorResponse("查詢結算記錄失敗"),
+			)
+		}
+		err = h.stateService.TransitionLinked(linked, models.SettlementCancelled, user.UserID, "")
+	} else {
+		err = h.stateService.Transition(&settlement, models.SettlementCancelled, user.UserID, "")
+	}
+	if err != nil {
+		return settlementTransitionError(c, err)
 	}
 
 	return c.JSON(
@@ -267,73 +539,654 @@ func (h *SettlementHandler) GetSettlementSuggestions(c *fiber.Ctx) error {
 		return err
 	}
 
-	// 計算群組內每個用戶的平衡
-	balances, err := h.balanceService.CalculateGroupBalances(groupID)
+	// 解析結算策略（greedy、minimal、pairwise，預設為 minimal）
+	strategy, err := services.ParseSettlementStrategy(c.Query("strategy"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	}
+
+	// 生成結算建議
+	plan, err := h.suggestionService.SuggestForGroup(groupID, strategy)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(
 			responses.ErrorResponse("計算群組平衡失敗"),
 		)
 	}
 
-	// 生成結算建議
-	suggestions := h.generateSettlementSuggestions(balances)
+	return c.JSON(responses.SuccessResponse(responses.NewSettlementPlanResponse(*plan)))
+}
 
-	// 轉換為回應格式
-	suggestionResponses := make([]responses.SettlementSuggestionResponse, len(suggestions))
-	for i, suggestion := range suggestions {
-		suggestionResponses[i] = responses.NewSettlementSuggestionResponse(suggestion)
+func (h *SettlementHandler) GetGroupDebts(c *fiber.Ctx) error {
+	// 獲取群組 ID
+	groupID, err := middleware.ParseGroupIDFromParams(c)
+	if err != nil {
+		return err
 	}
 
-	return c.JSON(responses.SuccessResponse(suggestionResponses))
+	// 驗證用戶是群組成員
+	_, err = middleware.RequireGroupMember(c, h.db, groupID)
+	if err != nil {
+		return err
+	}
+
+	// 計算未經簡化的兩兩債務
+	debts, err := h.balanceService.CalculatePairwiseLedger(groupID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("計算群組債務失敗"),
+		)
+	}
+
+	// 可選擇只查看與指定用戶相關的債務
+	if userID := c.QueryInt("user_id"); userID > 0 {
+		var filtered []models.PairwiseDebt
+		for _, debt := range debts {
+			if debt.FromUserID == uint(userID) || debt.ToUserID == uint(userID) {
+				filtered = append(filtered, debt)
+			}
+		}
+		debts = filtered
+	}
+
+	// 轉換為回應格式（details=true 時列出構成每筆債務的交易與結算）
+	withDetails := c.QueryBool("details")
+	debtResponses := make([]responses.PairwiseDebtResponse, len(debts))
+	for i, debt := range debts {
+		debtResponses[i] = responses.NewPairwiseDebtResponse(debt, withDetails)
+	}
+
+	return c.JSON(responses.SuccessResponse(debtResponses))
 }
 
-// generateSettlementSuggestions 生成結算建議（使用貪心算法最小化轉帳次數）
-func (h *SettlementHandler) generateSettlementSuggestions(balances []models.Balance) []models.SettlementSuggestion {
-	var suggestions []models.SettlementSuggestion
-	const tolerance = 0.01 // 容差值，處理浮點數精度問題
+func (h *SettlementHandler) GetCrossGroupSettlementSuggestions(c *fiber.Ctx) error {
+	// 驗證用戶身份
+	userID, err := middleware.GetCurrentUserID(c)
+	if err != nil {
+		return err
+	}
 
-	// 分離債權人和債務人
-	var creditors []models.Balance // 應收錢的人（balance > 0）
-	var debtors []models.Balance   // 應付錢的人（balance < 0）
+	// 抵銷與同一位用戶在不同群組的債務
+	suggestions, err := h.suggestionService.SuggestAcrossGroups(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("計算跨群組結算建議失敗"),
+		)
+	}
 
-	for _, balance := range balances {
-		if balance.Balance > tolerance {
-			creditors = append(creditors, balance)
-		} else if balance.Balance < -tolerance {
-			debtors = append(debtors, balance)
-		}
+	suggestionResponses := make([]responses.CrossGroupSuggestionResponse, len(suggestions))
+	for i, suggestion := range suggestions {
+		suggestionResponses[i] = responses.NewCrossGroupSuggestionResponse(suggestion)
 	}
 
-	// 使用貪心算法生成結算建議
-	i, j := 0, 0
-	for i < len(creditors) && j < len(debtors) {
-		creditor := &creditors[i]
-		debtor := &debtors[j]
+	return c.JSON(responses.SuccessResponse(suggestionResponses))
+}
 
-		// 計算轉帳金額
-		amount := math.Min(creditor.Balance, -debtor.Balance)
+func (h *SettlementHandler) AcceptCrossGroupSettlementSuggestion(c *fiber.Ctx) error {
+	// 1. 驗證用戶身份
+	userID, err := middleware.GetCurrentUserID(c)
+	if err != nil {
+		return err
+	}
 
-		// 創建結算建議
-		suggestions = append(suggestions, models.SettlementSuggestion{
-			FromUserID: debtor.UserID,
-			FromUser:   debtor.User,
-			ToUserID:   creditor.UserID,
-			ToUser:     creditor.User,
-			Amount:     amount,
-		})
+	// 2. 解析請求資料
+	var req models.AcceptCrossGroupSettlementRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse("無效的請求格式"),
+		)
+	}
+	if req.CounterpartyID == 0 || req.Currency == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse("請提供對象與幣別"),
+		)
+	}
+	currency, err := money.NormalizeCurrency(req.Currency)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	}
 
-		// 更新餘額
-		creditor.Balance -= amount
-		debtor.Balance += amount
+	// 3. 重新計算建議，確保依據的是最新的債務
+	suggestions, err := h.suggestionService.SuggestAcrossGroups(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("計算跨群組結算建議失敗"),
+		)
+	}
 
-		// 移動指針
-		if math.Abs(creditor.Balance) <= tolerance {
-			i++
-		}
-		if math.Abs(debtor.Balance) <= tolerance {
-			j++
+	var suggestion *models.CrossGroupSuggestion
+	for i := range suggestions {
+		if suggestions[i].CounterpartyID == req.CounterpartyID && suggestions[i].Currency == currency {
+			suggestion = &suggestions[i]
+			break
 		}
 	}
+	if suggestion == nil {
+		return c.Status(fiber.StatusNotFound).JSON(
+			responses.ErrorResponse("找不到可跨群組抵銷的債務"),
+		)
+	}
+
+	// 4. 相關群組中雙方仍有待付款的結算時不建立，避免重複結算
+	groupIDs := make([]uint, len(suggestion.Legs))
+	for i, leg := range suggestion.Legs {
+		groupIDs[i] = leg.GroupID
+	}
+	var pendingCount int64
+	if err := h.db.Model(&models.Settlement{}).
+		Where("group_id IN ? AND status IN ?", groupIDs, models.OpenSettlementStatuses).
+		Where("(from_user_id = ? AND to_user_id = ?) OR (from_user_id = ? AND to_user_id = ?)",
+			userID, req.CounterpartyID, req.CounterpartyID, userID).
+		Count(&pendingCount).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("查詢結算記錄失敗"),
+		)
+	}
+	if pendingCount > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse("雙方在相關群組仍有未完成的結算或請款，請先完成或取消"),
+		)
+	}
 
-	return suggestions
+	// 5. 在每個群組建立共用識別碼的結算記錄，讓各群組的平衡各自結清
+	linkID := uuid.New().String()
+	settlements := make([]*models.Settlement, len(suggestion.Legs))
+	for i, leg := range suggestion.Legs {
+		settlements[i] = &models.Settlement{
+			GroupID:      leg.GroupID,
+			FromUserID:   leg.FromUserID,
+			ToUserID:     leg.ToUserID,
+			Amount:       leg.Amount,
+			Currency:     currency,
+			ExchangeRate: 1,
+			BaseAmount:   leg.Amount,
+			Status:       models.SettlementPending,
+			Notes:        "跨群組抵銷",
+			LinkID:       linkID,
+		}
+	}
+	if err := h.stateService.Create(settlements, userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("創建結算記錄失敗"),
+		)
+	}
+
+	// 6. 載入關聯資料並返回
+	var created []models.Settlement
+	if err := h.db.Preload("Group").Preload("FromUser").Preload("ToUser").
+		Where("link_id = ?", linkID).Order("id").
+		Find(&created).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("載入結算記錄失敗"),
+		)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(
+		responses.SuccessWithMessageResponse("跨群組結算記錄創建成功",
+			responses.NewLinkedSettlementResponse(linkID, *suggestion, created)),
+	)
+}
+
+// markLinkedAsPaid 將同一批跨群組抵銷的結算記錄一起標記為已付款
+// 淨額不為零時只有收到淨額的一方可以確認；淨額為零時任一方皆可確認
+func (h *SettlementHandler) markLinkedAsPaid(c *fiber.Ctx, settlement models.Settlement, userID uint) error {
+	var linked []models.Settlement
+	if err := h.db.Where("link_id = ? AND status IN ?", settlement.LinkID, models.OpenSettlementStatuses).
+		Find(&linked).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("查詢結算記錄失敗"),
+		)
+	}
+
+	// 計算付款者的淨額：正數表示付款者需再付給收款者
+	var net money.Amount
+	for _, record := range linked {
+		if record.FromUserID == settlement.FromUserID {
+			net += record.AmountInBase()
+		} else {
+			net -= record.AmountInBase()
+		}
+	}
+	allowed := userID == settlement.ToUserID || userID == settlement.FromUserID
+	switch {
+	case net > 0:
+		allowed = userID == settlement.ToUserID
+	case net < 0:
+		allowed = userID == settlement.FromUserID
+	}
+	if !allowed {
+		return c.Status(fiber.StatusForbidden).JSON(
+			responses.ErrorResponse("只有收到淨額的一方可以標記為已付款"),
+		)
+	}
+
+	if err := h.stateService.TransitionLinked(linked, models.SettlementConfirmed, userID, ""); err != nil {
+		return settlementTransitionError(c, err)
+	}
+
+	settlement.Status = models.SettlementConfirmed
+	settlement.SettledAt = linked[0].SettledAt
+
+	return c.JSON(
+		responses.SuccessWithMessageResponse(
+			fmt.Sprintf("跨群組結算已標記為已付款（共 %d 筆）", len(linked)),
+			responses.NewSettlementResponse(settlement)),
+	)
+}
+
+func (h *SettlementHandler) CreateSettlementsFromSuggestions(c *fiber.Ctx) error {
+	// 1. 獲取群組 ID
+	groupID, err := middleware.ParseGroupIDFromParams(c)
+	if err != nil {
+		return err
+	}
+
+	// 2. 只有群組管理員可以代替成員建立結算
+	admin, err := middleware.RequireGroupAdmin(c, h.db, groupID)
+	if err != nil {
+		return err
+	}
+
+	// 3. 解析請求資料
+	var req CreateSettlementsFromSuggestionsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse("無效的請求格式"),
+		)
+	}
+	if req.Fingerprint == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse("請提供結算建議的 fingerprint"),
+		)
+	}
+	strategy, err := services.ParseSettlementStrategy(req.Strategy)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	}
+
+	// 4. 在同一個資料庫交易中重新計算建議並建立所有結算記錄
+	batchID := uuid.New().String()
+	var plan *models.SettlementPlan
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var pendingCount int64
+		if err := tx.Model(&models.Settlement{}).
+			Where("group_id = ? AND status IN ?", groupID, models.OpenSettlementStatuses).
+			Count(&pendingCount).Error; err != nil {
+			return err
+		}
+		if pendingCount > 0 {
+			return errPendingSettlements
+		}
+
+		plan, err = services.NewSettlementSuggestionService(tx).SuggestForGroup(groupID, strategy)
+		if err != nil {
+			return err
+		}
+		if plan.Fingerprint != req.Fingerprint {
+			return errBalancesChanged
+		}
+		if len(plan.Suggestions) == 0 {
+			return errNothingToSettle
+		}
+
+		settlements := make([]*models.Settlement, len(plan.Suggestions))
+		for i, suggestion := range plan.Suggestions {
+			settlements[i] = &models.Settlement{
+				GroupID:      groupID,
+				FromUserID:   suggestion.FromUserID,
+				ToUserID:     suggestion.ToUserID,
+				Amount:       suggestion.Amount,
+				Currency:     suggestion.Currency,
+				ExchangeRate: 1,
+				BaseAmount:   suggestion.Amount,
+				Status:       models.SettlementPending,
+				Notes:        "依結算建議建立",
+				BatchID:      batchID,
+			}
+		}
+		return services.NewSettlementStateService(tx).Create(settlements, admin.UserID)
+	})
+	switch {
+	case errors.Is(err, errBalancesChanged):
+		return c.Status(fiber.StatusConflict).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	case errors.Is(err, errPendingSettlements), errors.Is(err, errNothingToSettle):
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("批次建立結算記錄失敗"),
+		)
+	}
+
+	// 5. 載入關聯資料並返回
+	var settlements []models.Settlement
+	if err := h.db.Preload("Group").Preload("FromUser").Preload("ToUser").
+		Where("batch_id = ?", batchID).Order("id").
+		Find(&settlements).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("載入結算記錄失敗"),
+		)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(
+		responses.SuccessWithMessageResponse("結算記錄批次建立成功",
+			responses.NewSettlementBatchResponse(batchID, plan.Strategy, settlements)),
+	)
+}
+
+func (h *SettlementHandler) MarkAsSent(c *fiber.Ctx) error {
+	// 驗證用戶身份
+	user, err := middleware.GetCurrentUser(c, h.db)
+	if err != nil {
+		return err
+	}
+
+	// 查詢結算記錄
+	settlement, err := h.findSettlement(c)
+	if err != nil {
+		return err
+	}
+
+	// 只有付款者可以標記已付款，等待收款者確認
+	if settlement.FromUserID != user.UserID {
+		return c.Status(fiber.StatusForbidden).JSON(
+			responses.ErrorResponse("只有付款者可以標記為已送出"),
+		)
+	}
+	if settlement.LinkID != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse("跨群組抵銷的結算需整批標記為已付款"),
+		)
+	}
+	if err := h.stateService.Transition(settlement, models.SettlementPayerMarkedSent, user.UserID, ""); err != nil {
+		return settlementTransitionError(c, err)
+	}
+
+	return c.JSON(
+		responses.SuccessWithMessageResponse("已標記為已送出，等待收款者確認", responses.NewSettlementResponse(*settlement)),
+	)
+}
+
+func (h *SettlementHandler) DisputeSettlement(c *fiber.Ctx) error {
+	// 驗證用戶身份
+	user, err := middleware.GetCurrentUser(c, h.db)
+	if err != nil {
+		return err
+	}
+
+	// 解析請求資料（必須提供原因）
+	var req models.DisputeSettlementRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse("無效的請求格式"),
+		)
+	}
+	if req.Reason == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse("請提供爭議原因"),
+		)
+	}
+
+	// 查詢結算記錄
+	settlement, err := h.findSettlement(c)
+	if err != nil {
+		return err
+	}
+
+	// 付款者或收款者都可以提出爭議
+	if settlement.FromUserID != user.UserID && settlement.ToUserID != user.UserID {
+		return c.Status(fiber.StatusForbidden).JSON(
+			responses.ErrorResponse("無權限對此結算提出爭議"),
+		)
+	}
+
+	// 跨群組抵銷的結算整批進入爭議，避免同一批結算的狀態不一致
+	if settlement.LinkID != "" {
+		var linked []models.Settlement
+		if err := h.db.Where("link_id = ? AND status IN ?", settlement.LinkID, models.OpenSettlementStatuses).
+			Find(&linked).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(
+				responses.ErrorResponse("查詢結算記錄失敗"),
+			)
+		}
+		err = h.stateService.TransitionLinked(linked, models.SettlementDisputed, user.UserID, req.Reason)
+		if err == nil {
+			settlement.Status = models.SettlementDisputed
+		}
+	} else {
+		err = h.stateService.Transition(settlement, models.SettlementDisputed, user.UserID, req.Reason)
+	}
+	if err != nil {
+		return settlementTransitionError(c, err)
+	}
+
+	return c.JSON(
+		responses.SuccessWithMessageResponse("已提出爭議", responses.NewSettlementResponse(*settlement)),
+	)
+}
+
+func (h *SettlementHandler) GetSettlementEvents(c *fiber.Ctx) error {
+	// 查詢結算記錄
+	settlement, err := h.findSettlement(c)
+	if err != nil {
+		return err
+	}
+
+	// 驗證用戶是群組成員
+	_, err = middleware.RequireGroupMember(c, h.db, settlement.GroupID)
+	if err != nil {
+		return err
+	}
+
+	// 查詢狀態變更記錄
+	events, err := h.stateService.Events(settlement.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("查詢結算記錄失敗"),
+		)
+	}
+
+	eventResponses := make([]responses.SettlementEventResponse, len(events))
+	for i, event := range events {
+		eventResponses[i] = responses.NewSettlementEventResponse(event)
+	}
+
+	return c.JSON(responses.SuccessResponse(eventResponses))
+}
+
+func (h *SettlementHandler) RecordSettlementPayment(c *fiber.Ctx) error {
+	// 驗證用戶身份
+	user, err := middleware.GetCurrentUser(c, h.db)
+	if err != nil {
+		return err
+	}
+
+	// 解析請求資料
+	var req RecordSettlementPaymentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse("無效的請求格式"),
+		)
+	}
+
+	// 查詢結算記錄
+	settlement, err := h.findSettlement(c)
+	if err != nil {
+		return err
+	}
+
+	// 付款者或收款者都可以記錄付款
+	if settlement.FromUserID != user.UserID && settlement.ToUserID != user.UserID {
+		return c.Status(fiber.StatusForbidden).JSON(
+			responses.ErrorResponse("無權限記錄此結算的付款"),
+		)
+	}
+	if settlement.LinkID != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse("跨群組抵銷的結算需整批標記為已付款"),
+		)
+	}
+
+	// 驗證金額（以結算幣別計算）
+	amount, err := req.Amount.Amount(settlement.Currency)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	}
+	if amount <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse("金額必須大於零"),
+		)
+	}
+
+	// 記錄付款（收款者記錄時直接確認）
+	payment, err := h.stateService.RecordPayment(settlement, amount, user.UserID, req.Notes)
+	if err != nil {
+		return settlementTransitionError(c, err)
+	}
+	if err := h.db.Preload("RecordedBy").First(payment, payment.ID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("載入付款記錄失敗"),
+		)
+	}
+
+	message := "付款已記錄，等待收款者確認"
+	if payment.IsConfirmed() {
+		message = "付款已記錄"
+	}
+	return c.Status(fiber.StatusCreated).JSON(
+		responses.SuccessWithMessageResponse(message,
+			responses.NewSettlementPaymentResultResponse(*payment, *settlement)),
+	)
+}
+
+func (h *SettlementHandler) GetSettlementPayments(c *fiber.Ctx) error {
+	// 查詢結算記錄
+	settlement, err := h.findSettlement(c)
+	if err != nil {
+		return err
+	}
+
+	// 驗證用戶是群組成員
+	_, err = middleware.RequireGroupMember(c, h.db, settlement.GroupID)
+	if err != nil {
+		return err
+	}
+
+	// 查詢付款記錄
+	payments, err := h.stateService.Payments(settlement.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("查詢付款記錄失敗"),
+		)
+	}
+
+	paymentResponses := make([]responses.SettlementPaymentResponse, len(payments))
+	for i, payment := range payments {
+		paymentResponses[i] = responses.NewSettlementPaymentResponse(payment, settlement.Currency)
+	}
+
+	return c.JSON(responses.SuccessResponse(paymentResponses))
+}
+
+func (h *SettlementHandler) ConfirmSettlementPayment(c *fiber.Ctx) error {
+	// 驗證用戶身份
+	user, err := middleware.GetCurrentUser(c, h.db)
+	if err != nil {
+		return err
+	}
+
+	// 獲取付款 ID
+	paymentID, err := middleware.ParsePaymentIDFromParams(c)
+	if err != nil {
+		return err
+	}
+
+	// 查詢結算記錄
+	settlement, err := h.findSettlement(c)
+	if err != nil {
+		return err
+	}
+
+	// 查詢付款記錄
+	var payment models.SettlementPayment
+	if err := h.db.Preload("RecordedBy").
+		Where("id = ? AND settlement_id = ?", paymentID, settlement.ID).
+		First(&payment).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(
+				responses.ErrorResponse("付款記錄不存在"),
+			)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("查詢付款記錄失敗"),
+		)
+	}
+
+	// 只有收款者可以確認收到付款
+	if settlement.ToUserID != user.UserID {
+		return c.Status(fiber.StatusForbidden).JSON(
+			responses.ErrorResponse("只有收款者可以確認付款"),
+		)
+	}
+	if err := h.stateService.ConfirmPayment(settlement, &payment, user.UserID); err != nil {
+		return settlementTransitionError(c, err)
+	}
+
+	return c.JSON(
+		responses.SuccessWithMessageResponse("付款已確認",
+			responses.NewSettlementPaymentResultResponse(payment, *settlement)),
+	)
+}
+
+// findSettlement 依 URL 參數查詢結算記錄（含關聯資料）
+func (h *SettlementHandler) findSettlement(c *fiber.Ctx) (*models.Settlement, error) {
+	settlementID, err := middleware.ParseSettlementIDFromParams(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var settlement models.Settlement
+	if err := h.db.Preload("Group").Preload("FromUser").Preload("ToUser").
+		First(&settlement, settlementID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fiber.NewError(fiber.StatusNotFound, "結算記錄不存在")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "查詢結算記錄失敗")
+	}
+
+	return &settlement, nil
+}
+
+// settlementTransitionError 將狀態轉換錯誤轉換為對應的回應
+func settlementTransitionError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, models.ErrSettlementTransitionForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	case errors.Is(err, models.ErrInvalidSettlementTransition),
+		errors.Is(err, services.ErrPaymentExceedsRemaining),
+		errors.Is(err, services.ErrPaymentAlreadyConfirmed):
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	case errors.Is(err, services.ErrSettlementStatusChanged):
+		return c.Status(fiber.StatusConflict).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("更新結算狀態失敗"),
+		)
+	}
 }
@@ -5,69 +5,131 @@ import (
 	"math"
 	"split-go/internal/middleware"
 	"split-go/internal/models"
+	"split-go/internal/money"
 	"split-go/internal/responses"
 	"split-go/internal/services"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
 
+// defaultTransactionRetention 已刪除的交易預設可以還原的期限
+const defaultTransactionRetention = 30 * 24 * time.Hour
+
 type TransactionHandler struct {
-	db                *gorm.DB
-	balanceService    *services.BalanceService
-	validationService *services.ValidationService
+	db                  *gorm.DB
+	balanceService      *services.BalanceService
+	validationService   *services.ValidationService
+	exchangeRateService *services.ExchangeRateService
+	retention           time.Duration // 已刪除的交易可以還原的期限
 }
 
 func NewTransactionHandler(db *gorm.DB) *TransactionHandler {
 	return &TransactionHandler{
-		db:                db,
-		balanceService:    services.NewBalanceService(db),
-		validationService: services.NewValidationService(db),
+		db:                  db,
+		balanceService:      services.NewBalanceService(db),
+		validationService:   services.NewValidationService(db),
+		exchangeRateService: services.NewExchangeRateService(db),
+		retention:           defaultTransactionRetention,
+	}
+}
+
+// SetRetention 設定已刪除的交易可以還原的期限
+func (h *TransactionHandler) SetRetention(retention time.Duration) {
+	if retention > 0 {
+		h.retention = retention
 	}
 }
 
 // GetTransactions 獲取用戶參與的所有交易
 // @Summary 獲取交易列表
-// @Description 獲取當前用戶參與的所有交易（作為付款者或分帳參與者）
+// @Description 獲取當前用戶參與的交易（作為付款者或分帳參與者），可依日期、分類、付款者、參與者、金額、幣別與關鍵字篩選並排序
 // @Tags 交易
 // @Produce json
 // @Security BearerAuth
-// @Success 200 {object} object{error=bool,data=[]object{id=int,description=string,amount=number,split_type=string,paid_by=int,group_id=int,category_id=int,receipt_url=string,created_at=string,updated_at=string,payer=object{id=int,name=string,username=string},creator=object{id=int,name=string,username=string},category=object{id=int,name=string},group=object{id=int,name=string},splits=[]object{id=int,user_id=int,amount=number,percentage=number,user=object{id=int,name=string,username=string}}}} "交易列表"
+// @Param page query int false "頁碼" default(1)
+// @Param limit query int false "每頁筆數" default(20)
+// @Param from query string false "交易日期起始 (YYYY-MM-DD，含當天)"
+// @Param to query string false "交易日期結束 (YYYY-MM-DD，含當天)"
+// @Param category_id query int false "分類ID"
+// @Param paid_by query int false "付款者ID (主要付款者或付款明細中的用戶)"
+// @Param participant_id query int false "參與者ID (付款者或分帳參與者)"
+// @Param currency query string false "交易幣別"
+// @Param min_amount query string false "最低金額 (需同時指定 currency)"
+// @Param max_amount query string false "最高金額 (需同時指定 currency)"
+// @Param q query string false "搜尋描述或備註"
+// @Param sort query string false "排序欄位 (created_at、updated_at、amount、description，依 amount 排序需同時指定 currency)" default(created_at)
+// @Param order query string false "排序方向 (asc、desc)" default(desc)
+// @Success 200 {object} object{error=bool,data=object{data=[]object{id=int,description=string,amount=number,split_type=string,paid_by=int,group_id=int,category_id=int,receipt_url=string,created_at=string,updated_at=string,payer=object{id=int,name=string,username=string},creator=object{id=int,name=string,username=string},category=object{id=int,name=string},group=object{id=int,name=string},splits=[]object{id=int,user_id=int,amount=number,percentage=number,shares=int,adjustment=number,user=object{id=int,name=string,username=string}}},pagination=object{page=int,limit=int,total=int,total_pages=int}}} "交易列表"
+// @Failure 400 {object} object{error=bool,message=string} "查詢參數無效"
 // @Failure 401 {object} object{error=bool,message=string} "未授權"
 // @Failure 500 {object} object{error=bool,message=string} "服務器內部錯誤"
 // @Router /transactions [get]
 func (h *TransactionHandler) GetTransactions(c *fiber.Ctx) error {
+	// 1. 驗證用戶身份
 	user, err := middleware.GetCurrentUser(c, h.db)
 	if err != nil {
 		return err
 	}
 
-	// 查詢用戶參與的所有交易（作為付款者或分帳參與者）
-	var transactions []models.Transaction
+	// 2. 解析查詢參數（跨群組的交易沒有共同的基準幣別，依金額篩選或排序時必須指定幣別）
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", 20)
+	if limit > 100 {
+		limit = 100 // 限制最大頁面大小
+	}
+	offset := (page - 1) * limit
+
+	filter, err := parseTransactionFilter(c, "")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	}
 
-	// 使用子查詢找出用戶參與的交易 ID
+	// 3. 查詢用戶參與的交易（作為付款者或分帳參與者）
 	subQuery := h.db.Model(&models.TransactionSplit{}).
 		Select("transaction_id").
 		Where("user_id = ?", user.UserID)
 
-	// 查詢條件：用戶是付款者 OR 用戶參與分帳
-	if err := h.db.Where("paid_by = ? OR id IN (?)", user.UserID, subQuery).
+	paymentSubQuery := h.db.Model(&models.TransactionPayment{}).
+		Select("transaction_id").
+		Where("user_id = ?", user.UserID)
+
+	transactionQuery := filter.Apply(h.db.Model(&models.Transaction{}).
+		Where("(paid_by = ? OR id IN (?) OR id IN (?))", user.UserID, subQuery, paymentSubQuery))
+
+	var transactions []models.Transaction
+	if err := filter.Order(transactionQuery.Session(&gorm.Session{})).
 		Preload("Payer").
+		Preload("Payments").
 		Preload("Creator").
 		Preload("Category").
 		Preload("Group").
 		Preload("Splits.User").
-		Order("created_at DESC").
+		Offset(offset).
+		Limit(limit).
 		Find(&transactions).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(
 			responses.ErrorResponse("查詢交易記錄失敗"),
 		)
 	}
 
-	// 使用簡化的回應格式（列表頁面不需要太詳細的資訊）
+	// 4. 計算總筆數（用於分頁）
+	var total int64
+	if err := transactionQuery.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("計算總筆數失敗"),
+		)
+	}
+
+	// 5. 使用簡化的回應格式（列表頁面不需要太詳細的資訊）
 	transactionResponses := responses.NewTransactionSimpleResponseList(transactions, user.UserID)
+	paginatedResponse := responses.NewPaginatedResponse(transactionResponses, page, limit, total)
 
-	return c.JSON(responses.SuccessResponse(transactionResponses))
+	return c.JSON(responses.SuccessResponse(paginatedResponse))
 }
 
 // CreateTransaction 創建新交易
@@ -77,8 +139,8 @@ func (h *TransactionHandler) GetTransactions(c *fiber.Ctx) error {
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param request body object{description=string,amount=number,split_type=string,paid_by=int,group_id=int,category_id=int,receipt_url=string,splits=[]object{user_id=int,amount=number,percentage=number}} true "交易資料"
-// @Success 201 {object} object{error=bool,message=string,data=object{id=int,description=string,amount=number,split_type=string,paid_by=int,group_id=int,category_id=int,receipt_url=string,created_at=string,updated_at=string,payer=object{id=int,name=string,username=string},creator=object{id=int,name=string,username=string},category=object{id=int,name=string},group=object{id=int,name=string},splits=[]object{id=int,user_id=int,amount=number,percentage=number,user=object{id=int,name=string,username=string}}}} "交易創建成功"
+// @Param request body object{description=string,amount=number,currency=string,exchange_rate=number,split_type=string,paid_by=int,group_id=int,category_id=int,receipt_url=string,splits=[]object{user_id=int,amount=number,percentage=number,shares=int,adjustment=number},items=[]object{name=string,kind=string,quantity=int,unit_price=number,consumer_ids=[]int},payments=[]object{user_id=int,amount=number}} true "交易資料"
+// @Success 201 {object} object{error=bool,message=string,data=object{id=int,description=string,amount=number,currency=string,exchange_rate=number,base_amount=number,base_currency=string,split_type=string,paid_by=int,group_id=int,category_id=int,receipt_url=string,created_at=string,updated_at=string,payer=object{id=int,name=string,username=string},creator=object{id=int,name=string,username=string},category=object{id=int,name=string},group=object{id=int,name=string},splits=[]object{id=int,user_id=int,amount=number,percentage=number,shares=int,adjustment=number,user=object{id=int,name=string,username=string}},items=[]object{id=int,name=string,kind=string,quantity=int,unit_price=number,total=number,consumers=[]object{id=int,name=string,username=string}},payments=[]object{amount=number,user=object{id=int,name=string,username=string}}}} "交易創建成功"
 // @Failure 400 {object} object{error=bool,message=string} "請求格式錯誤或參數無效"
 // @Failure 401 {object} object{error=bool,message=string} "未授權"
 // @Failure 403 {object} object{error=bool,message=string} "不是群組成員"
@@ -105,56 +167,15 @@ func (h *TransactionHandler) CreateTransaction(c *fiber.Ctx) error {
 		return err
 	}
 
-	// 4. 驗證付款者是群組成員
-	if err := h.validationService.ValidateGroupMember(req.GroupID, req.PaidBy); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(
-			responses.ErrorResponse(err.Error()),
-		)
-	}
-
-	// 5. 驗證所有分帳用戶都是群組成員
-	var splitUserIDs []uint
-	for _, split := range req.Splits {
-		splitUserIDs = append(splitUserIDs, split.UserID)
-	}
-
-	if err := h.validationService.ValidateMultipleGroupMembers(req.GroupID, splitUserIDs); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(
-			responses.ErrorResponse(err.Error()),
-		)
-	}
-
-	// 6. 計算分帳金額
-	// 轉換為通用結構
-	calculations := make([]SplitCalculation, len(req.Splits))
-	for i, split := range req.Splits {
-		calculations[i] = SplitCalculation{
-			UserID:     split.UserID,
-			Amount:     split.Amount,
-			Percentage: split.Percentage,
-		}
-	}
-
-	calculated, err := h.calculateSplits(req.SplitType, req.Amount, calculations)
+	// 4. 驗證成員並計算分帳、付款與匯率
+	prepared, err := h.prepareTransaction(req, user.UserID, time.Now())
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(
 			responses.ErrorResponse(err.Error()),
 		)
 	}
 
-	// 轉換回原始結構
-	calculatedSplits := req.Splits
-	for i, calc := range calculated {
-		calculatedSplits[i].Amount = calc.Amount
-		calculatedSplits[i].Percentage = calc.Percentage
-	}
-
-	// 7. 設定預設值
-	if req.Currency == "" {
-		req.Currency = "TWD"
-	}
-
-	// 8. 使用資料庫交易確保資料一致性
+	// 5. 使用資料庫交易確保資料一致性
 	tx := h.db.Begin()
 	defer func() {
 		if r := recover(); r != nil {
@@ -162,44 +183,25 @@ func (h *TransactionHandler) CreateTransaction(c *fiber.Ctx) error {
 		}
 	}()
 
-	// 9. 創建交易記錄
-	transaction := models.Transaction{
-		GroupID:     req.GroupID,
-		Description: req.Description,
-		Amount:      req.Amount,
-		Currency:    req.Currency,
-		CategoryID:  req.CategoryID,
-		PaidBy:      req.PaidBy,
-		Receipt:     req.Receipt,
-		Notes:       req.Notes,
-		CreatedBy:   user.UserID,
-	}
-
-	if err := tx.Create(&transaction).Error; err != nil {
-		tx.Rollback()
-		return c.Status(fiber.StatusInternalServerError).JSON(
-			responses.ErrorResponse("創建交易失敗"),
-		)
-	}
-
-	// 10. 創建分帳記錄
-	if err := h.createSplitRecords(tx, transaction.ID, req.SplitType, calculatedSplits); err != nil {
+	// 6. 創建交易、付款、明細與分帳記錄
+	if err := h.savePreparedTransaction(tx, prepared); err != nil {
 		tx.Rollback()
 		return c.Status(fiber.StatusInternalServerError).JSON(
-			responses.ErrorResponse("創建分帳記錄失敗"),
+			responses.ErrorResponse(err.Error()),
 		)
 	}
+	transaction := prepared.transaction
 
-	// 11. 提交交易
+	// 7. 提交交易
 	if err := tx.Commit().Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(
 			responses.ErrorResponse("保存交易失敗"),
 		)
 	}
 
-	// 12. 載入完整的交易資料回傳
+	// 8. 載入完整的交易資料回傳
 	if err := h.db.Preload("Group").Preload("Payer").Preload("Creator").
-		Preload("Category").Preload("Splits.User").
+		Preload("Category").Preload("Payments.User").Preload("Splits.User").Preload("Items.Consumers").
 		First(&transaction, transaction.ID).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(
 			responses.ErrorResponse("載入交易資料失敗"),
@@ -207,6 +209,7 @@ func (h *TransactionHandler) CreateTransaction(c *fiber.Ctx) error {
 	}
 
 	// 轉換為回應格式
+	middleware.SetETag(c, transaction.Version)
 	transactionResponse := responses.NewTransactionResponse(transaction, user.UserID)
 
 	return c.Status(fiber.StatusCreated).JSON(
@@ -216,18 +219,21 @@ func (h *TransactionHandler) CreateTransaction(c *fiber.Ctx) error {
 
 // UpdateTransaction 更新交易
 // @Summary 更新交易
-// @Description 更新交易信息，只有創庺者可以更新
+// @Description 更新交易信息，只有創庺者可以更新。需以 If-Match 標頭或 version 欄位提供修改所依據的版本，版本已過期時回傳 409
 // @Tags 交易
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "交易ID"
-// @Param request body object{description=string,amount=number,category_id=int,receipt_url=string,splits=[]object{user_id=int,amount=number,percentage=number}} true "更新資料"
-// @Success 200 {object} object{error=bool,message=string,data=object{id=int,description=string,amount=number,split_type=string,paid_by=int,group_id=int,category_id=int,receipt_url=string,created_at=string,updated_at=string,payer=object{id=int,name=string,username=string},creator=object{id=int,name=string,username=string},category=object{id=int,name=string},group=object{id=int,name=string},splits=[]object{id=int,user_id=int,amount=number,percentage=number,user=object{id=int,name=string,username=string}}}} "交易更新成功"
+// @Param If-Match header string false "GET 回傳的 ETag（未提供時需在請求內容帶 version）"
+// @Param request body object{version=int,description=string,amount=number,currency=string,exchange_rate=number,category_id=int,receipt_url=string,splits=[]object{user_id=int,amount=number,percentage=number,shares=int,adjustment=number},items=[]object{name=string,kind=string,quantity=int,unit_price=number,consumer_ids=[]int},payments=[]object{user_id=int,amount=number}} true "更新資料"
+// @Success 200 {object} object{error=bool,message=string,data=object{id=int,description=string,amount=number,currency=string,exchange_rate=number,base_amount=number,base_currency=string,split_type=string,paid_by=int,group_id=int,category_id=int,receipt_url=string,created_at=string,updated_at=string,payer=object{id=int,name=string,username=string},creator=object{id=int,name=string,username=string},category=object{id=int,name=string},group=object{id=int,name=string},splits=[]object{id=int,user_id=int,amount=number,percentage=number,shares=int,adjustment=number,user=object{id=int,name=string,username=string}},items=[]object{id=int,name=string,kind=string,quantity=int,unit_price=number,total=number,consumers=[]object{id=int,name=string,username=string}},payments=[]object{amount=number,user=object{id=int,name=string,username=string}}}} "交易更新成功"
 // @Failure 400 {object} object{error=bool,message=string} "請求格式錯誤或參數無效"
 // @Failure 401 {object} object{error=bool,message=string} "未授權"
 // @Failure 403 {object} object{error=bool,message=string} "只有創庺者可以更新交易"
 // @Failure 404 {object} object{error=bool,message=string} "交易不存在"
+// @Failure 409 {object} object{error=bool,message=string,data=object{id=int,version=int}} "版本已過期，data 為目前的交易內容"
+// @Failure 428 {object} object{error=bool,message=string} "未提供 If-Match 或 version"
 // @Failure 500 {object} object{error=bool,message=string} "服務器內部錯誤"
 // @Router /transactions/{id} [put]
 func (h *TransactionHandler) UpdateTransaction(c *fiber.Ctx) error {
@@ -246,7 +252,7 @@ func (h *TransactionHandler) UpdateTransaction(c *fiber.Ctx) error {
 	// 3. 查詢現有交易
 	var existingTransaction models.Transaction
 	if err := h.db.Preload("Group").Preload("Payer").Preload("Creator").
-		Preload("Category").Preload("Splits.User").
+		Preload("Category").Preload("Payments.User").Preload("Splits.User").Preload("Items.Consumers").
 		First(&existingTransaction, transactionID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(fiber.StatusNotFound).JSON(
@@ -259,7 +265,8 @@ func (h *TransactionHandler) UpdateTransaction(c *fiber.Ctx) error {
 	}
 
 	// 4. 檢查用戶權限（只有創建者或付款者可以編輯）
-	if existingTransaction.CreatedBy != user.UserID && existingTransaction.PaidBy != user.UserID {
+	if existingTransaction.CreatedBy != user.UserID && existingTransaction.PaidBy != user.UserID &&
+		existingTransaction.PaidAmount(user.UserID) == 0 {
 		return c.Status(fiber.StatusForbidden).JSON(
 			responses.ErrorResponse("您沒有權限編輯此交易"),
 		)
@@ -273,7 +280,45 @@ func (h *TransactionHandler) UpdateTransaction(c *fiber.Ctx) error {
 		)
 	}
 
-	// 6. 開始資料庫交易
+	// 6. 檢查修改所依據的版本，避免覆寫其他人的修改
+	expectedVersion, err := middleware.RequireVersion(c, req.Version)
+	if err != nil {
+		return err
+	}
+	if existingTransaction.Version != expectedVersion {
+		return h.versionConflict(c, transactionID, user.UserID)
+	}
+
+	// 7. 解析金額（以更新後的幣別精度計算）
+	currency := existingTransaction.Currency
+	if req.Currency != "" {
+		currency, err = money.NormalizeCurrency(req.Currency)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(
+				responses.ErrorResponse(err.Error()),
+			)
+		}
+		req.Currency = currency
+	}
+	amount, err := req.Amount.Amount(currency)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	}
+	if amount < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse("交易金額必須大於 0"),
+		)
+	}
+	// 金額以最小貨幣單位保存，變更幣別時必須以新幣別重新提供金額（或明細），否則會改變金額的精度
+	if currency != existingTransaction.Currency && amount == 0 && len(req.Items) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse("變更幣別時必須同時提供金額"),
+		)
+	}
+
+	// 8. 開始資料庫交易
 	tx := h.db.Begin()
 	defer func() {
 		if r := recover(); r != nil {
@@ -281,18 +326,55 @@ func (h *TransactionHandler) UpdateTransaction(c *fiber.Ctx) error {
 		}
 	}()
 
-	// 7. 更新基本資訊
-	if err := h.updateBasicFields(tx, &existingTransaction, req); err != nil {
+	// 9. 以條件更新遞增版本，同時送出的修改只有一個會成功
+	result := tx.Model(&models.Transaction{}).Where("id = ? AND version = ?", transactionID, expectedVersion).
+		Update("version", gorm.Expr("version + 1"))
+	if result.Error != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("更新交易失敗"),
+		)
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return h.versionConflict(c, transactionID, user.UserID)
+	}
+
+	// 保留修改前的版本，並先從平衡表扣除原本的交易，更新完成後再加回
+	revisions := services.NewTransactionRevisionService(tx)
+	if err := revisions.EnsureBaseline(transactionID); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("記錄交易版本失敗"),
+		)
+	}
+	ledger := services.NewBalanceService(tx)
+	if err := ledger.RemoveTransaction(transactionID); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("更新平衡失敗"),
+		)
+	}
+
+	// 更新基本資訊
+	if err := h.updateBasicFields(tx, &existingTransaction, req, amount); err != nil {
 		tx.Rollback()
 		return c.Status(fiber.StatusBadRequest).JSON(
 			responses.ErrorResponse(err.Error()),
 		)
 	}
 
-	// 8. 處理分帳更新
-	shouldUpdateSplits := len(req.Splits) > 0 || req.SplitType != "" || req.Amount > 0
-	if shouldUpdateSplits {
-		if err := h.updateSplits(tx, transactionID, &existingTransaction, req); err != nil {
+	// 10. 處理分帳更新（提供明細時由明細重新推導分帳）
+	shouldUpdateSplits := len(req.Splits) > 0 || req.SplitType != "" || amount > 0
+	if len(req.Items) > 0 {
+		if err := h.updateItems(tx, transactionID, &existingTransaction, req.Items, amount, currency); err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusBadRequest).JSON(
+				responses.ErrorResponse(err.Error()),
+			)
+		}
+	} else if shouldUpdateSplits {
+		if err := h.updateSplits(tx, transactionID, &existingTransaction, req, amount, currency); err != nil {
 			tx.Rollback()
 			return c.Status(fiber.StatusBadRequest).JSON(
 				responses.ErrorResponse(err.Error()),
@@ -300,24 +382,53 @@ func (h *TransactionHandler) UpdateTransaction(c *fiber.Ctx) error {
 		}
 	}
 
-	// 9. 提交交易
+	// 11. 處理付款明細更新
+	if err := h.updatePayments(tx, transactionID, &existingTransaction, req, currency); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	}
+
+	// 12. 重新換算群組基準幣別金額
+	if err := h.updateBaseAmount(tx, transactionID, &existingTransaction, req, currency); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	}
+
+	// 13. 將更新後的交易加回平衡表、記錄新版本並提交
+	if err := ledger.AddTransaction(transactionID); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("更新平衡失敗"),
+		)
+	}
+	if _, err := revisions.Record(transactionID, models.RevisionUpdated, user.UserID, nil); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("記錄交易版本失敗"),
+		)
+	}
 	if err := tx.Commit().Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(
 			responses.ErrorResponse("保存更新失敗"),
 		)
 	}
 
-	// 10. 載入更新後的完整資料
+	// 14. 載入更新後的完整資料
 	var updatedTransaction models.Transaction
 	if err := h.db.Preload("Group").Preload("Payer").Preload("Creator").
-		Preload("Category").Preload("Splits.User").
+		Preload("Category").Preload("Payments.User").Preload("Splits.User").Preload("Items.Consumers").
 		First(&updatedTransaction, transactionID).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(
 			responses.ErrorResponse("載入更新後的交易資料失敗"),
 		)
 	}
 
-	// 11. 轉換為回應格式並回傳
+	// 15. 轉換為回應格式並回傳
+	middleware.SetETag(c, updatedTransaction.Version)
 	transactionResponse := responses.NewTransactionResponse(updatedTransaction, user.UserID)
 	return c.JSON(
 		responses.SuccessWithMessageResponse("交易更新成功", transactionResponse),
@@ -332,7 +443,8 @@ func (h *TransactionHandler) UpdateTransaction(c *fiber.Ctx) error {
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "交易ID"
-// @Success 200 {object} object{error=bool,data=object{id=int,description=string,amount=number,split_type=string,paid_by=int,group_id=int,category_id=int,receipt_url=string,created_at=string,updated_at=string,payer=object{id=int,name=string,username=string},creator=object{id=int,name=string,username=string},category=object{id=int,name=string},group=object{id=int,name=string},splits=[]object{id=int,user_id=int,amount=number,percentage=number,user=object{id=int,name=string,username=string}}}} "交易詳細資訊"
+// @Success 200 {object} object{error=bool,data=object{id=int,description=string,amount=number,currency=string,exchange_rate=number,base_amount=number,base_currency=string,split_type=string,paid_by=int,group_id=int,category_id=int,receipt_url=string,created_at=string,updated_at=string,payer=object{id=int,name=string,username=string},creator=object{id=int,name=string,username=string},category=object{id=int,name=string},group=object{id=int,name=string},splits=[]object{id=int,user_id=int,amount=number,percentage=number,shares=int,adjustment=number,user=object{id=int,name=string,username=string}},items=[]object{id=int,name=string,kind=string,quantity=int,unit_price=number,total=number,consumers=[]object{id=int,name=string,username=string}},payments=[]object{amount=number,user=object{id=int,name=string,username=string}}}} "交易詳細資訊"
+// @Header 200 {string} ETag "交易目前的版本"
 // @Failure 401 {object} object{error=bool,message=string} "未授權"
 // @Failure 403 {object} object{error=bool,message=string} "不是群組成員"
 // @Failure 404 {object} object{error=bool,message=string} "交易不存在"
@@ -354,7 +466,7 @@ func (h *TransactionHandler) GetTransaction(c *fiber.Ctx) error {
 	// 3. 查詢交易並檢查權限
 	var transaction models.Transaction
 	if err := h.db.Preload("Group").Preload("Payer").Preload("Creator").
-		Preload("Category").Preload("Splits.User").
+		Preload("Category").Preload("Payments.User").Preload("Splits.User").Preload("Items.Consumers").
 		First(&transaction, transactionID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(fiber.StatusNotFound).JSON(
@@ -372,45 +484,115 @@ func (h *TransactionHandler) GetTransaction(c *fiber.Ctx) error {
 		return err
 	}
 
-	// 5. 轉換為回應格式並回傳
+	// 5. 轉換為回應格式並回傳（ETag 為目前的版本）
+	middleware.SetETag(c, transaction.Version)
 	transactionResponse := responses.NewTransactionResponse(transaction, user.UserID)
 	return c.JSON(responses.SuccessResponse(transactionResponse))
 }
 
 // DeleteTransaction 刪除交易
 // @Summary 刪除交易
-// @Description 刪除交易，只有創庺者可以刪除
+// @Description 將交易移至群組垃圾桶並立即從平衡中扣除，創建者、付款者或群組管理員可以刪除，保留期限內可以還原
 // @Tags 交易
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "交易ID"
-// @Success 200 {object} object{error=bool,message=string} "交易刪除成功"
+// @Success 200 {object} object{error=bool,message=string,data=object{id=int,description=string,amount=number,currency=string,deleted_at=string,deleted_by=object{id=int,name=string,username=string},restorable_until=string}} "交易已移至垃圾桶"
 // @Failure 401 {object} object{error=bool,message=string} "未授權"
-// @Failure 403 {object} object{error=bool,message=string} "只有創庺者可以刪除交易"
+// @Failure 403 {object} object{error=bool,message=string} "沒有權限刪除此交易"
 // @Failure 404 {object} object{error=bool,message=string} "交易不存在"
 // @Failure 500 {object} object{error=bool,message=string} "服務器內部錯誤"
 // @Router /transactions/{id} [delete]
 func (h *TransactionHandler) DeleteTransaction(c *fiber.Ctx) error {
-	return c.Status(fiber.StatusMethodNotAllowed).JSON(
-		responses.ErrorResponse("刪除交易功能未提供"),
-	)
+	// 1. 取得當前用戶
+	user, err := middleware.GetCurrentUser(c, h.db)
+	if err != nil {
+		return err
+	}
+
+	// 2. 解析交易 ID
+	transactionID, err := middleware.ParseTransactionIDFromParams(c)
+	if err != nil {
+		return err
+	}
+
+	// 3. 查詢交易
+	var transaction models.Transaction
+	if err := h.db.Preload("Payments").First(&transaction, transactionID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(
+				responses.ErrorResponse("交易不存在"),
+			)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("查詢交易失敗"),
+		)
+	}
+
+	// 4. 檢查用戶權限（創建者、付款者或群組管理員）
+	allowed, err := h.canManageTransaction(user.UserID, transaction)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("檢查權限失敗"),
+		)
+	}
+	if !allowed {
+		return c.Status(fiber.StatusForbidden).JSON(
+			responses.ErrorResponse("您沒有權限刪除此交易"),
+		)
+	}
+
+	// 5. 沖銷交易的過帳並移至垃圾桶，同時記錄刪除版本
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		revisions := services.NewTransactionRevisionService(tx)
+		if err := revisions.EnsureBaseline(transactionID); err != nil {
+			return err
+		}
+		if err := services.NewBalanceService(tx).RemoveTransaction(transactionID); err != nil {
+			return err
+		}
+		if err := tx.Model(&transaction).Update("deleted_by", user.UserID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&transaction).Error; err != nil {
+			return err
+		}
+		_, err := revisions.Record(transactionID, models.RevisionDeleted, user.UserID, nil)
+		return err
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("刪除交易失敗"),
+		)
+	}
+
+	// 6. 載入垃圾桶中的交易資料回傳
+	if err := h.db.Unscoped().Preload("Group").Preload("Payer").Preload("Category").
+		Preload("Splits").Preload("Deleter").
+		First(&transaction, transactionID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("載入交易資料失敗"),
+		)
+	}
+
+	return c.JSON(responses.SuccessWithMessageResponse("交易已移至垃圾桶",
+		responses.NewDeletedTransactionResponse(transaction, user.UserID, h.retention)))
 }
 
-// GetGroupTransactions 示範完整的群組交易查詢邏輯
-// GetGroupTransactions 獲取群組交易
-// @Summary 獲取群組交易列表
-// @Description 獲取指定群組的所有交易記錄
+// GetDeletedTransactions 獲取群組垃圾桶中的交易
+// @Summary 獲取已刪除的交易
+// @Description 列出群組中仍在保留期限內、可以還原的已刪除交易（依刪除時間由新到舊）
 // @Tags 交易
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "群組ID"
-// @Success 200 {object} object{error=bool,data=[]object{id=int,description=string,amount=number,split_type=string,paid_by=int,group_id=int,category_id=int,receipt_url=string,created_at=string,updated_at=string,payer=object{id=int,name=string,username=string},creator=object{id=int,name=string,username=string},category=object{id=int,name=string},group=object{id=int,name=string},splits=[]object{id=int,user_id=int,amount=number,percentage=number,user=object{id=int,name=string,username=string}}}} "群組交易列表"
+// @Param page query int false "頁碼" default(1)
+// @Param limit query int false "每頁筆數" default(20)
+// @Success 200 {object} object{error=bool,data=object{data=[]object{id=int,description=string,amount=number,currency=string,deleted_at=string,deleted_by=object{id=int,name=string,username=string},restorable_until=string},pagination=object{page=int,limit=int,total=int,total_pages=int}}} "已刪除的交易列表"
 // @Failure 401 {object} object{error=bool,message=string} "未授權"
 // @Failure 403 {object} object{error=bool,message=string} "不是群組成員"
-// @Failure 404 {object} object{error=bool,message=string} "群組不存在"
 // @Failure 500 {object} object{error=bool,message=string} "服務器內部錯誤"
-// @Router /groups/{id}/transactions [get]
-func (h *TransactionHandler) GetGroupTransactions(c *fiber.Ctx) error {
+// @Router /groups/{id}/transactions/deleted [get]
+func (h *TransactionHandler) GetDeletedTransactions(c *fiber.Ctx) error {
 	// 1. 解析群組 ID
 	groupID, err := middleware.ParseGroupIDFromParams(c)
 	if err != nil {
@@ -431,128 +613,946 @@ func (h *TransactionHandler) GetGroupTransactions(c *fiber.Ctx) error {
 	}
 	offset := (page - 1) * limit
 
-	// 4. 查詢群組交易
+	// 4. 查詢保留期限內的已刪除交易
+	deletedQuery := h.db.Unscoped().Model(&models.Transaction{}).
+		Where("group_id = ? AND deleted_at IS NOT NULL AND deleted_at > ?", groupID, time.Now().Add(-h.retention))
+
 	var transactions []models.Transaction
-	query := h.db.Where("group_id = ?", groupID).
+	if err := deletedQuery.Session(&gorm.Session{}).
 		Preload("Payer").
-		Preload("Creator").
 		Preload("Category").
-		Preload("Splits.User").
+		Preload("Splits").
 		Preload("Group").
-		Order("created_at DESC").
+		Preload("Deleter").
+		Order("deleted_at DESC").
 		Offset(offset).
-		Limit(limit)
-
-	if err := query.Find(&transactions).Error; err != nil {
+		Limit(limit).
+		Find(&transactions).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(
-			responses.ErrorResponse("查詢交易記錄失敗"),
+			responses.ErrorResponse("查詢已刪除的交易失敗"),
 		)
 	}
 
 	// 5. 計算總筆數（用於分頁）
 	var total int64
-	if err := h.db.Model(&models.Transaction{}).Where("group_id = ?", groupID).Count(&total).Error; err != nil {
+	if err := deletedQuery.Session(&gorm.Session{}).Count(&total).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(
 			responses.ErrorResponse("計算總筆數失敗"),
 		)
 	}
 
 	// 6. 轉換為回應格式
-	transactionResponses := responses.NewTransactionSimpleResponseList(transactions, authUser.UserID)
+	transactionResponses := responses.NewDeletedTransactionResponseList(transactions, authUser.UserID, h.retention)
 	paginatedResponse := responses.NewPaginatedResponse(transactionResponses, page, limit, total)
 
 	return c.JSON(responses.SuccessResponse(paginatedResponse))
 }
 
-// GetGroupBalance 獲取群組總欠
-// @Summary 獲取群組總欠
-// @Description 獲取群組中每個成員的總欠情況
+// RestoreTransaction 還原已刪除的交易
+// @Summary 還原交易
+// @Description 在保留期限內將垃圾桶中的交易還原並重新計入平衡，創建者、付款者或群組管理員可以還原
 // @Tags 交易
 // @Produce json
 // @Security BearerAuth
-// @Param id path int true "群組ID"
-// @Success 200 {object} object{error=bool,data=[]object{user_id=int,name=string,username=string,net_balance=number}} "群組總欠情況"
+// @Param id path int true "交易ID"
+// @Success 200 {object} object{error=bool,message=string,data=object{id=int,description=string,amount=number,currency=string,split_type=string,paid_by=int,group_id=int,created_at=string,updated_at=string}} "交易已還原"
+// @Failure 400 {object} object{error=bool,message=string} "部分用戶已不是群組成員"
 // @Failure 401 {object} object{error=bool,message=string} "未授權"
-// @Failure 403 {object} object{error=bool,message=string} "不是群組成員"
-// @Failure 404 {object} object{error=bool,message=string} "群組不存在"
+// @Failure 403 {object} object{error=bool,message=string} "沒有權限還原此交易"
+// @Failure 404 {object} object{error=bool,message=string} "已刪除的交易不存在"
+// @Failure 410 {object} object{error=bool,message=string} "已超過可還原的期限"
 // @Failure 500 {object} object{error=bool,message=string} "服務器內部錯誤"
-// @Router /groups/{id}/balance [get]
-func (h *TransactionHandler) GetGroupBalance(c *fiber.Ctx) error {
-	// 解析群組 ID
-	groupID, err := middleware.ParseGroupIDFromParams(c)
+// @Router /transactions/{id}/restore [post]
+func (h *TransactionHandler) RestoreTransaction(c *fiber.Ctx) error {
+	// 1. 取得當前用戶
+	user, err := middleware.GetCurrentUser(c, h.db)
 	if err != nil {
 		return err
 	}
 
-	// 驗證用戶是群組成員
-	_, err = middleware.RequireGroupMember(c, h.db, groupID)
+	// 2. 解析交易 ID
+	transactionID, err := middleware.ParseTransactionIDFromParams(c)
 	if err != nil {
 		return err
 	}
 
-	// 計算群組內每個用戶的平衡
-	balances, err := h.balanceService.CalculateGroupBalances(groupID)
-	if err != nil {
+	// 3. 查詢垃圾桶中的交易
+	var transaction models.Transaction
+	if err := h.db.Unscoped().Preload("Payments").Preload("Splits").
+		Where("deleted_at IS NOT NULL").
+		First(&transaction, transactionID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(
+				responses.ErrorResponse("已刪除的交易不存在"),
+			)
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(
-			responses.ErrorResponse("計算群組平衡失敗"),
+			responses.ErrorResponse("查詢交易失敗"),
 		)
 	}
 
-	// 轉換為回應格式
-	balanceResponses := make([]responses.BalanceResponse, len(balances))
-	for i, balance := range balances {
-		balanceResponses[i] = responses.NewBalanceResponse(balance)
+	// 4. 檢查用戶權限（創建者、付款者或群組管理員）
+	allowed, err := h.canManageTransaction(user.UserID, transaction)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("檢查權限失敗"),
+		)
+	}
+	if !allowed {
+		return c.Status(fiber.StatusForbidden).JSON(
+			responses.ErrorResponse("您沒有權限還原此交易"),
+		)
 	}
 
-	return c.JSON(responses.SuccessResponse(balanceResponses))
-}
-
-// ============ 共用函數 ============
+	// 5. 檢查保留期限
+	if time.Since(transaction.DeletedAt.Time) > h.retention {
+		return c.Status(fiber.StatusGone).JSON(
+			responses.ErrorResponse("已超過可還原的期限"),
+		)
+	}
 
-// SplitCalculation 通用的分帳計算結構
-type SplitCalculation struct {
-	UserID     uint
-	Amount     float64
-	Percentage float64
-}
+	// 6. 付款者與分帳參與者必須仍是群組成員
+	var userIDs []uint
+	for _, payment := range transaction.PaymentsOrDefault() {
+		userIDs = append(userIDs, payment.UserID)
+	}
+	for _, split := range transaction.Splits {
+		userIDs = append(userIDs, split.UserID)
+	}
+	if err := h.validationService.ValidateMultipleGroupMembers(transaction.GroupID, userIDs); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	}
 
-// calculateSplits 通用的分帳計算函數
-func (h *TransactionHandler) calculateSplits(splitType models.SplitType, totalAmount float64, splits []SplitCalculation) ([]SplitCalculation, error) {
-	switch splitType {
-	case models.SplitEqual:
-		amountPerPerson := totalAmount / float64(len(splits))
-		for i := range splits {
-			splits[i].Amount = amountPerPerson
-			splits[i].Percentage = math.Round((100.0/float64(len(splits)))*100) / 100.0
+	// 7. 還原交易、重新過帳並記錄還原版本
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		revisions := services.NewTransactionRevisionService(tx)
+		if err := revisions.EnsureBaseline(transactionID); err != nil {
+			return err
 		}
-
+		if err := tx.Unscoped().Model(&models.Transaction{}).Where("id = ?", transactionID).
+			Updates(map[string]interface{}{"deleted_at": nil, "deleted_by": nil}).Error; err != nil {
+			return err
+		}
+		if err := services.NewBalanceService(tx).AddTransaction(transactionID); err != nil {
+			return err
+		}
+		_, err := revisions.Record(transactionID, models.RevisionRestored, user.UserID, nil)
+		return err
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("還原交易失敗"),
+		)
+	}
+
+	// 8. 載入完整的交易資料回傳
+	if err := h.db.Preload("Group").Preload("Payer").Preload("Creator").
+		Preload("Category").Preload("Payments.User").Preload("Splits.User").Preload("Items.Consumers").
+		First(&transaction, transactionID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("載入交易資料失敗"),
+		)
+	}
+
+	return c.JSON(responses.SuccessWithMessageResponse("交易已還原",
+		responses.NewTransactionResponse(transaction, user.UserID)))
+}
+
+// GetTransactionHistory 獲取交易的修改記錄
+// @Summary 獲取交易修改記錄
+// @Description 依版本號列出交易每次建立、修改、刪除、還原或回復後的完整內容、編輯者，以及與前一個版本的欄位差異（已刪除的交易也可查詢）
+// @Tags 交易
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "交易ID"
+// @Success 200 {object} object{error=bool,data=[]object{revision=int,action=string,editor_id=int,editor=object{id=int,name=string},reverted_from=int,changes=[]object{field=string,user_id=int,from=object,to=object},snapshot=object{description=string,amount=number,currency=string,exchange_rate=number,base_amount=number,base_currency=string,category_id=int,paid_by=int,split_type=string,payments=[]object{user_id=int,amount=number},splits=[]object{user_id=int,amount=number,percentage=number,shares=int,adjustment=number},items=[]object{name=string,kind=string,quantity=int,unit_price=number,consumer_ids=[]int},receipt_url=string,notes=string},created_at=string}} "交易修改記錄"
+// @Failure 401 {object} object{error=bool,message=string} "未授權"
+// @Failure 403 {object} object{error=bool,message=string} "不是群組成員"
+// @Failure 404 {object} object{error=bool,message=string} "交易不存在"
+// @Failure 500 {object} object{error=bool,message=string} "服務器內部錯誤"
+// @Router /transactions/{id}/history [get]
+func (h *TransactionHandler) GetTransactionHistory(c *fiber.Ctx) error {
+	// 1. 解析交易 ID
+	transactionID, err := middleware.ParseTransactionIDFromParams(c)
+	if err != nil {
+		return err
+	}
+
+	// 2. 查詢交易（包含垃圾桶中的交易）
+	var transaction models.Transaction
+	if err := h.db.Unscoped().First(&transaction, transactionID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(
+				responses.ErrorResponse("交易不存在"),
+			)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("查詢交易失敗"),
+		)
+	}
+
+	// 3. 驗證用戶是群組成員
+	_, err = middleware.RequireGroupMember(c, h.db, transaction.GroupID)
+	if err != nil {
+		return err
+	}
+
+	// 4. 取得所有版本（舊交易先以目前內容建立第一個版本）
+	revisionService := services.NewTransactionRevisionService(h.db)
+	if err := revisionService.EnsureBaseline(transactionID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("記錄交易版本失敗"),
+		)
+	}
+	revisions, err := revisionService.History(transactionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("查詢交易修改記錄失敗"),
+		)
+	}
+
+	// 5. 解碼快照並計算各版本的差異
+	snapshots := make([]models.TransactionSnapshot, len(revisions))
+	for i, revision := range revisions {
+		snapshots[i], err = revision.TransactionSnapshot()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(
+				responses.ErrorResponse("解析交易版本失敗"),
+			)
+		}
+	}
+
+	return c.JSON(responses.SuccessResponse(responses.NewTransactionRevisionResponseList(revisions, snapshots)))
+}
+
+// RevertTransaction 將交易回復為先前的版本
+// @Summary 回復交易版本
+// @Description 以指定版本的內容（金額、付款、分帳、明細、分類與備註）取代目前的交易並重新過帳，回復本身會成為新的版本。創建者、付款者或群組管理員可以回復
+// @Tags 交易
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "交易ID"
+// @Param If-Match header string false "GET 回傳的 ETag（未提供時需在請求內容帶 version）"
+// @Param request body object{revision=int,version=int} true "要回復的版本號與目前的交易版本"
+// @Success 200 {object} object{error=bool,message=string,data=object{id=int,description=string,amount=number,currency=string,exchange_rate=number,base_amount=number,base_currency=string,split_type=string,paid_by=int,group_id=int,category_id=int,receipt_url=string,created_at=string,updated_at=string}} "交易已回復"
+// @Failure 400 {object} object{error=bool,message=string} "請求格式錯誤、內容與該版本相同或部分用戶已不是群組成員"
+// @Failure 401 {object} object{error=bool,message=string} "未授權"
+// @Failure 403 {object} object{error=bool,message=string} "沒有權限回復此交易"
+// @Failure 404 {object} object{error=bool,message=string} "交易或版本不存在"
+// @Failure 409 {object} object{error=bool,message=string,data=object{id=int,version=int}} "版本已過期，data 為目前的交易內容"
+// @Failure 428 {object} object{error=bool,message=string} "未提供 If-Match 或 version"
+// @Failure 500 {object} object{error=bool,message=string} "服務器內部錯誤"
+// @Router /transactions/{id}/revert [post]
+func (h *TransactionHandler) RevertTransaction(c *fiber.Ctx) error {
+	// 1. 取得當前用戶
+	user, err := middleware.GetCurrentUser(c, h.db)
+	if err != nil {
+		return err
+	}
+
+	// 2. 解析交易 ID
+	transactionID, err := middleware.ParseTransactionIDFromParams(c)
+	if err != nil {
+		return err
+	}
+
+	// 3. 解析請求資料
+	var req models.RevertTransactionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse("無效的請求格式"),
+		)
+	}
+	if req.Revision < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse("請提供要回復的版本"),
+		)
+	}
+
+	// 4. 查詢交易（垃圾桶中的交易需先還原）
+	var transaction models.Transaction
+	if err := h.db.Preload("Payments").First(&transaction, transactionID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(
+				responses.ErrorResponse("交易不存在"),
+			)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("查詢交易失敗"),
+		)
+	}
+
+	// 5. 檢查用戶權限（創建者、付款者或群組管理員）
+	allowed, err := h.canManageTransaction(user.UserID, transaction)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("檢查權限失敗"),
+		)
+	}
+	if !allowed {
+		return c.Status(fiber.StatusForbidden).JSON(
+			responses.ErrorResponse("您沒有權限回復此交易"),
+		)
+	}
+
+	// 6. 檢查回復所依據的版本，避免以過期的歷史畫面覆寫其他人的修改
+	expectedVersion, err := middleware.RequireVersion(c, req.Version)
+	if err != nil {
+		return err
+	}
+	if transaction.Version != expectedVersion {
+		return h.versionConflict(c, transactionID, user.UserID)
+	}
+
+	// 7. 取得要回復的版本內容，並與目前的內容比較
+	revisionService := services.NewTransactionRevisionService(h.db)
+	if err := revisionService.EnsureBaseline(transactionID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("記錄交易版本失敗"),
+		)
+	}
+	target, err := revisionService.Find(transactionID, req.Revision)
+	if errors.Is(err, services.ErrRevisionNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("查詢交易版本失敗"),
+		)
+	}
+	snapshot, err := target.TransactionSnapshot()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("解析交易版本失敗"),
+		)
+	}
+	current, err := revisionService.Snapshot(transactionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("查詢交易失敗"),
+		)
+	}
+	if snapshot.Equal(current) {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse("交易內容已與此版本相同"),
+		)
+	}
+
+	// 8. 付款者、分帳參與者與明細消費者必須仍是群組成員
+	if err := h.validationService.ValidateMultipleGroupMembers(transaction.GroupID, snapshot.ParticipantIDs()); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	}
+
+	// 9. 以條件更新遞增版本後沖銷目前的過帳，以版本內容取代交易後重新過帳並記錄回復版本
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Transaction{}).Where("id = ? AND version = ?", transactionID, expectedVersion).
+			Update("version", gorm.Expr("version + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errTransactionVersionConflict
+		}
+
+		ledger := services.NewBalanceService(tx)
+		if err := ledger.RemoveTransaction(transactionID); err != nil {
+			return err
+		}
+		if err := h.applySnapshot(tx, transactionID, snapshot); err != nil {
+			return err
+		}
+		if err := ledger.AddTransaction(transactionID); err != nil {
+			return err
+		}
+		_, err := services.NewTransactionRevisionService(tx).Record(transactionID, models.RevisionReverted, user.UserID, &req.Revision)
+		return err
+	})
+	if errors.Is(err, errTransactionVersionConflict) {
+		return h.versionConflict(c, transactionID, user.UserID)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("回復交易失敗"),
+		)
+	}
+
+	// 10. 載入完整的交易資料回傳
+	if err := h.db.Preload("Group").Preload("Payer").Preload("Creator").
+		Preload("Category").Preload("Payments.User").Preload("Splits.User").Preload("Items.Consumers").
+		First(&transaction, transactionID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("載入交易資料失敗"),
+		)
+	}
+
+	middleware.SetETag(c, transaction.Version)
+	return c.JSON(responses.SuccessWithMessageResponse("交易已回復",
+		responses.NewTransactionResponse(transaction, user.UserID)))
+}
+
+// applySnapshot 以版本快照取代交易的欄位、付款、分帳與明細記錄
+func (h *TransactionHandler) applySnapshot(tx *gorm.DB, transactionID uint, snapshot models.TransactionSnapshot) error {
+	if err := tx.Model(&models.Transaction{}).Where("id = ?", transactionID).Updates(map[string]interface{}{
+		"description":   snapshot.Description,
+		"amount":        snapshot.Amount,
+		"currency":      snapshot.Currency,
+		"exchange_rate": snapshot.ExchangeRate,
+		"base_amount":   snapshot.BaseAmount,
+		"category_id":   snapshot.CategoryID,
+		"paid_by":       snapshot.PaidBy,
+		"receipt":       snapshot.Receipt,
+		"notes":         snapshot.Notes,
+	}).Error; err != nil {
+		return errors.New("更新交易失敗")
+	}
+
+	payments := make([]models.TransactionPayment, len(snapshot.Payments))
+	for i, payment := range snapshot.Payments {
+		payments[i] = models.TransactionPayment{UserID: payment.UserID, Amount: payment.Amount}
+	}
+	if err := h.replacePaymentRecords(tx, transactionID, payments, snapshot.PaidBy); err != nil {
+		return err
+	}
+
+	if err := tx.Where("transaction_id = ?", transactionID).Delete(&models.TransactionSplit{}).Error; err != nil {
+		return errors.New("刪除舊分帳記錄失敗")
+	}
+	splits := make([]SplitCalculation, len(snapshot.Splits))
+	for i, split := range snapshot.Splits {
+		splits[i] = SplitCalculation{
+			UserID:     split.UserID,
+			Amount:     split.Amount,
+			Percentage: split.Percentage,
+			Shares:     split.Shares,
+			Adjustment: split.Adjustment,
+		}
+	}
+	if len(splits) > 0 {
+		if err := h.createSplitRecords(tx, transactionID, snapshot.SplitType, splits); err != nil {
+			return errors.New("創建分帳記錄失敗")
+		}
+	}
+
+	if err := h.deleteItemRecords(tx, transactionID); err != nil {
+		return err
+	}
+	items := make([]models.TransactionItem, len(snapshot.Items))
+	for i, item := range snapshot.Items {
+		consumers := make([]models.User, len(item.ConsumerIDs))
+		for j, consumerID := range item.ConsumerIDs {
+			consumers[j] = models.User{ID: consumerID}
+		}
+		items[i] = models.TransactionItem{
+			Name:      item.Name,
+			Kind:      item.Kind,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+			Consumers: consumers,
+		}
+	}
+	if err := h.createItemRecords(tx, transactionID, items); err != nil {
+		return errors.New("創建明細記錄失敗")
+	}
+
+	return nil
+}
+
+// errTransactionVersionConflict 條件更新時交易版本已被其他修改遞增
+var errTransactionVersionConflict = errors.New("交易版本已變更")
+
+// versionConflict 回傳 409 與交易目前的內容，讓客戶端以最新版本重新修改
+func (h *TransactionHandler) versionConflict(c *fiber.Ctx, transactionID, currentUserID uint) error {
+	var current models.Transaction
+	if err := h.db.Preload("Group").Preload("Payer").Preload("Creator").
+		Preload("Category").Preload("Payments.User").Preload("Splits.User").Preload("Items.Consumers").
+		First(&current, transactionID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("查詢交易失敗"),
+		)
+	}
+
+	middleware.SetETag(c, current.Version)
+	return c.Status(fiber.StatusConflict).JSON(
+		responses.ErrorWithDataResponse("交易已被其他人修改，請以最新內容重新編輯", responses.NewTransactionResponse(current, currentUserID)),
+	)
+}
+
+// canManageTransaction 檢查用戶是否可以刪除或還原交易：創建者、付款者或群組管理員
+func (h *TransactionHandler) canManageTransaction(userID uint, transaction models.Transaction) (bool, error) {
+	if transaction.CreatedBy == userID || transaction.PaidBy == userID || transaction.PaidAmount(userID) > 0 {
+		return true, nil
+	}
+
+	var count int64
+	if err := h.db.Model(&models.GroupMember{}).
+		Where("group_id = ? AND user_id = ? AND role = ?", transaction.GroupID, userID, "admin").
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetGroupTransactions 示範完整的群組交易查詢邏輯
+// GetGroupTransactions 獲取群組交易
+// @Summary 獲取群組交易列表
+// @Description 獲取指定群組的交易記錄，可依日期、分類、付款者、參與者、金額、幣別與關鍵字篩選並排序
+// @Tags 交易
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "群組ID"
+// @Param page query int false "頁碼" default(1)
+// @Param limit query int false "每頁筆數" default(20)
+// @Param from query string false "交易日期起始 (YYYY-MM-DD，含當天)"
+// @Param to query string false "交易日期結束 (YYYY-MM-DD，含當天)"
+// @Param category_id query int false "分類ID"
+// @Param paid_by query int false "付款者ID (主要付款者或付款明細中的用戶)"
+// @Param participant_id query int false "參與者ID (付款者或分帳參與者)"
+// @Param currency query string false "交易幣別"
+// @Param min_amount query string false "最低金額 (未指定 currency 時為群組基準幣別)"
+// @Param max_amount query string false "最高金額 (未指定 currency 時為群組基準幣別)"
+// @Param q query string false "搜尋描述或備註"
+// @Param sort query string false "排序欄位 (created_at、updated_at、amount、description)" default(created_at)
+// @Param order query string false "排序方向 (asc、desc)" default(desc)
+// @Success 200 {object} object{error=bool,data=object{data=[]object{id=int,description=string,amount=number,split_type=string,paid_by=int,group_id=int,category_id=int,receipt_url=string,created_at=string,updated_at=string,payer=object{id=int,name=string,username=string},creator=object{id=int,name=string,username=string},category=object{id=int,name=string},group=object{id=int,name=string},splits=[]object{id=int,user_id=int,amount=number,percentage=number,shares=int,adjustment=number,user=object{id=int,name=string,username=string}}},pagination=object{page=int,limit=int,total=int,total_pages=int}}} "群組交易列表"
+// @Failure 400 {object} object{error=bool,message=string} "查詢參數無效"
+// @Failure 401 {object} object{error=bool,message=string} "未授權"
+// @Failure 403 {object} object{error=bool,message=string} "不是群組成員"
+// @Failure 404 {object} object{error=bool,message=string} "群組不存在"
+// @Failure 500 {object} object{error=bool,message=string} "服務器內部錯誤"
+// @Router /groups/{id}/transactions [get]
+func (h *TransactionHandler) GetGroupTransactions(c *fiber.Ctx) error {
+	// 1. 解析群組 ID
+	groupID, err := middleware.ParseGroupIDFromParams(c)
+	if err != nil {
+		return err
+	}
+
+	// 2. 驗證用戶是群組成員並取得認證資訊
+	authUser, err := middleware.RequireGroupMember(c, h.db, groupID)
+	if err != nil {
+		return err
+	}
+
+	// 3. 解析查詢參數（未指定幣別時金額範圍以群組基準幣別計）
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", 20)
+	if limit > 100 {
+		limit = 100 // 限制最大頁面大小
+	}
+	offset := (page - 1) * limit
+
+	baseCurrency, err := loadGroupBaseCurrency(h.db, groupID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	}
+	filter, err := parseTransactionFilter(c, baseCurrency)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			responses.ErrorResponse(err.Error()),
+		)
+	}
+
+	// 4. 查詢群組交易
+	transactionQuery := filter.Apply(h.db.Model(&models.Transaction{}).Where("group_id = ?", groupID))
+
+	var transactions []models.Transaction
+	if err := filter.Order(transactionQuery.Session(&gorm.Session{})).
+		Preload("Payer").
+		Preload("Payments").
+		Preload("Creator").
+		Preload("Category").
+		Preload("Splits.User").
+		Preload("Group").
+		Offset(offset).
+		Limit(limit).
+		Find(&transactions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("查詢交易記錄失敗"),
+		)
+	}
+
+	// 5. 計算總筆數（用於分頁）
+	var total int64
+	if err := transactionQuery.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("計算總筆數失敗"),
+		)
+	}
+
+	// 6. 轉換為回應格式
+	transactionResponses := responses.NewTransactionSimpleResponseList(transactions, authUser.UserID)
+	paginatedResponse := responses.NewPaginatedResponse(transactionResponses, page, limit, total)
+
+	return c.JSON(responses.SuccessResponse(paginatedResponse))
+}
+
+// GetGroupBalance 獲取群組總欠
+// @Summary 獲取群組總欠
+// @Description 獲取群組中每個成員的總欠情況
+// @Tags 交易
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "群組ID"
+// @Success 200 {object} object{error=bool,data=[]object{user_id=int,name=string,username=string,net_balance=number}} "群組總欠情況"
+// @Failure 401 {object} object{error=bool,message=string} "未授權"
+// @Failure 403 {object} object{error=bool,message=string} "不是群組成員"
+// @Failure 404 {object} object{error=bool,message=string} "群組不存在"
+// @Failure 500 {object} object{error=bool,message=string} "服務器內部錯誤"
+// @Router /groups/{id}/balance [get]
+func (h *TransactionHandler) GetGroupBalance(c *fiber.Ctx) error {
+	// 解析群組 ID
+	groupID, err := middleware.ParseGroupIDFromParams(c)
+	if err != nil {
+		return err
+	}
+
+	// 驗證用戶是群組成員
+	_, err = middleware.RequireGroupMember(c, h.db, groupID)
+	if err != nil {
+		return err
+	}
+
+	// 計算群組內每個用戶的平衡
+	balances, err := h.balanceService.CalculateGroupBalances(groupID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("計算群組平衡失敗"),
+		)
+	}
+
+	// 轉換為回應格式
+	balanceResponses := make([]responses.BalanceResponse, len(balances))
+	for i, balance := range balances {
+		balanceResponses[i] = responses.NewBalanceResponse(balance)
+	}
+
+	return c.JSON(responses.SuccessResponse(balanceResponses))
+}
+
+// ============ 共用函數 ============
+
+// SplitCalculation 通用的分帳計算結構
+type SplitCalculation struct {
+	UserID     uint
+	Amount     money.Amount
+	Percentage float64
+	Shares     int64
+	Adjustment money.Amount
+}
+
+// percentageScale 百分比以萬分比 (basis points) 計算，保留兩位小數
+const percentageScale = 100
+
+// preparedTransaction 已完成驗證與計算、尚未寫入資料庫的交易
+type preparedTransaction struct {
+	transaction models.Transaction
+	splitType   models.SplitType
+	splits      []SplitCalculation
+	items       []models.TransactionItem
+	payments    []models.TransactionPayment
+}
+
+// prepareTransaction 驗證付款者與分帳成員，並計算分帳、付款明細與基準幣別金額
+// date 為交易日期，未提供匯率時以此日期查詢匯率資料
+func (h *TransactionHandler) prepareTransaction(req models.CreateTransactionRequest, createdBy uint, date time.Time) (*preparedTransaction, error) {
+	// 1. 驗證付款者是群組成員
+	if len(req.Payments) == 0 {
+		if err := h.validationService.ValidateGroupMember(req.GroupID, req.PaidBy); err != nil {
+			return nil, err
+		}
+	} else {
+		payerIDs := paymentUserIDs(req.Payments)
+		if req.PaidBy > 0 {
+			payerIDs = append(payerIDs, req.PaidBy)
+		}
+		if err := h.validationService.ValidateMultipleGroupMembers(req.GroupID, payerIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	// 2. 驗證所有分帳用戶（含明細消費者）都是群組成員
+	var splitUserIDs []uint
+	for _, split := range req.Splits {
+		splitUserIDs = append(splitUserIDs, split.UserID)
+	}
+	for _, item := range req.Items {
+		splitUserIDs = append(splitUserIDs, item.ConsumerIDs...)
+	}
+
+	if err := h.validationService.ValidateMultipleGroupMembers(req.GroupID, splitUserIDs); err != nil {
+		return nil, err
+	}
+
+	// 3. 設定預設值（幣別預設為群組基準幣別）
+	baseCurrency, err := loadGroupBaseCurrency(h.db, req.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Currency == "" {
+		req.Currency = baseCurrency
+	}
+	req.Currency, err = money.NormalizeCurrency(req.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	// 4. 計算分帳金額（以最小貨幣單位計算）
+	amount, err := req.Amount.Amount(req.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if amount < 0 {
+		return nil, errors.New("交易金額必須大於 0")
+	}
+
+	var items []models.TransactionItem
+	var calculatedSplits []SplitCalculation
+	if len(req.Items) > 0 {
+		// 明細模式：由明細項目推導分帳，未提供金額時使用明細總額
+		req.SplitType = models.SplitItemized
+		items, calculatedSplits, amount, err = h.prepareItemizedSplits(req.Items, req.Currency, amount)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if amount <= 0 {
+			return nil, errors.New("交易金額必須大於 0")
+		}
+
+		calculations, err := toSplitCalculations(req.Splits, req.Currency)
+		if err != nil {
+			return nil, err
+		}
+
+		calculatedSplits, err = h.calculateSplits(req.SplitType, amount, calculations)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 5. 解析付款明細（未提供時由 paid_by 支付全額）
+	payments, paidBy, err := resolvePayments(req.Payments, req.PaidBy, amount, req.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	// 6. 鎖定匯率並換算為群組基準幣別
+	exchangeRate, baseAmount, err := convertToBase(h.exchangeRateService, req.Currency, baseCurrency, req.ExchangeRate, amount, date)
+	if err != nil {
+		return nil, err
+	}
+
+	return &preparedTransaction{
+		transaction: models.Transaction{
+			GroupID:      req.GroupID,
+			Description:  req.Description,
+			Amount:       amount,
+			Currency:     req.Currency,
+			ExchangeRate: exchangeRate,
+			BaseAmount:   baseAmount,
+			CategoryID:   req.CategoryID,
+			PaidBy:       paidBy,
+			Receipt:      req.Receipt,
+			Notes:        req.Notes,
+			CreatedBy:    createdBy,
+		},
+		splitType: req.SplitType,
+		splits:    calculatedSplits,
+		items:     items,
+		payments:  payments,
+	}, nil
+}
+
+// savePreparedTransaction 在資料庫交易中寫入交易、付款、明細與分帳記錄
+func (h *TransactionHandler) savePreparedTransaction(tx *gorm.DB, prepared *preparedTransaction) error {
+	if err := tx.Create(&prepared.transaction).Error; err != nil {
+		return errors.New("創建交易失敗")
+	}
+
+	transactionID := prepared.transaction.ID
+	if err := h.createPaymentRecords(tx, transactionID, prepared.payments); err != nil {
+		return errors.New("創建付款記錄失敗")
+	}
+	if err := h.createItemRecords(tx, transactionID, prepared.items); err != nil {
+		return errors.New("創建明細記錄失敗")
+	}
+	if err := h.createSplitRecords(tx, transactionID, prepared.splitType, prepared.splits); err != nil {
+		return errors.New("創建分帳記錄失敗")
+	}
+	if err := services.NewBalanceService(tx).AddTransaction(transactionID); err != nil {
+		return errors.New("更新平衡失敗")
+	}
+	if _, err := services.NewTransactionRevisionService(tx).Record(transactionID, models.RevisionCreated, prepared.transaction.CreatedBy, nil); err != nil {
+		return errors.New("記錄交易版本失敗")
+	}
+
+	return nil
+}
+
+// toSplitCalculations 將分帳請求轉換為通用計算結構
+func toSplitCalculations(splits []models.TransactionSplitRequest, currency string) ([]SplitCalculation, error) {
+	calculations := make([]SplitCalculation, len(splits))
+	for i, split := range splits {
+		amount, err := split.Amount.Amount(currency)
+		if err != nil {
+			return nil, err
+		}
+		adjustment, err := split.Adjustment.Amount(currency)
+		if err != nil {
+			return nil, err
+		}
+		calculations[i] = SplitCalculation{
+			UserID:     split.UserID,
+			Amount:     amount,
+			Percentage: split.Percentage,
+			Shares:     split.Shares,
+			Adjustment: adjustment,
+		}
+	}
+	return calculations, nil
+}
+
+// basisPointsToPercentages 將萬分比轉換為百分比
+func basisPointsToPercentages(basisPoints []money.Amount) []float64 {
+	percentages := make([]float64, len(basisPoints))
+	for i, bp := range basisPoints {
+		percentages[i] = float64(bp) / percentageScale
+	}
+	return percentages
+}
+
+// calculateSplits 通用的分帳計算函數
+// 所有金額皆以最小貨幣單位計算，並使用最大餘數法確保分帳總和等於交易金額
+func (h *TransactionHandler) calculateSplits(splitType models.SplitType, totalAmount money.Amount, splits []SplitCalculation) ([]SplitCalculation, error) {
+	if len(splits) == 0 {
+		return nil, errors.New("至少需要一位分帳成員")
+	}
+
+	fullPercentage := money.Amount(100 * percentageScale)
+
+	switch splitType {
+	case models.SplitEqual:
+		amounts, err := money.SplitEvenly(totalAmount, len(splits))
+		if err != nil {
+			return nil, err
+		}
+		basisPoints, err := money.SplitEvenly(fullPercentage, len(splits))
+		if err != nil {
+			return nil, err
+		}
+		percentages := basisPointsToPercentages(basisPoints)
+		for i := range splits {
+			splits[i].Amount = amounts[i]
+			splits[i].Percentage = percentages[i]
+		}
+
 	case models.SplitPercentage:
-		totalPercentage := 0.0
-		for _, split := range splits {
-			totalPercentage += split.Percentage
+		weights := make([]int64, len(splits))
+		var totalBasisPoints int64
+		for i, split := range splits {
+			if split.Percentage < 0 {
+				return nil, errors.New("分帳比例不能為負數")
+			}
+			weights[i] = int64(math.Round(split.Percentage * percentageScale))
+			totalBasisPoints += weights[i]
 		}
-		if totalPercentage != 100.0 {
+		if totalBasisPoints != int64(fullPercentage) {
 			return nil, errors.New("分帳比例總和必須等於 100%")
 		}
+		amounts, err := money.Allocate(totalAmount, weights)
+		if err != nil {
+			return nil, err
+		}
 		for i := range splits {
-			splits[i].Amount = totalAmount * splits[i].Percentage / 100.0
+			splits[i].Amount = amounts[i]
+			splits[i].Percentage = float64(weights[i]) / percentageScale
 		}
 
 	case models.SplitFixed:
-		totalSplitAmount := 0.0
-		for _, split := range splits {
+		weights := make([]int64, len(splits))
+		var totalSplitAmount money.Amount
+		for i, split := range splits {
 			if split.Amount <= 0 {
 				return nil, errors.New("固定金額必須大於 0")
 			}
+			weights[i] = int64(split.Amount)
 			totalSplitAmount += split.Amount
 		}
 		if totalSplitAmount != totalAmount {
 			return nil, errors.New("分帳金額總和必須等於交易金額")
 		}
+		basisPoints, err := money.Allocate(fullPercentage, weights)
+		if err != nil {
+			return nil, err
+		}
+		percentages := basisPointsToPercentages(basisPoints)
+		for i := range splits {
+			splits[i].Percentage = percentages[i]
+		}
+
+	case models.SplitShares:
+		weights := make([]int64, len(splits))
+		for i, split := range splits {
+			if split.Shares <= 0 {
+				return nil, errors.New("分帳份數必須大於 0")
+			}
+			weights[i] = split.Shares
+		}
+		amounts, err := money.Allocate(totalAmount, weights)
+		if err != nil {
+			return nil, err
+		}
+		basisPoints, err := money.Allocate(fullPercentage, weights)
+		if err != nil {
+			return nil, err
+		}
+		percentages := basisPointsToPercentages(basisPoints)
+		for i := range splits {
+			splits[i].Amount = amounts[i]
+			splits[i].Percentage = percentages[i]
+		}
+
+	case models.SplitAdjustment:
+		// 先扣除各自的調整金額，剩餘金額再平均分攤
+		remaining := totalAmount
+		for _, split := range splits {
+			remaining -= split.Adjustment
+		}
+		if remaining < 0 {
+			return nil, errors.New("調整金額總和不能超過交易金額")
+		}
+		amounts, err := money.SplitEvenly(remaining, len(splits))
+		if err != nil {
+			return nil, err
+		}
+		weights := make([]int64, len(splits))
 		for i := range splits {
-			splits[i].Percentage = splits[i].Amount / totalAmount * 100.0
+			splits[i].Amount = amounts[i] + splits[i].Adjustment
+			if splits[i].Amount < 0 {
+				return nil, errors.New("調整後的分帳金額不能為負數")
+			}
+			weights[i] = int64(splits[i].Amount)
+		}
+		basisPoints, err := money.Allocate(fullPercentage, weights)
+		if err != nil {
+			return nil, err
+		}
+		percentages := basisPointsToPercentages(basisPoints)
+		for i := range splits {
+			splits[i].Percentage = percentages[i]
 		}
 
+	case models.SplitItemized:
+		return nil, errors.New("明細分帳需要提供明細項目")
+
 	default:
 		return nil, errors.New("無效的分帳類型")
 	}
@@ -561,7 +1561,7 @@ func (h *TransactionHandler) calculateSplits(splitType models.SplitType, totalAm
 }
 
 // createSplitRecords 創建分帳記錄
-func (h *TransactionHandler) createSplitRecords(tx *gorm.DB, transactionID uint, splitType models.SplitType, splits []models.TransactionSplitRequest) error {
+func (h *TransactionHandler) createSplitRecords(tx *gorm.DB, transactionID uint, splitType models.SplitType, splits []SplitCalculation) error {
 	var splitRecords []models.TransactionSplit
 	for _, split := range splits {
 		splitRecords = append(splitRecords, models.TransactionSplit{
@@ -569,6 +1569,8 @@ func (h *TransactionHandler) createSplitRecords(tx *gorm.DB, transactionID uint,
 			UserID:        split.UserID,
 			Amount:        split.Amount,
 			Percentage:    split.Percentage,
+			Shares:        split.Shares,
+			Adjustment:    split.Adjustment,
 			SplitType:     splitType,
 		})
 	}
@@ -576,15 +1578,518 @@ func (h *TransactionHandler) createSplitRecords(tx *gorm.DB, transactionID uint,
 	return tx.Create(&splitRecords).Error
 }
 
+// buildTransactionItems 將明細請求轉換為明細模型
+func buildTransactionItems(reqItems []models.TransactionItemRequest, currency string) ([]models.TransactionItem, error) {
+	items := make([]models.TransactionItem, len(reqItems))
+	for i, reqItem := range reqItems {
+		if reqItem.Name == "" {
+			return nil, errors.New("明細名稱不能為空")
+		}
+
+		kind := reqItem.Kind
+		if kind == "" {
+			kind = models.ItemKindItem
+		}
+		switch kind {
+		case models.ItemKindItem, models.ItemKindTax, models.ItemKindServiceCharge, models.ItemKindTip:
+		default:
+			return nil, errors.New("無效的明細類型")
+		}
+
+		quantity := reqItem.Quantity
+		if quantity == 0 {
+			quantity = 1
+		}
+		if quantity < 0 {
+			return nil, errors.New("明細數量必須大於 0")
+		}
+
+		unitPrice, err := reqItem.UnitPrice.Amount(currency)
+		if err != nil {
+			return nil, err
+		}
+		if unitPrice <= 0 {
+			return nil, errors.New("明細單價必須大於 0")
+		}
+
+		// 一般品項需要消費者，稅金/服務費/小費依品項小計分攤
+		var consumers []models.User
+		seen := make(map[uint]bool)
+		for _, consumerID := range reqItem.ConsumerIDs {
+			if !seen[consumerID] {
+				seen[consumerID] = true
+				consumers = append(consumers, models.User{ID: consumerID})
+			}
+		}
+		if kind == models.ItemKindItem && len(consumers) == 0 {
+			return nil, errors.New("每個明細品項至少需要一位消費者")
+		}
+		if kind != models.ItemKindItem && len(consumers) > 0 {
+			return nil, errors.New("稅金、服務費與小費不需指定消費者")
+		}
+
+		items[i] = models.TransactionItem{
+			Name:      reqItem.Name,
+			Kind:      kind,
+			Quantity:  quantity,
+			UnitPrice: unitPrice,
+			Consumers: consumers,
+		}
+	}
+
+	return items, nil
+}
+
+// calculateItemizedSplits 依明細項目計算分帳
+// 品項由其消費者平均分攤，稅金/服務費/小費依各人品項小計比例分攤
+func (h *TransactionHandler) calculateItemizedSplits(items []models.TransactionItem) ([]SplitCalculation, money.Amount, error) {
+	var userOrder []uint
+	subtotals := make(map[uint]money.Amount)
+	var itemsTotal, chargesTotal money.Amount
+
+	for _, item := range items {
+		if item.Kind != models.ItemKindItem {
+			chargesTotal += item.Total()
+			continue
+		}
+
+		shares, err := money.SplitEvenly(item.Total(), len(item.Consumers))
+		if err != nil {
+			return nil, 0, err
+		}
+		for i, consumer := range item.Consumers {
+			if _, exists := subtotals[consumer.ID]; !exists {
+				userOrder = append(userOrder, consumer.ID)
+			}
+			subtotals[consumer.ID] += shares[i]
+		}
+		itemsTotal += item.Total()
+	}
+
+	if itemsTotal <= 0 {
+		return nil, 0, errors.New("明細至少需要一個品項")
+	}
+
+	splits := make([]SplitCalculation, len(userOrder))
+	weights := make([]int64, len(userOrder))
+	for i, userID := range userOrder {
+		splits[i] = SplitCalculation{UserID: userID, Amount: subtotals[userID]}
+		weights[i] = int64(subtotals[userID])
+	}
+
+	// 稅金/服務費/小費逐項依小計比例分攤
+	for _, item := range items {
+		if item.Kind == models.ItemKindItem {
+			continue
+		}
+		shares, err := money.Allocate(item.Total(), weights)
+		if err != nil {
+			return nil, 0, err
+		}
+		for i := range splits {
+			splits[i].Amount += shares[i]
+		}
+	}
+
+	amountWeights := make([]int64, len(splits))
+	for i, split := range splits {
+		amountWeights[i] = int64(split.Amount)
+	}
+	basisPoints, err := money.Allocate(money.Amount(100*percentageScale), amountWeights)
+	if err != nil {
+		return nil, 0, err
+	}
+	percentages := basisPointsToPercentages(basisPoints)
+	for i := range splits {
+		splits[i].Percentage = percentages[i]
+	}
+
+	return splits, itemsTotal + chargesTotal, nil
+}
+
+// prepareItemizedSplits 轉換明細並計算分帳，若有提供金額則必須等於明細總額
+func (h *TransactionHandler) prepareItemizedSplits(reqItems []models.TransactionItemRequest, currency string, amount money.Amount) ([]models.TransactionItem, []SplitCalculation, money.Amount, error) {
+	items, err := buildTransactionItems(reqItems, currency)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	splits, total, err := h.calculateItemizedSplits(items)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	if amount > 0 && amount != total {
+		return nil, nil, 0, errors.New("明細總額必須等於交易金額")
+	}
+
+	return items, splits, total, nil
+}
+
+// createItemRecords 創建明細記錄（僅建立消費者關聯，不更新用戶資料）
+func (h *TransactionHandler) createItemRecords(tx *gorm.DB, transactionID uint, items []models.TransactionItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	for i := range items {
+		items[i].TransactionID = transactionID
+	}
+
+	return tx.Omit("Consumers.*").Create(&items).Error
+}
+
+// deleteItemRecords 刪除交易的所有明細與消費者關聯
+func (h *TransactionHandler) deleteItemRecords(tx *gorm.DB, transactionID uint) error {
+	itemIDs := tx.Model(&models.TransactionItem{}).Select("id").Where("transaction_id = ?", transactionID)
+	if err := tx.Exec("DELETE FROM transaction_item_consumers WHERE transaction_item_id IN (?)", itemIDs).Error; err != nil {
+		return errors.New("刪除明細消費者失敗")
+	}
+
+	if err := tx.Where("transaction_id = ?", transactionID).Delete(&models.TransactionItem{}).Error; err != nil {
+		return errors.New("刪除舊明細記錄失敗")
+	}
+
+	return nil
+}
+
+// updateItems 以新的明細取代原有明細，並重新推導分帳與交易金額
+func (h *TransactionHandler) updateItems(tx *gorm.DB, transactionID uint, existingTransaction *models.Transaction, reqItems []models.TransactionItemRequest, amount money.Amount, currency string) error {
+	// 驗證消費者都是群組成員
+	var consumerIDs []uint
+	for _, item := range reqItems {
+		consumerIDs = append(consumerIDs, item.ConsumerIDs...)
+	}
+	if err := h.validationService.ValidateMultipleGroupMembers(existingTransaction.GroupID, consumerIDs); err != nil {
+		return err
+	}
+
+	items, splits, total, err := h.prepareItemizedSplits(reqItems, currency, amount)
+	if err != nil {
+		return err
+	}
+
+	if err := h.deleteItemRecords(tx, transactionID); err != nil {
+		return err
+	}
+	if err := h.createItemRecords(tx, transactionID, items); err != nil {
+		return errors.New("創建新明細記錄失敗")
+	}
+
+	if err := tx.Where("transaction_id = ?", transactionID).Delete(&models.TransactionSplit{}).Error; err != nil {
+		return errors.New("刪除舊分帳記錄失敗")
+	}
+	if err := h.createSplitRecords(tx, transactionID, models.SplitItemized, splits); err != nil {
+		return errors.New("創建新分帳記錄失敗")
+	}
+
+	if err := tx.Model(&models.Transaction{}).Where("id = ?", transactionID).Update("amount", total).Error; err != nil {
+		return errors.New("更新交易金額失敗")
+	}
+
+	return nil
+}
+
+// paymentUserIDs 取得付款明細中的所有付款者 ID
+func paymentUserIDs(payments []models.TransactionPaymentRequest) []uint {
+	userIDs := make([]uint, len(payments))
+	for i, payment := range payments {
+		userIDs[i] = payment.UserID
+	}
+	return userIDs
+}
+
+// resolvePayments 解析付款明細並決定主要付款者
+// 未提供付款明細時由 paidBy 支付全額；提供時總和必須等於交易金額
+func resolvePayments(reqPayments []models.TransactionPaymentRequest, paidBy uint, amount money.Amount, currency string) ([]models.TransactionPayment, uint, error) {
+	if len(reqPayments) == 0 {
+		if paidBy == 0 {
+			return nil, 0, errors.New("必須指定付款者")
+		}
+		return []models.TransactionPayment{{UserID: paidBy, Amount: amount}}, paidBy, nil
+	}
+
+	payments := make([]models.TransactionPayment, len(reqPayments))
+	seen := make(map[uint]bool)
+	var total money.Amount
+	for i, reqPayment := range reqPayments {
+		if seen[reqPayment.UserID] {
+			return nil, 0, errors.New("付款者不能重複")
+		}
+		seen[reqPayment.UserID] = true
+
+		paymentAmount, err := reqPayment.Amount.Amount(currency)
+		if err != nil {
+			return nil, 0, err
+		}
+		if paymentAmount <= 0 {
+			return nil, 0, errors.New("付款金額必須大於 0")
+		}
+
+		payments[i] = models.TransactionPayment{UserID: reqPayment.UserID, Amount: paymentAmount}
+		total += paymentAmount
+	}
+
+	if total != amount {
+		return nil, 0, errors.New("付款金額總和必須等於交易金額")
+	}
+
+	// 主要付款者預設為第一位付款者
+	if paidBy == 0 {
+		return payments, payments[0].UserID, nil
+	}
+	if !seen[paidBy] {
+		return nil, 0, errors.New("主要付款者必須是付款者之一")
+	}
+
+	return payments, paidBy, nil
+}
+
+// createPaymentRecords 創建付款記錄
+func (h *TransactionHandler) createPaymentRecords(tx *gorm.DB, transactionID uint, payments []models.TransactionPayment) error {
+	for i := range payments {
+		payments[i].TransactionID = transactionID
+	}
+
+	return tx.Create(&payments).Error
+}
+
+// replacePaymentRecords 以新的付款明細取代原有付款記錄
+func (h *TransactionHandler) replacePaymentRecords(tx *gorm.DB, transactionID uint, payments []models.TransactionPayment, paidBy uint) error {
+	if err := tx.Where("transaction_id = ?", transactionID).Delete(&models.TransactionPayment{}).Error; err != nil {
+		return errors.New("刪除舊付款記錄失敗")
+	}
+
+	if err := h.createPaymentRecords(tx, transactionID, payments); err != nil {
+		return errors.New("創建新付款記錄失敗")
+	}
+
+	if err := tx.Model(&models.Transaction{}).Where("id = ?", transactionID).Update("paid_by", paidBy).Error; err != nil {
+		return errors.New("更新付款者失敗")
+	}
+
+	return nil
+}
+
+// updatePayments 更新付款明細
+// 提供付款明細時直接取代；否則在付款者或金額變更時改為單一付款者支付全額
+func (h *TransactionHandler) updatePayments(tx *gorm.DB, transactionID uint, existingTransaction *models.Transaction, req models.UpdateTransactionRequest, currency string) error {
+	// 取得更新後的交易金額（明細模式可能重新推導金額）
+	amount, err := loadTransactionAmount(tx, transactionID)
+	if err != nil {
+		return err
+	}
+
+	if len(req.Payments) > 0 {
+		payerIDs := paymentUserIDs(req.Payments)
+		if err := h.validationService.ValidateMultipleGroupMembers(existingTransaction.GroupID, payerIDs); err != nil {
+			return err
+		}
+
+		payments, paidBy, err := resolvePayments(req.Payments, req.PaidBy, amount, currency)
+		if err != nil {
+			return err
+		}
+
+		return h.replacePaymentRecords(tx, transactionID, payments, paidBy)
+	}
+
+	if req.PaidBy == 0 && amount == existingTransaction.Amount {
+		return nil
+	}
+
+	// 多人付款的交易只變更金額時無法推斷各付款者的金額
+	if req.PaidBy == 0 && len(existingTransaction.Payments) > 1 {
+		return errors.New("多人付款的交易變更金額時需同時提供付款明細")
+	}
+
+	paidBy := existingTransaction.PaidBy
+	if req.PaidBy > 0 {
+		paidBy = req.PaidBy
+	}
+
+	payments := []models.TransactionPayment{{UserID: paidBy, Amount: amount}}
+	return h.replacePaymentRecords(tx, transactionID, payments, paidBy)
+}
+
+// rescaleAmount 將金額的數值保持不變，改以另一個幣別的最小貨幣單位表示（例如 TWD 5.00 => JPY 5）
+func rescaleAmount(amount money.Amount, from, to string) (money.Amount, error) {
+	if from == to || amount == 0 {
+		return amount, nil
+	}
+	rescaled, err := money.Parse(amount.String(from), to)
+	if err != nil {
+		return 0, errors.New("原有的分帳金額無法以新幣別的精度表示，請重新提供分帳")
+	}
+	return rescaled, nil
+}
+
+// loadTransactionAmount 取得交易目前的金額
+func loadTransactionAmount(tx *gorm.DB, transactionID uint) (money.Amount, error) {
+	var amount money.Amount
+	if err := tx.Model(&models.Transaction{}).Select("amount").
+		Where("id = ?", transactionID).Scan(&amount).Error; err != nil {
+		return 0, errors.New("查詢交易金額失敗")
+	}
+	return amount, nil
+}
+
+// loadGroupBaseCurrency 取得群組基準幣別
+func loadGroupBaseCurrency(db *gorm.DB, groupID uint) (string, error) {
+	var group models.Group
+	if err := db.Select("id", "base_currency").First(&group, groupID).Error; err != nil {
+		return "", errors.New("查詢群組基準幣別失敗")
+	}
+	if group.BaseCurrency == "" {
+		return money.DefaultCurrency, nil
+	}
+	return group.BaseCurrency, nil
+}
+
+// parseTransactionFilter 解析交易列表的篩選與排序參數
+// 未指定 currency 時金額範圍與排序以 baseCurrency 的基準幣別金額比較，baseCurrency 為空時必須指定 currency
+func parseTransactionFilter(c *fiber.Ctx, baseCurrency string) (services.TransactionFilter, error) {
+	var filter services.TransactionFilter
+
+	// 日期範圍（以伺服器時區的日期計算，to 包含當天）
+	parseDate := func(key string) (*time.Time, error) {
+		value := c.Query(key)
+		if value == "" {
+			return nil, nil
+		}
+		date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return nil, errors.New("無效的日期格式，請使用 YYYY-MM-DD")
+		}
+		return &date, nil
+	}
+	from, err := parseDate("from")
+	if err != nil {
+		return filter, err
+	}
+	to, err := parseDate("to")
+	if err != nil {
+		return filter, err
+	}
+	if from != nil && to != nil && from.After(*to) {
+		return filter, errors.New("開始日期不可晚於結束日期")
+	}
+	filter.From = from
+	if to != nil {
+		until := to.AddDate(0, 0, 1)
+		filter.Until = &until
+	}
+
+	if categoryID := c.QueryInt("category_id"); categoryID > 0 {
+		filter.CategoryID = uint(categoryID)
+	}
+	if payerID := c.QueryInt("paid_by"); payerID > 0 {
+		filter.PayerID = uint(payerID)
+	}
+	if participantID := c.QueryInt("participant_id"); participantID > 0 {
+		filter.ParticipantID = uint(participantID)
+	}
+
+	// 幣別與金額範圍
+	amountCurrency := baseCurrency
+	if currencyParam := c.Query("currency"); currencyParam != "" {
+		currency, err := money.NormalizeCurrency(currencyParam)
+		if err != nil {
+			return filter, err
+		}
+		filter.Currency = currency
+		amountCurrency = currency
+	}
+	parseAmount := func(key string) (*money.Amount, error) {
+		value := c.Query(key)
+		if value == "" {
+			return nil, nil
+		}
+		if amountCurrency == "" {
+			return nil, errors.New("依金額篩選時必須指定 currency")
+		}
+		amount, err := money.Parse(value, amountCurrency)
+		if err != nil {
+			return nil, err
+		}
+		return &amount, nil
+	}
+	if filter.MinAmount, err = parseAmount("min_amount"); err != nil {
+		return filter, err
+	}
+	if filter.MaxAmount, err = parseAmount("max_amount"); err != nil {
+		return filter, err
+	}
+	if filter.MinAmount != nil && filter.MaxAmount != nil && *filter.MinAmount > *filter.MaxAmount {
+		return filter, errors.New("最低金額不可大於最高金額")
+	}
+
+	filter.Search = c.Query("q")
+
+	// 排序
+	if filter.Sort, filter.Descending, err = services.ParseTransactionSort(c.Query("sort"), c.Query("order")); err != nil {
+		return filter, err
+	}
+	if filter.Sort == services.TransactionSortAmount && amountCurrency == "" {
+		return filter, errors.New("依金額排序時必須指定 currency")
+	}
+
+	return filter, nil
+}
+
+// convertToBase 鎖定匯率並將金額換算為群組基準幣別
+// 未提供匯率時使用匯率資料中指定日期的匯率
+func convertToBase(exchangeRates *services.ExchangeRateService, currency, baseCurrency string, requestedRate float64, amount money.Amount, date time.Time) (float64, money.Amount, error) {
+	rate, err := exchangeRates.RateFor(currency, baseCurrency, requestedRate, date)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return rate, money.Convert(amount, currency, baseCurrency, rate), nil
+}
+
+// updateBaseAmount 依更新後的金額與幣別重新換算基準幣別金額
+// 未變更幣別且未提供匯率時沿用建立時鎖定的匯率
+func (h *TransactionHandler) updateBaseAmount(tx *gorm.DB, transactionID uint, existingTransaction *models.Transaction, req models.UpdateTransactionRequest, currency string) error {
+	amount, err := loadTransactionAmount(tx, transactionID)
+	if err != nil {
+		return err
+	}
+
+	requestedRate := existingTransaction.ExchangeRate
+	if !strings.EqualFold(currency, existingTransaction.Currency) || req.ExchangeRate != 0 {
+		requestedRate = req.ExchangeRate
+	}
+
+	baseCurrency, err := loadGroupBaseCurrency(tx, existingTransaction.GroupID)
+	if err != nil {
+		return err
+	}
+
+	exchangeRate, baseAmount, err := convertToBase(h.exchangeRateService, currency, baseCurrency, requestedRate, amount, existingTransaction.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Model(&models.Transaction{}).Where("id = ?", transactionID).Updates(map[string]interface{}{
+		"exchange_rate": exchangeRate,
+		"base_amount":   baseAmount,
+	}).Error; err != nil {
+		return errors.New("更新基準幣別金額失敗")
+	}
+
+	return nil
+}
+
 // updateBasicFields 更新交易基本欄位
-func (h *TransactionHandler) updateBasicFields(tx *gorm.DB, existingTransaction *models.Transaction, req models.UpdateTransactionRequest) error {
+func (h *TransactionHandler) updateBasicFields(tx *gorm.DB, existingTransaction *models.Transaction, req models.UpdateTransactionRequest, amount money.Amount) error {
 	updateData := make(map[string]interface{})
 
 	if req.Description != "" {
 		updateData["description"] = req.Description
 	}
-	if req.Amount > 0 {
-		updateData["amount"] = req.Amount
+	if amount > 0 {
+		updateData["amount"] = amount
 	}
 	if req.Currency != "" {
 		updateData["currency"] = req.Currency
@@ -606,8 +2111,10 @@ func (h *TransactionHandler) updateBasicFields(tx *gorm.DB, existingTransaction
 		updateData["notes"] = req.Notes
 	}
 
+	// 不回寫 existingTransaction，後續步驟需要比對原本的金額與幣別
 	if len(updateData) > 0 {
-		if err := tx.Model(existingTransaction).Updates(updateData).Error; err != nil {
+		if err := tx.Model(&models.Transaction{}).Where("id = ?", existingTransaction.ID).
+			Updates(updateData).Error; err != nil {
 			return errors.New("更新交易基本資訊失敗")
 		}
 	}
@@ -616,63 +2123,67 @@ func (h *TransactionHandler) updateBasicFields(tx *gorm.DB, existingTransaction
 }
 
 // updateSplits 更新分帳記錄
-func (h *TransactionHandler) updateSplits(tx *gorm.DB, transactionID uint, existingTransaction *models.Transaction, req models.UpdateTransactionRequest) error {
+func (h *TransactionHandler) updateSplits(tx *gorm.DB, transactionID uint, existingTransaction *models.Transaction, req models.UpdateTransactionRequest, amount money.Amount, currency string) error {
 	// 確定使用的分帳類型和金額
 	splitType := req.SplitType
 	if splitType == "" {
 		splitType = existingTransaction.Splits[0].SplitType
 	}
 
-	amount := req.Amount
 	if amount == 0 {
 		amount = existingTransaction.Amount
 	}
 
 	// 準備分帳資料
-	var splitsToCalculate []models.TransactionSplitRequest
+	var calculations []SplitCalculation
 	if len(req.Splits) > 0 {
-		splitsToCalculate = req.Splits
-
 		// 驗證分帳用戶
 		var splitUserIDs []uint
-		for _, split := range splitsToCalculate {
+		for _, split := range req.Splits {
 			splitUserIDs = append(splitUserIDs, split.UserID)
 		}
 
 		if err := h.validationService.ValidateMultipleGroupMembers(existingTransaction.GroupID, splitUserIDs); err != nil {
 			return err
 		}
+
+		var err error
+		calculations, err = toSplitCalculations(req.Splits, currency)
+		if err != nil {
+			return err
+		}
 	} else {
-		// 保持現有的分帳用戶
+		// 保持現有的分帳用戶，變更幣別時將原有的固定金額與調整金額換算為新幣別的最小貨幣單位
 		for _, existingSplit := range existingTransaction.Splits {
-			splitsToCalculate = append(splitsToCalculate, models.TransactionSplitRequest{
+			splitAmount, err := rescaleAmount(existingSplit.Amount, existingTransaction.Currency, currency)
+			if err != nil {
+				return err
+			}
+			adjustment, err := rescaleAmount(existingSplit.Adjustment, existingTransaction.Currency, currency)
+			if err != nil {
+				return err
+			}
+			calculations = append(calculations, SplitCalculation{
 				UserID:     existingSplit.UserID,
-				Amount:     existingSplit.Amount,
+				Amount:     splitAmount,
 				Percentage: existingSplit.Percentage,
+				Shares:     existingSplit.Shares,
+				Adjustment: adjustment,
 			})
 		}
 	}
 
 	// 重新計算分帳
-	// 轉換為通用結構
-	calculations := make([]SplitCalculation, len(splitsToCalculate))
-	for i, split := range splitsToCalculate {
-		calculations[i] = SplitCalculation{
-			UserID:     split.UserID,
-			Amount:     split.Amount,
-			Percentage: split.Percentage,
-		}
-	}
-
 	calculated, err := h.calculateSplits(splitType, amount, calculations)
 	if err != nil {
 		return err
 	}
 
-	// 轉換回原始結構
-	for i, calc := range calculated {
-		splitsToCalculate[i].Amount = calc.Amount
-		splitsToCalculate[i].Percentage = calc.Percentage
+	// 改為非明細分帳時移除原有明細
+	if len(existingTransaction.Items) > 0 {
+		if err := h.deleteItemRecords(tx, transactionID); err != nil {
+			return err
+		}
 	}
 
 	// 刪除舊的分帳記錄
@@ -681,18 +2192,7 @@ func (h *TransactionHandler) updateSplits(tx *gorm.DB, transactionID uint, exist
 	}
 
 	// 創建新的分帳記錄
-	var newSplits []models.TransactionSplit
-	for _, split := range splitsToCalculate {
-		newSplits = append(newSplits, models.TransactionSplit{
-			TransactionID: transactionID,
-			UserID:        split.UserID,
-			Amount:        split.Amount,
-			Percentage:    split.Percentage,
-			SplitType:     splitType,
-		})
-	}
-
-	if err := tx.Create(&newSplits).Error; err != nil {
+	if err := h.createSplitRecords(tx, transactionID, splitType, calculated); err != nil {
 		return errors.New("創建新分帳記錄失敗")
 	}
 
@@ -1,20 +1,30 @@
 package handlers
 
 import (
+	"time"
+
 	"split-go/internal/middleware"
 	"split-go/internal/models"
+	"split-go/internal/money"
 	"split-go/internal/responses"
+	"split-go/internal/services"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
 
 type UserHandler struct {
-	db *gorm.DB
+	db                  *gorm.DB
+	balanceService      *services.BalanceService
+	exchangeRateService *services.ExchangeRateService
 }
 
 func NewUserHandler(db *gorm.DB) *UserHandler {
-	return &UserHandler{db: db}
+	return &UserHandler{
+		db:                  db,
+		balanceService:      services.NewBalanceService(db),
+		exchangeRateService: services.NewExchangeRateService(db),
+	}
 }
 
 // GetProfile 獲取用戶資料
@@ -157,3 +167,66 @@ func (h *UserHandler) UpdateFCMToken(c *fiber.Ctx) error {
 		responses.SuccessWithMessageResponse("FCM Token 更新成功", nil),
 	)
 }
+
+// GetBalances 獲取用戶跨群組的平衡摘要
+// @Summary 獲取跨群組平衡摘要
+// @Description 彙整當前用戶所屬所有群組的平衡、與每位用戶之間的債務及待付款結算；提供 currency 時以最新匯率換算總額
+// @Tags 用戶
+// @Produce json
+// @Security BearerAuth
+// @Param currency query string false "換算總額的幣別 (ISO 4217)"
+// @Success 200 {object} object{error=bool,data=object{groups=[]object{group=object{id=int,name=string},currency=string,balance=number,paid=number,owed=number},counterparties=[]object{user_id=int,currency=string,amount=number},totals=[]object{currency=string,balance=number},converted_total=object{currency=string,balance=number},pending_settlements=[]object{id=int,direction=string}}} "跨群組平衡摘要"
+// @Failure 400 {object} object{error=bool,message=string} "不支援的幣別或找不到匯率"
+// @Failure 401 {object} object{error=bool,message=string} "未授權"
+// @Failure 500 {object} object{error=bool,message=string} "服務器內部錯誤"
+// @Router /users/me/balances [get]
+func (h *UserHandler) GetBalances(c *fiber.Ctx) error {
+	// 1. 驗證用戶身份
+	userID, err := middleware.GetCurrentUserID(c)
+	if err != nil {
+		return err
+	}
+
+	// 2. 解析換算幣別
+	targetCurrency := c.Query("currency")
+	if targetCurrency != "" {
+		targetCurrency, err = money.NormalizeCurrency(targetCurrency)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(
+				responses.ErrorResponse(err.Error()),
+			)
+		}
+	}
+
+	// 3. 彙整所有群組的平衡
+	summary, err := h.balanceService.SummarizeUserBalances(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(
+			responses.ErrorResponse("計算平衡摘要失敗"),
+		)
+	}
+
+	response := responses.NewUserBalanceSummaryResponse(*summary, userID)
+
+	// 4. 以最新匯率將各幣別總額換算為指定幣別
+	if targetCurrency != "" {
+		var converted money.Amount
+		for _, total := range summary.Totals {
+			rate, err := h.exchangeRateService.RateFor(total.Currency, targetCurrency, 0, time.Now())
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(
+					responses.ErrorResponse(err.Error()),
+				)
+			}
+			converted += money.Convert(total.Balance, total.Currency, targetCurrency, rate)
+		}
+
+		convertedTotal := responses.NewCurrencyBalanceResponse(models.CurrencyBalance{
+			Currency: targetCurrency,
+			Balance:  converted,
+		})
+		response.ConvertedTotal = &convertedTotal
+	}
+
+	return c.JSON(responses.SuccessResponse(response))
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"strconv"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -21,6 +22,21 @@ func ParseSettlementIDFromParams(c *fiber.Ctx) (uint, error) {
 	return uint(id), nil
 }
 
+// ParseRecurringIDFromParams 從 URL 參數中安全地解析定期交易 ID
+func ParseRecurringIDFromParams(c *fiber.Ctx) (uint, error) {
+	idStr := c.Params("recurringId")
+	if idStr == "" {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "缺少定期交易 ID")
+	}
+
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "無效的定期交易 ID")
+	}
+
+	return uint(id), nil
+}
+
 // ParseUserIDFromParams 從 URL 參數中安全地解析用戶 ID
 func ParseUserIDFromParams(c *fiber.Ctx) (uint, error) {
 	idStr := c.Params("userId") // 注意這裡是 userId 不是 id
@@ -35,3 +51,43 @@ func ParseUserIDFromParams(c *fiber.Ctx) (uint, error) {
 
 	return uint(id), nil
 }
+
+// ParsePaymentIDFromParams 從 URL 參數中安全地解析結算付款 ID
+func ParsePaymentIDFromParams(c *fiber.Ctx) (uint, error) {
+	idStr := c.Params("paymentId")
+	if idStr == "" {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "缺少付款 ID")
+	}
+
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "無效的付款 ID")
+	}
+
+	return uint(id), nil
+}
+
+// SetETag 以資源版本設定 ETag 標頭
+func SetETag(c *fiber.Ctx, version uint) {
+	c.Set(fiber.HeaderETag, strconv.Quote(strconv.FormatUint(uint64(version), 10)))
+}
+
+// RequireVersion 取得客戶端修改時所依據的版本
+// 優先使用 If-Match 標頭（GET 回傳的 ETag），未提供時使用請求內容中的 version 欄位
+func RequireVersion(c *fiber.Ctx, bodyVersion uint) (uint, error) {
+	ifMatch := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if ifMatch == "" {
+		if bodyVersion == 0 {
+			return 0, fiber.NewError(fiber.StatusPreconditionRequired, "請提供 If-Match 標頭或 version 欄位")
+		}
+		return bodyVersion, nil
+	}
+
+	tag := strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`)
+	version, err := strconv.ParseUint(tag, 10, 32)
+	if err != nil || version == 0 {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "無效的 If-Match 標頭")
+	}
+
+	return uint(version), nil
+}
@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"split-go/internal/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	// HeaderIdempotencyKey 客戶端為每個建立請求產生的唯一值，重試時沿用
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed 回應為先前保存的結果時設定為 true
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+)
+
+// idempotencyProcessingTimeout 處理中的記錄超過此時間仍未完成時視為已放棄，讓重試可以重新執行
+const idempotencyProcessingTimeout = time.Minute
+
+// idempotentResponseHeaders 與回應一起保存、重送時還原的標頭
+var idempotentResponseHeaders = []string{fiber.HeaderContentType, fiber.HeaderETag, fiber.HeaderLocation}
+
+// Idempotency 支援 Idempotency-Key 標頭的中介軟體（需在 JWT 驗證之後使用）
+// 同一用戶以相同的 key 重送相同的請求時直接回傳原本的回應；key 用於不同的請求時回傳 422
+// 只保存成功的回應，失敗的請求會釋放 key，客戶端可以用相同的 key 重試
+func Idempotency(db *gorm.DB, ttl time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := strings.TrimSpace(c.Get(HeaderIdempotencyKey))
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > 255 {
+			return fiber.NewError(fiber.StatusBadRequest, "Idempotency-Key 長度不能超過 255 個字元")
+		}
+
+		userID, err := GetCurrentUserID(c)
+		if err != nil {
+			return err
+		}
+		requestHash := hashRequest(c)
+
+		// 1. 已有相同 key 的記錄時回傳原本的結果
+		record, err := findIdempotencyKey(db, userID, key, ttl)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "查詢 Idempotency-Key 失敗")
+		}
+		if record != nil {
+			return replayIdempotentRequest(c, *record, requestHash)
+		}
+
+		// 2. 先建立處理中的記錄，唯一索引確保同時送出的重試只有一個會執行
+		record = &models.IdempotencyKey{
+			UserID:      userID,
+			Key:         key,
+			RequestHash: requestHash,
+		}
+		if err := db.Create(record).Error; err != nil {
+			if isDuplicateKey(db, err) {
+				return fiber.NewError(fiber.StatusConflict, "相同 Idempotency-Key 的請求仍在處理中")
+			}
+			return fiber.NewError(fiber.StatusInternalServerError, "保存 Idempotency-Key 失敗")
+		}
+
+		// 3. 執行請求，成功時保存回應，否則釋放 key
+		if err := c.Next(); err != nil {
+			db.Delete(record)
+			return err
+		}
+		status := c.Response().StatusCode()
+		if status < 200 || status >= 300 {
+			return db.Delete(record).Error
+		}
+
+		headers := make(map[string]string)
+		for _, name := range idempotentResponseHeaders {
+			if value := c.GetRespHeader(name); value != "" {
+				headers[name] = value
+			}
+		}
+		encodedHeaders, err := json.Marshal(headers)
+		if err != nil {
+			return err
+		}
+
+		// 請求已經成功，保存回應失敗時只記錄錯誤，不改變回傳給客戶端的結果
+		body := append([]byte(nil), c.Response().Body()...)
+		if err := db.Model(record).Updates(map[string]interface{}{
+			"status_code":      status,
+			"response_body":    body,
+			"response_headers": encodedHeaders,
+		}).Error; err != nil {
+			log.Printf("保存 Idempotency-Key %d 的回應失敗: %v", record.ID, err)
+		}
+		return nil
+	}
+}
+
+// findIdempotencyKey 查詢用戶的 key，已過期或已放棄的記錄會刪除並視為不存在
+func findIdempotencyKey(db *gorm.DB, userID uint, key string, ttl time.Duration) (*models.IdempotencyKey, error) {
+	var record models.IdempotencyKey
+	err := db.Where("user_id = ? AND idempotency_key = ?", userID, key).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if record.Expired(ttl, now) || record.Abandoned(idempotencyProcessingTimeout, now) {
+		if err := db.Delete(&record).Error; err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return &record, nil
+}
+
+// replayIdempotentRequest 回傳保存的回應；請求內容不同時回傳 422
+func replayIdempotentRequest(c *fiber.Ctx, record models.IdempotencyKey, requestHash string) error {
+	if record.RequestHash != requestHash {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "Idempotency-Key 已用於不同的請求")
+	}
+	if !record.Completed() {
+		return fiber.NewError(fiber.StatusConflict, "相同 Idempotency-Key 的請求仍在處理中")
+	}
+
+	headers, err := record.Headers()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "讀取保存的回應失敗")
+	}
+	if headers[fiber.HeaderContentType] == "" {
+		headers[fiber.HeaderContentType] = fiber.MIMEApplicationJSON
+	}
+	for name, value := range headers {
+		c.Set(name, value)
+	}
+	c.Set(HeaderIdempotentReplayed, "true")
+	return c.Status(record.StatusCode).Send(record.ResponseBody)
+}
+
+// isDuplicateKey 是否為唯一索引衝突（依資料庫驅動轉換錯誤）
+func isDuplicateKey(db *gorm.DB, err error) bool {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	if translator, ok := db.Dialector.(gorm.ErrorTranslator); ok {
+		return errors.Is(translator.Translate(err), gorm.ErrDuplicatedKey)
+	}
+	return false
+}
+
+// hashRequest 以方法、路徑與請求內容計算雜湊，用來判斷重送的是否為相同請求
+func hashRequest(c *fiber.Ctx) string {
+	hash := sha256.New()
+	hash.Write([]byte(c.Method()))
+	hash.Write([]byte{0})
+	hash.Write([]byte(c.Path()))
+	hash.Write([]byte{0})
+	hash.Write(c.Body())
+	return hex.EncodeToString(hash.Sum(nil))
+}
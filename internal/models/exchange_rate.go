@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// ExchangeRate 匯率記錄，表示 1 單位 Base 幣別可兌換 Rate 單位 Quote 幣別
+type ExchangeRate struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Date      time.Time `json:"date" gorm:"type:date;not null;uniqueIndex:idx_exchange_rates_date_pair"`
+	Base      string    `json:"base" gorm:"size:3;not null;uniqueIndex:idx_exchange_rates_date_pair"`
+	Quote     string    `json:"quote" gorm:"size:3;not null;uniqueIndex:idx_exchange_rates_date_pair"`
+	Rate      float64   `json:"rate" gorm:"not null"`
+	Source    string    `json:"source"` // 匯率來源，例如 ecb、csv
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -8,15 +8,17 @@ import (
 
 // Group 群組模型
 type Group struct {
-	ID          uint           `json:"id" gorm:"primaryKey"`
-	Name        string         `json:"name" gorm:"not null"`
-	Description string         `json:"description"`
-	CreatedBy   uint           `json:"created_by"`
-	Creator     User           `json:"creator" gorm:"foreignKey:CreatedBy"`
-	Members     []User         `json:"members" gorm:"many2many:group_members;"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	ID           uint           `json:"id" gorm:"primaryKey"`
+	Name         string         `json:"name" gorm:"not null"`
+	Description  string         `json:"description"`
+	BaseCurrency string         `json:"base_currency" gorm:"default:'TWD'"` // 群組基準幣別，平衡與結算建議以此幣別計算
+	Version      uint           `json:"version" gorm:"not null;default:1"`  // 每次修改遞增，用於偵測同時編輯
+	CreatedBy    uint           `json:"created_by"`
+	Creator      User           `json:"creator" gorm:"foreignKey:CreatedBy"`
+	Members      []User         `json:"members" gorm:"many2many:group_members;"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
 // GroupMember 群組成員關聯表
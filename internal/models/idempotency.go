@@ -0,0 +1,47 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// IdempotencyKey 帶有 Idempotency-Key 標頭的建立請求，保存成功的回應讓重送的請求取得相同結果
+// key 以用戶為範圍，不同用戶可以使用相同的 key
+type IdempotencyKey struct {
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	UserID          uint           `json:"user_id" gorm:"not null;uniqueIndex:idx_idempotency_keys_user_key"`
+	Key             string         `json:"key" gorm:"column:idempotency_key;size:255;not null;uniqueIndex:idx_idempotency_keys_user_key"`
+	RequestHash     string         `json:"request_hash" gorm:"not null"` // 方法、路徑與請求內容的 SHA-256
+	StatusCode      int            `json:"status_code"`                  // 0 表示原本的請求仍在處理中
+	ResponseBody    []byte         `json:"-"`
+	ResponseHeaders datatypes.JSON `json:"-"` // 重送時需還原的回應標頭（Content-Type、ETag 等）
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+}
+
+// Completed 原本的請求是否已完成並保存回應
+func (k IdempotencyKey) Completed() bool {
+	return k.StatusCode != 0
+}
+
+// Expired 是否已超過保存期限，過期的 key 視為新的請求
+func (k IdempotencyKey) Expired(ttl time.Duration, now time.Time) bool {
+	return now.Sub(k.CreatedAt) > ttl
+}
+
+// Abandoned 原本的請求是否超過處理時限仍未完成（例如伺服器在處理途中停止），視為已放棄
+func (k IdempotencyKey) Abandoned(timeout time.Duration, now time.Time) bool {
+	return !k.Completed() && now.Sub(k.CreatedAt) > timeout
+}
+
+// Headers 取得保存的回應標頭
+func (k IdempotencyKey) Headers() (map[string]string, error) {
+	headers := make(map[string]string)
+	if len(k.ResponseHeaders) == 0 {
+		return headers, nil
+	}
+	err := json.Unmarshal(k.ResponseHeaders, &headers)
+	return headers, err
+}
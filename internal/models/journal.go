@@ -0,0 +1,112 @@
+package models
+
+import (
+	"split-go/internal/money"
+	"time"
+)
+
+// JournalSource 分錄的來源
+type JournalSource string
+
+const (
+	JournalSourceTransaction JournalSource = "transaction"
+	JournalSourceSettlement  JournalSource = "settlement"
+)
+
+// PostingKind 過帳的性質，用於區分平衡中的支付與應付金額
+type PostingKind string
+
+const (
+	PostingPayment    PostingKind = "payment"    // 交易付款者支付的金額（借方）
+	PostingShare      PostingKind = "share"      // 交易參與者應分攤的金額（貸方）
+	PostingSettlement PostingKind = "settlement" // 結算付款（付款者借方、收款者貸方）
+)
+
+// JournalEntry 複式記帳分錄
+// 交易與結算每次影響平衡時過帳一筆分錄，各幣別的借方與貸方金額必須相等；
+// 修改交易時先以沖銷分錄抵銷原本的過帳，不會修改或刪除既有分錄
+type JournalEntry struct {
+	ID          uint          `json:"id" gorm:"primaryKey"`
+	GroupID     uint          `json:"group_id" gorm:"not null;index"`
+	SourceType  JournalSource `json:"source_type" gorm:"not null;index:idx_journal_entries_source"`
+	SourceID    uint          `json:"source_id" gorm:"not null;index:idx_journal_entries_source"`
+	Description string        `json:"description"`
+	Reversal    bool          `json:"reversal"` // 沖銷同一來源先前過帳的分錄
+	Postings    []Posting     `json:"postings" gorm:"foreignKey:JournalEntryID"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+// Posting 分錄中單一成員帳戶（成員 + 幣別）的過帳金額
+// 正數為借方，表示成員應收增加；負數為貸方，表示成員應付增加
+type Posting struct {
+	ID             uint         `json:"id" gorm:"primaryKey"`
+	JournalEntryID uint         `json:"journal_entry_id" gorm:"not null;index"`
+	GroupID        uint         `json:"group_id" gorm:"not null;index"`
+	UserID         uint         `json:"user_id" gorm:"not null;index"`
+	User           User         `json:"user" gorm:"foreignKey:UserID"`
+	Kind           PostingKind  `json:"kind" gorm:"not null"`
+	Currency       string       `json:"currency" gorm:"not null"`
+	Amount         money.Amount `json:"amount" gorm:"not null"`      // 來源幣別的最小貨幣單位
+	BaseAmount     money.Amount `json:"base_amount" gorm:"not null"` // 換算為群組基準幣別的金額
+	CreatedAt      time.Time    `json:"created_at"`
+}
+
+// Debit 借方金額
+func (p Posting) Debit() money.Amount {
+	return max(p.Amount, 0)
+}
+
+// Credit 貸方金額
+func (p Posting) Credit() money.Amount {
+	return max(-p.Amount, 0)
+}
+
+// LedgerAccount 成員在單一幣別的帳戶彙總
+type LedgerAccount struct {
+	UserID   uint         `json:"user_id"`
+	User     User         `json:"user"`
+	Currency string       `json:"currency"`
+	Debit    money.Amount `json:"debit"`
+	Credit   money.Amount `json:"credit"`
+	Balance  money.Amount `json:"balance"` // 借方減貸方，正數表示應收
+}
+
+// LedgerTotal 單一幣別所有帳戶的借貸合計
+type LedgerTotal struct {
+	Currency string       `json:"currency"`
+	Debit    money.Amount `json:"debit"`
+	Credit   money.Amount `json:"credit"`
+}
+
+// TrialBalance 群組試算表
+type TrialBalance struct {
+	BaseCurrency      string          `json:"base_currency"`
+	Accounts          []LedgerAccount `json:"accounts"`           // 依用戶與幣別排序
+	Totals            []LedgerTotal   `json:"totals"`             // 依幣別排序
+	UnbalancedEntries []uint          `json:"unbalanced_entries"` // 借貸不相等的分錄
+	Balanced          bool            `json:"balanced"`
+}
+
+// StatementLine 帳戶明細中的一筆過帳
+type StatementLine struct {
+	EntryID        uint          `json:"entry_id"`
+	SourceType     JournalSource `json:"source_type"`
+	SourceID       uint          `json:"source_id"`
+	Description    string        `json:"description"`
+	Reversal       bool          `json:"reversal"`
+	Kind           PostingKind   `json:"kind"`
+	Currency       string        `json:"currency"`
+	Amount         money.Amount  `json:"amount"`
+	BaseAmount     money.Amount  `json:"base_amount"`
+	RunningBalance money.Amount  `json:"running_balance"` // 過帳後的累計平衡（群組基準幣別）
+	PostedAt       time.Time     `json:"posted_at"`
+}
+
+// AccountStatement 成員在群組中的帳戶明細
+type AccountStatement struct {
+	UserID       uint            `json:"user_id"`
+	User         User            `json:"user"`
+	BaseCurrency string          `json:"base_currency"`
+	Lines        []StatementLine `json:"lines"`   // 依過帳時間排序
+	Balance      money.Amount    `json:"balance"` // 群組基準幣別
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"split-go/internal/money"
+	"time"
+)
+
+// MemberBalance 持續維護的成員平衡（以群組基準幣別計算）
+// 交易與結算變更時在同一個資料庫交易中更新，可由完整重新計算重建
+type MemberBalance struct {
+	GroupID   uint         `json:"group_id" gorm:"primaryKey;autoIncrement:false"`
+	UserID    uint         `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	Balance   money.Amount `json:"balance" gorm:"not null;default:0"` // 正數表示應收，負數表示應付
+	Paid      money.Amount `json:"paid" gorm:"not null;default:0"`    // 總共支付金額
+	Owed      money.Amount `json:"owed" gorm:"not null;default:0"`    // 總共應付金額
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// BalanceDiscrepancy 平衡表與完整重新計算結果不一致的記錄
+type BalanceDiscrepancy struct {
+	GroupID  uint          `json:"group_id"`
+	UserID   uint          `json:"user_id"`
+	Stored   MemberBalance `json:"stored"`   // 平衡表中的數值
+	Expected MemberBalance `json:"expected"` // 完整重新計算的數值
+}
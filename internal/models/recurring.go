@@ -0,0 +1,191 @@
+package models
+
+import (
+	"encoding/json"
+	"split-go/internal/money"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// RecurrenceFrequency 定期交易的重複方式
+type RecurrenceFrequency string
+
+const (
+	RecurrenceMonthly RecurrenceFrequency = "monthly" // 每 N 個月的第幾天
+	RecurrenceWeekly  RecurrenceFrequency = "weekly"  // 每 N 週，星期幾依開始日期
+	RecurrenceCustom  RecurrenceFrequency = "custom"  // 每 N 天
+)
+
+// RecurringTransaction 定期交易範本，排程器會在到期時產生實際的交易記錄
+type RecurringTransaction struct {
+	ID           uint                `json:"id" gorm:"primaryKey"`
+	GroupID      uint                `json:"group_id" gorm:"not null;index"`
+	Group        Group               `json:"group" gorm:"foreignKey:GroupID"`
+	Description  string              `json:"description" gorm:"not null"`
+	Amount       money.Amount        `json:"amount" gorm:"not null"` // 最小貨幣單位
+	Currency     string              `json:"currency" gorm:"default:'TWD'"`
+	ExchangeRate float64             `json:"exchange_rate"` // 固定匯率，0 表示每期依匯率資料換算
+	CategoryID   uint                `json:"category_id"`
+	Category     Category            `json:"category" gorm:"foreignKey:CategoryID"`
+	PaidBy       uint                `json:"paid_by" gorm:"not null"`
+	Payer        User                `json:"payer" gorm:"foreignKey:PaidBy"`
+	Payments     datatypes.JSON      `json:"payments"` // []TransactionPaymentRequest，多人付款時使用
+	SplitType    SplitType           `json:"split_type" gorm:"not null"`
+	Splits       datatypes.JSON      `json:"splits"` // []TransactionSplitRequest
+	Notes        string              `json:"notes"`
+	Frequency    RecurrenceFrequency `json:"frequency" gorm:"not null"`
+	Interval     int                 `json:"interval" gorm:"default:1"` // 每 N 個月/週/天
+	DayOfMonth   int                 `json:"day_of_month"`              // 每月模式使用，當月天數不足時使用月底
+	StartDate    time.Time           `json:"start_date" gorm:"not null"`
+	EndDate      *time.Time          `json:"end_date"` // 最後一次可發生的日期（含）
+	NextRunAt    time.Time           `json:"next_run_at" gorm:"not null;index"`
+	LastRunAt    *time.Time          `json:"last_run_at"`
+	Active       bool                `json:"active" gorm:"default:true"`
+	LastError    string              `json:"last_error"` // 產生交易失敗時的原因，排程會暫停直到範本被更新
+	CreatedBy    uint                `json:"created_by"`
+	Creator      User                `json:"creator" gorm:"foreignKey:CreatedBy"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt      `json:"-" gorm:"index"`
+}
+
+// SplitRequests 取得範本中的分帳定義
+func (r RecurringTransaction) SplitRequests() ([]TransactionSplitRequest, error) {
+	var splits []TransactionSplitRequest
+	if len(r.Splits) == 0 {
+		return splits, nil
+	}
+	err := json.Unmarshal(r.Splits, &splits)
+	return splits, err
+}
+
+// PaymentRequests 取得範本中的付款明細
+func (r RecurringTransaction) PaymentRequests() ([]TransactionPaymentRequest, error) {
+	var payments []TransactionPaymentRequest
+	if len(r.Payments) == 0 {
+		return payments, nil
+	}
+	err := json.Unmarshal(r.Payments, &payments)
+	return payments, err
+}
+
+// TransactionRequest 依範本建立一次發生所使用的交易請求
+func (r RecurringTransaction) TransactionRequest() (CreateTransactionRequest, error) {
+	splits, err := r.SplitRequests()
+	if err != nil {
+		return CreateTransactionRequest{}, err
+	}
+	payments, err := r.PaymentRequests()
+	if err != nil {
+		return CreateTransactionRequest{}, err
+	}
+
+	return CreateTransactionRequest{
+		GroupID:      r.GroupID,
+		Description:  r.Description,
+		Amount:       r.Amount.Decimal(r.Currency),
+		Currency:     r.Currency,
+		ExchangeRate: r.ExchangeRate,
+		CategoryID:   r.CategoryID,
+		PaidBy:       r.PaidBy,
+		Payments:     payments,
+		SplitType:    r.SplitType,
+		Splits:       splits,
+		Notes:        r.Notes,
+	}, nil
+}
+
+// interval 取得重複間隔，未設定時視為 1
+func (r RecurringTransaction) interval() int {
+	if r.Interval < 1 {
+		return 1
+	}
+	return r.Interval
+}
+
+// monthlyOccurrence 取得指定年月的發生日期，當月天數不足時使用月底
+func (r RecurringTransaction) monthlyOccurrence(year int, month time.Month) time.Time {
+	day := r.DayOfMonth
+	if day < 1 {
+		day = r.StartDate.Day()
+	}
+	lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// FirstOccurrence 取得開始日期（含）之後的第一次發生日期
+func (r RecurringTransaction) FirstOccurrence() time.Time {
+	start := RecurrenceDate(r.StartDate)
+	if r.Frequency != RecurrenceMonthly {
+		return start
+	}
+
+	occurrence := r.monthlyOccurrence(start.Year(), start.Month())
+	if occurrence.Before(start) {
+		occurrence = r.monthlyOccurrence(start.Year(), start.Month()+1)
+	}
+	return occurrence
+}
+
+// NextOccurrence 取得指定發生日期的下一次發生日期
+func (r RecurringTransaction) NextOccurrence(occurrence time.Time) time.Time {
+	switch r.Frequency {
+	case RecurrenceMonthly:
+		return r.monthlyOccurrence(occurrence.Year(), occurrence.Month()+time.Month(r.interval()))
+	case RecurrenceWeekly:
+		return occurrence.AddDate(0, 0, 7*r.interval())
+	default:
+		return occurrence.AddDate(0, 0, r.interval())
+	}
+}
+
+// OccurrenceOnOrAfter 取得指定日期（含）之後的第一次發生日期
+func (r RecurringTransaction) OccurrenceOnOrAfter(date time.Time) time.Time {
+	date = RecurrenceDate(date)
+	occurrence := r.FirstOccurrence()
+	for occurrence.Before(date) {
+		occurrence = r.NextOccurrence(occurrence)
+	}
+	return occurrence
+}
+
+// EndsBefore 判斷指定的發生日期是否已超過結束日期
+func (r RecurringTransaction) EndsBefore(occurrence time.Time) bool {
+	return r.EndDate != nil && occurrence.After(RecurrenceDate(*r.EndDate))
+}
+
+// RecurrenceDate 取得日期部分（UTC 零時），定期交易的日期皆以此格式儲存
+func RecurrenceDate(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// CreateRecurringTransactionRequest 創建定期交易的請求結構
+type CreateRecurringTransactionRequest struct {
+	Description  string                      `json:"description" validate:"required,min=1,max=255"`
+	Amount       money.Decimal               `json:"amount"`
+	Currency     string                      `json:"currency" validate:"omitempty,iso4217"` // 預設為群組基準幣別
+	ExchangeRate float64                     `json:"exchange_rate"`                         // 固定匯率，未提供時每期依匯率資料換算
+	CategoryID   uint                        `json:"category_id"`
+	PaidBy       uint                        `json:"paid_by" validate:"required_without=Payments"`
+	Payments     []TransactionPaymentRequest `json:"payments"`
+	SplitType    SplitType                   `json:"split_type" validate:"required,oneof=equal percentage fixed shares adjustment"`
+	Splits       []TransactionSplitRequest   `json:"splits" validate:"required"`
+	Notes        string                      `json:"notes" validate:"max=500"`
+	Frequency    RecurrenceFrequency         `json:"frequency" validate:"required,oneof=monthly weekly custom"`
+	Interval     int                         `json:"interval"`                       // 每 N 個月/週/天，預設為 1
+	DayOfMonth   int                         `json:"day_of_month"`                   // 每月模式使用 (1-31)，預設為開始日期的日
+	StartDate    string                      `json:"start_date" validate:"required"` // YYYY-MM-DD
+	EndDate      string                      `json:"end_date"`                       // YYYY-MM-DD，未提供時不會結束
+}
+
+// UpdateRecurringTransactionRequest 更新定期交易的請求結構（取代整個範本）
+type UpdateRecurringTransactionRequest struct {
+	CreateRecurringTransactionRequest
+	Active *bool `json:"active"` // 暫停或恢復排程
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"split-go/internal/money"
 	"time"
 
 	"gorm.io/gorm"
@@ -8,37 +9,190 @@ import (
 
 // Settlement 結算記錄
 type Settlement struct {
-	ID         uint           `json:"id" gorm:"primaryKey"`
-	GroupID    uint           `json:"group_id" gorm:"not null"`
-	Group      Group          `json:"group" gorm:"foreignKey:GroupID"`
-	FromUserID uint           `json:"from_user_id" gorm:"not null"`
-	FromUser   User           `json:"from_user" gorm:"foreignKey:FromUserID"`
-	ToUserID   uint           `json:"to_user_id" gorm:"not null"`
-	ToUser     User           `json:"to_user" gorm:"foreignKey:ToUserID"`
-	Amount     float64        `json:"amount" gorm:"not null"`
-	Currency   string         `json:"currency" gorm:"default:'TWD'"`
-	Status     string         `json:"status" gorm:"default:'pending'"` // pending, paid, cancelled
-	SettledAt  *time.Time     `json:"settled_at"`
-	Notes      string         `json:"notes"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+	ID           uint             `json:"id" gorm:"primaryKey"`
+	GroupID      uint             `json:"group_id" gorm:"not null"`
+	Group        Group            `json:"group" gorm:"foreignKey:GroupID"`
+	FromUserID   uint             `json:"from_user_id" gorm:"not null"`
+	FromUser     User             `json:"from_user" gorm:"foreignKey:FromUserID"`
+	ToUserID     uint             `json:"to_user_id" gorm:"not null"`
+	ToUser       User             `json:"to_user" gorm:"foreignKey:ToUserID"`
+	Amount       money.Amount     `json:"amount" gorm:"not null"` // 最小貨幣單位
+	Currency     string           `json:"currency" gorm:"default:'TWD'"`
+	ExchangeRate float64          `json:"exchange_rate" gorm:"default:1"`  // 結算幣別兌換群組基準幣別的匯率（建立時鎖定）
+	BaseAmount   money.Amount     `json:"base_amount"`                     // 換算為群組基準幣別的金額
+	Status       SettlementStatus `json:"status" gorm:"default:'pending'"` // 允許的狀態轉換見 settlementTransitions
+	SettledAt    *time.Time       `json:"settled_at"`                      // 收款者確認收款的時間
+	Notes        string           `json:"notes"`
+	LinkID       string           `json:"link_id,omitempty" gorm:"size:36;index"`  // 跨群組抵銷時同一批結算記錄共用的識別碼
+	BatchID      string           `json:"batch_id,omitempty" gorm:"size:36;index"` // 由結算建議批次建立時共用的識別碼
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt   `json:"-" gorm:"index"`
+
+	// 由收款者發起的請款，付款者接受後成為一般的待付款結算
+	RequestedBy   *uint      `json:"requested_by"`   // 發起請款的收款者
+	RespondedAt   *time.Time `json:"responded_at"`   // 付款者接受或拒絕的時間
+	DeclineReason string     `json:"decline_reason"` // 付款者拒絕的原因
+	DisputeReason string     `json:"dispute_reason"` // 最近一次提出爭議的原因
+
+	// 分期付款：收款者確認的付款累計於 PaidAmount，付清後狀態變為 confirmed
+	PaidAmount money.Amount        `json:"paid_amount" gorm:"not null;default:0"` // 已確認的付款總額（結算幣別）
+	Payments   []SettlementPayment `json:"payments,omitempty" gorm:"foreignKey:SettlementID"`
+}
+
+// AmountInBase 取得換算為群組基準幣別的金額，舊資料未記錄時視為原始金額
+func (s Settlement) AmountInBase() money.Amount {
+	if s.BaseAmount == 0 {
+		return s.Amount
+	}
+	return s.BaseAmount
+}
+
+// SettledAmount 已計入平衡的金額：已確認的結算為全額，其餘為已確認的部分付款
+func (s Settlement) SettledAmount() money.Amount {
+	if s.Status == SettlementConfirmed {
+		return s.Amount
+	}
+	return s.PaidAmount
+}
+
+// RemainingAmount 尚未付清的金額
+func (s Settlement) RemainingAmount() money.Amount {
+	return s.Amount - s.SettledAmount()
+}
+
+// SettledAmountInBase 換算為群組基準幣別的已計入平衡金額，部分付款依比例換算
+func (s Settlement) SettledAmountInBase() money.Amount {
+	settled := s.SettledAmount()
+	switch settled {
+	case 0:
+		return 0
+	case s.Amount:
+		return s.AmountInBase()
+	}
+	parts, err := money.Allocate(s.AmountInBase(), []int64{int64(settled), int64(s.Amount - settled)})
+	if err != nil {
+		return settled
+	}
+	return parts[0]
 }
 
 // Balance 平衡計算結果 (用於 API 回應)
 type Balance struct {
-	UserID  uint    `json:"user_id"`
-	User    User    `json:"user"`
-	Balance float64 `json:"balance"` // 正數表示應收，負數表示應付
-	Paid    float64 `json:"paid"`    // 總共支付金額
-	Owed    float64 `json:"owed"`    // 總共應付金額
+	UserID   uint         `json:"user_id"`
+	User     User         `json:"user"`
+	Currency string       `json:"currency"` // 群組基準幣別
+	Balance  money.Amount `json:"balance"`  // 正數表示應收，負數表示應付
+	Paid     money.Amount `json:"paid"`     // 總共支付金額
+	Owed     money.Amount `json:"owed"`     // 總共應付金額
+}
+
+// SettlementProjection 建立結算前依目前平衡所做的預估
+// 尚未完成的結算視為即將付款，避免與已建立的結算重複
+type SettlementProjection struct {
+	Currency string       `json:"currency"` // 群組基準幣別
+	Owed     money.Amount `json:"owed"`     // 付款者可付給收款者而不使任一方平衡反轉的最大金額
+	Pending  money.Amount `json:"pending"`  // 兩人之間同方向尚未完成的結算金額
+	Balances []Balance    `json:"balances"` // 未完成的結算及本次結算確認後的預估平衡
 }
 
 // SettlementSuggestion 結算建議 (用於 API 回應)
 type SettlementSuggestion struct {
-	FromUserID uint    `json:"from_user_id"`
-	FromUser   User    `json:"from_user"`
-	ToUserID   uint    `json:"to_user_id"`
-	ToUser     User    `json:"to_user"`
-	Amount     float64 `json:"amount"`
+	FromUserID uint         `json:"from_user_id"`
+	FromUser   User         `json:"from_user"`
+	ToUserID   uint         `json:"to_user_id"`
+	ToUser     User         `json:"to_user"`
+	Amount     money.Amount `json:"amount"`
+	Currency   string       `json:"currency"`
+}
+
+// SettlementStrategy 結算建議演算法
+type SettlementStrategy string
+
+const (
+	StrategyGreedy   SettlementStrategy = "greedy"   // 依金額由大到小配對債權人與債務人
+	StrategyMinimal  SettlementStrategy = "minimal"  // 最少轉帳次數（人數過多時改用 greedy）
+	StrategyPairwise SettlementStrategy = "pairwise" // 依實際交易的兩兩債務，不跨人抵銷
+)
+
+// SettlementPlan 結算建議及實際使用的演算法
+type SettlementPlan struct {
+	Strategy    SettlementStrategy     `json:"strategy"`
+	Suggestions []SettlementSuggestion `json:"suggestions"`
+	Fingerprint string                 `json:"fingerprint"` // 建議內容的雜湊值，用於確認批次建立時平衡未變更
+}
+
+// PairwiseDebt 兩位用戶之間未經簡化的債務
+type PairwiseDebt struct {
+	FromUserID    uint               `json:"from_user_id"`
+	FromUser      User               `json:"from_user"`
+	ToUserID      uint               `json:"to_user_id"`
+	ToUser        User               `json:"to_user"`
+	Amount        money.Amount       `json:"amount"`
+	Currency      string             `json:"currency"`
+	Contributions []DebtContribution `json:"contributions"` // 構成此債務的交易與結算
+}
+
+// DebtContribution 單筆交易或結算對兩兩債務的影響
+type DebtContribution struct {
+	TransactionID *uint        `json:"transaction_id,omitempty"`
+	SettlementID  *uint        `json:"settlement_id,omitempty"`
+	Description   string       `json:"description"`
+	Date          time.Time    `json:"date"`
+	Amount        money.Amount `json:"amount"` // 正數增加債務，負數減少債務
+}
+
+// UserBalanceSummary 用戶跨群組的平衡摘要
+type UserBalanceSummary struct {
+	Groups             []GroupBalanceSummary `json:"groups"`
+	Counterparties     []CounterpartyBalance `json:"counterparties"`      // 跨群組加總的對象債務（依幣別分開）
+	Totals             []CurrencyBalance     `json:"totals"`              // 依幣別加總的淨平衡
+	PendingSettlements []Settlement          `json:"pending_settlements"` // 用戶為付款者或收款者的待付款結算
+}
+
+// GroupBalanceSummary 用戶在單一群組中的平衡
+type GroupBalanceSummary struct {
+	Group          Group                 `json:"group"`
+	Balance        Balance               `json:"balance"`
+	Counterparties []CounterpartyBalance `json:"counterparties"`
+}
+
+// CounterpartyBalance 用戶與另一位用戶之間的債務
+type CounterpartyBalance struct {
+	UserID   uint         `json:"user_id"`
+	User     User         `json:"user"`
+	Currency string       `json:"currency"`
+	Amount   money.Amount `json:"amount"` // 正數表示對方欠用戶，負數表示用戶欠對方
+}
+
+// CurrencyBalance 單一幣別的金額
+type CurrencyBalance struct {
+	Currency string       `json:"currency"`
+	Balance  money.Amount `json:"balance"`
+}
+
+// CrossGroupSuggestion 同一對用戶跨群組抵銷後的結算建議
+type CrossGroupSuggestion struct {
+	CounterpartyID uint            `json:"counterparty_id"`
+	Counterparty   User            `json:"counterparty"`
+	Currency       string          `json:"currency"`
+	FromUserID     uint            `json:"from_user_id"` // 抵銷後需付款的一方
+	ToUserID       uint            `json:"to_user_id"`
+	Amount         money.Amount    `json:"amount"` // 抵銷後的淨額，為零時不需轉帳
+	Legs           []CrossGroupLeg `json:"legs"`   // 各群組內原本的債務
+}
+
+// CrossGroupLeg 跨群組抵銷中單一群組內的債務
+type CrossGroupLeg struct {
+	GroupID    uint         `json:"group_id"`
+	Group      Group        `json:"group"`
+	FromUserID uint         `json:"from_user_id"`
+	ToUserID   uint         `json:"to_user_id"`
+	Amount     money.Amount `json:"amount"`
+}
+
+// AcceptCrossGroupSettlementRequest 接受跨群組抵銷建議請求
+type AcceptCrossGroupSettlementRequest struct {
+	CounterpartyID uint   `json:"counterparty_id" validate:"required"`
+	Currency       string `json:"currency" validate:"required,iso4217"`
 }
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"split-go/internal/money"
+	"time"
+)
+
+// SettlementPayment 結算的一筆付款（分期付款）
+// 收款者記錄的付款直接視為已確認；付款者記錄的付款需由收款者確認後才計入平衡
+type SettlementPayment struct {
+	ID           uint         `json:"id" gorm:"primaryKey"`
+	SettlementID uint         `json:"settlement_id" gorm:"not null;index"`
+	Amount       money.Amount `json:"amount" gorm:"not null"` // 最小貨幣單位（結算幣別）
+	RecordedByID uint         `json:"recorded_by_id" gorm:"not null"`
+	RecordedBy   User         `json:"recorded_by" gorm:"foreignKey:RecordedByID"`
+	Notes        string       `json:"notes"`
+	ConfirmedAt  *time.Time   `json:"confirmed_at"` // 收款者確認收到付款的時間
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+// IsConfirmed 收款者是否已確認收到此付款
+func (p SettlementPayment) IsConfirmed() bool {
+	return p.ConfirmedAt != nil
+}
+
+// AcceptsPayments 結算是否可以記錄付款
+// 待付款、付款者已標記付款、部分付款及爭議中的結算可以繼續付款
+func (s Settlement) AcceptsPayments() bool {
+	return s.Status == SettlementPartiallyPaid || s.CanTransitionTo(SettlementPartiallyPaid) == nil
+}
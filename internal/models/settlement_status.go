@@ -0,0 +1,131 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SettlementStatus 結算狀態
+type SettlementStatus string
+
+const (
+	SettlementRequested       SettlementStatus = "requested"         // 收款者請款，等待付款者回覆
+	SettlementPending         SettlementStatus = "pending"           // 等待付款
+	SettlementPayerMarkedSent SettlementStatus = "payer_marked_sent" // 付款者表示已付款，等待收款者確認
+	SettlementPartiallyPaid   SettlementStatus = "partially_paid"    // 收款者已確認部分付款
+	SettlementConfirmed       SettlementStatus = "confirmed"         // 收款者確認收款，計入平衡
+	SettlementDisputed        SettlementStatus = "disputed"          // 任一方對結算提出爭議
+	SettlementRejected        SettlementStatus = "rejected"          // 付款者拒絕請款
+	SettlementCancelled       SettlementStatus = "cancelled"         // 已取消
+)
+
+// OpenSettlementStatuses 尚未結束的結算狀態
+var OpenSettlementStatuses = []SettlementStatus{
+	SettlementRequested,
+	SettlementPending,
+	SettlementPayerMarkedSent,
+	SettlementPartiallyPaid,
+	SettlementDisputed,
+}
+
+// SettlementRole 用戶在結算中的角色
+type SettlementRole string
+
+const (
+	SettlementRolePayer SettlementRole = "payer" // 付款者 (FromUser)
+	SettlementRolePayee SettlementRole = "payee" // 收款者 (ToUser)
+)
+
+// settlementTransitions 允許的狀態轉換及可執行的角色
+// confirmed、rejected、cancelled 為最終狀態，不可再轉換；已收到部分付款的結算不能取消
+var settlementTransitions = map[SettlementStatus]map[SettlementStatus][]SettlementRole{
+	SettlementRequested: {
+		SettlementPending:   {SettlementRolePayer},
+		SettlementRejected:  {SettlementRolePayer},
+		SettlementCancelled: {SettlementRolePayee},
+	},
+	SettlementPending: {
+		SettlementPayerMarkedSent: {SettlementRolePayer},
+		SettlementPartiallyPaid:   {SettlementRolePayee},
+		SettlementConfirmed:       {SettlementRolePayee},
+		SettlementDisputed:        {SettlementRolePayer, SettlementRolePayee},
+		SettlementCancelled:       {SettlementRolePayer, SettlementRolePayee},
+	},
+	SettlementPayerMarkedSent: {
+		SettlementPartiallyPaid: {SettlementRolePayee},
+		SettlementConfirmed:     {SettlementRolePayee},
+		SettlementDisputed:      {SettlementRolePayer, SettlementRolePayee},
+	},
+	SettlementPartiallyPaid: {
+		SettlementPayerMarkedSent: {SettlementRolePayer},
+		SettlementConfirmed:       {SettlementRolePayee},
+		SettlementDisputed:        {SettlementRolePayer, SettlementRolePayee},
+	},
+	SettlementDisputed: {
+		SettlementPayerMarkedSent: {SettlementRolePayer},
+		SettlementPartiallyPaid:   {SettlementRolePayee},
+		SettlementConfirmed:       {SettlementRolePayee},
+		SettlementCancelled:       {SettlementRolePayer, SettlementRolePayee},
+	},
+}
+
+var (
+	// ErrInvalidSettlementTransition 目前狀態不允許轉換為目標狀態
+	ErrInvalidSettlementTransition = errors.New("無效的結算狀態轉換")
+	// ErrSettlementTransitionForbidden 用戶的角色不能執行此狀態轉換
+	ErrSettlementTransitionForbidden = errors.New("無權限變更此結算狀態")
+)
+
+// CanTransitionTo 檢查目前狀態是否允許轉換為目標狀態（不檢查角色）
+func (s Settlement) CanTransitionTo(to SettlementStatus) error {
+	if _, allowed := settlementTransitions[s.Status][to]; !allowed {
+		return fmt.Errorf("%w: %s → %s", ErrInvalidSettlementTransition, s.Status, to)
+	}
+	if to == SettlementCancelled && s.PaidAmount > 0 {
+		return fmt.Errorf("%w: 已收到部分付款的結算不能取消", ErrInvalidSettlementTransition)
+	}
+	return nil
+}
+
+// CheckTransition 檢查用戶是否可以將結算轉換為目標狀態
+func (s Settlement) CheckTransition(to SettlementStatus, userID uint) error {
+	if err := s.CanTransitionTo(to); err != nil {
+		return err
+	}
+
+	for _, role := range settlementTransitions[s.Status][to] {
+		if s.HasRole(userID, role) {
+			return nil
+		}
+	}
+	return ErrSettlementTransitionForbidden
+}
+
+// HasRole 檢查用戶在結算中是否具有指定角色
+func (s Settlement) HasRole(userID uint, role SettlementRole) bool {
+	switch role {
+	case SettlementRolePayer:
+		return s.FromUserID == userID
+	case SettlementRolePayee:
+		return s.ToUserID == userID
+	}
+	return false
+}
+
+// SettlementEvent 結算狀態變更記錄
+type SettlementEvent struct {
+	ID           uint             `json:"id" gorm:"primaryKey"`
+	SettlementID uint             `json:"settlement_id" gorm:"not null;index"`
+	ActorID      uint             `json:"actor_id" gorm:"not null"`
+	Actor        User             `json:"actor" gorm:"foreignKey:ActorID"`
+	FromStatus   SettlementStatus `json:"from_status"` // 建立結算時為空
+	ToStatus     SettlementStatus `json:"to_status" gorm:"not null"`
+	Reason       string           `json:"reason"`
+	CreatedAt    time.Time        `json:"created_at"`
+}
+
+// DisputeSettlementRequest 提出結算爭議請求
+type DisputeSettlementRequest struct {
+	Reason string `json:"reason" validate:"required"`
+}
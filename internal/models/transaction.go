@@ -1,6 +1,7 @@
 package models
 
 import (
+	"split-go/internal/money"
 	"time"
 
 	"gorm.io/gorm"
@@ -8,24 +9,78 @@ import (
 
 // Transaction 交易記錄
 type Transaction struct {
-	ID          uint               `json:"id" gorm:"primaryKey"`
-	GroupID     uint               `json:"group_id" gorm:"not null"`
-	Group       Group              `json:"group" gorm:"foreignKey:GroupID"`
-	Description string             `json:"description" gorm:"not null"`
-	Amount      float64            `json:"amount" gorm:"not null"`
-	Currency    string             `json:"currency" gorm:"default:'TWD'"`
-	CategoryID  uint               `json:"category_id"`
-	Category    Category           `json:"category" gorm:"foreignKey:CategoryID"`
-	PaidBy      uint               `json:"paid_by" gorm:"not null"`
-	Payer       User               `json:"payer" gorm:"foreignKey:PaidBy"`
-	Splits      []TransactionSplit `json:"splits" gorm:"foreignKey:TransactionID"`
-	Receipt     string             `json:"receipt"` // 收據圖片 URL
-	Notes       string             `json:"notes"`
-	CreatedBy   uint               `json:"created_by"`
-	Creator     User               `json:"creator" gorm:"foreignKey:CreatedBy"`
-	CreatedAt   time.Time          `json:"created_at"`
-	UpdatedAt   time.Time          `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt     `json:"-" gorm:"index"`
+	ID           uint                 `json:"id" gorm:"primaryKey"`
+	GroupID      uint                 `json:"group_id" gorm:"not null"`
+	Group        Group                `json:"group" gorm:"foreignKey:GroupID"`
+	Description  string               `json:"description" gorm:"not null"`
+	Amount       money.Amount         `json:"amount" gorm:"not null"` // 最小貨幣單位
+	Currency     string               `json:"currency" gorm:"default:'TWD'"`
+	ExchangeRate float64              `json:"exchange_rate" gorm:"default:1"` // 交易幣別兌換群組基準幣別的匯率（建立時鎖定）
+	BaseAmount   money.Amount         `json:"base_amount"`                    // 換算為群組基準幣別的金額
+	CategoryID   uint                 `json:"category_id"`
+	Category     Category             `json:"category" gorm:"foreignKey:CategoryID"`
+	PaidBy       uint                 `json:"paid_by" gorm:"not null"` // 主要付款者 (單一付款者時即為付款者)
+	Payer        User                 `json:"payer" gorm:"foreignKey:PaidBy"`
+	Payments     []TransactionPayment `json:"payments" gorm:"foreignKey:TransactionID"` // 付款明細 (可多人付款)
+	Splits       []TransactionSplit   `json:"splits" gorm:"foreignKey:TransactionID"`
+	Items        []TransactionItem    `json:"items" gorm:"foreignKey:TransactionID"` // 明細項目 (明細模式使用)
+	Receipt      string               `json:"receipt"`                               // 收據圖片 URL
+	Notes        string               `json:"notes"`
+	Version      uint                 `json:"version" gorm:"not null;default:1"` // 每次修改遞增，用於偵測同時編輯
+	CreatedBy    uint                 `json:"created_by"`
+	Creator      User                 `json:"creator" gorm:"foreignKey:CreatedBy"`
+	CreatedAt    time.Time            `json:"created_at"`
+	UpdatedAt    time.Time            `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt       `json:"-" gorm:"index"`
+	DeletedBy    *uint                `json:"deleted_by"` // 刪除交易的用戶，還原時清除
+	Deleter      *User                `json:"deleter,omitempty" gorm:"foreignKey:DeletedBy"`
+
+	// 由定期交易產生時記錄來源與發生日期，唯一索引確保每次發生只會產生一筆交易
+	RecurringTransactionID *uint      `json:"recurring_transaction_id" gorm:"uniqueIndex:idx_transactions_recurring_occurrence"`
+	OccurrenceDate         *time.Time `json:"occurrence_date" gorm:"uniqueIndex:idx_transactions_recurring_occurrence"`
+}
+
+// AmountInBase 取得換算為群組基準幣別的金額，舊資料未記錄時視為原始金額
+func (t Transaction) AmountInBase() money.Amount {
+	if t.BaseAmount == 0 {
+		return t.Amount
+	}
+	return t.BaseAmount
+}
+
+// PaymentsOrDefault 取得付款明細，舊資料沒有付款記錄時視為 paid_by 支付全額
+func (t Transaction) PaymentsOrDefault() []TransactionPayment {
+	if len(t.Payments) > 0 {
+		return t.Payments
+	}
+	return []TransactionPayment{{
+		TransactionID: t.ID,
+		UserID:        t.PaidBy,
+		User:          t.Payer,
+		Amount:        t.Amount,
+	}}
+}
+
+// PaidAmount 計算指定用戶在此交易中支付的金額
+func (t Transaction) PaidAmount(userID uint) money.Amount {
+	var paid money.Amount
+	for _, payment := range t.PaymentsOrDefault() {
+		if payment.UserID == userID {
+			paid += payment.Amount
+		}
+	}
+	return paid
+}
+
+// TransactionPayment 交易付款記錄，同一筆交易可由多人共同支付
+type TransactionPayment struct {
+	ID            uint         `json:"id" gorm:"primaryKey"`
+	TransactionID uint         `json:"transaction_id" gorm:"not null;index"`
+	UserID        uint         `json:"user_id" gorm:"not null"`
+	User          User         `json:"user" gorm:"foreignKey:UserID"`
+	Amount        money.Amount `json:"amount" gorm:"not null"` // 最小貨幣單位
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
 }
 
 // SplitType 分帳類型枚舉
@@ -35,51 +90,108 @@ const (
 	SplitEqual      SplitType = "equal"      // 平均分攤
 	SplitPercentage SplitType = "percentage" // 按比例分攤
 	SplitFixed      SplitType = "fixed"      // 固定金額
+	SplitShares     SplitType = "shares"     // 按份數分攤
+	SplitAdjustment SplitType = "adjustment" // 平均分攤後加減調整金額
+	SplitItemized   SplitType = "itemized"   // 依明細項目分攤
 )
 
 // TransactionSplit 交易分攤記錄
 type TransactionSplit struct {
-	ID            uint      `json:"id" gorm:"primaryKey"`
-	TransactionID uint      `json:"transaction_id" gorm:"not null"`
-	UserID        uint      `json:"user_id" gorm:"not null"`
-	User          User      `json:"user" gorm:"foreignKey:UserID"`
-	Amount        float64   `json:"amount" gorm:"not null"`
-	Percentage    float64   `json:"percentage"` // 百分比 (0-100)
-	SplitType     SplitType `json:"split_type" gorm:"not null"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID            uint         `json:"id" gorm:"primaryKey"`
+	TransactionID uint         `json:"transaction_id" gorm:"not null"`
+	UserID        uint         `json:"user_id" gorm:"not null"`
+	User          User         `json:"user" gorm:"foreignKey:UserID"`
+	Amount        money.Amount `json:"amount" gorm:"not null"` // 最小貨幣單位
+	Percentage    float64      `json:"percentage"`             // 百分比 (0-100)
+	Shares        int64        `json:"shares"`                 // 份數 (份數模式使用)
+	Adjustment    money.Amount `json:"adjustment"`             // 調整金額 (調整模式使用，可為負數)
+	SplitType     SplitType    `json:"split_type" gorm:"not null"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
+
+// ItemKind 明細項目類型
+type ItemKind string
+
+const (
+	ItemKindItem          ItemKind = "item"           // 一般品項，由消費者平均分攤
+	ItemKindTax           ItemKind = "tax"            // 稅金，依品項小計比例分攤
+	ItemKindServiceCharge ItemKind = "service_charge" // 服務費，依品項小計比例分攤
+	ItemKindTip           ItemKind = "tip"            // 小費，依品項小計比例分攤
+)
+
+// TransactionItem 交易明細項目（例如餐廳帳單中的單一餐點）
+type TransactionItem struct {
+	ID            uint         `json:"id" gorm:"primaryKey"`
+	TransactionID uint         `json:"transaction_id" gorm:"not null;index"`
+	Name          string       `json:"name" gorm:"not null"`
+	Kind          ItemKind     `json:"kind" gorm:"not null;default:'item'"`
+	Quantity      int64        `json:"quantity" gorm:"not null;default:1"`
+	UnitPrice     money.Amount `json:"unit_price" gorm:"not null"` // 最小貨幣單位
+	Consumers     []User       `json:"consumers" gorm:"many2many:transaction_item_consumers;"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
+
+// Total 明細項目總額
+func (item TransactionItem) Total() money.Amount {
+	return item.UnitPrice * money.Amount(item.Quantity)
 }
 
 // CreateTransactionRequest 創建交易的請求結構
 type CreateTransactionRequest struct {
-	GroupID     uint                      `json:"group_id" validate:"required"`
-	Description string                    `json:"description" validate:"required,min=1,max=255"`
-	Amount      float64                   `json:"amount" validate:"required,gt=0"`
-	Currency    string                    `json:"currency"`
-	CategoryID  uint                      `json:"category_id"`
-	PaidBy      uint                      `json:"paid_by" validate:"required"`
-	SplitType   SplitType                 `json:"split_type" validate:"required,oneof=equal percentage fixed"`
-	Splits      []TransactionSplitRequest `json:"splits" validate:"required,min=1"`
-	Receipt     string                    `json:"receipt"`
-	Notes       string                    `json:"notes" validate:"max=500"`
+	GroupID      uint                        `json:"group_id" validate:"required"`
+	Description  string                      `json:"description" validate:"required,min=1,max=255"`
+	Amount       money.Decimal               `json:"amount"`
+	Currency     string                      `json:"currency" validate:"omitempty,iso4217"` // 預設為群組基準幣別
+	ExchangeRate float64                     `json:"exchange_rate"`                         // 兌換群組基準幣別的匯率，未提供時使用匯率資料
+	CategoryID   uint                        `json:"category_id"`
+	PaidBy       uint                        `json:"paid_by" validate:"required_without=Payments"`
+	Payments     []TransactionPaymentRequest `json:"payments"` // 多人付款時使用，總和必須等於交易金額
+	SplitType    SplitType                   `json:"split_type" validate:"required,oneof=equal percentage fixed shares adjustment itemized"`
+	Splits       []TransactionSplitRequest   `json:"splits" validate:"required_without=Items"`
+	Items        []TransactionItemRequest    `json:"items"` // 明細模式使用，分帳由明細推導
+	Receipt      string                      `json:"receipt"`
+	Notes        string                      `json:"notes" validate:"max=500"`
 }
 
 // CreateTransactionSplit 創建分帳的請求結構
 type TransactionSplitRequest struct {
-	UserID     uint    `json:"user_id" validate:"required"`
-	Amount     float64 `json:"amount"`     // 固定金額模式使用
-	Percentage float64 `json:"percentage"` // 百分比模式使用 (0-100)
+	UserID     uint          `json:"user_id" validate:"required"`
+	Amount     money.Decimal `json:"amount"`     // 固定金額模式使用
+	Percentage float64       `json:"percentage"` // 百分比模式使用 (0-100)
+	Shares     int64         `json:"shares"`     // 份數模式使用
+	Adjustment money.Decimal `json:"adjustment"` // 調整模式使用，可為負數
+}
+
+// TransactionPaymentRequest 付款明細的請求結構
+type TransactionPaymentRequest struct {
+	UserID uint          `json:"user_id" validate:"required"`
+	Amount money.Decimal `json:"amount" validate:"required"`
 }
 
 // UpdateTransactionRequest 更新交易的請求結構
 type UpdateTransactionRequest struct {
-	Description string                    `json:"description" validate:"omitempty,min=1,max=255"`
-	Amount      float64                   `json:"amount" validate:"omitempty,gt=0"`
-	Currency    string                    `json:"currency"`
-	CategoryID  uint                      `json:"category_id"`
-	PaidBy      uint                      `json:"paid_by"`
-	SplitType   SplitType                 `json:"split_type" validate:"omitempty,oneof=equal percentage fixed"`
-	Splits      []TransactionSplitRequest `json:"splits" validate:"omitempty,min=1"`
-	Receipt     string                    `json:"receipt"`
-	Notes       string                    `json:"notes" validate:"max=500"`
+	Description  string                      `json:"description" validate:"omitempty,min=1,max=255"`
+	Amount       money.Decimal               `json:"amount"`
+	Currency     string                      `json:"currency" validate:"omitempty,iso4217"`
+	ExchangeRate float64                     `json:"exchange_rate"` // 提供時覆寫鎖定的匯率
+	CategoryID   uint                        `json:"category_id"`
+	PaidBy       uint                        `json:"paid_by"`  // 提供時改為單一付款者
+	Payments     []TransactionPaymentRequest `json:"payments"` // 提供時會取代所有付款明細
+	SplitType    SplitType                   `json:"split_type" validate:"omitempty,oneof=equal percentage fixed shares adjustment itemized"`
+	Splits       []TransactionSplitRequest   `json:"splits" validate:"omitempty,min=1"`
+	Items        []TransactionItemRequest    `json:"items"` // 明細模式使用，提供時會取代所有明細
+	Receipt      string                      `json:"receipt"`
+	Notes        string                      `json:"notes" validate:"max=500"`
+	Version      uint                        `json:"version"` // 修改所依據的版本，未提供 If-Match 標頭時使用
+}
+
+// TransactionItemRequest 明細項目的請求結構
+type TransactionItemRequest struct {
+	Name        string        `json:"name" validate:"required,min=1,max=255"`
+	Kind        ItemKind      `json:"kind" validate:"omitempty,oneof=item tax service_charge tip"`
+	Quantity    int64         `json:"quantity"` // 預設為 1
+	UnitPrice   money.Decimal `json:"unit_price" validate:"required"`
+	ConsumerIDs []uint        `json:"consumer_ids"` // 一般品項必填，稅金/服務費/小費不需要
 }
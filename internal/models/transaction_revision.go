@@ -0,0 +1,316 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"split-go/internal/money"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// RevisionAction 交易版本的變更類型
+type RevisionAction string
+
+const (
+	RevisionCreated  RevisionAction = "created"  // 建立交易
+	RevisionUpdated  RevisionAction = "updated"  // 修改交易
+	RevisionDeleted  RevisionAction = "deleted"  // 移至垃圾桶
+	RevisionRestored RevisionAction = "restored" // 從垃圾桶還原
+	RevisionReverted RevisionAction = "reverted" // 回復為先前的版本
+)
+
+// TransactionRevision 交易版本記錄，每次建立、修改、刪除、還原或回復交易時保存完整快照
+type TransactionRevision struct {
+	ID            uint           `json:"id" gorm:"primaryKey"`
+	TransactionID uint           `json:"transaction_id" gorm:"not null;uniqueIndex:idx_transaction_revisions_number"`
+	Revision      int            `json:"revision" gorm:"not null;uniqueIndex:idx_transaction_revisions_number"` // 從 1 開始的版本號
+	Action        RevisionAction `json:"action" gorm:"not null"`
+	EditorID      uint           `json:"editor_id" gorm:"not null"`
+	Editor        User           `json:"editor" gorm:"foreignKey:EditorID"`
+	RevertedFrom  *int           `json:"reverted_from"` // 回復時所依據的版本號
+	Snapshot      datatypes.JSON `json:"snapshot"`      // TransactionSnapshot
+	CreatedAt     time.Time      `json:"created_at"`
+}
+
+// TransactionSnapshot 取得此版本保存的交易內容
+func (r TransactionRevision) TransactionSnapshot() (TransactionSnapshot, error) {
+	var snapshot TransactionSnapshot
+	if len(r.Snapshot) == 0 {
+		return snapshot, nil
+	}
+	err := json.Unmarshal(r.Snapshot, &snapshot)
+	return snapshot, err
+}
+
+// TransactionSnapshot 交易在某個版本的完整內容（金額皆為最小貨幣單位）
+type TransactionSnapshot struct {
+	Description  string            `json:"description"`
+	Amount       money.Amount      `json:"amount"`
+	Currency     string            `json:"currency"`
+	ExchangeRate float64           `json:"exchange_rate"`
+	BaseAmount   money.Amount      `json:"base_amount"`
+	BaseCurrency string            `json:"base_currency"`
+	CategoryID   uint              `json:"category_id"`
+	PaidBy       uint              `json:"paid_by"`
+	SplitType    SplitType         `json:"split_type"`
+	Payments     []PaymentSnapshot `json:"payments"`
+	Splits       []SplitSnapshot   `json:"splits"`
+	Items        []ItemSnapshot    `json:"items"`
+	Receipt      string            `json:"receipt"`
+	Notes        string            `json:"notes"`
+}
+
+// PaymentSnapshot 快照中的付款明細
+type PaymentSnapshot struct {
+	UserID uint         `json:"user_id"`
+	Amount money.Amount `json:"amount"`
+}
+
+// SplitSnapshot 快照中的分帳記錄
+type SplitSnapshot struct {
+	UserID     uint         `json:"user_id"`
+	Amount     money.Amount `json:"amount"`
+	Percentage float64      `json:"percentage"`
+	Shares     int64        `json:"shares"`
+	Adjustment money.Amount `json:"adjustment"`
+}
+
+// ItemSnapshot 快照中的明細項目
+type ItemSnapshot struct {
+	Name        string       `json:"name"`
+	Kind        ItemKind     `json:"kind"`
+	Quantity    int64        `json:"quantity"`
+	UnitPrice   money.Amount `json:"unit_price"`
+	ConsumerIDs []uint       `json:"consumer_ids"`
+}
+
+// NewTransactionSnapshot 由交易建立快照，需預先載入 Group、Payments、Splits 與 Items.Consumers
+// 付款與分帳依用戶排序，讓不同版本可以直接比較
+func NewTransactionSnapshot(t Transaction) TransactionSnapshot {
+	snapshot := TransactionSnapshot{
+		Description:  t.Description,
+		Amount:       t.Amount,
+		Currency:     t.Currency,
+		ExchangeRate: t.ExchangeRate,
+		BaseAmount:   t.BaseAmount,
+		BaseCurrency: t.Group.BaseCurrency,
+		CategoryID:   t.CategoryID,
+		PaidBy:       t.PaidBy,
+		Payments:     []PaymentSnapshot{},
+		Splits:       []SplitSnapshot{},
+		Items:        []ItemSnapshot{},
+		Receipt:      t.Receipt,
+		Notes:        t.Notes,
+	}
+
+	for _, payment := range t.PaymentsOrDefault() {
+		snapshot.Payments = append(snapshot.Payments, PaymentSnapshot{UserID: payment.UserID, Amount: payment.Amount})
+	}
+	sort.Slice(snapshot.Payments, func(i, j int) bool { return snapshot.Payments[i].UserID < snapshot.Payments[j].UserID })
+
+	for _, split := range t.Splits {
+		snapshot.SplitType = split.SplitType
+		snapshot.Splits = append(snapshot.Splits, SplitSnapshot{
+			UserID:     split.UserID,
+			Amount:     split.Amount,
+			Percentage: split.Percentage,
+			Shares:     split.Shares,
+			Adjustment: split.Adjustment,
+		})
+	}
+	sort.Slice(snapshot.Splits, func(i, j int) bool { return snapshot.Splits[i].UserID < snapshot.Splits[j].UserID })
+
+	for _, item := range t.Items {
+		consumerIDs := make([]uint, len(item.Consumers))
+		for i, consumer := range item.Consumers {
+			consumerIDs[i] = consumer.ID
+		}
+		sort.Slice(consumerIDs, func(i, j int) bool { return consumerIDs[i] < consumerIDs[j] })
+		snapshot.Items = append(snapshot.Items, ItemSnapshot{
+			Name:        item.Name,
+			Kind:        item.Kind,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			ConsumerIDs: consumerIDs,
+		})
+	}
+
+	return snapshot
+}
+
+// ParticipantIDs 快照中所有付款者、分帳參與者與明細消費者
+func (s TransactionSnapshot) ParticipantIDs() []uint {
+	var userIDs []uint
+	for _, payment := range s.Payments {
+		userIDs = append(userIDs, payment.UserID)
+	}
+	for _, split := range s.Splits {
+		userIDs = append(userIDs, split.UserID)
+	}
+	for _, item := range s.Items {
+		userIDs = append(userIDs, item.ConsumerIDs...)
+	}
+	return userIDs
+}
+
+// Equal 兩個快照的交易內容是否相同
+func (s TransactionSnapshot) Equal(other TransactionSnapshot) bool {
+	return len(s.Diff(other)) == 0
+}
+
+// RevisionChange 兩個版本之間單一欄位的差異
+type RevisionChange struct {
+	Field  string      `json:"field"`
+	UserID *uint       `json:"user_id,omitempty"` // 付款或分帳變更所屬的用戶
+	From   interface{} `json:"from"`              // 新增時為 null
+	To     interface{} `json:"to"`                // 移除時為 null
+}
+
+// ItemChangeValue 明細變更中的單一明細項目（金額為十進位）
+type ItemChangeValue struct {
+	Name        string        `json:"name"`
+	Kind        ItemKind      `json:"kind"`
+	Quantity    int64         `json:"quantity"`
+	UnitPrice   money.Decimal `json:"unit_price"`
+	ConsumerIDs []uint        `json:"consumer_ids"`
+}
+
+// Diff 列出此快照相對於前一個快照變更的欄位，金額以十進位表示
+// 付款與分帳依用戶逐筆比較，明細項目則整批比較
+func (s TransactionSnapshot) Diff(previous TransactionSnapshot) []RevisionChange {
+	changes := []RevisionChange{}
+	addChange := func(field string, from, to interface{}) {
+		changes = append(changes, RevisionChange{Field: field, From: from, To: to})
+	}
+
+	if s.Description != previous.Description {
+		addChange("description", previous.Description, s.Description)
+	}
+	if s.Amount != previous.Amount || s.Currency != previous.Currency {
+		addChange("amount", previous.Amount.Decimal(previous.Currency), s.Amount.Decimal(s.Currency))
+	}
+	if s.Currency != previous.Currency {
+		addChange("currency", previous.Currency, s.Currency)
+	}
+	if s.ExchangeRate != previous.ExchangeRate {
+		addChange("exchange_rate", previous.ExchangeRate, s.ExchangeRate)
+	}
+	if s.CategoryID != previous.CategoryID {
+		addChange("category_id", previous.CategoryID, s.CategoryID)
+	}
+	if s.PaidBy != previous.PaidBy {
+		addChange("paid_by", previous.PaidBy, s.PaidBy)
+	}
+	if s.SplitType != previous.SplitType {
+		addChange("split_type", previous.SplitType, s.SplitType)
+	}
+
+	changes = append(changes, diffUserAmounts("payment",
+		paymentAmounts(previous.Payments), previous.Currency,
+		paymentAmounts(s.Payments), s.Currency)...)
+	changes = append(changes, diffUserAmounts("split",
+		splitAmounts(previous.Splits), previous.Currency,
+		splitAmounts(s.Splits), s.Currency)...)
+
+	if !reflect.DeepEqual(normalizeItems(previous.Items), normalizeItems(s.Items)) || (len(s.Items) > 0 && s.Currency != previous.Currency) {
+		addChange("items", itemChangeValues(previous.Items, previous.Currency), itemChangeValues(s.Items, s.Currency))
+	}
+
+	if s.Receipt != previous.Receipt {
+		addChange("receipt", previous.Receipt, s.Receipt)
+	}
+	if s.Notes != previous.Notes {
+		addChange("notes", previous.Notes, s.Notes)
+	}
+
+	return changes
+}
+
+// paymentAmounts 依用戶彙總付款金額
+func paymentAmounts(payments []PaymentSnapshot) map[uint]money.Amount {
+	amounts := make(map[uint]money.Amount, len(payments))
+	for _, payment := range payments {
+		amounts[payment.UserID] += payment.Amount
+	}
+	return amounts
+}
+
+// splitAmounts 依用戶彙總分帳金額
+func splitAmounts(splits []SplitSnapshot) map[uint]money.Amount {
+	amounts := make(map[uint]money.Amount, len(splits))
+	for _, split := range splits {
+		amounts[split.UserID] += split.Amount
+	}
+	return amounts
+}
+
+// diffUserAmounts 逐一比較每位用戶的金額（依用戶 ID 排序）
+func diffUserAmounts(field string, from map[uint]money.Amount, fromCurrency string, to map[uint]money.Amount, toCurrency string) []RevisionChange {
+	userIDs := make([]uint, 0, len(from)+len(to))
+	for userID := range from {
+		userIDs = append(userIDs, userID)
+	}
+	for userID := range to {
+		if _, ok := from[userID]; !ok {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+
+	var changes []RevisionChange
+	for _, userID := range userIDs {
+		fromAmount, hadFrom := from[userID]
+		toAmount, hasTo := to[userID]
+		if hadFrom && hasTo && fromAmount == toAmount && fromCurrency == toCurrency {
+			continue
+		}
+
+		change := RevisionChange{Field: field, UserID: &userID}
+		if hadFrom {
+			change.From = fromAmount.Decimal(fromCurrency)
+		}
+		if hasTo {
+			change.To = toAmount.Decimal(toCurrency)
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// normalizeItems 將空的明細列表統一為 nil，避免 JSON 解碼差異造成誤判
+func normalizeItems(items []ItemSnapshot) []ItemSnapshot {
+	if len(items) == 0 {
+		return nil
+	}
+	normalized := make([]ItemSnapshot, len(items))
+	for i, item := range items {
+		if len(item.ConsumerIDs) == 0 {
+			item.ConsumerIDs = nil
+		}
+		normalized[i] = item
+	}
+	return normalized
+}
+
+// itemChangeValues 將明細項目轉換為十進位金額表示
+func itemChangeValues(items []ItemSnapshot, currency string) []ItemChangeValue {
+	values := make([]ItemChangeValue, len(items))
+	for i, item := range items {
+		values[i] = ItemChangeValue{
+			Name:        item.Name,
+			Kind:        item.Kind,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice.Decimal(currency),
+			ConsumerIDs: item.ConsumerIDs,
+		}
+	}
+	return values
+}
+
+// RevertTransactionRequest 回復交易版本請求
+type RevertTransactionRequest struct {
+	Revision int  `json:"revision" validate:"required,min=1"`
+	Version  uint `json:"version"` // 回復所依據的交易版本，未提供 If-Match 標頭時使用
+}
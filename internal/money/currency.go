@@ -0,0 +1,206 @@
+package money
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Currency ISO 4217 幣別資訊
+type Currency struct {
+	Code        string // 三碼字母代碼，例如 TWD
+	NumericCode string // 三碼數字代碼，例如 901
+	Exponent    int    // 最小貨幣單位的小數位數
+	Symbol      string // 顯示用符號
+}
+
+// currencies ISO 4217 現行流通幣別（不含基金與貴金屬代碼）
+var currencies = map[string]Currency{}
+
+func init() {
+	for _, currency := range []Currency{
+		{"AED", "784", 2, "د.إ"},
+		{"AFN", "971", 2, "؋"},
+		{"ALL", "008", 2, "L"},
+		{"AMD", "051", 2, "֏"},
+		{"ANG", "532", 2, "ƒ"},
+		{"AOA", "973", 2, "Kz"},
+		{"ARS", "032", 2, "$"},
+		{"AUD", "036", 2, "A$"},
+		{"AWG", "533", 2, "ƒ"},
+		{"AZN", "944", 2, "₼"},
+		{"BAM", "977", 2, "KM"},
+		{"BBD", "052", 2, "$"},
+		{"BDT", "050", 2, "৳"},
+		{"BGN", "975", 2, "лв"},
+		{"BHD", "048", 3, ".د.ب"},
+		{"BIF", "108", 0, "FBu"},
+		{"BMD", "060", 2, "$"},
+		{"BND", "096", 2, "$"},
+		{"BOB", "068", 2, "Bs."},
+		{"BRL", "986", 2, "R$"},
+		{"BSD", "044", 2, "$"},
+		{"BTN", "064", 2, "Nu."},
+		{"BWP", "072", 2, "P"},
+		{"BYN", "933", 2, "Br"},
+		{"BZD", "084", 2, "$"},
+		{"CAD", "124", 2, "C$"},
+		{"CDF", "976", 2, "FC"},
+		{"CHF", "756", 2, "CHF"},
+		{"CLP", "152", 0, "$"},
+		{"CNY", "156", 2, "¥"},
+		{"COP", "170", 2, "$"},
+		{"CRC", "188", 2, "₡"},
+		{"CUP", "192", 2, "$"},
+		{"CVE", "132", 2, "$"},
+		{"CZK", "203", 2, "Kč"},
+		{"DJF", "262", 0, "Fdj"},
+		{"DKK", "208", 2, "kr"},
+		{"DOP", "214", 2, "$"},
+		{"DZD", "012", 2, "د.ج"},
+		{"EGP", "818", 2, "E£"},
+		{"ERN", "232", 2, "Nfk"},
+		{"ETB", "230", 2, "Br"},
+		{"EUR", "978", 2, "€"},
+		{"FJD", "242", 2, "$"},
+		{"FKP", "238", 2, "£"},
+		{"GBP", "826", 2, "£"},
+		{"GEL", "981", 2, "₾"},
+		{"GHS", "936", 2, "₵"},
+		{"GIP", "292", 2, "£"},
+		{"GMD", "270", 2, "D"},
+		{"GNF", "324", 0, "FG"},
+		{"GTQ", "320", 2, "Q"},
+		{"GYD", "328", 2, "$"},
+		{"HKD", "344", 2, "HK$"},
+		{"HNL", "340", 2, "L"},
+		{"HTG", "332", 2, "G"},
+		{"HUF", "348", 2, "Ft"},
+		{"IDR", "360", 2, "Rp"},
+		{"ILS", "376", 2, "₪"},
+		{"INR", "356", 2, "₹"},
+		{"IQD", "368", 3, "ع.د"},
+		{"IRR", "364", 2, "﷼"},
+		{"ISK", "352", 0, "kr"},
+		{"JMD", "388", 2, "$"},
+		{"JOD", "400", 3, "د.ا"},
+		{"JPY", "392", 0, "¥"},
+		{"KES", "404", 2, "KSh"},
+		{"KGS", "417", 2, "с"},
+		{"KHR", "116", 2, "៛"},
+		{"KMF", "174", 0, "CF"},
+		{"KPW", "408", 2, "₩"},
+		{"KRW", "410", 0, "₩"},
+		{"KWD", "414", 3, "د.ك"},
+		{"KYD", "136", 2, "$"},
+		{"KZT", "398", 2, "₸"},
+		{"LAK", "418", 2, "₭"},
+		{"LBP", "422", 2, "ل.ل"},
+		{"LKR", "144", 2, "Rs"},
+		{"LRD", "430", 2, "$"},
+		{"LSL", "426", 2, "L"},
+		{"LYD", "434", 3, "ل.د"},
+		{"MAD", "504", 2, "د.م."},
+		{"MDL", "498", 2, "L"},
+		{"MGA", "969", 2, "Ar"},
+		{"MKD", "807", 2, "ден"},
+		{"MMK", "104", 2, "K"},
+		{"MNT", "496", 2, "₮"},
+		{"MOP", "446", 2, "MOP$"},
+		{"MRU", "929", 2, "UM"},
+		{"MUR", "480", 2, "₨"},
+		{"MVR", "462", 2, "Rf"},
+		{"MWK", "454", 2, "MK"},
+		{"MXN", "484", 2, "$"},
+		{"MYR", "458", 2, "RM"},
+		{"MZN", "943", 2, "MT"},
+		{"NAD", "516", 2, "$"},
+		{"NGN", "566", 2, "₦"},
+		{"NIO", "558", 2, "C$"},
+		{"NOK", "578", 2, "kr"},
+		{"NPR", "524", 2, "₨"},
+		{"NZD", "554", 2, "NZ$"},
+		{"OMR", "512", 3, "ر.ع."},
+		{"PAB", "590", 2, "B/."},
+		{"PEN", "604", 2, "S/"},
+		{"PGK", "598", 2, "K"},
+		{"PHP", "608", 2, "₱"},
+		{"PKR", "586", 2, "₨"},
+		{"PLN", "985", 2, "zł"},
+		{"PYG", "600", 0, "₲"},
+		{"QAR", "634", 2, "ر.ق"},
+		{"RON", "946", 2, "lei"},
+		{"RSD", "941", 2, "дин."},
+		{"RUB", "643", 2, "₽"},
+		{"RWF", "646", 0, "FRw"},
+		{"SAR", "682", 2, "ر.س"},
+		{"SBD", "090", 2, "$"},
+		{"SCR", "690", 2, "₨"},
+		{"SDG", "938", 2, "ج.س."},
+		{"SEK", "752", 2, "kr"},
+		{"SGD", "702", 2, "S$"},
+		{"SHP", "654", 2, "£"},
+		{"SLE", "925", 2, "Le"},
+		{"SOS", "706", 2, "Sh"},
+		{"SRD", "968", 2, "$"},
+		{"SSP", "728", 2, "£"},
+		{"STN", "930", 2, "Db"},
+		{"SYP", "760", 2, "£"},
+		{"SZL", "748", 2, "L"},
+		{"THB", "764", 2, "฿"},
+		{"TJS", "972", 2, "SM"},
+		{"TMT", "934", 2, "m"},
+		{"TND", "788", 3, "د.ت"},
+		{"TOP", "776", 2, "T$"},
+		{"TRY", "949", 2, "₺"},
+		{"TTD", "780", 2, "$"},
+		{"TWD", "901", 2, "NT$"},
+		{"TZS", "834", 2, "TSh"},
+		{"UAH", "980", 2, "₴"},
+		{"UGX", "800", 0, "USh"},
+		{"USD", "840", 2, "$"},
+		{"UYU", "858", 2, "$U"},
+		{"UZS", "860", 2, "soʻm"},
+		{"VES", "928", 2, "Bs."},
+		{"VND", "704", 0, "₫"},
+		{"VUV", "548", 0, "VT"},
+		{"WST", "882", 2, "T"},
+		{"XAF", "950", 0, "FCFA"},
+		{"XCD", "951", 2, "$"},
+		{"XOF", "952", 0, "CFA"},
+		{"XPF", "953", 0, "₣"},
+		{"YER", "886", 2, "﷼"},
+		{"ZAR", "710", 2, "R"},
+		{"ZMW", "967", 2, "ZK"},
+		{"ZWL", "932", 2, "$"},
+	} {
+		currencies[currency.Code] = currency
+	}
+}
+
+// LookupCurrency 依代碼查詢幣別（不分大小寫）
+func LookupCurrency(code string) (Currency, bool) {
+	currency, exists := currencies[strings.ToUpper(strings.TrimSpace(code))]
+	return currency, exists
+}
+
+// NormalizeCurrency 將幣別代碼轉為大寫並驗證是否為 ISO 4217 幣別
+func NormalizeCurrency(code string) (string, error) {
+	currency, exists := LookupCurrency(code)
+	if !exists {
+		return "", fmt.Errorf("不支援的幣別: %s", code)
+	}
+	return currency.Code, nil
+}
+
+// Currencies 依代碼排序列出所有支援的幣別
+func Currencies() []Currency {
+	result := make([]Currency, 0, len(currencies))
+	for _, currency := range currencies {
+		result = append(result, currency)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Code < result[j].Code
+	})
+	return result
+}
@@ -0,0 +1,237 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency 預設幣別
+const DefaultCurrency = "TWD"
+
+// Amount 以最小貨幣單位儲存的金額（例如 TWD 100.50 儲存為 10050）
+type Amount int64
+
+// defaultExponent 未知幣別（例如舊資料）使用的小數位數
+const defaultExponent = 2
+
+// Exponent 取得幣別的小數位數（依 ISO 4217），未知幣別預設為 2 位
+func Exponent(currency string) int {
+	if c, exists := LookupCurrency(currency); exists {
+		return c.Exponent
+	}
+	return defaultExponent
+}
+
+// Exponents 列出所有已知幣別的小數位數（供 SQL 轉換使用）
+func Exponents() map[string]int {
+	result := make(map[string]int, len(currencies))
+	for code, currency := range currencies {
+		result[code] = currency.Exponent
+	}
+	return result
+}
+
+// pow10 計算 10 的 n 次方
+func pow10(n int) int64 {
+	result := int64(1)
+	for i := 0; i < n; i++ {
+		result *= 10
+	}
+	return result
+}
+
+// FromFloat 將主要單位的浮點數金額轉換為最小貨幣單位（四捨五入）
+func FromFloat(value float64, currency string) Amount {
+	return Amount(math.Round(value * float64(pow10(Exponent(currency)))))
+}
+
+// Convert 依匯率將金額從來源幣別換算為目標幣別的最小貨幣單位（四捨五入）
+func Convert(a Amount, from, to string, rate float64) Amount {
+	scale := math.Pow10(Exponent(to) - Exponent(from))
+	return Amount(math.Round(float64(a) * rate * scale))
+}
+
+// Float64 將金額轉換為主要單位的浮點數（僅供顯示使用）
+func (a Amount) Float64(currency string) float64 {
+	return float64(a) / float64(pow10(Exponent(currency)))
+}
+
+// String 以主要單位格式化金額，例如 10050 (TWD) => "100.50"
+func (a Amount) String(currency string) string {
+	exp := Exponent(currency)
+	sign := ""
+	value := int64(a)
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	if exp == 0 {
+		return sign + strconv.FormatInt(value, 10)
+	}
+	unit := pow10(exp)
+	fraction := strconv.FormatInt(value%unit, 10)
+	fraction = strings.Repeat("0", exp-len(fraction)) + fraction
+	return sign + strconv.FormatInt(value/unit, 10) + "." + fraction
+}
+
+// Decimal 轉換為 JSON 使用的十進位表示
+func (a Amount) Decimal(currency string) Decimal {
+	return Decimal(a.String(currency))
+}
+
+// Parse 將十進位字串精確轉換為最小貨幣單位，小數位數超過幣別精度時回傳錯誤
+func Parse(value string, currency string) (Amount, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	negative := false
+	switch value[0] {
+	case '-':
+		negative = true
+		value = value[1:]
+	case '+':
+		value = value[1:]
+	}
+
+	integerPart, fractionPart, _ := strings.Cut(value, ".")
+	if integerPart == "" && fractionPart == "" {
+		return 0, errors.New("無效的金額格式")
+	}
+	if integerPart == "" {
+		integerPart = "0"
+	}
+
+	exp := Exponent(currency)
+	fractionPart = strings.TrimRight(fractionPart, "0")
+	if len(fractionPart) > exp {
+		return 0, errors.New("金額小數位數超過幣別精度")
+	}
+	fractionPart += strings.Repeat("0", exp-len(fractionPart))
+
+	for _, r := range integerPart + fractionPart {
+		if r < '0' || r > '9' {
+			return 0, errors.New("無效的金額格式")
+		}
+	}
+
+	minor, err := strconv.ParseInt(integerPart+fractionPart, 10, 64)
+	if err != nil {
+		return 0, errors.New("金額超出範圍")
+	}
+	if negative {
+		minor = -minor
+	}
+
+	return Amount(minor), nil
+}
+
+// Decimal JSON 中的十進位金額，直接保留原始字面值以避免浮點誤差
+type Decimal string
+
+// UnmarshalJSON 接受 JSON 數字或字串
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*d = ""
+		return nil
+	}
+
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return errors.New("無效的金額格式")
+	}
+	if strings.ContainsAny(number.String(), "eE") {
+		return errors.New("金額不支援科學記號")
+	}
+
+	*d = Decimal(number.String())
+	return nil
+}
+
+// MarshalJSON 以 JSON 數字輸出
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	if d == "" {
+		return []byte("0"), nil
+	}
+	return []byte(d), nil
+}
+
+// IsZero 判斷金額是否未提供或為零
+func (d Decimal) IsZero() bool {
+	value := strings.TrimLeft(string(d), "+-")
+	return strings.Trim(strings.Replace(value, ".", "", 1), "0") == ""
+}
+
+// Amount 依幣別精度轉換為最小貨幣單位
+func (d Decimal) Amount(currency string) (Amount, error) {
+	return Parse(string(d), currency)
+}
+
+// Allocate 依權重將總金額分配為整數金額，使用最大餘數法確保總和等於總金額
+// 餘數相同時依輸入順序分配，結果具確定性
+func Allocate(total Amount, weights []int64) ([]Amount, error) {
+	if len(weights) == 0 {
+		return nil, errors.New("沒有可分配的對象")
+	}
+	if total < 0 {
+		return nil, errors.New("分配金額不能為負數")
+	}
+
+	var weightSum uint64
+	for _, weight := range weights {
+		if weight < 0 {
+			return nil, errors.New("分配權重不能為負數")
+		}
+		var carry uint64
+		weightSum, carry = bits.Add64(weightSum, uint64(weight), 0)
+		if carry != 0 {
+			return nil, errors.New("分配權重總和過大")
+		}
+	}
+	if weightSum == 0 {
+		return nil, errors.New("分配權重總和必須大於 0")
+	}
+
+	shares := make([]Amount, len(weights))
+	remainders := make([]uint64, len(weights))
+	var allocated Amount
+	for i, weight := range weights {
+		// 使用 128 位元乘法避免溢位
+		hi, lo := bits.Mul64(uint64(total), uint64(weight))
+		quotient, remainder := bits.Div64(hi, lo, weightSum)
+		shares[i] = Amount(quotient)
+		remainders[i] = remainder
+		allocated += shares[i]
+	}
+
+	// 依餘數由大到小分配剩餘的最小單位
+	for leftover := total - allocated; leftover > 0; leftover-- {
+		best := -1
+		for i := range remainders {
+			if remainders[i] == 0 {
+				continue
+			}
+			if best == -1 || remainders[i] > remainders[best] {
+				best = i
+			}
+		}
+		shares[best]++
+		remainders[best] = 0
+	}
+
+	return shares, nil
+}
+
+// SplitEvenly 將總金額平均分配給 n 個對象
+func SplitEvenly(total Amount, n int) ([]Amount, error) {
+	weights := make([]int64, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	return Allocate(total, weights)
+}
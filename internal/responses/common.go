@@ -32,6 +32,15 @@ func ErrorResponse(message string) APIResponse {
 	}
 }
 
+// ErrorWithDataResponse 帶資料的錯誤回應（例如版本衝突時回傳目前的資料）
+func ErrorWithDataResponse(message string, data interface{}) APIResponse {
+	return APIResponse{
+		Error:   true,
+		Message: message,
+		Data:    data,
+	}
+}
+
 // PaginationMeta 分頁元資訊
 type PaginationMeta struct {
 	Page       int   `json:"page"`
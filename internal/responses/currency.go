@@ -0,0 +1,30 @@
+package responses
+
+import "split-go/internal/money"
+
+// CurrencyResponse 幣別回應結構
+type CurrencyResponse struct {
+	Code        string `json:"code"`
+	NumericCode string `json:"numeric_code"`
+	Exponent    int    `json:"exponent"` // 小數位數，金額會依此位數進位
+	Symbol      string `json:"symbol"`
+}
+
+// NewCurrencyResponse 創建幣別回應
+func NewCurrencyResponse(currency money.Currency) CurrencyResponse {
+	return CurrencyResponse{
+		Code:        currency.Code,
+		NumericCode: currency.NumericCode,
+		Exponent:    currency.Exponent,
+		Symbol:      currency.Symbol,
+	}
+}
+
+// NewCurrencyResponseList 創建幣別列表回應
+func NewCurrencyResponseList(currencies []money.Currency) []CurrencyResponse {
+	result := make([]CurrencyResponse, len(currencies))
+	for i, currency := range currencies {
+		result[i] = NewCurrencyResponse(currency)
+	}
+	return result
+}
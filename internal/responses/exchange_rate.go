@@ -0,0 +1,30 @@
+package responses
+
+import (
+	"split-go/internal/models"
+	"split-go/internal/money"
+)
+
+// ExchangeRateResponse 匯率回應結構
+type ExchangeRateResponse struct {
+	Base   string  `json:"base"`
+	Quote  string  `json:"quote"`
+	Rate   float64 `json:"rate"`
+	Date   string  `json:"date"` // 實際使用的匯率日期 (YYYY-MM-DD)，可能早於查詢日期
+	Source string  `json:"source,omitempty"`
+
+	// 換算預覽（有提供 amount 時才會回傳）
+	Amount          money.Decimal `json:"amount,omitempty"`
+	ConvertedAmount money.Decimal `json:"converted_amount,omitempty"`
+}
+
+// NewExchangeRateResponse 創建匯率回應
+func NewExchangeRateResponse(rate models.ExchangeRate) ExchangeRateResponse {
+	return ExchangeRateResponse{
+		Base:   rate.Base,
+		Quote:  rate.Quote,
+		Rate:   rate.Rate,
+		Date:   rate.Date.Format("2006-01-02"),
+		Source: rate.Source,
+	}
+}
@@ -7,21 +7,25 @@ import (
 
 // GroupResponse 群組回應結構
 type GroupResponse struct {
-	ID          uint               `json:"id"`
-	Name        string             `json:"name"`
-	Description string             `json:"description,omitempty"`
-	Creator     UserSimpleResponse `json:"creator"`
-	CreatedAt   time.Time          `json:"created_at"`
+	ID           uint               `json:"id"`
+	Name         string             `json:"name"`
+	Description  string             `json:"description,omitempty"`
+	BaseCurrency string             `json:"base_currency"`
+	Version      uint               `json:"version"` // 修改時透過 If-Match 或 version 欄位帶回
+	Creator      UserSimpleResponse `json:"creator"`
+	CreatedAt    time.Time          `json:"created_at"`
 }
 
 // NewGroupResponse 創建群組回應
 func NewGroupResponse(group models.Group) GroupResponse {
 	return GroupResponse{
-		ID:          group.ID,
-		Name:        group.Name,
-		Description: group.Description,
-		Creator:     NewUserSimpleResponse(group.Creator),
-		CreatedAt:   group.CreatedAt,
+		ID:           group.ID,
+		Name:         group.Name,
+		Description:  group.Description,
+		BaseCurrency: group.BaseCurrency,
+		Version:      group.Version,
+		Creator:      NewUserSimpleResponse(group.Creator),
+		CreatedAt:    group.CreatedAt,
 	}
 }
 
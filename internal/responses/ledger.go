@@ -0,0 +1,117 @@
+package responses
+
+import (
+	"split-go/internal/models"
+	"split-go/internal/money"
+	"time"
+)
+
+// LedgerAccountResponse 成員帳戶彙總回應格式
+type LedgerAccountResponse struct {
+	UserID   uint          `json:"user_id"`
+	User     UserResponse  `json:"user"`
+	Currency string        `json:"currency"`
+	Debit    money.Decimal `json:"debit"`
+	Credit   money.Decimal `json:"credit"`
+	Balance  money.Decimal `json:"balance"` // 借方減貸方，正數應收
+}
+
+// LedgerTotalResponse 單一幣別借貸合計回應格式
+type LedgerTotalResponse struct {
+	Currency string        `json:"currency"`
+	Debit    money.Decimal `json:"debit"`
+	Credit   money.Decimal `json:"credit"`
+}
+
+// TrialBalanceResponse 試算表回應格式
+type TrialBalanceResponse struct {
+	BaseCurrency      string                  `json:"base_currency"`
+	Accounts          []LedgerAccountResponse `json:"accounts"`
+	Totals            []LedgerTotalResponse   `json:"totals"`
+	UnbalancedEntries []uint                  `json:"unbalanced_entries"` // 借貸不相等的分錄
+	Balanced          bool                    `json:"balanced"`
+}
+
+// NewTrialBalanceResponse 創建試算表回應
+func NewTrialBalanceResponse(trialBalance models.TrialBalance) TrialBalanceResponse {
+	accounts := make([]LedgerAccountResponse, len(trialBalance.Accounts))
+	for i, account := range trialBalance.Accounts {
+		accounts[i] = LedgerAccountResponse{
+			UserID:   account.UserID,
+			User:     NewUserResponse(account.User),
+			Currency: account.Currency,
+			Debit:    account.Debit.Decimal(account.Currency),
+			Credit:   account.Credit.Decimal(account.Currency),
+			Balance:  account.Balance.Decimal(account.Currency),
+		}
+	}
+
+	totals := make([]LedgerTotalResponse, len(trialBalance.Totals))
+	for i, total := range trialBalance.Totals {
+		totals[i] = LedgerTotalResponse{
+			Currency: total.Currency,
+			Debit:    total.Debit.Decimal(total.Currency),
+			Credit:   total.Credit.Decimal(total.Currency),
+		}
+	}
+
+	return TrialBalanceResponse{
+		BaseCurrency:      trialBalance.BaseCurrency,
+		Accounts:          accounts,
+		Totals:            totals,
+		UnbalancedEntries: trialBalance.UnbalancedEntries,
+		Balanced:          trialBalance.Balanced,
+	}
+}
+
+// StatementLineResponse 帳戶明細中單筆過帳的回應格式
+type StatementLineResponse struct {
+	EntryID        uint          `json:"entry_id"`
+	SourceType     string        `json:"source_type"` // transaction 或 settlement
+	SourceID       uint          `json:"source_id"`
+	Description    string        `json:"description"`
+	Reversal       bool          `json:"reversal"` // 修改交易時沖銷原本過帳的分錄
+	Kind           string        `json:"kind"`     // payment、share 或 settlement
+	Currency       string        `json:"currency"`
+	Amount         money.Decimal `json:"amount"`          // 正數借方，負數貸方
+	BaseAmount     money.Decimal `json:"base_amount"`     // 換算為群組基準幣別的金額
+	RunningBalance money.Decimal `json:"running_balance"` // 過帳後的累計平衡（群組基準幣別）
+	PostedAt       time.Time     `json:"posted_at"`
+}
+
+// AccountStatementResponse 成員帳戶明細回應格式
+type AccountStatementResponse struct {
+	UserID       uint                    `json:"user_id"`
+	User         UserResponse            `json:"user"`
+	BaseCurrency string                  `json:"base_currency"`
+	Lines        []StatementLineResponse `json:"lines"`
+	Balance      money.Decimal           `json:"balance"`
+}
+
+// NewAccountStatementResponse 創建帳戶明細回應
+func NewAccountStatementResponse(statement models.AccountStatement) AccountStatementResponse {
+	lines := make([]StatementLineResponse, len(statement.Lines))
+	for i, line := range statement.Lines {
+		lines[i] = StatementLineResponse{
+			EntryID:        line.EntryID,
+			SourceType:     string(line.SourceType),
+			SourceID:       line.SourceID,
+			Description:    line.Description,
+			Reversal:       line.Reversal,
+			Kind:           string(line.Kind),
+			Currency:       line.Currency,
+			Amount:         line.Amount.Decimal(line.Currency),
+			BaseAmount:     line.BaseAmount.Decimal(statement.BaseCurrency),
+			RunningBalance: line.RunningBalance.Decimal(statement.BaseCurrency),
+			PostedAt:       line.PostedAt,
+		}
+	}
+
+	return AccountStatementResponse{
+		UserID:       statement.UserID,
+		User:         NewUserResponse(statement.User),
+		BaseCurrency: statement.BaseCurrency,
+		Lines:        lines,
+		Balance:      statement.Balance.Decimal(statement.BaseCurrency),
+	}
+}
@@ -0,0 +1,94 @@
+package responses
+
+import (
+	"split-go/internal/models"
+	"split-go/internal/money"
+	"time"
+)
+
+// RecurringTransactionResponse 定期交易範本回應結構
+type RecurringTransactionResponse struct {
+	ID           uint                               `json:"id"`
+	GroupID      uint                               `json:"group_id"`
+	Description  string                             `json:"description"`
+	Amount       money.Decimal                      `json:"amount"`
+	Currency     string                             `json:"currency"`
+	ExchangeRate float64                            `json:"exchange_rate,omitempty"` // 固定匯率，未設定時每期依匯率資料換算
+	Category     *CategoryResponse                  `json:"category,omitempty"`
+	Payer        UserSimpleResponse                 `json:"payer"`
+	Payments     []models.TransactionPaymentRequest `json:"payments,omitempty"`
+	SplitType    models.SplitType                   `json:"split_type"`
+	Splits       []models.TransactionSplitRequest   `json:"splits"`
+	Notes        string                             `json:"notes,omitempty"`
+	Creator      UserSimpleResponse                 `json:"creator"`
+	CreatedAt    time.Time                          `json:"created_at"`
+	UpdatedAt    time.Time                          `json:"updated_at"`
+
+	// 排程設定
+	Frequency  models.RecurrenceFrequency `json:"frequency"`
+	Interval   int                        `json:"interval"`
+	DayOfMonth int                        `json:"day_of_month,omitempty"`
+	StartDate  string                     `json:"start_date"`
+	EndDate    string                     `json:"end_date,omitempty"`
+	NextRunAt  string                     `json:"next_run_at"`
+	LastRunAt  string                     `json:"last_run_at,omitempty"`
+	Active     bool                       `json:"active"`
+	LastError  string                     `json:"last_error,omitempty"`
+}
+
+// NewRecurringTransactionResponse 創建定期交易回應
+func NewRecurringTransactionResponse(recurring models.RecurringTransaction) RecurringTransactionResponse {
+	// 範本內容於建立時已驗證，解析失敗時回傳空的分帳定義
+	splits, _ := recurring.SplitRequests()
+	payments, _ := recurring.PaymentRequests()
+
+	var categoryResponse *CategoryResponse
+	if recurring.CategoryID != 0 && recurring.Category.ID != 0 {
+		category := NewCategoryResponse(recurring.Category)
+		categoryResponse = &category
+	}
+
+	var endDate, lastRunAt string
+	if recurring.EndDate != nil {
+		endDate = recurring.EndDate.Format("2006-01-02")
+	}
+	if recurring.LastRunAt != nil {
+		lastRunAt = recurring.LastRunAt.Format("2006-01-02")
+	}
+
+	return RecurringTransactionResponse{
+		ID:           recurring.ID,
+		GroupID:      recurring.GroupID,
+		Description:  recurring.Description,
+		Amount:       recurring.Amount.Decimal(recurring.Currency),
+		Currency:     recurring.Currency,
+		ExchangeRate: recurring.ExchangeRate,
+		Category:     categoryResponse,
+		Payer:        NewUserSimpleResponse(recurring.Payer),
+		Payments:     payments,
+		SplitType:    recurring.SplitType,
+		Splits:       splits,
+		Notes:        recurring.Notes,
+		Creator:      NewUserSimpleResponse(recurring.Creator),
+		CreatedAt:    recurring.CreatedAt,
+		UpdatedAt:    recurring.UpdatedAt,
+		Frequency:    recurring.Frequency,
+		Interval:     recurring.Interval,
+		DayOfMonth:   recurring.DayOfMonth,
+		StartDate:    recurring.StartDate.Format("2006-01-02"),
+		EndDate:      endDate,
+		NextRunAt:    recurring.NextRunAt.Format("2006-01-02"),
+		LastRunAt:    lastRunAt,
+		Active:       recurring.Active,
+		LastError:    recurring.LastError,
+	}
+}
+
+// NewRecurringTransactionResponseList 批量轉換定期交易列表
+func NewRecurringTransactionResponseList(recurrings []models.RecurringTransaction) []RecurringTransactionResponse {
+	result := make([]RecurringTransactionResponse, len(recurrings))
+	for i, recurring := range recurrings {
+		result[i] = NewRecurringTransactionResponse(recurring)
+	}
+	return result
+}
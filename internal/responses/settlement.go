@@ -2,74 +2,210 @@ package responses
 
 import (
 	"split-go/internal/models"
+	"split-go/internal/money"
 	"time"
 )
 
 // SettlementResponse 結算記錄回應格式
 type SettlementResponse struct {
-	ID         uint          `json:"id"`
-	GroupID    uint          `json:"group_id"`
-	Group      GroupResponse `json:"group"`
-	FromUserID uint          `json:"from_user_id"`
-	FromUser   UserResponse  `json:"from_user"`
-	ToUserID   uint          `json:"to_user_id"`
-	ToUser     UserResponse  `json:"to_user"`
-	Amount     float64       `json:"amount"`
-	Currency   string        `json:"currency"`
-	Status     string        `json:"status"`
-	SettledAt  *time.Time    `json:"settled_at"`
-	Notes      string        `json:"notes"`
-	CreatedAt  time.Time     `json:"created_at"`
-	UpdatedAt  time.Time     `json:"updated_at"`
+	ID           uint          `json:"id"`
+	GroupID      uint          `json:"group_id"`
+	Group        GroupResponse `json:"group"`
+	FromUserID   uint          `json:"from_user_id"`
+	FromUser     UserResponse  `json:"from_user"`
+	ToUserID     uint          `json:"to_user_id"`
+	ToUser       UserResponse  `json:"to_user"`
+	Amount       money.Decimal `json:"amount"`
+	Currency     string        `json:"currency"`
+	ExchangeRate float64       `json:"exchange_rate"` // 兌換群組基準幣別的匯率（建立時鎖定）
+	BaseAmount   money.Decimal `json:"base_amount"`   // 換算為群組基準幣別的金額
+	Status       string        `json:"status"`
+	SettledAt    *time.Time    `json:"settled_at"`
+	Notes        string        `json:"notes"`
+	LinkID       string        `json:"link_id,omitempty"`  // 跨群組抵銷的結算記錄共用的識別碼
+	BatchID      string        `json:"batch_id,omitempty"` // 由結算建議批次建立的結算記錄共用的識別碼
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+
+	// 請款流程：requested 待付款者回覆 → pending（接受）或 rejected（拒絕）
+	Origin        string     `json:"origin"`                   // payment: 付款者建立，request: 收款者請款
+	RequestedBy   *uint      `json:"requested_by,omitempty"`   // 發起請款的收款者
+	RespondedAt   *time.Time `json:"responded_at,omitempty"`   // 付款者接受或拒絕請款的時間
+	DeclineReason string     `json:"decline_reason,omitempty"` // 付款者拒絕請款的原因
+	DisputeReason string     `json:"dispute_reason,omitempty"` // 最近一次提出爭議的原因
+
+	PaidAmount      money.Decimal `json:"paid_amount"`      // 收款者已確認的付款總額
+	RemainingAmount money.Decimal `json:"remaining_amount"` // 尚未付清的金額
 }
 
 // NewSettlementResponse 創建結算回應
 func NewSettlementResponse(settlement models.Settlement) SettlementResponse {
+	// 舊資料未記錄匯率時視為 1
+	exchangeRate := settlement.ExchangeRate
+	if exchangeRate == 0 {
+		exchangeRate = 1
+	}
+	baseCurrency := settlement.Group.BaseCurrency
+	if baseCurrency == "" {
+		baseCurrency = settlement.Currency
+	}
+	origin := "payment"
+	if settlement.RequestedBy != nil {
+		origin = "request"
+	}
+
 	return SettlementResponse{
-		ID:         settlement.ID,
-		GroupID:    settlement.GroupID,
-		Group:      NewGroupResponse(settlement.Group),
-		FromUserID: settlement.FromUserID,
-		FromUser:   NewUserResponse(settlement.FromUser),
-		ToUserID:   settlement.ToUserID,
-		ToUser:     NewUserResponse(settlement.ToUser),
-		Amount:     settlement.Amount,
-		Currency:   settlement.Currency,
-		Status:     settlement.Status,
-		SettledAt:  settlement.SettledAt,
-		Notes:      settlement.Notes,
-		CreatedAt:  settlement.CreatedAt,
-		UpdatedAt:  settlement.UpdatedAt,
+		ID:           settlement.ID,
+		GroupID:      settlement.GroupID,
+		Group:        NewGroupResponse(settlement.Group),
+		FromUserID:   settlement.FromUserID,
+		FromUser:     NewUserResponse(settlement.FromUser),
+		ToUserID:     settlement.ToUserID,
+		ToUser:       NewUserResponse(settlement.ToUser),
+		Amount:       settlement.Amount.Decimal(settlement.Currency),
+		Currency:     settlement.Currency,
+		ExchangeRate: exchangeRate,
+		BaseAmount:   settlement.AmountInBase().Decimal(baseCurrency),
+		Status:       string(settlement.Status),
+		SettledAt:    settlement.SettledAt,
+		Notes:        settlement.Notes,
+		LinkID:       settlement.LinkID,
+		BatchID:      settlement.BatchID,
+		CreatedAt:    settlement.CreatedAt,
+		UpdatedAt:    settlement.UpdatedAt,
+
+		Origin:        origin,
+		RequestedBy:   settlement.RequestedBy,
+		RespondedAt:   settlement.RespondedAt,
+		DeclineReason: settlement.DeclineReason,
+		DisputeReason: settlement.DisputeReason,
+
+		PaidAmount:      settlement.SettledAmount().Decimal(settlement.Currency),
+		RemainingAmount: settlement.RemainingAmount().Decimal(settlement.Currency),
+	}
+}
+
+// SettlementCreatedResponse 建立結算或請款的回應格式，包含預估的平衡
+type SettlementCreatedResponse struct {
+	SettlementResponse
+	Owed              money.Decimal     `json:"owed"`               // 建立前付款者應付給收款者的金額（群組基準幣別）
+	ProjectedBalances []BalanceResponse `json:"projected_balances"` // 未完成的結算及本次結算確認後的預估平衡
+	Warning           string            `json:"warning,omitempty"`  // 強制建立超額結算時的提醒
+}
+
+// NewSettlementCreatedResponse 創建建立結算的回應
+func NewSettlementCreatedResponse(settlement models.Settlement, projection models.SettlementProjection, warning string) SettlementCreatedResponse {
+	balances := make([]BalanceResponse, len(projection.Balances))
+	for i, balance := range projection.Balances {
+		balances[i] = NewBalanceResponse(balance)
+	}
+
+	return SettlementCreatedResponse{
+		SettlementResponse: NewSettlementResponse(settlement),
+		Owed:               projection.Owed.Decimal(projection.Currency),
+		ProjectedBalances:  balances,
+		Warning:            warning,
+	}
+}
+
+// SettlementPaymentResponse 結算付款回應格式
+type SettlementPaymentResponse struct {
+	ID           uint               `json:"id"`
+	SettlementID uint               `json:"settlement_id"`
+	Amount       money.Decimal      `json:"amount"`
+	Currency     string             `json:"currency"`
+	RecordedByID uint               `json:"recorded_by_id"`
+	RecordedBy   UserSimpleResponse `json:"recorded_by"`
+	Notes        string             `json:"notes"`
+	Confirmed    bool               `json:"confirmed"`
+	ConfirmedAt  *time.Time         `json:"confirmed_at"`
+	CreatedAt    time.Time          `json:"created_at"`
+}
+
+// NewSettlementPaymentResponse 創建結算付款回應
+func NewSettlementPaymentResponse(payment models.SettlementPayment, currency string) SettlementPaymentResponse {
+	return SettlementPaymentResponse{
+		ID:           payment.ID,
+		SettlementID: payment.SettlementID,
+		Amount:       payment.Amount.Decimal(currency),
+		Currency:     currency,
+		RecordedByID: payment.RecordedByID,
+		RecordedBy:   NewUserSimpleResponse(payment.RecordedBy),
+		Notes:        payment.Notes,
+		Confirmed:    payment.IsConfirmed(),
+		ConfirmedAt:  payment.ConfirmedAt,
+		CreatedAt:    payment.CreatedAt,
+	}
+}
+
+// SettlementPaymentResultResponse 記錄或確認付款後的回應格式
+type SettlementPaymentResultResponse struct {
+	Payment    SettlementPaymentResponse `json:"payment"`
+	Settlement SettlementResponse        `json:"settlement"` // 更新後的結算記錄
+}
+
+// NewSettlementPaymentResultResponse 創建記錄或確認付款後的回應
+func NewSettlementPaymentResultResponse(payment models.SettlementPayment, settlement models.Settlement) SettlementPaymentResultResponse {
+	return SettlementPaymentResultResponse{
+		Payment:    NewSettlementPaymentResponse(payment, settlement.Currency),
+		Settlement: NewSettlementResponse(settlement),
+	}
+}
+
+// SettlementEventResponse 結算狀態變更記錄回應格式
+type SettlementEventResponse struct {
+	ID         uint               `json:"id"`
+	ActorID    uint               `json:"actor_id"`
+	Actor      UserSimpleResponse `json:"actor"`
+	FromStatus string             `json:"from_status,omitempty"` // 建立結算時為空
+	ToStatus   string             `json:"to_status"`
+	Reason     string             `json:"reason,omitempty"`
+	CreatedAt  time.Time          `json:"created_at"`
+}
+
+// NewSettlementEventResponse 創建結算狀態變更記錄回應
+func NewSettlementEventResponse(event models.SettlementEvent) SettlementEventResponse {
+	return SettlementEventResponse{
+		ID:         event.ID,
+		ActorID:    event.ActorID,
+		Actor:      NewUserSimpleResponse(event.Actor),
+		FromStatus: string(event.FromStatus),
+		ToStatus:   string(event.ToStatus),
+		Reason:     event.Reason,
+		CreatedAt:  event.CreatedAt,
 	}
 }
 
 // BalanceResponse 平衡計算回應格式
 type BalanceResponse struct {
-	UserID  uint         `json:"user_id"`
-	User    UserResponse `json:"user"`
-	Balance float64      `json:"balance"` // 正數應收，負數應付
-	Paid    float64      `json:"paid"`    // 總支付金額
-	Owed    float64      `json:"owed"`    // 總應付金額
+	UserID   uint          `json:"user_id"`
+	User     UserResponse  `json:"user"`
+	Currency string        `json:"currency"`
+	Balance  money.Decimal `json:"balance"` // 正數應收，負數應付
+	Paid     money.Decimal `json:"paid"`    // 總支付金額
+	Owed     money.Decimal `json:"owed"`    // 總應付金額
 }
 
 // NewBalanceResponse 創建平衡回應
 func NewBalanceResponse(balance models.Balance) BalanceResponse {
 	return BalanceResponse{
-		UserID:  balance.UserID,
-		User:    NewUserResponse(balance.User),
-		Balance: balance.Balance,
-		Paid:    balance.Paid,
-		Owed:    balance.Owed,
+		UserID:   balance.UserID,
+		User:     NewUserResponse(balance.User),
+		Currency: balance.Currency,
+		Balance:  balance.Balance.Decimal(balance.Currency),
+		Paid:     balance.Paid.Decimal(balance.Currency),
+		Owed:     balance.Owed.Decimal(balance.Currency),
 	}
 }
 
 // SettlementSuggestionResponse 結算建議回應格式
 type SettlementSuggestionResponse struct {
-	FromUserID uint         `json:"from_user_id"`
-	FromUser   UserResponse `json:"from_user"`
-	ToUserID   uint         `json:"to_user_id"`
-	ToUser     UserResponse `json:"to_user"`
-	Amount     float64      `json:"amount"`
+	FromUserID uint          `json:"from_user_id"`
+	FromUser   UserResponse  `json:"from_user"`
+	ToUserID   uint          `json:"to_user_id"`
+	ToUser     UserResponse  `json:"to_user"`
+	Amount     money.Decimal `json:"amount"`
+	Currency   string        `json:"currency"`
 }
 
 // NewSettlementSuggestionResponse 創建結算建議回應
@@ -79,6 +215,274 @@ func NewSettlementSuggestionResponse(suggestion models.SettlementSuggestion) Set
 		FromUser:   NewUserResponse(suggestion.FromUser),
 		ToUserID:   suggestion.ToUserID,
 		ToUser:     NewUserResponse(suggestion.ToUser),
-		Amount:     suggestion.Amount,
+		Amount:     suggestion.Amount.Decimal(suggestion.Currency),
+		Currency:   suggestion.Currency,
+	}
+}
+
+// SettlementPlanResponse 結算建議列表回應格式
+type SettlementPlanResponse struct {
+	Strategy      models.SettlementStrategy      `json:"strategy"`       // 實際使用的演算法
+	TransferCount int                            `json:"transfer_count"` // 需要的轉帳次數
+	Suggestions   []SettlementSuggestionResponse `json:"suggestions"`
+	Fingerprint   string                         `json:"fingerprint"` // 批次建立結算時用於確認平衡未變更
+}
+
+// NewSettlementPlanResponse 創建結算建議列表回應
+func NewSettlementPlanResponse(plan models.SettlementPlan) SettlementPlanResponse {
+	suggestions := make([]SettlementSuggestionResponse, len(plan.Suggestions))
+	for i, suggestion := range plan.Suggestions {
+		suggestions[i] = NewSettlementSuggestionResponse(suggestion)
+	}
+
+	return SettlementPlanResponse{
+		Strategy:      plan.Strategy,
+		TransferCount: len(suggestions),
+		Suggestions:   suggestions,
+		Fingerprint:   plan.Fingerprint,
+	}
+}
+
+// PairwiseDebtResponse 兩兩債務回應格式
+type PairwiseDebtResponse struct {
+	FromUserID    uint                       `json:"from_user_id"`
+	FromUser      UserResponse               `json:"from_user"`
+	ToUserID      uint                       `json:"to_user_id"`
+	ToUser        UserResponse               `json:"to_user"`
+	Amount        money.Decimal              `json:"amount"`
+	Currency      string                     `json:"currency"`
+	Contributions []DebtContributionResponse `json:"contributions,omitempty"` // 僅在要求明細時回傳
+}
+
+// DebtContributionResponse 構成債務的交易或結算回應格式
+type DebtContributionResponse struct {
+	TransactionID *uint         `json:"transaction_id,omitempty"`
+	SettlementID  *uint         `json:"settlement_id,omitempty"`
+	Description   string        `json:"description"`
+	Date          time.Time     `json:"date"`
+	Amount        money.Decimal `json:"amount"` // 正數增加債務，負數減少債務
+}
+
+// NewPairwiseDebtResponse 創建兩兩債務回應，withDetails 為 true 時包含構成債務的明細
+func NewPairwiseDebtResponse(debt models.PairwiseDebt, withDetails bool) PairwiseDebtResponse {
+	response := PairwiseDebtResponse{
+		FromUserID: debt.FromUserID,
+		FromUser:   NewUserResponse(debt.FromUser),
+		ToUserID:   debt.ToUserID,
+		ToUser:     NewUserResponse(debt.ToUser),
+		Amount:     debt.Amount.Decimal(debt.Currency),
+		Currency:   debt.Currency,
+	}
+
+	if withDetails {
+		response.Contributions = make([]DebtContributionResponse, len(debt.Contributions))
+		for i, contribution := range debt.Contributions {
+			response.Contributions[i] = DebtContributionResponse{
+				TransactionID: contribution.TransactionID,
+				SettlementID:  contribution.SettlementID,
+				Description:   contribution.Description,
+				Date:          contribution.Date,
+				Amount:        contribution.Amount.Decimal(debt.Currency),
+			}
+		}
+	}
+
+	return response
+}
+
+// UserBalanceSummaryResponse 用戶跨群組平衡摘要回應格式
+type UserBalanceSummaryResponse struct {
+	Groups             []GroupBalanceSummaryResponse `json:"groups"`
+	Counterparties     []CounterpartyBalanceResponse `json:"counterparties"` // 跨群組加總的對象債務（依幣別分開）
+	Totals             []CurrencyBalanceResponse     `json:"totals"`         // 依幣別加總的淨平衡
+	ConvertedTotal     *CurrencyBalanceResponse      `json:"converted_total,omitempty"`
+	PendingSettlements []PendingSettlementResponse   `json:"pending_settlements"`
+}
+
+// GroupBalanceSummaryResponse 用戶在單一群組中的平衡回應格式
+type GroupBalanceSummaryResponse struct {
+	Group          GroupSimpleResponse           `json:"group"`
+	Currency       string                        `json:"currency"`
+	Balance        money.Decimal                 `json:"balance"` // 正數應收，負數應付
+	Paid           money.Decimal                 `json:"paid"`
+	Owed           money.Decimal                 `json:"owed"`
+	Counterparties []CounterpartyBalanceResponse `json:"counterparties"`
+}
+
+// CounterpartyBalanceResponse 與另一位用戶之間的債務回應格式
+type CounterpartyBalanceResponse struct {
+	UserID   uint               `json:"user_id"`
+	User     UserSimpleResponse `json:"user"`
+	Currency string             `json:"currency"`
+	Amount   money.Decimal      `json:"amount"` // 正數表示對方欠你，負數表示你欠對方
+}
+
+// CurrencyBalanceResponse 單一幣別金額回應格式
+type CurrencyBalanceResponse struct {
+	Currency string        `json:"currency"`
+	Balance  money.Decimal `json:"balance"`
+}
+
+// PendingSettlementResponse 待付款結算回應格式
+type PendingSettlementResponse struct {
+	SettlementResponse
+	Direction string `json:"direction"` // outgoing: 你需要付款，incoming: 你將收款
+}
+
+// NewUserBalanceSummaryResponse 創建用戶跨群組平衡摘要回應
+func NewUserBalanceSummaryResponse(summary models.UserBalanceSummary, userID uint) UserBalanceSummaryResponse {
+	response := UserBalanceSummaryResponse{
+		Groups:             make([]GroupBalanceSummaryResponse, len(summary.Groups)),
+		Counterparties:     newCounterpartyBalanceResponses(summary.Counterparties),
+		Totals:             make([]CurrencyBalanceResponse, len(summary.Totals)),
+		PendingSettlements: make([]PendingSettlementResponse, len(summary.PendingSettlements)),
+	}
+
+	for i, group := range summary.Groups {
+		currency := group.Balance.Currency
+		response.Groups[i] = GroupBalanceSummaryResponse{
+			Group:          NewGroupSimpleResponse(group.Group),
+			Currency:       currency,
+			Balance:        group.Balance.Balance.Decimal(currency),
+			Paid:           group.Balance.Paid.Decimal(currency),
+			Owed:           group.Balance.Owed.Decimal(currency),
+			Counterparties: newCounterpartyBalanceResponses(group.Counterparties),
+		}
+	}
+
+	for i, total := range summary.Totals {
+		response.Totals[i] = NewCurrencyBalanceResponse(total)
+	}
+
+	for i, settlement := range summary.PendingSettlements {
+		direction := "incoming"
+		if settlement.FromUserID == userID {
+			direction = "outgoing"
+		}
+		response.PendingSettlements[i] = PendingSettlementResponse{
+			SettlementResponse: NewSettlementResponse(settlement),
+			Direction:          direction,
+		}
+	}
+
+	return response
+}
+
+// NewCurrencyBalanceResponse 創建單一幣別金額回應
+func NewCurrencyBalanceResponse(balance models.CurrencyBalance) CurrencyBalanceResponse {
+	return CurrencyBalanceResponse{
+		Currency: balance.Currency,
+		Balance:  balance.Balance.Decimal(balance.Currency),
+	}
+}
+
+// newCounterpartyBalanceResponses 轉換對象債務列表
+func newCounterpartyBalanceResponses(counterparties []models.CounterpartyBalance) []CounterpartyBalanceResponse {
+	result := make([]CounterpartyBalanceResponse, len(counterparties))
+	for i, counterparty := range counterparties {
+		result[i] = CounterpartyBalanceResponse{
+			UserID:   counterparty.UserID,
+			User:     NewUserSimpleResponse(counterparty.User),
+			Currency: counterparty.Currency,
+			Amount:   counterparty.Amount.Decimal(counterparty.Currency),
+		}
+	}
+	return result
+}
+
+// CrossGroupSuggestionResponse 跨群組抵銷建議回應格式
+type CrossGroupSuggestionResponse struct {
+	CounterpartyID uint                    `json:"counterparty_id"`
+	Counterparty   UserSimpleResponse      `json:"counterparty"`
+	Currency       string                  `json:"currency"`
+	FromUserID     uint                    `json:"from_user_id"`
+	ToUserID       uint                    `json:"to_user_id"`
+	Amount         money.Decimal           `json:"amount"`          // 抵銷後的淨額
+	TransfersSaved int                     `json:"transfers_saved"` // 相較於各群組分別結算省下的轉帳次數
+	Legs           []CrossGroupLegResponse `json:"legs"`
+}
+
+// CrossGroupLegResponse 單一群組內債務回應格式
+type CrossGroupLegResponse struct {
+	Group      GroupSimpleResponse `json:"group"`
+	FromUserID uint                `json:"from_user_id"`
+	ToUserID   uint                `json:"to_user_id"`
+	Amount     money.Decimal       `json:"amount"`
+}
+
+// NewCrossGroupSuggestionResponse 創建跨群組抵銷建議回應
+func NewCrossGroupSuggestionResponse(suggestion models.CrossGroupSuggestion) CrossGroupSuggestionResponse {
+	legs := make([]CrossGroupLegResponse, len(suggestion.Legs))
+	for i, leg := range suggestion.Legs {
+		legs[i] = CrossGroupLegResponse{
+			Group:      NewGroupSimpleResponse(leg.Group),
+			FromUserID: leg.FromUserID,
+			ToUserID:   leg.ToUserID,
+			Amount:     leg.Amount.Decimal(suggestion.Currency),
+		}
+	}
+
+	transfers := 0
+	if suggestion.Amount != 0 {
+		transfers = 1
+	}
+
+	return CrossGroupSuggestionResponse{
+		CounterpartyID: suggestion.CounterpartyID,
+		Counterparty:   NewUserSimpleResponse(suggestion.Counterparty),
+		Currency:       suggestion.Currency,
+		FromUserID:     suggestion.FromUserID,
+		ToUserID:       suggestion.ToUserID,
+		Amount:         suggestion.Amount.Decimal(suggestion.Currency),
+		TransfersSaved: len(legs) - transfers,
+		Legs:           legs,
+	}
+}
+
+// LinkedSettlementResponse 跨群組抵銷建立的結算記錄回應格式
+type LinkedSettlementResponse struct {
+	LinkID      string               `json:"link_id"`
+	FromUserID  uint                 `json:"from_user_id"` // 實際需要轉帳的一方
+	ToUserID    uint                 `json:"to_user_id"`
+	Amount      money.Decimal        `json:"amount"`
+	Currency    string               `json:"currency"`
+	Settlements []SettlementResponse `json:"settlements"` // 各群組的結算記錄
+}
+
+// NewLinkedSettlementResponse 創建跨群組抵銷結算記錄回應
+func NewLinkedSettlementResponse(linkID string, suggestion models.CrossGroupSuggestion, settlements []models.Settlement) LinkedSettlementResponse {
+	settlementResponses := make([]SettlementResponse, len(settlements))
+	for i, settlement := range settlements {
+		settlementResponses[i] = NewSettlementResponse(settlement)
+	}
+
+	return LinkedSettlementResponse{
+		LinkID:      linkID,
+		FromUserID:  suggestion.FromUserID,
+		ToUserID:    suggestion.ToUserID,
+		Amount:      suggestion.Amount.Decimal(suggestion.Currency),
+		Currency:    suggestion.Currency,
+		Settlements: settlementResponses,
+	}
+}
+
+// SettlementBatchResponse 由結算建議批次建立的結算記錄回應格式
+type SettlementBatchResponse struct {
+	BatchID     string                    `json:"batch_id"`
+	Strategy    models.SettlementStrategy `json:"strategy"`
+	Settlements []SettlementResponse      `json:"settlements"`
+}
+
+// NewSettlementBatchResponse 創建批次結算記錄回應
+func NewSettlementBatchResponse(batchID string, strategy models.SettlementStrategy, settlements []models.Settlement) SettlementBatchResponse {
+	settlementResponses := make([]SettlementResponse, len(settlements))
+	for i, settlement := range settlements {
+		settlementResponses[i] = NewSettlementResponse(settlement)
+	}
+
+	return SettlementBatchResponse{
+		BatchID:     batchID,
+		Strategy:    strategy,
+		Settlements: settlementResponses,
 	}
 }
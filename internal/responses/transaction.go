@@ -2,6 +2,7 @@ package responses
 
 import (
 	"split-go/internal/models"
+	"split-go/internal/money"
 	"time"
 )
 
@@ -9,42 +10,106 @@ import (
 type TransactionSplitResponse struct {
 	ID         uint               `json:"id"`
 	User       UserSimpleResponse `json:"user"`
-	Amount     float64            `json:"amount"`
+	Amount     money.Decimal      `json:"amount"`
 	Percentage float64            `json:"percentage"`
+	Shares     int64              `json:"shares,omitempty"`
+	Adjustment money.Decimal      `json:"adjustment,omitempty"`
 	SplitType  models.SplitType   `json:"split_type"`
 }
 
 // NewTransactionSplitResponse 創建分帳回應
-func NewTransactionSplitResponse(split models.TransactionSplit) TransactionSplitResponse {
+func NewTransactionSplitResponse(split models.TransactionSplit, currency string) TransactionSplitResponse {
+	// 只有調整模式才顯示調整金額
+	var adjustment money.Decimal
+	if split.Adjustment != 0 {
+		adjustment = split.Adjustment.Decimal(currency)
+	}
+
 	return TransactionSplitResponse{
 		ID:         split.ID,
 		User:       NewUserSimpleResponse(split.User),
-		Amount:     split.Amount,
+		Amount:     split.Amount.Decimal(currency),
 		Percentage: split.Percentage,
+		Shares:     split.Shares,
+		Adjustment: adjustment,
 		SplitType:  split.SplitType,
 	}
 }
 
+// TransactionPaymentResponse 付款明細回應結構
+type TransactionPaymentResponse struct {
+	User   UserSimpleResponse `json:"user"`
+	Amount money.Decimal      `json:"amount"`
+}
+
+// NewTransactionPaymentResponse 創建付款明細回應
+func NewTransactionPaymentResponse(payment models.TransactionPayment, currency string) TransactionPaymentResponse {
+	return TransactionPaymentResponse{
+		User:   NewUserSimpleResponse(payment.User),
+		Amount: payment.Amount.Decimal(currency),
+	}
+}
+
+// TransactionItemResponse 交易明細回應結構
+type TransactionItemResponse struct {
+	ID        uint                 `json:"id"`
+	Name      string               `json:"name"`
+	Kind      models.ItemKind      `json:"kind"`
+	Quantity  int64                `json:"quantity"`
+	UnitPrice money.Decimal        `json:"unit_price"`
+	Total     money.Decimal        `json:"total"`
+	Consumers []UserSimpleResponse `json:"consumers,omitempty"`
+}
+
+// NewTransactionItemResponse 創建交易明細回應
+func NewTransactionItemResponse(item models.TransactionItem, currency string) TransactionItemResponse {
+	consumers := make([]UserSimpleResponse, len(item.Consumers))
+	for i, consumer := range item.Consumers {
+		consumers[i] = NewUserSimpleResponse(consumer)
+	}
+
+	return TransactionItemResponse{
+		ID:        item.ID,
+		Name:      item.Name,
+		Kind:      item.Kind,
+		Quantity:  item.Quantity,
+		UnitPrice: item.UnitPrice.Decimal(currency),
+		Total:     item.Total().Decimal(currency),
+		Consumers: consumers,
+	}
+}
+
 // TransactionResponse 交易回應結構
 type TransactionResponse struct {
-	ID          uint                       `json:"id"`
-	Description string                     `json:"description"`
-	Amount      float64                    `json:"amount"`
-	Currency    string                     `json:"currency"`
-	Group       GroupSimpleResponse        `json:"group"`
-	Category    *CategoryResponse          `json:"category,omitempty"`
-	Payer       UserSimpleResponse         `json:"payer"`
-	Creator     UserSimpleResponse         `json:"creator"`
-	Splits      []TransactionSplitResponse `json:"splits"`
-	Receipt     string                     `json:"receipt,omitempty"`
-	Notes       string                     `json:"notes,omitempty"`
-	CreatedAt   time.Time                  `json:"created_at"`
-	UpdatedAt   time.Time                  `json:"updated_at"`
+	ID          uint                         `json:"id"`
+	Description string                       `json:"description"`
+	Amount      money.Decimal                `json:"amount"`
+	Currency    string                       `json:"currency"`
+	Group       GroupSimpleResponse          `json:"group"`
+	Category    *CategoryResponse            `json:"category,omitempty"`
+	Payer       UserSimpleResponse           `json:"payer"`    // 主要付款者（單一付款者時即為付款者）
+	Payments    []TransactionPaymentResponse `json:"payments"` // 所有付款者及其支付金額
+	Creator     UserSimpleResponse           `json:"creator"`
+	Splits      []TransactionSplitResponse   `json:"splits"`
+	Items       []TransactionItemResponse    `json:"items,omitempty"`
+	Receipt     string                       `json:"receipt,omitempty"`
+	Notes       string                       `json:"notes,omitempty"`
+	CreatedAt   time.Time                    `json:"created_at"`
+	UpdatedAt   time.Time                    `json:"updated_at"`
+	Version     uint                         `json:"version"` // 修改時透過 If-Match 或 version 欄位帶回
+
+	// 由定期交易產生時的來源範本
+	RecurringTransactionID *uint `json:"recurring_transaction_id,omitempty"`
+
+	// 基準幣別換算（匯率於建立時鎖定）
+	ExchangeRate float64       `json:"exchange_rate"`
+	BaseAmount   money.Decimal `json:"base_amount"`
+	BaseCurrency string        `json:"base_currency,omitempty"`
 
 	// 計算欄位（基於當前用戶）
-	MyAmount  float64 `json:"my_amount"`  // 我需要付的金額
-	MyBalance float64 `json:"my_balance"` // 我的平衡狀況 (付出 - 應付)
-	AmIPayer  bool    `json:"am_i_payer"` // 我是否為付款者
+	MyAmount  money.Decimal `json:"my_amount"`  // 我需要付的金額
+	MyBalance money.Decimal `json:"my_balance"` // 我的平衡狀況 (付出 - 應付)
+	AmIPayer  bool          `json:"am_i_payer"` // 我是否為付款者
 
 	// 權限欄位
 	CanEdit   bool `json:"can_edit"`   // 是否可以編輯
@@ -55,11 +120,22 @@ type TransactionResponse struct {
 func NewTransactionResponse(tx models.Transaction, currentUserID uint) TransactionResponse {
 	splits := make([]TransactionSplitResponse, len(tx.Splits))
 	for i, split := range tx.Splits {
-		splits[i] = NewTransactionSplitResponse(split)
+		splits[i] = NewTransactionSplitResponse(split, tx.Currency)
+	}
+
+	paymentsOrDefault := tx.PaymentsOrDefault()
+	payments := make([]TransactionPaymentResponse, len(paymentsOrDefault))
+	for i, payment := range paymentsOrDefault {
+		payments[i] = NewTransactionPaymentResponse(payment, tx.Currency)
+	}
+
+	var items []TransactionItemResponse
+	for _, item := range tx.Items {
+		items = append(items, NewTransactionItemResponse(item, tx.Currency))
 	}
 
 	// 計算當前用戶的應付金額
-	myAmount := 0.0
+	var myAmount money.Amount
 	for _, split := range tx.Splits {
 		if split.UserID == currentUserID {
 			myAmount = split.Amount
@@ -67,18 +143,22 @@ func NewTransactionResponse(tx models.Transaction, currentUserID uint) Transacti
 		}
 	}
 
-	// 計算平衡狀況
-	var myBalance float64
-	if tx.PaidBy == currentUserID {
-		// 我是付款者：我付的錢 - 我應該付的錢
-		myBalance = tx.Amount - myAmount
-	} else {
-		// 我不是付款者：0 - 我應該付的錢 = 負數（我欠錢）
-		myBalance = -myAmount
+	// 計算平衡狀況：我付的錢 - 我應該付的錢（不是付款者時為負數，表示我欠錢）
+	myPaid := tx.PaidAmount(currentUserID)
+	myBalance := myPaid - myAmount
+
+	// 基準幣別資訊（舊資料未記錄匯率時視為 1）
+	exchangeRate := tx.ExchangeRate
+	if exchangeRate == 0 {
+		exchangeRate = 1
+	}
+	baseCurrency := tx.Group.BaseCurrency
+	if baseCurrency == "" {
+		baseCurrency = tx.Currency
 	}
 
 	// 權限檢查
-	canEdit := tx.CreatedBy == currentUserID || tx.PaidBy == currentUserID
+	canEdit := tx.CreatedBy == currentUserID || tx.PaidBy == currentUserID || myPaid > 0
 	canDelete := tx.CreatedBy == currentUserID
 
 	// 處理 Category（可能為空）
@@ -89,24 +169,32 @@ func NewTransactionResponse(tx models.Transaction, currentUserID uint) Transacti
 	}
 
 	return TransactionResponse{
-		ID:          tx.ID,
-		Description: tx.Description,
-		Amount:      tx.Amount,
-		Currency:    tx.Currency,
-		Group:       NewGroupSimpleResponse(tx.Group),
-		Category:    categoryResponse,
-		Payer:       NewUserSimpleResponse(tx.Payer),
-		Creator:     NewUserSimpleResponse(tx.Creator),
-		Splits:      splits,
-		Receipt:     tx.Receipt,
-		Notes:       tx.Notes,
-		CreatedAt:   tx.CreatedAt,
-		UpdatedAt:   tx.UpdatedAt,
-		MyAmount:    myAmount,
-		MyBalance:   myBalance,
-		AmIPayer:    tx.PaidBy == currentUserID,
-		CanEdit:     canEdit,
-		CanDelete:   canDelete,
+		ID:           tx.ID,
+		Description:  tx.Description,
+		Amount:       tx.Amount.Decimal(tx.Currency),
+		Currency:     tx.Currency,
+		Group:        NewGroupSimpleResponse(tx.Group),
+		Category:     categoryResponse,
+		Payer:        NewUserSimpleResponse(tx.Payer),
+		Payments:     payments,
+		Creator:      NewUserSimpleResponse(tx.Creator),
+		Splits:       splits,
+		Items:        items,
+		Receipt:      tx.Receipt,
+		Notes:        tx.Notes,
+		CreatedAt:    tx.CreatedAt,
+		UpdatedAt:    tx.UpdatedAt,
+		Version:      tx.Version,
+		ExchangeRate: exchangeRate,
+		BaseAmount:   tx.AmountInBase().Decimal(baseCurrency),
+		BaseCurrency: tx.Group.BaseCurrency,
+		MyAmount:     myAmount.Decimal(tx.Currency),
+		MyBalance:    myBalance.Decimal(tx.Currency),
+		AmIPayer:     myPaid > 0,
+		CanEdit:      canEdit,
+		CanDelete:    canDelete,
+
+		RecurringTransactionID: tx.RecurringTransactionID,
 	}
 }
 
@@ -123,7 +211,7 @@ func NewTransactionResponseList(transactions []models.Transaction, currentUserID
 type TransactionSimpleResponse struct {
 	ID          uint                `json:"id"`
 	Description string              `json:"description"`
-	Amount      float64             `json:"amount"`
+	Amount      money.Decimal       `json:"amount"`
 	Currency    string              `json:"currency"`
 	Group       GroupSimpleResponse `json:"group"`
 	Category    *CategoryResponse   `json:"category,omitempty"`
@@ -131,14 +219,14 @@ type TransactionSimpleResponse struct {
 	CreatedAt   time.Time           `json:"created_at"`
 
 	// 簡化的計算欄位
-	MyAmount float64 `json:"my_amount"`
-	AmIPayer bool    `json:"am_i_payer"`
+	MyAmount money.Decimal `json:"my_amount"`
+	AmIPayer bool          `json:"am_i_payer"`
 }
 
 // NewTransactionSimpleResponse 創建簡化的交易回應
 func NewTransactionSimpleResponse(tx models.Transaction, currentUserID uint) TransactionSimpleResponse {
 	// 計算當前用戶的應付金額
-	myAmount := 0.0
+	var myAmount money.Amount
 	for _, split := range tx.Splits {
 		if split.UserID == currentUserID {
 			myAmount = split.Amount
@@ -156,14 +244,14 @@ func NewTransactionSimpleResponse(tx models.Transaction, currentUserID uint) Tra
 	return TransactionSimpleResponse{
 		ID:          tx.ID,
 		Description: tx.Description,
-		Amount:      tx.Amount,
+		Amount:      tx.Amount.Decimal(tx.Currency),
 		Currency:    tx.Currency,
 		Group:       NewGroupSimpleResponse(tx.Group),
 		Category:    categoryResponse,
 		Payer:       NewUserSimpleResponse(tx.Payer),
 		CreatedAt:   tx.CreatedAt,
-		MyAmount:    myAmount,
-		AmIPayer:    tx.PaidBy == currentUserID,
+		MyAmount:    myAmount.Decimal(tx.Currency),
+		AmIPayer:    tx.PaidAmount(currentUserID) > 0,
 	}
 }
 
@@ -175,3 +263,34 @@ func NewTransactionSimpleResponseList(transactions []models.Transaction, current
 	}
 	return responses
 }
+
+// DeletedTransactionResponse 垃圾桶中的交易回應格式
+type DeletedTransactionResponse struct {
+	TransactionSimpleResponse
+	DeletedAt       time.Time           `json:"deleted_at"`
+	DeletedBy       *UserSimpleResponse `json:"deleted_by,omitempty"`
+	RestorableUntil time.Time           `json:"restorable_until"` // 超過此時間後無法還原
+}
+
+// NewDeletedTransactionResponse 創建垃圾桶中的交易回應
+func NewDeletedTransactionResponse(tx models.Transaction, currentUserID uint, retention time.Duration) DeletedTransactionResponse {
+	response := DeletedTransactionResponse{
+		TransactionSimpleResponse: NewTransactionSimpleResponse(tx, currentUserID),
+		DeletedAt:                 tx.DeletedAt.Time,
+		RestorableUntil:           tx.DeletedAt.Time.Add(retention),
+	}
+	if tx.Deleter != nil {
+		deleter := NewUserSimpleResponse(*tx.Deleter)
+		response.DeletedBy = &deleter
+	}
+	return response
+}
+
+// NewDeletedTransactionResponseList 創建垃圾桶中的交易回應列表
+func NewDeletedTransactionResponseList(transactions []models.Transaction, currentUserID uint, retention time.Duration) []DeletedTransactionResponse {
+	responses := make([]DeletedTransactionResponse, len(transactions))
+	for i, tx := range transactions {
+		responses[i] = NewDeletedTransactionResponse(tx, currentUserID, retention)
+	}
+	return responses
+}
@@ -0,0 +1,125 @@
+package responses
+
+import (
+	"split-go/internal/models"
+	"split-go/internal/money"
+	"time"
+)
+
+// TransactionSnapshotResponse 交易版本快照回應格式
+type TransactionSnapshotResponse struct {
+	Description  string                    `json:"description"`
+	Amount       money.Decimal             `json:"amount"`
+	Currency     string                    `json:"currency"`
+	ExchangeRate float64                   `json:"exchange_rate"`
+	BaseAmount   money.Decimal             `json:"base_amount"`
+	BaseCurrency string                    `json:"base_currency"`
+	CategoryID   uint                      `json:"category_id"`
+	PaidBy       uint                      `json:"paid_by"`
+	SplitType    string                    `json:"split_type"`
+	Payments     []PaymentSnapshotResponse `json:"payments"`
+	Splits       []SplitSnapshotResponse   `json:"splits"`
+	Items        []models.ItemChangeValue  `json:"items"`
+	ReceiptURL   string                    `json:"receipt_url"`
+	Notes        string                    `json:"notes"`
+}
+
+// PaymentSnapshotResponse 快照中的付款明細回應格式
+type PaymentSnapshotResponse struct {
+	UserID uint          `json:"user_id"`
+	Amount money.Decimal `json:"amount"`
+}
+
+// SplitSnapshotResponse 快照中的分帳記錄回應格式
+type SplitSnapshotResponse struct {
+	UserID     uint          `json:"user_id"`
+	Amount     money.Decimal `json:"amount"`
+	Percentage float64       `json:"percentage"`
+	Shares     int64         `json:"shares"`
+	Adjustment money.Decimal `json:"adjustment"`
+}
+
+// NewTransactionSnapshotResponse 創建交易版本快照回應
+func NewTransactionSnapshotResponse(snapshot models.TransactionSnapshot) TransactionSnapshotResponse {
+	payments := make([]PaymentSnapshotResponse, len(snapshot.Payments))
+	for i, payment := range snapshot.Payments {
+		payments[i] = PaymentSnapshotResponse{
+			UserID: payment.UserID,
+			Amount: payment.Amount.Decimal(snapshot.Currency),
+		}
+	}
+
+	splits := make([]SplitSnapshotResponse, len(snapshot.Splits))
+	for i, split := range snapshot.Splits {
+		splits[i] = SplitSnapshotResponse{
+			UserID:     split.UserID,
+			Amount:     split.Amount.Decimal(snapshot.Currency),
+			Percentage: split.Percentage,
+			Shares:     split.Shares,
+			Adjustment: split.Adjustment.Decimal(snapshot.Currency),
+		}
+	}
+
+	items := make([]models.ItemChangeValue, len(snapshot.Items))
+	for i, item := range snapshot.Items {
+		items[i] = models.ItemChangeValue{
+			Name:        item.Name,
+			Kind:        item.Kind,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice.Decimal(snapshot.Currency),
+			ConsumerIDs: item.ConsumerIDs,
+		}
+	}
+
+	return TransactionSnapshotResponse{
+		Description:  snapshot.Description,
+		Amount:       snapshot.Amount.Decimal(snapshot.Currency),
+		Currency:     snapshot.Currency,
+		ExchangeRate: snapshot.ExchangeRate,
+		BaseAmount:   snapshot.BaseAmount.Decimal(snapshot.BaseCurrency),
+		BaseCurrency: snapshot.BaseCurrency,
+		CategoryID:   snapshot.CategoryID,
+		PaidBy:       snapshot.PaidBy,
+		SplitType:    string(snapshot.SplitType),
+		Payments:     payments,
+		Splits:       splits,
+		Items:        items,
+		ReceiptURL:   snapshot.Receipt,
+		Notes:        snapshot.Notes,
+	}
+}
+
+// TransactionRevisionResponse 交易版本記錄回應格式
+type TransactionRevisionResponse struct {
+	Revision     int                         `json:"revision"`
+	Action       string                      `json:"action"`
+	EditorID     uint                        `json:"editor_id"`
+	Editor       UserSimpleResponse          `json:"editor"`
+	RevertedFrom *int                        `json:"reverted_from,omitempty"` // 回復時所依據的版本號
+	Changes      []models.RevisionChange     `json:"changes"`                 // 與前一個版本的差異，第一個版本為空
+	Snapshot     TransactionSnapshotResponse `json:"snapshot"`
+	CreatedAt    time.Time                   `json:"created_at"`
+}
+
+// NewTransactionRevisionResponseList 創建交易版本記錄列表回應，snapshots 為各版本解碼後的快照
+func NewTransactionRevisionResponseList(revisions []models.TransactionRevision, snapshots []models.TransactionSnapshot) []TransactionRevisionResponse {
+	result := make([]TransactionRevisionResponse, len(revisions))
+	for i, revision := range revisions {
+		changes := []models.RevisionChange{}
+		if i > 0 {
+			changes = snapshots[i].Diff(snapshots[i-1])
+		}
+
+		result[i] = TransactionRevisionResponse{
+			Revision:     revision.Revision,
+			Action:       string(revision.Action),
+			EditorID:     revision.EditorID,
+			Editor:       NewUserSimpleResponse(revision.Editor),
+			RevertedFrom: revision.RevertedFrom,
+			Changes:      changes,
+			Snapshot:     NewTransactionSnapshotResponse(snapshots[i]),
+			CreatedAt:    revision.CreatedAt,
+		}
+	}
+	return result
+}
@@ -31,8 +31,13 @@ func Setup(app *fiber.App, db *gorm.DB, cfg *config.Config) {
 	userHandler := handlers.NewUserHandler(db)
 	groupHandler := handlers.NewGroupHandler(db)
 	transactionHandler := handlers.NewTransactionHandler(db)
+	transactionHandler.SetRetention(cfg.TransactionRetention)
 	categoryHandler := handlers.NewCategoryHandler(db)
 	settlementHandler := handlers.NewSettlementHandler(db)
+	exchangeRateHandler := handlers.NewExchangeRateHandler(db)
+	currencyHandler := handlers.NewCurrencyHandler()
+	recurringHandler := handlers.NewRecurringTransactionHandler(db)
+	ledgerHandler := handlers.NewLedgerHandler(db)
 
 	// 認証相關路由 (不需要驗證)
 	auth := api.Group("/auth")
@@ -45,10 +50,16 @@ func Setup(app *fiber.App, db *gorm.DB, cfg *config.Config) {
 	// 需要認證的路由 - 使用企業級中間件
 	protected := api.Group("/", middleware.EnterpriseJWTMiddleware(cfg.AccessTokenSecret, cfg.RefreshTokenSecret))
 
+	// 建立請求支援 Idempotency-Key，避免客戶端重試時重複建立
+	idempotency := middleware.Idempotency(db, cfg.IdempotencyKeyTTL)
+
 	// 用戶相關路由
 	users := protected.Group("/users")
 	users.Get("/me", userHandler.GetProfile)
 	users.Put("/me", userHandler.UpdateProfile)
+	users.Get("/me/balances", userHandler.GetBalances)
+	users.Get("/me/settlement-suggestions", settlementHandler.GetCrossGroupSettlementSuggestions)
+	users.Post("/me/settlement-suggestions/accept", settlementHandler.AcceptCrossGroupSettlementSuggestion)
 	users.Post("/fcm-token", userHandler.UpdateFCMToken)
 
 	// 企業級認證管理路由
@@ -73,15 +84,30 @@ func Setup(app *fiber.App, db *gorm.DB, cfg *config.Config) {
 	// 交易相關路由
 	transactions := protected.Group("/transactions")
 	transactions.Get("/", transactionHandler.GetTransactions)
-	transactions.Post("/", transactionHandler.CreateTransaction)
+	transactions.Post("/", idempotency, transactionHandler.CreateTransaction)
 	transactions.Get("/:id", transactionHandler.GetTransaction)
 	transactions.Put("/:id", transactionHandler.UpdateTransaction)
 	transactions.Delete("/:id", transactionHandler.DeleteTransaction)
+	transactions.Post("/:id/restore", transactionHandler.RestoreTransaction)
+	transactions.Get("/:id/history", transactionHandler.GetTransactionHistory)
+	transactions.Post("/:id/revert", transactionHandler.RevertTransaction)
 
 	// 群組交易路由
 	groups.Get("/:id/transactions", transactionHandler.GetGroupTransactions)
+	groups.Get("/:id/transactions/deleted", transactionHandler.GetDeletedTransactions)
 	groups.Get("/:id/balance", transactionHandler.GetGroupBalance)
 
+	// 群組帳簿路由
+	groups.Get("/:id/ledger", ledgerHandler.GetTrialBalance)
+	groups.Get("/:id/ledger/members/:userId", ledgerHandler.GetAccountStatement)
+
+	// 群組定期交易路由
+	groups.Get("/:id/recurring", recurringHandler.GetRecurringTransactions)
+	groups.Post("/:id/recurring", recurringHandler.CreateRecurringTransaction)
+	groups.Get("/:id/recurring/:recurringId", recurringHandler.GetRecurringTransaction)
+	groups.Put("/:id/recurring/:recurringId", recurringHandler.UpdateRecurringTransaction)
+	groups.Delete("/:id/recurring/:recurringId", recurringHandler.DeleteRecurringTransaction)
+
 	// 分類相關路由
 	categories := protected.Group("/categories")
 	categories.Get("/", categoryHandler.GetCategories)
@@ -89,10 +115,27 @@ func Setup(app *fiber.App, db *gorm.DB, cfg *config.Config) {
 	// 結算相關路由
 	settlements := protected.Group("/settlements")
 	settlements.Get("/", settlementHandler.GetSettlements)
-	settlements.Post("/", settlementHandler.CreateSettlement)
+	settlements.Post("/", idempotency, settlementHandler.CreateSettlement)
+	settlements.Post("/requests", idempotency, settlementHandler.CreatePaymentRequest)
+	settlements.Put("/:id/accept", settlementHandler.AcceptPaymentRequest)
+	settlements.Put("/:id/decline", settlementHandler.DeclinePaymentRequest)
+	settlements.Put("/:id/sent", settlementHandler.MarkAsSent)
 	settlements.Put("/:id/paid", settlementHandler.MarkAsPaid)
+	settlements.Get("/:id/payments", settlementHandler.GetSettlementPayments)
+	settlements.Post("/:id/payments", settlementHandler.RecordSettlementPayment)
+	settlements.Put("/:id/payments/:paymentId/confirm", settlementHandler.ConfirmSettlementPayment)
+	settlements.Put("/:id/dispute", settlementHandler.DisputeSettlement)
+	settlements.Get("/:id/events", settlementHandler.GetSettlementEvents)
 	settlements.Delete("/:id", settlementHandler.CancelSettlement)
 
 	// 群組結算路由
 	groups.Get("/:id/settlement-suggestions", settlementHandler.GetSettlementSuggestions)
+	groups.Get("/:id/debts", settlementHandler.GetGroupDebts)
+	groups.Post("/:id/settlements/from-suggestions", settlementHandler.CreateSettlementsFromSuggestions)
+
+	// 匯率相關路由
+	protected.Get("/exchange-rates", exchangeRateHandler.GetExchangeRate)
+
+	// 幣別相關路由
+	protected.Get("/currencies", currencyHandler.GetCurrencies)
 }
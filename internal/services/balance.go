@@ -1,7 +1,9 @@
 package services
 
 import (
+	"sort"
 	"split-go/internal/models"
+	"split-go/internal/money"
 
 	"gorm.io/gorm"
 )
@@ -16,13 +18,283 @@ func NewBalanceService(db *gorm.DB) *BalanceService {
 	return &BalanceService{db: db}
 }
 
-// CalculateGroupBalances 計算群組內每個用戶的平衡
+// CalculateGroupBalances 取得群組內每個用戶的平衡（以群組基準幣別計算）
+// 讀取持續維護的平衡表，群組尚未建立平衡表時先完整計算一次
 func (s *BalanceService) CalculateGroupBalances(groupID uint) ([]models.Balance, error) {
+	// 獲取群組基準幣別與成員
+	baseCurrency, userMap, err := s.loadGroupMembers(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.ensureLedger(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := make(map[uint]models.MemberBalance, len(rows))
+	for _, row := range rows {
+		stored[row.UserID] = row
+	}
+
+	// 只回傳目前的成員，尚未有記錄的成員平衡為零
+	var balances []models.Balance
+	for userID, user := range userMap {
+		row := stored[userID]
+		balances = append(balances, models.Balance{
+			UserID:   userID,
+			User:     user,
+			Currency: baseCurrency,
+			Balance:  row.Balance,
+			Paid:     row.Paid,
+			Owed:     row.Owed,
+		})
+	}
+
+	return balances, nil
+}
+
+// RecomputeGroupBalances 由日記帳的所有過帳完整重新計算群組內每個用戶的平衡
+func (s *BalanceService) RecomputeGroupBalances(groupID uint) ([]models.Balance, error) {
+	// 獲取群組基準幣別與成員
+	baseCurrency, userMap, err := s.loadGroupMembers(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	deltas, err := s.computeBalanceDeltas(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 轉換為切片（只包含目前的成員）
+	var balances []models.Balance
+	for userID, user := range userMap {
+		balance := models.Balance{UserID: userID}
+		if delta, exists := deltas[userID]; exists {
+			balance = *delta
+		}
+		balance.User = user
+		balance.Currency = baseCurrency
+		balances = append(balances, balance)
+	}
+
+	return balances, nil
+}
+
+// computeBalanceDeltas 加總群組內所有過帳對各用戶平衡的影響（包含已離開群組的用戶）
+func (s *BalanceService) computeBalanceDeltas(groupID uint) (map[uint]*models.Balance, error) {
+	var postings []models.Posting
+	if err := s.db.Where("group_id = ?", groupID).Find(&postings).Error; err != nil {
+		return nil, err
+	}
+
+	deltas := make(map[uint]*models.Balance)
+	addPostingEffects(deltas, postings)
+	return deltas, nil
+}
+
+// balanceDelta 取得用戶的平衡變動記錄，不存在時建立
+func balanceDelta(deltas map[uint]*models.Balance, userID uint) *models.Balance {
+	delta, exists := deltas[userID]
+	if !exists {
+		delta = &models.Balance{UserID: userID}
+		deltas[userID] = delta
+	}
+	return delta
+}
+
+// CalculatePairwiseDebts 計算群組內兩兩之間的債務（以群組基準幣別計算，不跨人抵銷）
+func (s *BalanceService) CalculatePairwiseDebts(groupID uint) ([]models.SettlementSuggestion, error) {
+	debts, err := s.CalculatePairwiseLedger(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]models.SettlementSuggestion, len(debts))
+	for i, debt := range debts {
+		suggestions[i] = models.SettlementSuggestion{
+			FromUserID: debt.FromUserID,
+			FromUser:   debt.FromUser,
+			ToUserID:   debt.ToUserID,
+			ToUser:     debt.ToUser,
+			Amount:     debt.Amount,
+			Currency:   debt.Currency,
+		}
+	}
+	return suggestions, nil
+}
+
+// CalculatePairwiseLedger 計算群組內兩兩之間的債務及構成債務的交易與結算
+// 每筆分帳依付款者實際支付的比例分配給各付款者，已付款的結算會抵銷對應的債務
+func (s *BalanceService) CalculatePairwiseLedger(groupID uint) ([]models.PairwiseDebt, error) {
+	baseCurrency, userMap, err := s.loadGroupMembers(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 以 ID 較小的用戶為第一位記錄每對用戶的債務，正數表示第一位欠第二位
+	type pairKey struct{ low, high uint }
+	totals := make(map[pairKey]money.Amount)
+	contributions := make(map[pairKey][]models.DebtContribution)
+
+	// record 記錄一筆交易或結算對各對用戶的影響（同一筆記錄內的雙向債務先行抵銷）
+	record := func(entry models.DebtContribution, debts map[[2]uint]money.Amount) {
+		pairs := make(map[pairKey]money.Amount)
+		for users, amount := range debts {
+			from, to := users[0], users[1]
+			if from == to || amount == 0 {
+				continue
+			}
+			if _, exists := userMap[from]; !exists {
+				continue
+			}
+			if _, exists := userMap[to]; !exists {
+				continue
+			}
+			if from < to {
+				pairs[pairKey{from, to}] += amount
+			} else {
+				pairs[pairKey{to, from}] -= amount
+			}
+		}
+		for key, amount := range pairs {
+			if amount == 0 {
+				continue
+			}
+			totals[key] += amount
+			contribution := entry
+			contribution.Amount = amount
+			contributions[key] = append(contributions[key], contribution)
+		}
+	}
+
+	var transactions []models.Transaction
+	if err := s.db.Where("group_id = ?", groupID).
+		Preload("Payments").
+		Preload("Splits").
+		Order("created_at, id").
+		Find(&transactions).Error; err != nil {
+		return nil, err
+	}
+
+	for _, transaction := range transactions {
+		baseAmount := transaction.AmountInBase()
+
+		payments := transaction.PaymentsOrDefault()
+		paymentWeights := make([]int64, len(payments))
+		for i, payment := range payments {
+			paymentWeights[i] = int64(payment.Amount)
+		}
+
+		splitAmounts := make([]money.Amount, len(transaction.Splits))
+		for i, split := range transaction.Splits {
+			splitAmounts[i] = split.Amount
+		}
+
+		// 每位參與者的應付金額依付款比例分配給各付款者
+		debts := make(map[[2]uint]money.Amount)
+		for i, owed := range convertParts(baseAmount, transaction.Amount, splitAmounts) {
+			shares, err := money.Allocate(owed, paymentWeights)
+			if err != nil {
+				continue
+			}
+			for j, share := range shares {
+				debts[[2]uint{transaction.Splits[i].UserID, payments[j].UserID}] += share
+			}
+		}
+
+		transactionID := transaction.ID
+		record(models.DebtContribution{
+			TransactionID: &transactionID,
+			Description:   transaction.Description,
+			Date:          transaction.CreatedAt,
+		}, debts)
+	}
+
+	// 已確認的結算及部分付款視為反向債務以抵銷
+	settlements, err := s.settledSettlements(groupID)
+	if err != nil {
+		return nil, err
+	}
+	for _, settlement := range settlements {
+		date := settlement.CreatedAt
+		if settlement.SettledAt != nil {
+			date = *settlement.SettledAt
+		}
+		description := settlement.Notes
+		if description == "" {
+			description = "結算"
+		}
+
+		settlementID := settlement.ID
+		record(models.DebtContribution{
+			SettlementID: &settlementID,
+			Description:  description,
+			Date:         date,
+		}, map[[2]uint]money.Amount{
+			{settlement.ToUserID, settlement.FromUserID}: settlement.SettledAmountInBase(),
+		})
+	}
+
+	// 依用戶 ID 排序確保結果具確定性
+	keys := make([]pairKey, 0, len(totals))
+	for key, total := range totals {
+		if total != 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].low != keys[j].low {
+			return keys[i].low < keys[j].low
+		}
+		return keys[i].high < keys[j].high
+	})
+
+	result := make([]models.PairwiseDebt, 0, len(keys))
+	for _, key := range keys {
+		from, to, amount := key.low, key.high, totals[key]
+		entries := contributions[key]
+
+		// 債務方向相反時，交換雙方並反轉每筆記錄的正負號
+		if amount < 0 {
+			from, to, amount = to, from, -amount
+			for i := range entries {
+				entries[i].Amount = -entries[i].Amount
+			}
+		}
+
+		result = append(result, models.PairwiseDebt{
+			FromUserID:    from,
+			FromUser:      userMap[from],
+			ToUserID:      to,
+			ToUser:        userMap[to],
+			Amount:        amount,
+			Currency:      baseCurrency,
+			Contributions: entries,
+		})
+	}
+
+	return result, nil
+}
+
+// loadGroupMembers 取得群組基準幣別與成員資料
+func (s *BalanceService) loadGroupMembers(groupID uint) (string, map[uint]models.User, error) {
+	// 獲取群組基準幣別
+	var group models.Group
+	if err := s.db.Select("id", "base_currency").First(&group, groupID).Error; err != nil {
+		return "", nil, err
+	}
+	baseCurrency := group.BaseCurrency
+	if baseCurrency == "" {
+		baseCurrency = money.DefaultCurrency
+	}
+
 	// 獲取群組所有成員
 	var members []models.GroupMember
 	if err := s.db.Where("group_id = ?", groupID).
 		Find(&members).Error; err != nil {
-		return nil, err
+		return "", nil, err
 	}
 
 	// 獲取用戶資訊
@@ -33,7 +305,7 @@ func (s *BalanceService) CalculateGroupBalances(groupID uint) ([]models.Balance,
 
 	var users []models.User
 	if err := s.db.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
-		return nil, err
+		return "", nil, err
 	}
 
 	// 建立用戶 ID 到用戶對象的映射
@@ -42,68 +314,201 @@ func (s *BalanceService) CalculateGroupBalances(groupID uint) ([]models.Balance,
 		userMap[user.ID] = user
 	}
 
-	// 初始化每個用戶的平衡記錄
-	balanceMap := make(map[uint]*models.Balance)
-	for _, member := range members {
-		if user, exists := userMap[member.UserID]; exists {
-			balanceMap[member.UserID] = &models.Balance{
-				UserID:  member.UserID,
-				User:    user,
-				Balance: 0,
-				Paid:    0,
-				Owed:    0,
-			}
-		}
-	}
+	return baseCurrency, userMap, nil
+}
 
-	// 獲取群組所有交易
-	var transactions []models.Transaction
-	if err := s.db.Where("group_id = ?", groupID).
-		Preload("Splits").
-		Find(&transactions).Error; err != nil {
+// ProjectSettlement 預估結算確認後的群組平衡，並計算付款者目前應付給收款者的金額
+// 金額皆以群組基準幣別計算；尚未完成的結算以剩餘金額計入
+func (s *BalanceService) ProjectSettlement(settlement models.Settlement) (*models.SettlementProjection, error) {
+	balances, err := s.CalculateGroupBalances(settlement.GroupID)
+	if err != nil {
 		return nil, err
 	}
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].UserID < balances[j].UserID
+	})
 
-	// 計算每筆交易對用戶平衡的影響
-	for _, transaction := range transactions {
-		// 付款者增加應收金額
-		if balance, exists := balanceMap[transaction.PaidBy]; exists {
-			balance.Paid += transaction.Amount
-			balance.Balance += transaction.Amount
+	projection := &models.SettlementProjection{Balances: balances}
+	projected := make(map[uint]*models.Balance, len(balances))
+	for i := range balances {
+		projected[balances[i].UserID] = &balances[i]
+		projection.Currency = balances[i].Currency
+	}
+	apply := func(fromUserID, toUserID uint, amount money.Amount) {
+		if balance, exists := projected[fromUserID]; exists {
+			balance.Balance += amount
+		}
+		if balance, exists := projected[toUserID]; exists {
+			balance.Balance -= amount
 		}
+	}
 
-		// 分帳參與者增加應付金額
-		for _, split := range transaction.Splits {
-			if balance, exists := balanceMap[split.UserID]; exists {
-				balance.Owed += split.Amount
-				balance.Balance -= split.Amount
-			}
+	// 尚未完成的結算視為即將付款
+	var open []models.Settlement
+	if err := s.db.Where("group_id = ? AND status IN ?", settlement.GroupID, models.OpenSettlementStatuses).
+		Find(&open).Error; err != nil {
+		return nil, err
+	}
+	for _, record := range open {
+		if record.ID == settlement.ID {
+			continue
+		}
+		remaining := record.AmountInBase() - record.SettledAmountInBase()
+		apply(record.FromUserID, record.ToUserID, remaining)
+		if record.FromUserID == settlement.FromUserID && record.ToUserID == settlement.ToUserID {
+			projection.Pending += remaining
 		}
 	}
 
-	// 考慮已經完成的結算記錄
+	// 付款者仍欠款且收款者仍應收時才需要結算
+	var payerOwes, payeeIsOwed money.Amount
+	if balance, exists := projected[settlement.FromUserID]; exists {
+		payerOwes = max(-balance.Balance, 0)
+	}
+	if balance, exists := projected[settlement.ToUserID]; exists {
+		payeeIsOwed = max(balance.Balance, 0)
+	}
+	projection.Owed = min(payerOwes, payeeIsOwed)
+
+	apply(settlement.FromUserID, settlement.ToUserID, settlement.AmountInBase())
+	return projection, nil
+}
+
+// settledSettlements 取得群組內已計入平衡的結算記錄：已確認或已收到部分付款
+func (s *BalanceService) settledSettlements(groupID uint) ([]models.Settlement, error) {
 	var settlements []models.Settlement
-	if err := s.db.Where("group_id = ? AND status = 'paid'", groupID).
+	if err := s.db.Where("group_id = ? AND (status = ? OR paid_amount > 0)", groupID, models.SettlementConfirmed).
+		Order("created_at, id").
 		Find(&settlements).Error; err != nil {
 		return nil, err
 	}
+	return settlements, nil
+}
 
-	for _, settlement := range settlements {
-		// 付款者減少應付
-		if balance, exists := balanceMap[settlement.FromUserID]; exists {
-			balance.Balance += settlement.Amount
+// convertParts 將交易各部分金額換算為基準幣別
+// 依原始金額比例分配換算後的總額，確保各部分總和等於換算後的交易金額
+func convertParts(baseTotal, total money.Amount, parts []money.Amount) []money.Amount {
+	if baseTotal == total || len(parts) == 0 {
+		return parts
+	}
+
+	weights := make([]int64, len(parts))
+	for i, part := range parts {
+		weights[i] = int64(part)
+	}
+
+	converted, err := money.Allocate(baseTotal, weights)
+	if err != nil {
+		return parts
+	}
+	return converted
+}
+
+// SummarizeUserBalances 彙整用戶所屬所有群組的平衡
+// 各群組以其基準幣別計算，跨群組的加總依幣別分開
+func (s *BalanceService) SummarizeUserBalances(userID uint) (*models.UserBalanceSummary, error) {
+	var groups []models.Group
+	if err := s.db.Joins("JOIN group_members ON group_members.group_id = groups.id").
+		Where("group_members.user_id = ?", userID).
+		Order("groups.id").
+		Find(&groups).Error; err != nil {
+		return nil, err
+	}
+
+	summary := &models.UserBalanceSummary{
+		Groups:         []models.GroupBalanceSummary{},
+		Counterparties: []models.CounterpartyBalance{},
+		Totals:         []models.CurrencyBalance{},
+	}
+
+	type counterpartyKey struct {
+		userID   uint
+		currency string
+	}
+	counterparties := make(map[counterpartyKey]*models.CounterpartyBalance)
+	var counterpartyOrder []counterpartyKey
+	totals := make(map[string]money.Amount)
+	var currencies []string
+
+	for _, group := range groups {
+		balances, err := s.CalculateGroupBalances(group.ID)
+		if err != nil {
+			return nil, err
 		}
-		// 收款者減少應收
-		if balance, exists := balanceMap[settlement.ToUserID]; exists {
-			balance.Balance -= settlement.Amount
+		debts, err := s.CalculatePairwiseLedger(group.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		groupSummary := models.GroupBalanceSummary{
+			Group:          group,
+			Counterparties: []models.CounterpartyBalance{},
 		}
+		for _, balance := range balances {
+			if balance.UserID == userID {
+				groupSummary.Balance = balance
+			}
+		}
+		if groupSummary.Balance.Currency == "" {
+			// 成員資料不完整（例如用戶已被刪除）時略過
+			continue
+		}
+
+		// 群組內與每位成員之間的債務
+		for _, debt := range debts {
+			var counterparty models.CounterpartyBalance
+			switch userID {
+			case debt.ToUserID:
+				counterparty = models.CounterpartyBalance{UserID: debt.FromUserID, User: debt.FromUser, Currency: debt.Currency, Amount: debt.Amount}
+			case debt.FromUserID:
+				counterparty = models.CounterpartyBalance{UserID: debt.ToUserID, User: debt.ToUser, Currency: debt.Currency, Amount: -debt.Amount}
+			default:
+				continue
+			}
+			groupSummary.Counterparties = append(groupSummary.Counterparties, counterparty)
+
+			key := counterpartyKey{counterparty.UserID, counterparty.Currency}
+			if existing, exists := counterparties[key]; exists {
+				existing.Amount += counterparty.Amount
+			} else {
+				counterparties[key] = &counterparty
+				counterpartyOrder = append(counterpartyOrder, key)
+			}
+		}
+
+		currency := groupSummary.Balance.Currency
+		if _, exists := totals[currency]; !exists {
+			currencies = append(currencies, currency)
+		}
+		totals[currency] += groupSummary.Balance.Balance
+
+		summary.Groups = append(summary.Groups, groupSummary)
 	}
 
-	// 轉換為切片
-	var balances []models.Balance
-	for _, balance := range balanceMap {
-		balances = append(balances, *balance)
+	// 跨群組加總後互相抵銷的對象不列出
+	for _, key := range counterpartyOrder {
+		if counterparty := counterparties[key]; counterparty.Amount != 0 {
+			summary.Counterparties = append(summary.Counterparties, *counterparty)
+		}
 	}
+	sort.SliceStable(summary.Counterparties, func(i, j int) bool {
+		return summary.Counterparties[i].UserID < summary.Counterparties[j].UserID
+	})
 
-	return balances, nil
+	sort.Strings(currencies)
+	for _, currency := range currencies {
+		summary.Totals = append(summary.Totals, models.CurrencyBalance{Currency: currency, Balance: totals[currency]})
+	}
+
+	// 用戶為付款者或收款者的未完成結算
+	if err := s.db.Where("(from_user_id = ? OR to_user_id = ?) AND status IN ?", userID, userID, models.OpenSettlementStatuses).
+		Preload("Group").
+		Preload("FromUser").
+		Preload("ToUser").
+		Order("created_at DESC").
+		Find(&summary.PendingSettlements).Error; err != nil {
+		return nil, err
+	}
+
+	return summary, nil
 }
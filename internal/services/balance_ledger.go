@@ -0,0 +1,213 @@
+package services
+
+import (
+	"sort"
+	"split-go/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 平衡表 (member_balances) 為日記帳過帳的加總，交易與結算過帳時在同一個資料庫交易中增量更新。
+// 群組尚未建立平衡表時只寫入分錄，於第一次讀取時由所有過帳完整計算建立。
+
+// AddTransaction 依交易目前的付款與分帳過帳（交易需已寫入）
+func (s *BalanceService) AddTransaction(transactionID uint) error {
+	entry, err := s.transactionEntry(transactionID)
+	if err != nil {
+		return err
+	}
+	return s.postEntry(entry)
+}
+
+// RemoveTransaction 以沖銷分錄抵銷交易先前的過帳（修改或刪除交易時呼叫）
+func (s *BalanceService) RemoveTransaction(transactionID uint) error {
+	return s.reverseSource(models.JournalSourceTransaction, transactionID)
+}
+
+// ApplySettlement 依結算已計入平衡金額的變動過帳，previous 為變更前的結算
+func (s *BalanceService) ApplySettlement(settlement, previous models.Settlement) error {
+	amount := settlement.SettledAmount() - previous.SettledAmount()
+	baseAmount := settlement.SettledAmountInBase() - previous.SettledAmountInBase()
+	return s.postEntry(settlementEntry(settlement, amount, baseAmount))
+}
+
+// RebuildLedger 補登尚未過帳的分錄後，以所有過帳的加總重建群組的平衡表
+func (s *BalanceService) RebuildLedger(groupID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// 鎖定群組，同時第一次讀取平衡時依序重建，避免重複補登同一筆交易或結算的分錄
+		service := NewBalanceService(tx)
+		if err := service.lockGroup(groupID); err != nil {
+			return err
+		}
+		if err := service.postMissingEntries(groupID); err != nil {
+			return err
+		}
+		deltas, err := service.computeBalanceDeltas(groupID)
+		if err != nil {
+			return err
+		}
+
+		// 目前的成員即使沒有交易也建立記錄，代表群組已建立平衡表
+		var memberIDs []uint
+		if err := tx.Model(&models.GroupMember{}).Where("group_id = ?", groupID).
+			Pluck("user_id", &memberIDs).Error; err != nil {
+			return err
+		}
+		for _, userID := range memberIDs {
+			balanceDelta(deltas, userID)
+		}
+
+		if err := tx.Where("group_id = ?", groupID).Delete(&models.MemberBalance{}).Error; err != nil {
+			return err
+		}
+		rows := ledgerRowsFromDeltas(groupID, deltas)
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+// RebuildAllLedgers 重建所有群組的平衡表，回傳處理的群組數量
+func (s *BalanceService) RebuildAllLedgers() (int, error) {
+	var groupIDs []uint
+	if err := s.db.Model(&models.Group{}).Order("id").Pluck("id", &groupIDs).Error; err != nil {
+		return 0, err
+	}
+
+	for _, groupID := range groupIDs {
+		if err := s.RebuildLedger(groupID); err != nil {
+			return 0, err
+		}
+	}
+	return len(groupIDs), nil
+}
+
+// CheckLedger 比對群組平衡表與所有過帳加總的結果，回傳不一致的記錄
+// 群組尚未建立平衡表時不視為不一致
+func (s *BalanceService) CheckLedger(groupID uint) ([]models.BalanceDiscrepancy, error) {
+	rows, err := s.ledgerRows(groupID)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+
+	deltas, err := s.computeBalanceDeltas(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := make(map[uint]models.MemberBalance, len(rows))
+	for _, row := range rows {
+		stored[row.UserID] = row
+		balanceDelta(deltas, row.UserID)
+	}
+
+	var discrepancies []models.BalanceDiscrepancy
+	for _, expected := range ledgerRowsFromDeltas(groupID, deltas) {
+		row := stored[expected.UserID]
+		if row.Balance != expected.Balance || row.Paid != expected.Paid || row.Owed != expected.Owed {
+			row.GroupID, row.UserID = groupID, expected.UserID
+			discrepancies = append(discrepancies, models.BalanceDiscrepancy{
+				GroupID:  groupID,
+				UserID:   expected.UserID,
+				Stored:   row,
+				Expected: expected,
+			})
+		}
+	}
+	return discrepancies, nil
+}
+
+// CheckAllLedgers 比對所有群組的平衡表
+func (s *BalanceService) CheckAllLedgers() ([]models.BalanceDiscrepancy, error) {
+	var groupIDs []uint
+	if err := s.db.Model(&models.Group{}).Order("id").Pluck("id", &groupIDs).Error; err != nil {
+		return nil, err
+	}
+
+	var discrepancies []models.BalanceDiscrepancy
+	for _, groupID := range groupIDs {
+		found, err := s.CheckLedger(groupID)
+		if err != nil {
+			return nil, err
+		}
+		discrepancies = append(discrepancies, found...)
+	}
+	return discrepancies, nil
+}
+
+// applyDeltas 將平衡變動累加至平衡表，群組尚未建立平衡表時略過
+func (s *BalanceService) applyDeltas(groupID uint, deltas map[uint]*models.Balance) error {
+	var count int64
+	if err := s.db.Model(&models.MemberBalance{}).Where("group_id = ?", groupID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+
+	for _, row := range ledgerRowsFromDeltas(groupID, deltas) {
+		if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.MemberBalance{GroupID: groupID, UserID: row.UserID}).Error; err != nil {
+			return err
+		}
+		if err := s.db.Model(&models.MemberBalance{}).
+			Where("group_id = ? AND user_id = ?", groupID, row.UserID).
+			Updates(map[string]interface{}{
+				"balance": gorm.Expr("balance + ?", row.Balance),
+				"paid":    gorm.Expr("paid + ?", row.Paid),
+				"owed":    gorm.Expr("owed + ?", row.Owed),
+			}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockGroup 鎖定群組記錄直到資料庫交易結束，讓過帳與平衡表重建依序執行
+func (s *BalanceService) lockGroup(groupID uint) error {
+	var group models.Group
+	return s.db.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").Where("id = ?", groupID).Find(&group).Error
+}
+
+// ensureLedger 取得群組的平衡表記錄，尚未建立時先完整計算建立
+func (s *BalanceService) ensureLedger(groupID uint) ([]models.MemberBalance, error) {
+	rows, err := s.ledgerRows(groupID)
+	if err != nil || len(rows) > 0 {
+		return rows, err
+	}
+	if err := s.RebuildLedger(groupID); err != nil {
+		return nil, err
+	}
+	return s.ledgerRows(groupID)
+}
+
+// ledgerRows 取得群組的平衡表記錄
+func (s *BalanceService) ledgerRows(groupID uint) ([]models.MemberBalance, error) {
+	var rows []models.MemberBalance
+	if err := s.db.Where("group_id = ?", groupID).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ledgerRowsFromDeltas 將平衡變動轉換為平衡表記錄（依用戶 ID 排序）
+func ledgerRowsFromDeltas(groupID uint, deltas map[uint]*models.Balance) []models.MemberBalance {
+	rows := make([]models.MemberBalance, 0, len(deltas))
+	for userID, delta := range deltas {
+		rows = append(rows, models.MemberBalance{
+			GroupID: groupID,
+			UserID:  userID,
+			Balance: delta.Balance,
+			Paid:    delta.Paid,
+			Owed:    delta.Owed,
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].UserID < rows[j].UserID
+	})
+	return rows
+}
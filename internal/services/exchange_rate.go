@@ -0,0 +1,277 @@
+package services
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"split-go/internal/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ExchangeRateService 匯率服務（使用離線匯入的匯率資料）
+type ExchangeRateService struct {
+	db *gorm.DB
+}
+
+// NewExchangeRateService 創建匯率服務
+func NewExchangeRateService(db *gorm.DB) *ExchangeRateService {
+	return &ExchangeRateService{db: db}
+}
+
+// Resolve 取得指定日期的匯率，當天沒有資料時使用最近的前一天
+// 依序嘗試直接匯率、反向匯率，以及透過共同基準幣別（例如 ECB 的 EUR）換算的交叉匯率
+// 找不到任何匯率時回傳 gorm.ErrRecordNotFound
+func (s *ExchangeRateService) Resolve(base, quote string, date time.Time) (*models.ExchangeRate, error) {
+	base = strings.ToUpper(base)
+	quote = strings.ToUpper(quote)
+	day := truncateToDate(date)
+
+	if base == quote {
+		return &models.ExchangeRate{Date: day, Base: base, Quote: quote, Rate: 1}, nil
+	}
+
+	// 直接匯率
+	direct, err := s.findLatest(base, quote, day)
+	if err == nil {
+		return direct, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	// 反向匯率
+	inverse, err := s.findLatest(quote, base, day)
+	if err == nil {
+		return &models.ExchangeRate{
+			Date:   inverse.Date,
+			Base:   base,
+			Quote:  quote,
+			Rate:   1 / inverse.Rate,
+			Source: inverse.Source,
+		}, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	// 交叉匯率：找出同時有兩個幣別報價的基準幣別
+	var pivots []string
+	if err := s.db.Model(&models.ExchangeRate{}).
+		Where("quote = ?", base).
+		Distinct("base").Pluck("base", &pivots).Error; err != nil {
+		return nil, err
+	}
+
+	for _, pivot := range pivots {
+		pivotToBase, err := s.findLatest(pivot, base, day)
+		if err != nil {
+			continue
+		}
+		pivotToQuote, err := s.findLatest(pivot, quote, day)
+		if err != nil {
+			continue
+		}
+
+		// 以兩筆資料中較早的日期作為匯率日期
+		rateDate := pivotToBase.Date
+		if pivotToQuote.Date.Before(rateDate) {
+			rateDate = pivotToQuote.Date
+		}
+
+		return &models.ExchangeRate{
+			Date:   rateDate,
+			Base:   base,
+			Quote:  quote,
+			Rate:   pivotToQuote.Rate / pivotToBase.Rate,
+			Source: pivotToQuote.Source,
+		}, nil
+	}
+
+	return nil, gorm.ErrRecordNotFound
+}
+
+// RateFor 決定幣別兌換基準幣別的匯率
+// 幣別相同時為 1；有提供匯率時使用提供的匯率；否則查詢指定日期的匯率資料
+func (s *ExchangeRateService) RateFor(currency, baseCurrency string, requested float64, date time.Time) (float64, error) {
+	if requested < 0 {
+		return 0, errors.New("匯率必須大於 0")
+	}
+	if strings.EqualFold(currency, baseCurrency) {
+		return 1, nil
+	}
+	if requested > 0 {
+		return requested, nil
+	}
+
+	rate, err := s.Resolve(currency, baseCurrency, date)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return 0, fmt.Errorf("找不到 %s/%s 的匯率，請提供匯率",
+				strings.ToUpper(currency), strings.ToUpper(baseCurrency))
+		}
+		return 0, errors.New("查詢匯率失敗")
+	}
+
+	return rate.Rate, nil
+}
+
+// Import 匯入匯率資料，相同日期與幣別組合的資料會被覆寫（同一批資料中重複時以最後一筆為準）
+func (s *ExchangeRateService) Import(rates []models.ExchangeRate) (int, error) {
+	if len(rates) == 0 {
+		return 0, nil
+	}
+
+	for i := range rates {
+		rates[i].Base = strings.ToUpper(rates[i].Base)
+		rates[i].Quote = strings.ToUpper(rates[i].Quote)
+		rates[i].Date = truncateToDate(rates[i].Date)
+
+		if len(rates[i].Base) != 3 || len(rates[i].Quote) != 3 {
+			return 0, fmt.Errorf("無效的幣別組合: %s/%s", rates[i].Base, rates[i].Quote)
+		}
+		if rates[i].Base == rates[i].Quote {
+			return 0, fmt.Errorf("基準幣別與報價幣別不能相同: %s", rates[i].Base)
+		}
+		if rates[i].Rate <= 0 {
+			return 0, fmt.Errorf("匯率必須大於 0: %s/%s", rates[i].Base, rates[i].Quote)
+		}
+	}
+
+	// 同一個 INSERT ... ON CONFLICT 不能更新同一筆資料兩次（Postgres 會使整批匯入失敗），先移除重複的組合
+	rates = dedupeRates(rates)
+
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "date"}, {Name: "base"}, {Name: "quote"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "source", "updated_at"}),
+	}).CreateInBatches(&rates, 500).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return len(rates), nil
+}
+
+// dedupeRates 依日期與幣別組合去除重複的匯率，保留最後一筆
+func dedupeRates(rates []models.ExchangeRate) []models.ExchangeRate {
+	type rateKey struct {
+		date        time.Time
+		base, quote string
+	}
+
+	positions := make(map[rateKey]int, len(rates))
+	unique := make([]models.ExchangeRate, 0, len(rates))
+	for _, rate := range rates {
+		key := rateKey{date: rate.Date, base: rate.Base, quote: rate.Quote}
+		if i, exists := positions[key]; exists {
+			unique[i] = rate
+			continue
+		}
+		positions[key] = len(unique)
+		unique = append(unique, rate)
+	}
+	return unique
+}
+
+// findLatest 查詢指定日期（含）之前最近的一筆匯率
+func (s *ExchangeRateService) findLatest(base, quote string, day time.Time) (*models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+	if err := s.db.Where("base = ? AND quote = ? AND date <= ?", base, quote, day).
+		Order("date DESC").
+		First(&rate).Error; err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+// truncateToDate 取得日期部分（UTC 零時）
+func truncateToDate(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// ParseExchangeRatesCSV 解析 CSV 匯率檔案
+// 欄位依序為 date,base,quote,rate，日期格式為 YYYY-MM-DD，第一列可為標題列
+func ParseExchangeRatesCSV(r io.Reader, source string) ([]models.ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = 4
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("讀取 CSV 失敗: %w", err)
+	}
+
+	var rates []models.ExchangeRate
+	for i, record := range records {
+		if i == 0 && strings.EqualFold(record[0], "date") {
+			continue
+		}
+
+		date, err := time.Parse("2006-01-02", record[0])
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 列日期格式錯誤: %s", i+1, record[0])
+		}
+		rate, err := strconv.ParseFloat(record[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 列匯率格式錯誤: %s", i+1, record[3])
+		}
+
+		rates = append(rates, models.ExchangeRate{
+			Date:   date,
+			Base:   strings.ToUpper(record[1]),
+			Quote:  strings.ToUpper(record[2]),
+			Rate:   rate,
+			Source: source,
+		})
+	}
+
+	return rates, nil
+}
+
+// ecbEnvelope 歐洲央行 eurofxref XML 結構
+type ecbEnvelope struct {
+	Cube struct {
+		Days []struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string  `xml:"currency,attr"`
+				Rate     float64 `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube"`
+	} `xml:"Cube"`
+}
+
+// ParseECBXML 解析歐洲央行 (ECB) eurofxref 格式的 XML，所有匯率皆以 EUR 為基準
+func ParseECBXML(r io.Reader) ([]models.ExchangeRate, error) {
+	var envelope ecbEnvelope
+	if err := xml.NewDecoder(r).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("讀取 XML 失敗: %w", err)
+	}
+
+	var rates []models.ExchangeRate
+	for _, day := range envelope.Cube.Days {
+		date, err := time.Parse("2006-01-02", day.Time)
+		if err != nil {
+			return nil, fmt.Errorf("日期格式錯誤: %s", day.Time)
+		}
+
+		for _, rate := range day.Rates {
+			rates = append(rates, models.ExchangeRate{
+				Date:   date,
+				Base:   "EUR",
+				Quote:  strings.ToUpper(rate.Currency),
+				Rate:   rate.Rate,
+				Source: "ecb",
+			})
+		}
+	}
+
+	return rates, nil
+}
@@ -0,0 +1,433 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"split-go/internal/models"
+	"split-go/internal/money"
+
+	"gorm.io/gorm"
+)
+
+// ErrLedgerAccountNotFound 用戶在群組中沒有帳戶（不是成員且沒有任何過帳）
+var ErrLedgerAccountNotFound = errors.New("用戶在此群組沒有帳戶")
+
+// 複式記帳：每位成員在每個幣別各有一個帳戶，交易付款者借記、分攤者貸記，
+// 結算付款者借記、收款者貸記。群組平衡由各帳戶的基準幣別金額加總而來。
+
+// TrialBalance 取得群組的試算表
+func (s *BalanceService) TrialBalance(groupID uint) (*models.TrialBalance, error) {
+	if _, err := s.ensureLedger(groupID); err != nil {
+		return nil, err
+	}
+	baseCurrency, _, err := s.loadGroupMembers(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	var postings []models.Posting
+	if err := s.db.Where("group_id = ?", groupID).Order("id").Find(&postings).Error; err != nil {
+		return nil, err
+	}
+
+	type accountKey struct {
+		userID   uint
+		currency string
+	}
+	type entryKey struct {
+		entryID  uint
+		currency string
+	}
+	accounts := make(map[accountKey]*models.LedgerAccount)
+	totals := make(map[string]*models.LedgerTotal)
+	entrySums := make(map[entryKey]money.Amount)
+	entryBaseSums := make(map[uint]money.Amount)
+	for _, posting := range postings {
+		key := accountKey{posting.UserID, posting.Currency}
+		account, exists := accounts[key]
+		if !exists {
+			account = &models.LedgerAccount{UserID: posting.UserID, Currency: posting.Currency}
+			accounts[key] = account
+		}
+		account.Debit += posting.Debit()
+		account.Credit += posting.Credit()
+		account.Balance += posting.Amount
+
+		total, exists := totals[posting.Currency]
+		if !exists {
+			total = &models.LedgerTotal{Currency: posting.Currency}
+			totals[posting.Currency] = total
+		}
+		total.Debit += posting.Debit()
+		total.Credit += posting.Credit()
+
+		entrySums[entryKey{posting.JournalEntryID, posting.Currency}] += posting.Amount
+		entryBaseSums[posting.JournalEntryID] += posting.BaseAmount
+	}
+
+	trialBalance := &models.TrialBalance{
+		BaseCurrency:      baseCurrency,
+		Accounts:          make([]models.LedgerAccount, 0, len(accounts)),
+		Totals:            make([]models.LedgerTotal, 0, len(totals)),
+		UnbalancedEntries: []uint{},
+	}
+
+	// 各分錄在每個幣別及基準幣別的借貸都必須相等
+	unbalanced := make(map[uint]bool)
+	for key, sum := range entrySums {
+		if sum != 0 {
+			unbalanced[key.entryID] = true
+		}
+	}
+	for entryID, sum := range entryBaseSums {
+		if sum != 0 {
+			unbalanced[entryID] = true
+		}
+	}
+	for entryID := range unbalanced {
+		trialBalance.UnbalancedEntries = append(trialBalance.UnbalancedEntries, entryID)
+	}
+	sort.Slice(trialBalance.UnbalancedEntries, func(i, j int) bool {
+		return trialBalance.UnbalancedEntries[i] < trialBalance.UnbalancedEntries[j]
+	})
+
+	userIDs := make([]uint, 0, len(accounts))
+	for _, account := range accounts {
+		trialBalance.Accounts = append(trialBalance.Accounts, *account)
+		userIDs = append(userIDs, account.UserID)
+	}
+	users, err := s.loadUsers(userIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range trialBalance.Accounts {
+		trialBalance.Accounts[i].User = users[trialBalance.Accounts[i].UserID]
+	}
+	sort.Slice(trialBalance.Accounts, func(i, j int) bool {
+		a, b := trialBalance.Accounts[i], trialBalance.Accounts[j]
+		if a.UserID != b.UserID {
+			return a.UserID < b.UserID
+		}
+		return a.Currency < b.Currency
+	})
+
+	trialBalance.Balanced = len(unbalanced) == 0
+	for _, total := range totals {
+		trialBalance.Totals = append(trialBalance.Totals, *total)
+		if total.Debit != total.Credit {
+			trialBalance.Balanced = false
+		}
+	}
+	sort.Slice(trialBalance.Totals, func(i, j int) bool {
+		return trialBalance.Totals[i].Currency < trialBalance.Totals[j].Currency
+	})
+
+	return trialBalance, nil
+}
+
+// AccountStatement 取得成員在群組中的帳戶明細（包含已離開群組的成員）
+func (s *BalanceService) AccountStatement(groupID, userID uint) (*models.AccountStatement, error) {
+	if _, err := s.ensureLedger(groupID); err != nil {
+		return nil, err
+	}
+	baseCurrency, members, err := s.loadGroupMembers(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	var postings []models.Posting
+	if err := s.db.Where("group_id = ? AND user_id = ?", groupID, userID).
+		Order("id").Find(&postings).Error; err != nil {
+		return nil, err
+	}
+	if _, isMember := members[userID]; !isMember && len(postings) == 0 {
+		return nil, ErrLedgerAccountNotFound
+	}
+
+	entryIDs := make([]uint, len(postings))
+	for i, posting := range postings {
+		entryIDs[i] = posting.JournalEntryID
+	}
+	var entries []models.JournalEntry
+	if err := s.db.Where("id IN ?", entryIDs).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	entryMap := make(map[uint]models.JournalEntry, len(entries))
+	for _, entry := range entries {
+		entryMap[entry.ID] = entry
+	}
+
+	users, err := s.loadUsers([]uint{userID})
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &models.AccountStatement{
+		UserID:       userID,
+		User:         users[userID],
+		BaseCurrency: baseCurrency,
+		Lines:        make([]models.StatementLine, len(postings)),
+	}
+	for i, posting := range postings {
+		entry := entryMap[posting.JournalEntryID]
+		statement.Balance += posting.BaseAmount
+		statement.Lines[i] = models.StatementLine{
+			EntryID:        entry.ID,
+			SourceType:     entry.SourceType,
+			SourceID:       entry.SourceID,
+			Description:    entry.Description,
+			Reversal:       entry.Reversal,
+			Kind:           posting.Kind,
+			Currency:       posting.Currency,
+			Amount:         posting.Amount,
+			BaseAmount:     posting.BaseAmount,
+			RunningBalance: statement.Balance,
+			PostedAt:       posting.CreatedAt,
+		}
+	}
+
+	return statement, nil
+}
+
+// postEntry 寫入分錄並將其過帳累加至平衡表
+func (s *BalanceService) postEntry(entry *models.JournalEntry) error {
+	if len(entry.Postings) == 0 {
+		return nil
+	}
+	// 先鎖定群組再寫入，避免平衡表重建時讀不到這筆分錄、過帳又因平衡表尚未建立而略過累加
+	if err := s.lockGroup(entry.GroupID); err != nil {
+		return err
+	}
+	if err := s.createEntry(entry); err != nil {
+		return err
+	}
+
+	deltas := make(map[uint]*models.Balance)
+	addPostingEffects(deltas, entry.Postings)
+	return s.applyDeltas(entry.GroupID, deltas)
+}
+
+// createEntry 寫入分錄及其過帳
+func (s *BalanceService) createEntry(entry *models.JournalEntry) error {
+	for i := range entry.Postings {
+		entry.Postings[i].GroupID = entry.GroupID
+	}
+	return s.db.Create(entry).Error
+}
+
+// transactionEntry 依交易目前的付款與分帳建立分錄（尚未寫入）
+func (s *BalanceService) transactionEntry(transactionID uint) (*models.JournalEntry, error) {
+	var transaction models.Transaction
+	if err := s.db.Preload("Payments").Preload("Splits").
+		First(&transaction, transactionID).Error; err != nil {
+		return nil, err
+	}
+
+	entry := &models.JournalEntry{
+		GroupID:     transaction.GroupID,
+		SourceType:  models.JournalSourceTransaction,
+		SourceID:    transaction.ID,
+		Description: transaction.Description,
+	}
+	currency := transaction.Currency
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	baseAmount := transaction.AmountInBase()
+
+	// 付款者借記實際支付金額
+	payments := transaction.PaymentsOrDefault()
+	paymentAmounts := make([]money.Amount, len(payments))
+	for i, payment := range payments {
+		paymentAmounts[i] = payment.Amount
+	}
+	for i, paid := range convertParts(baseAmount, transaction.Amount, paymentAmounts) {
+		entry.Postings = appendPosting(entry.Postings, models.Posting{
+			UserID:     payments[i].UserID,
+			Kind:       models.PostingPayment,
+			Currency:   currency,
+			Amount:     payments[i].Amount,
+			BaseAmount: paid,
+		})
+	}
+
+	// 分帳參與者貸記應分攤金額
+	splitAmounts := make([]money.Amount, len(transaction.Splits))
+	for i, split := range transaction.Splits {
+		splitAmounts[i] = split.Amount
+	}
+	for i, owed := range convertParts(baseAmount, transaction.Amount, splitAmounts) {
+		entry.Postings = appendPosting(entry.Postings, models.Posting{
+			UserID:     transaction.Splits[i].UserID,
+			Kind:       models.PostingShare,
+			Currency:   currency,
+			Amount:     -transaction.Splits[i].Amount,
+			BaseAmount: -owed,
+		})
+	}
+
+	return entry, nil
+}
+
+// settlementEntry 建立結算付款的分錄（尚未寫入）：付款者借記、收款者貸記
+func settlementEntry(settlement models.Settlement, amount, baseAmount money.Amount) *models.JournalEntry {
+	entry := &models.JournalEntry{
+		GroupID:     settlement.GroupID,
+		SourceType:  models.JournalSourceSettlement,
+		SourceID:    settlement.ID,
+		Description: fmt.Sprintf("結算 #%d", settlement.ID),
+	}
+	currency := settlement.Currency
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	entry.Postings = appendPosting(entry.Postings, models.Posting{
+		UserID:     settlement.FromUserID,
+		Kind:       models.PostingSettlement,
+		Currency:   currency,
+		Amount:     amount,
+		BaseAmount: baseAmount,
+	})
+	entry.Postings = appendPosting(entry.Postings, models.Posting{
+		UserID:     settlement.ToUserID,
+		Kind:       models.PostingSettlement,
+		Currency:   currency,
+		Amount:     -amount,
+		BaseAmount: -baseAmount,
+	})
+	return entry
+}
+
+// reverseSource 以沖銷分錄抵銷來源目前所有過帳的淨額
+func (s *BalanceService) reverseSource(sourceType models.JournalSource, sourceID uint) error {
+	var entries []models.JournalEntry
+	if err := s.db.Where("source_type = ? AND source_id = ?", sourceType, sourceID).
+		Preload("Postings").Order("id").Find(&entries).Error; err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	reversal := &models.JournalEntry{
+		GroupID:    entries[0].GroupID,
+		SourceType: sourceType,
+		SourceID:   sourceID,
+		Reversal:   true,
+	}
+
+	// 依成員、性質與幣別加總淨額，保持第一次出現的順序
+	type postingKey struct {
+		userID   uint
+		kind     models.PostingKind
+		currency string
+	}
+	var keys []postingKey
+	net := make(map[postingKey]*models.Posting)
+	for _, entry := range entries {
+		if !entry.Reversal {
+			reversal.Description = "沖銷：" + entry.Description
+		}
+		for _, posting := range entry.Postings {
+			key := postingKey{posting.UserID, posting.Kind, posting.Currency}
+			sum, exists := net[key]
+			if !exists {
+				sum = &models.Posting{UserID: posting.UserID, Kind: posting.Kind, Currency: posting.Currency}
+				net[key] = sum
+				keys = append(keys, key)
+			}
+			sum.Amount += posting.Amount
+			sum.BaseAmount += posting.BaseAmount
+		}
+	}
+	for _, key := range keys {
+		posting := *net[key]
+		posting.Amount, posting.BaseAmount = -posting.Amount, -posting.BaseAmount
+		reversal.Postings = appendPosting(reversal.Postings, posting)
+	}
+
+	return s.postEntry(reversal)
+}
+
+// postMissingEntries 為尚未過帳的交易與已計入平衡的結算補登分錄（分錄功能加入前的資料）
+// 補登的分錄只寫入日記帳，平衡表由呼叫端重建
+func (s *BalanceService) postMissingEntries(groupID uint) error {
+	var transactionIDs []uint
+	if err := s.db.Model(&models.Transaction{}).
+		Where("group_id = ? AND id NOT IN (?)", groupID, s.postedSources(models.JournalSourceTransaction)).
+		Order("id").Pluck("id", &transactionIDs).Error; err != nil {
+		return err
+	}
+	for _, transactionID := range transactionIDs {
+		entry, err := s.transactionEntry(transactionID)
+		if err != nil {
+			return err
+		}
+		if len(entry.Postings) == 0 {
+			continue
+		}
+		if err := s.createEntry(entry); err != nil {
+			return err
+		}
+	}
+
+	var settlements []models.Settlement
+	if err := s.db.Where("group_id = ? AND (status = ? OR paid_amount > 0) AND id NOT IN (?)",
+		groupID, models.SettlementConfirmed, s.postedSources(models.JournalSourceSettlement)).
+		Order("id").Find(&settlements).Error; err != nil {
+		return err
+	}
+	for _, settlement := range settlements {
+		entry := settlementEntry(settlement, settlement.SettledAmount(), settlement.SettledAmountInBase())
+		if err := s.createEntry(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// postedSources 已有分錄的來源 ID 子查詢
+func (s *BalanceService) postedSources(sourceType models.JournalSource) *gorm.DB {
+	return s.db.Model(&models.JournalEntry{}).Select("source_id").Where("source_type = ?", sourceType)
+}
+
+// addPostingEffects 將過帳的基準幣別金額累加至 deltas
+func addPostingEffects(deltas map[uint]*models.Balance, postings []models.Posting) {
+	for _, posting := range postings {
+		delta := balanceDelta(deltas, posting.UserID)
+		delta.Balance += posting.BaseAmount
+		switch posting.Kind {
+		case models.PostingPayment:
+			delta.Paid += posting.BaseAmount
+		case models.PostingShare:
+			delta.Owed -= posting.BaseAmount
+		}
+	}
+}
+
+// appendPosting 加入過帳，略過金額為零的過帳
+func appendPosting(postings []models.Posting, posting models.Posting) []models.Posting {
+	if posting.Amount == 0 && posting.BaseAmount == 0 {
+		return postings
+	}
+	return append(postings, posting)
+}
+
+// loadUsers 依 ID 取得用戶資料
+func (s *BalanceService) loadUsers(userIDs []uint) (map[uint]models.User, error) {
+	users := make(map[uint]models.User, len(userIDs))
+	if len(userIDs) == 0 {
+		return users, nil
+	}
+
+	var records []models.User
+	if err := s.db.Where("id IN ?", userIDs).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	for _, user := range records {
+		users[user.ID] = user
+	}
+	return users, nil
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"split-go/internal/models"
+	"split-go/internal/money"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrSettlementStatusChanged 結算狀態已被其他請求變更
+	ErrSettlementStatusChanged = errors.New("結算狀態已變更，請重新整理後再試")
+	// ErrPaymentExceedsRemaining 付款金額超過尚未付清的金額（含待確認的付款）
+	ErrPaymentExceedsRemaining = errors.New("付款金額超過剩餘應付金額")
+	// ErrPaymentAlreadyConfirmed 付款已經確認過
+	ErrPaymentAlreadyConfirmed = errors.New("此付款已確認")
+)
+
+// SettlementStateService 結算狀態轉換服務，所有狀態變更都會記錄 SettlementEvent
+type SettlementStateService struct {
+	db *gorm.DB
+}
+
+// NewSettlementStateService 創建結算狀態轉換服務
+func NewSettlementStateService(db *gorm.DB) *SettlementStateService {
+	return &SettlementStateService{db: db}
+}
+
+// Create 建立結算記錄並記錄建立事件
+func (s *SettlementStateService) Create(settlements []*models.Settlement, actorID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, settlement := range settlements {
+			if err := tx.Create(settlement).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&models.SettlementEvent{
+				SettlementID: settlement.ID,
+				ActorID:      actorID,
+				ToStatus:     settlement.Status,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Transition 檢查用戶角色後變更結算狀態
+func (s *SettlementStateService) Transition(settlement *models.Settlement, to models.SettlementStatus, actorID uint, reason string) error {
+	if err := settlement.CheckTransition(to, actorID); err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return transitionSettlement(tx, settlement, to, actorID, reason)
+	})
+}
+
+// TransitionLinked 整批變更同一組結算記錄的狀態（例如跨群組抵銷）
+// 呼叫者需自行檢查權限，每筆記錄仍須符合狀態轉換規則
+func (s *SettlementStateService) TransitionLinked(settlements []models.Settlement, to models.SettlementStatus, actorID uint, reason string) error {
+	for _, settlement := range settlements {
+		if err := settlement.CanTransitionTo(to); err != nil {
+			return err
+		}
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for i := range settlements {
+			if err := transitionSettlement(tx, &settlements[i], to, actorID, reason); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Events 取得結算的狀態變更記錄（依時間排序）
+func (s *SettlementStateService) Events(settlementID uint) ([]models.SettlementEvent, error) {
+	var events []models.SettlementEvent
+	if err := s.db.Where("settlement_id = ?", settlementID).
+		Preload("Actor").
+		Order("created_at, id").
+		Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// RecordPayment 記錄一筆部分付款
+// 收款者記錄的付款直接確認並更新結算狀態，付款者記錄的付款需等待收款者確認
+func (s *SettlementStateService) RecordPayment(settlement *models.Settlement, amount money.Amount, actorID uint, notes string) (*models.SettlementPayment, error) {
+	if !settlement.AcceptsPayments() {
+		return nil, fmt.Errorf("%w: %s 狀態的結算不能記錄付款", models.ErrInvalidSettlementTransition, settlement.Status)
+	}
+	if !settlement.HasRole(actorID, models.SettlementRolePayer) && !settlement.HasRole(actorID, models.SettlementRolePayee) {
+		return nil, models.ErrSettlementTransitionForbidden
+	}
+
+	payment := &models.SettlementPayment{
+		SettlementID: settlement.ID,
+		Amount:       amount,
+		RecordedByID: actorID,
+		Notes:        notes,
+	}
+	if settlement.HasRole(actorID, models.SettlementRolePayee) {
+		now := time.Now()
+		payment.ConfirmedAt = &now
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// 待確認的付款也計入，避免付款總額超過結算金額
+		var unconfirmed money.Amount
+		if err := tx.Model(&models.SettlementPayment{}).
+			Where("settlement_id = ? AND confirmed_at IS NULL", settlement.ID).
+			Select("COALESCE(SUM(amount), 0)").
+			Scan(&unconfirmed).Error; err != nil {
+			return err
+		}
+		if settlement.PaidAmount+unconfirmed+amount > settlement.Amount {
+			return ErrPaymentExceedsRemaining
+		}
+
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+		if !payment.IsConfirmed() {
+			return nil
+		}
+		return applyPayment(tx, settlement, amount, actorID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// ConfirmPayment 收款者確認付款者記錄的付款
+func (s *SettlementStateService) ConfirmPayment(settlement *models.Settlement, payment *models.SettlementPayment, actorID uint) error {
+	if !settlement.HasRole(actorID, models.SettlementRolePayee) {
+		return models.ErrSettlementTransitionForbidden
+	}
+	if payment.IsConfirmed() {
+		return ErrPaymentAlreadyConfirmed
+	}
+	if !settlement.AcceptsPayments() {
+		return fmt.Errorf("%w: %s 狀態的結算不能確認付款", models.ErrInvalidSettlementTransition, settlement.Status)
+	}
+
+	now := time.Now()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.SettlementPayment{}).
+			Where("id = ? AND confirmed_at IS NULL", payment.ID).
+			Update("confirmed_at", &now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrPaymentAlreadyConfirmed
+		}
+		payment.ConfirmedAt = &now
+
+		return applyPayment(tx, settlement, payment.Amount, actorID)
+	})
+}
+
+// Payments 取得結算的付款記錄（依時間排序）
+func (s *SettlementStateService) Payments(settlementID uint) ([]models.SettlementPayment, error) {
+	var payments []models.SettlementPayment
+	if err := s.db.Where("settlement_id = ?", settlementID).
+		Preload("RecordedBy").
+		Order("created_at, id").
+		Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+// applyPayment 累加已確認的付款金額，付清時轉換為 confirmed，否則為 partially_paid
+func applyPayment(tx *gorm.DB, settlement *models.Settlement, amount money.Amount, actorID uint) error {
+	previous := *settlement
+	result := tx.Model(&models.Settlement{}).
+		Where("id = ? AND paid_amount + ? <= amount", settlement.ID, amount).
+		Update("paid_amount", gorm.Expr("paid_amount + ?", amount))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPaymentExceedsRemaining
+	}
+	settlement.PaidAmount += amount
+	if err := NewBalanceService(tx).ApplySettlement(*settlement, previous); err != nil {
+		return err
+	}
+
+	target := models.SettlementPartiallyPaid
+	if settlement.PaidAmount >= settlement.Amount {
+		target = models.SettlementConfirmed
+	}
+	if settlement.Status == target {
+		return nil
+	}
+	return transitionSettlement(tx, settlement, target, actorID, "")
+}
+
+// transitionSettlement 以條件更新變更狀態並記錄事件，避免並行請求重複轉換
+func transitionSettlement(tx *gorm.DB, settlement *models.Settlement, to models.SettlementStatus, actorID uint, reason string) error {
+	from := settlement.Status
+	previous := *settlement
+	now := time.Now()
+
+	updates := map[string]interface{}{"status": to}
+	switch {
+	case to == models.SettlementConfirmed:
+		updates["settled_at"] = &now
+		updates["paid_amount"] = settlement.Amount
+	case to == models.SettlementRejected:
+		updates["responded_at"] = &now
+		updates["decline_reason"] = reason
+	case to == models.SettlementDisputed:
+		updates["dispute_reason"] = reason
+	case from == models.SettlementRequested && to == models.SettlementPending:
+		updates["responded_at"] = &now
+	}
+
+	result := tx.Model(&models.Settlement{}).
+		Where("id = ? AND status = ?", settlement.ID, from).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSettlementStatusChanged
+	}
+
+	if err := tx.Create(&models.SettlementEvent{
+		SettlementID: settlement.ID,
+		ActorID:      actorID,
+		FromStatus:   from,
+		ToStatus:     to,
+		Reason:       reason,
+	}).Error; err != nil {
+		return err
+	}
+
+	// 更新本地對象
+	settlement.Status = to
+	switch {
+	case to == models.SettlementConfirmed:
+		settlement.SettledAt = &now
+		settlement.PaidAmount = settlement.Amount
+	case to == models.SettlementRejected:
+		settlement.RespondedAt = &now
+		settlement.DeclineReason = reason
+	case to == models.SettlementDisputed:
+		settlement.DisputeReason = reason
+	case from == models.SettlementRequested && to == models.SettlementPending:
+		settlement.RespondedAt = &now
+	}
+
+	// 確認收款時將結算過帳
+	return NewBalanceService(tx).ApplySettlement(*settlement, previous)
+}
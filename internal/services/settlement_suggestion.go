@@ -0,0 +1,291 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"split-go/internal/models"
+	"split-go/internal/money"
+
+	"gorm.io/gorm"
+)
+
+// minimalStrategyMaxParticipants 最少轉帳演算法可處理的最多非零平衡人數
+// 演算法需列舉所有子集合（2^n），超過此人數時改用 greedy
+const minimalStrategyMaxParticipants = 16
+
+// SettlementSuggestionService 結算建議服務
+type SettlementSuggestionService struct {
+	db             *gorm.DB
+	balanceService *BalanceService
+}
+
+// NewSettlementSuggestionService 創建結算建議服務
+func NewSettlementSuggestionService(db *gorm.DB) *SettlementSuggestionService {
+	return &SettlementSuggestionService{
+		db:             db,
+		balanceService: NewBalanceService(db),
+	}
+}
+
+// ParseSettlementStrategy 解析結算策略，未提供時使用 minimal
+func ParseSettlementStrategy(value string) (models.SettlementStrategy, error) {
+	switch strategy := models.SettlementStrategy(value); strategy {
+	case "":
+		return models.StrategyMinimal, nil
+	case models.StrategyGreedy, models.StrategyMinimal, models.StrategyPairwise:
+		return strategy, nil
+	default:
+		return "", errors.New("無效的結算策略，請使用 greedy、minimal 或 pairwise")
+	}
+}
+
+// SuggestForGroup 依指定策略產生群組的結算建議
+func (s *SettlementSuggestionService) SuggestForGroup(groupID uint, strategy models.SettlementStrategy) (*models.SettlementPlan, error) {
+	var plan *models.SettlementPlan
+	if strategy == models.StrategyPairwise {
+		debts, err := s.balanceService.CalculatePairwiseDebts(groupID)
+		if err != nil {
+			return nil, err
+		}
+		plan = &models.SettlementPlan{Strategy: strategy, Suggestions: debts}
+	} else {
+		balances, err := s.balanceService.CalculateGroupBalances(groupID)
+		if err != nil {
+			return nil, err
+		}
+		plan = SimplifyBalances(balances, strategy)
+	}
+
+	plan.Fingerprint = planFingerprint(plan)
+	return plan, nil
+}
+
+// planFingerprint 計算結算建議的雜湊值
+// 建議會結清所有平衡，因此內容相同即代表建議所依據的平衡未變更
+func planFingerprint(plan *models.SettlementPlan) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n", plan.Strategy)
+	for _, suggestion := range plan.Suggestions {
+		fmt.Fprintf(hash, "%d>%d:%d %s\n", suggestion.FromUserID, suggestion.ToUserID, suggestion.Amount, suggestion.Currency)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// SuggestAcrossGroups 將用戶與同一位用戶在不同群組的債務互相抵銷
+// 只抵銷相同幣別的債務，且只列出涉及兩個以上群組的對象
+func (s *SettlementSuggestionService) SuggestAcrossGroups(userID uint) ([]models.CrossGroupSuggestion, error) {
+	summary, err := s.balanceService.SummarizeUserBalances(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	type pairKey struct {
+		counterpartyID uint
+		currency       string
+	}
+	suggestions := make(map[pairKey]*models.CrossGroupSuggestion)
+	net := make(map[pairKey]money.Amount) // 正數表示對方欠用戶
+	var order []pairKey
+
+	for _, group := range summary.Groups {
+		for _, counterparty := range group.Counterparties {
+			key := pairKey{counterparty.UserID, counterparty.Currency}
+			suggestion, exists := suggestions[key]
+			if !exists {
+				suggestion = &models.CrossGroupSuggestion{
+					CounterpartyID: counterparty.UserID,
+					Counterparty:   counterparty.User,
+					Currency:       counterparty.Currency,
+				}
+				suggestions[key] = suggestion
+				order = append(order, key)
+			}
+
+			leg := models.CrossGroupLeg{
+				GroupID:    group.Group.ID,
+				Group:      group.Group,
+				FromUserID: counterparty.UserID,
+				ToUserID:   userID,
+				Amount:     counterparty.Amount,
+			}
+			if counterparty.Amount < 0 {
+				leg.FromUserID, leg.ToUserID, leg.Amount = userID, counterparty.UserID, -counterparty.Amount
+			}
+			suggestion.Legs = append(suggestion.Legs, leg)
+			net[key] += counterparty.Amount
+		}
+	}
+
+	result := []models.CrossGroupSuggestion{}
+	for _, key := range order {
+		suggestion := suggestions[key]
+		if len(suggestion.Legs) < 2 {
+			continue
+		}
+
+		suggestion.FromUserID, suggestion.ToUserID, suggestion.Amount = key.counterpartyID, userID, net[key]
+		if net[key] < 0 {
+			suggestion.FromUserID, suggestion.ToUserID, suggestion.Amount = userID, key.counterpartyID, -net[key]
+		}
+		result = append(result, *suggestion)
+	}
+
+	return result, nil
+}
+
+// SimplifyBalances 依平衡產生結算建議
+// minimal 策略在非零平衡人數超過上限時改用 greedy，回傳的 Strategy 為實際使用的演算法
+func SimplifyBalances(balances []models.Balance, strategy models.SettlementStrategy) *models.SettlementPlan {
+	// 只處理非零平衡，依用戶 ID 排序確保結果具確定性
+	var participants []models.Balance
+	for _, balance := range balances {
+		if balance.Balance != 0 {
+			participants = append(participants, balance)
+		}
+	}
+	sort.Slice(participants, func(i, j int) bool {
+		return participants[i].UserID < participants[j].UserID
+	})
+
+	if strategy == models.StrategyMinimal && len(participants) <= minimalStrategyMaxParticipants {
+		return &models.SettlementPlan{
+			Strategy:    models.StrategyMinimal,
+			Suggestions: minimalSettlements(participants),
+		}
+	}
+
+	return &models.SettlementPlan{
+		Strategy:    models.StrategyGreedy,
+		Suggestions: greedySettlements(participants),
+	}
+}
+
+// greedySettlements 貪心演算法：每次由最大債權人與最大債務人配對轉帳
+// 每次轉帳至少結清一人，n 人最多需要 n-1 次轉帳
+func greedySettlements(balances []models.Balance) []models.SettlementSuggestion {
+	var suggestions []models.SettlementSuggestion
+
+	// 分離債權人和債務人（金額皆為最小貨幣單位，可精確比較）
+	var creditors []models.Balance // 應收錢的人（balance > 0）
+	var debtors []models.Balance   // 應付錢的人（balance < 0）
+	for _, balance := range balances {
+		if balance.Balance > 0 {
+			creditors = append(creditors, balance)
+		} else if balance.Balance < 0 {
+			debtors = append(debtors, balance)
+		}
+	}
+
+	// 依金額由大到小排序（穩定排序保留用戶 ID 順序）
+	sort.SliceStable(creditors, func(i, j int) bool {
+		return creditors[i].Balance > creditors[j].Balance
+	})
+	sort.SliceStable(debtors, func(i, j int) bool {
+		return debtors[i].Balance < debtors[j].Balance
+	})
+
+	i, j := 0, 0
+	for i < len(creditors) && j < len(debtors) {
+		creditor := &creditors[i]
+		debtor := &debtors[j]
+
+		// 計算轉帳金額
+		amount := min(creditor.Balance, -debtor.Balance)
+
+		suggestions = append(suggestions, models.SettlementSuggestion{
+			FromUserID: debtor.UserID,
+			FromUser:   debtor.User,
+			ToUserID:   creditor.UserID,
+			ToUser:     creditor.User,
+			Amount:     amount,
+			Currency:   creditor.Currency,
+		})
+
+		// 更新餘額並移動指針
+		creditor.Balance -= amount
+		debtor.Balance += amount
+		if creditor.Balance == 0 {
+			i++
+		}
+		if debtor.Balance == 0 {
+			j++
+		}
+	}
+
+	return suggestions
+}
+
+// minimalSettlements 精確的最少轉帳演算法
+// 將平衡分割為最多個總和為零的子集合，k 個子集合時最少需要 n-k 次轉帳；
+// 每個子集合內部再以貪心演算法結清
+func minimalSettlements(balances []models.Balance) []models.SettlementSuggestion {
+	n := len(balances)
+	if n == 0 {
+		return nil
+	}
+
+	full := 1<<n - 1
+
+	// sums[mask] 子集合的平衡總和
+	sums := make([]money.Amount, full+1)
+	for mask := 1; mask <= full; mask++ {
+		lowest := mask & -mask
+		index := bitIndex(lowest)
+		sums[mask] = sums[mask^lowest] + balances[index].Balance
+	}
+
+	// groups[mask] 以逐一加入成員的順序，mask 最多可分割出的零和子集合數量
+	groups := make([]int, full+1)
+	for mask := 1; mask <= full; mask++ {
+		best := 0
+		for rest := mask; rest > 0; rest &= rest - 1 {
+			bit := rest & -rest
+			if groups[mask^bit] > best {
+				best = groups[mask^bit]
+			}
+		}
+		if sums[mask] == 0 {
+			best++
+		}
+		groups[mask] = best
+	}
+
+	// 回溯找出各零和子集合：路徑上總和為零的 mask 即為子集合的邊界
+	var suggestions []models.SettlementSuggestion
+	var subset []models.Balance
+	for mask := full; mask > 0; {
+		if sums[mask] == 0 && len(subset) > 0 {
+			suggestions = append(suggestions, greedySettlements(subset)...)
+			subset = nil
+		}
+
+		target := groups[mask]
+		if sums[mask] == 0 {
+			target--
+		}
+		for rest := mask; rest > 0; rest &= rest - 1 {
+			bit := rest & -rest
+			if groups[mask^bit] == target {
+				subset = append(subset, balances[bitIndex(bit)])
+				mask ^= bit
+				break
+			}
+		}
+	}
+	suggestions = append(suggestions, greedySettlements(subset)...)
+
+	return suggestions
+}
+
+// bitIndex 取得只有一個位元為 1 的整數中該位元的位置
+func bitIndex(bit int) int {
+	index := 0
+	for bit > 1 {
+		bit >>= 1
+		index++
+	}
+	return index
+}
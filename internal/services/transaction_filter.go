@@ -0,0 +1,127 @@
+package services
+
+import (
+	"errors"
+	"split-go/internal/models"
+	"split-go/internal/money"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TransactionSortField 交易列表可排序的欄位
+type TransactionSortField string
+
+const (
+	TransactionSortCreatedAt   TransactionSortField = "created_at"  // 交易日期
+	TransactionSortUpdatedAt   TransactionSortField = "updated_at"  // 最後修改時間
+	TransactionSortAmount      TransactionSortField = "amount"      // 金額
+	TransactionSortDescription TransactionSortField = "description" // 描述
+)
+
+// baseAmountColumn 換算為群組基準幣別的金額，舊資料未記錄時視為原始金額（與 Transaction.AmountInBase 相同）
+const baseAmountColumn = "CASE WHEN base_amount = 0 THEN amount ELSE base_amount END"
+
+// TransactionFilter 交易列表的篩選與排序條件
+type TransactionFilter struct {
+	From          *time.Time // 交易日期下限（含）
+	Until         *time.Time // 交易日期上限（不含）
+	CategoryID    uint
+	PayerID       uint // 主要付款者或付款明細中的用戶
+	ParticipantID uint // 付款者或分帳參與者
+	Currency      string
+	MinAmount     *money.Amount // 指定 Currency 時比較原始金額，否則比較基準幣別金額
+	MaxAmount     *money.Amount
+	Search        string // 描述或備註包含的文字（不分大小寫）
+	Sort          TransactionSortField
+	Descending    bool
+}
+
+// ParseTransactionSort 解析排序欄位與方向，未提供時依交易日期由新到舊排序
+func ParseTransactionSort(field, direction string) (TransactionSortField, bool, error) {
+	sortField := TransactionSortField(field)
+	switch sortField {
+	case "":
+		sortField = TransactionSortCreatedAt
+	case TransactionSortCreatedAt, TransactionSortUpdatedAt, TransactionSortAmount, TransactionSortDescription:
+	default:
+		return "", false, errors.New("無效的排序欄位，請使用 created_at、updated_at、amount 或 description")
+	}
+
+	switch strings.ToLower(direction) {
+	case "", "desc":
+		return sortField, true, nil
+	case "asc":
+		return sortField, false, nil
+	default:
+		return "", false, errors.New("無效的排序方向，請使用 asc 或 desc")
+	}
+}
+
+// Apply 將篩選條件加入交易查詢
+func (f TransactionFilter) Apply(query *gorm.DB) *gorm.DB {
+	db := query.Session(&gorm.Session{NewDB: true})
+	if f.From != nil {
+		query = query.Where("created_at >= ?", *f.From)
+	}
+	if f.Until != nil {
+		query = query.Where("created_at < ?", *f.Until)
+	}
+	if f.CategoryID > 0 {
+		query = query.Where("category_id = ?", f.CategoryID)
+	}
+	if f.PayerID > 0 {
+		payments := db.Model(&models.TransactionPayment{}).Select("transaction_id").Where("user_id = ?", f.PayerID)
+		query = query.Where("(paid_by = ? OR id IN (?))", f.PayerID, payments)
+	}
+	if f.ParticipantID > 0 {
+		splits := db.Model(&models.TransactionSplit{}).Select("transaction_id").Where("user_id = ?", f.ParticipantID)
+		payments := db.Model(&models.TransactionPayment{}).Select("transaction_id").Where("user_id = ?", f.ParticipantID)
+		query = query.Where("(paid_by = ? OR id IN (?) OR id IN (?))", f.ParticipantID, splits, payments)
+	}
+	if f.Currency != "" {
+		query = query.Where("currency = ?", f.Currency)
+	}
+	if f.MinAmount != nil {
+		query = query.Where(f.amountColumn()+" >= ?", *f.MinAmount)
+	}
+	if f.MaxAmount != nil {
+		query = query.Where(f.amountColumn()+" <= ?", *f.MaxAmount)
+	}
+	if search := strings.TrimSpace(f.Search); search != "" {
+		pattern := "%" + escapeLike(strings.ToLower(search)) + "%"
+		query = query.Where(`(LOWER(description) LIKE ? ESCAPE '\' OR LOWER(notes) LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+	return query
+}
+
+// Order 將排序條件加入交易查詢，相同值時依 ID 排序讓分頁結果穩定
+func (f TransactionFilter) Order(query *gorm.DB) *gorm.DB {
+	column := string(f.Sort)
+	switch f.Sort {
+	case "":
+		column = string(TransactionSortCreatedAt)
+	case TransactionSortAmount:
+		column = f.amountColumn()
+	}
+
+	direction := " ASC"
+	if f.Descending {
+		direction = " DESC"
+	}
+	return query.Order(column + direction).Order("id" + direction)
+}
+
+// amountColumn 金額篩選與排序使用的欄位，指定幣別時為原始金額，否則為基準幣別金額
+func (f TransactionFilter) amountColumn() string {
+	if f.Currency != "" {
+		return "amount"
+	}
+	return baseAmountColumn
+}
+
+// escapeLike 跳脫 LIKE 的萬用字元，讓搜尋文字依字面比對
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
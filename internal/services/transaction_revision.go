@@ -0,0 +1,135 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"split-go/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrRevisionNotFound 交易沒有指定的版本
+var ErrRevisionNotFound = errors.New("交易版本不存在")
+
+// TransactionRevisionService 交易版本記錄服務，與交易的變更在同一個資料庫交易中寫入
+type TransactionRevisionService struct {
+	db *gorm.DB
+}
+
+// NewTransactionRevisionService 創建交易版本記錄服務
+func NewTransactionRevisionService(db *gorm.DB) *TransactionRevisionService {
+	return &TransactionRevisionService{db: db}
+}
+
+// Record 以交易目前的內容（包含已刪除的交易）建立下一個版本
+func (s *TransactionRevisionService) Record(transactionID uint, action models.RevisionAction, editorID uint, revertedFrom *int) (*models.TransactionRevision, error) {
+	transaction, err := s.loadTransaction(transactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest int
+	if err := s.db.Model(&models.TransactionRevision{}).
+		Where("transaction_id = ?", transactionID).
+		Select("COALESCE(MAX(revision), 0)").
+		Scan(&latest).Error; err != nil {
+		return nil, err
+	}
+
+	revision, err := newRevision(*transaction, latest+1, action, editorID)
+	if err != nil {
+		return nil, err
+	}
+	revision.RevertedFrom = revertedFrom
+	if err := s.db.Create(revision).Error; err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
+
+// EnsureBaseline 交易尚無版本記錄時（版本記錄加入前建立的交易），以目前內容建立第一個版本
+// 修改、刪除或回復交易前呼叫，讓變更前的內容也保留在歷史中
+func (s *TransactionRevisionService) EnsureBaseline(transactionID uint) error {
+	var count int64
+	if err := s.db.Model(&models.TransactionRevision{}).
+		Where("transaction_id = ?", transactionID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	transaction, err := s.loadTransaction(transactionID)
+	if err != nil {
+		return err
+	}
+	revision, err := newRevision(*transaction, 1, models.RevisionCreated, transaction.CreatedBy)
+	if err != nil {
+		return err
+	}
+	revision.CreatedAt = transaction.CreatedAt
+	return s.db.Create(revision).Error
+}
+
+// History 取得交易的所有版本（依版本號排序）
+func (s *TransactionRevisionService) History(transactionID uint) ([]models.TransactionRevision, error) {
+	var revisions []models.TransactionRevision
+	if err := s.db.Where("transaction_id = ?", transactionID).
+		Preload("Editor").
+		Order("revision").
+		Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// Find 取得交易的指定版本
+func (s *TransactionRevisionService) Find(transactionID uint, revision int) (*models.TransactionRevision, error) {
+	var found models.TransactionRevision
+	err := s.db.Where("transaction_id = ? AND revision = ?", transactionID, revision).First(&found).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &found, nil
+}
+
+// Snapshot 取得交易目前內容的快照
+func (s *TransactionRevisionService) Snapshot(transactionID uint) (models.TransactionSnapshot, error) {
+	transaction, err := s.loadTransaction(transactionID)
+	if err != nil {
+		return models.TransactionSnapshot{}, err
+	}
+	return models.NewTransactionSnapshot(*transaction), nil
+}
+
+// loadTransaction 載入建立快照所需的交易資料
+func (s *TransactionRevisionService) loadTransaction(transactionID uint) (*models.Transaction, error) {
+	var transaction models.Transaction
+	if err := s.db.Unscoped().Preload("Group").Preload("Payments").
+		Preload("Splits", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Items.Consumers").
+		First(&transaction, transactionID).Error; err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+// newRevision 建立包含交易快照的版本記錄
+func newRevision(transaction models.Transaction, number int, action models.RevisionAction, editorID uint) (*models.TransactionRevision, error) {
+	snapshot, err := json.Marshal(models.NewTransactionSnapshot(transaction))
+	if err != nil {
+		return nil, err
+	}
+	return &models.TransactionRevision{
+		TransactionID: transaction.ID,
+		Revision:      number,
+		Action:        action,
+		EditorID:      editorID,
+		Snapshot:      snapshot,
+	}, nil
+}
@@ -32,6 +32,17 @@ func (s *ValidationService) ValidateGroupMember(groupID, userID uint) error {
 
 // ValidateMultipleGroupMembers 驗證多個用戶是否都是群組成員
 func (s *ValidationService) ValidateMultipleGroupMembers(groupID uint, userIDs []uint) error {
+	// 去除重複的用戶 ID，避免計數不一致
+	seen := make(map[uint]bool)
+	var uniqueIDs []uint
+	for _, userID := range userIDs {
+		if !seen[userID] {
+			seen[userID] = true
+			uniqueIDs = append(uniqueIDs, userID)
+		}
+	}
+	userIDs = uniqueIDs
+
 	var memberCount int64
 	if err := s.db.Model(&models.GroupMember{}).
 		Where("group_id = ? AND user_id IN ?", groupID, userIDs).
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"reflect"
 	"regexp"
+	"split-go/internal/money"
 	"strings"
 )
 
@@ -56,6 +57,13 @@ func validateField(field reflect.Value, rule, fieldName string) error {
 			}
 		}
 
+	case rule == "iso4217":
+		if field.Kind() == reflect.String && field.String() != "" {
+			if _, exists := money.LookupCurrency(field.String()); !exists {
+				return errors.New(fieldName + " 不是有效的 ISO 4217 幣別")
+			}
+		}
+
 	case strings.HasPrefix(rule, "min="):
 		minStr := strings.TrimPrefix(rule, "min=")
 		if field.Kind() == reflect.String {
@@ -0,0 +1,78 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"split-go/internal/handlers"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestGetCurrencies(t *testing.T) {
+	handler := handlers.NewCurrencyHandler()
+
+	app := fiber.New()
+	app.Get("/currencies", handler.GetCurrencies)
+
+	req := httptest.NewRequest("GET", "/currencies", nil)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("無法執行請求: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("期望狀態碼 %d，得到 %d", http.StatusOK, resp.StatusCode)
+	}
+
+	var response struct {
+		Data []struct {
+			Code        string `json:"code"`
+			NumericCode string `json:"numeric_code"`
+			Exponent    int    `json:"exponent"`
+			Symbol      string `json:"symbol"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("無法解析回應: %v", err)
+	}
+
+	// 幣別應依代碼排序
+	for i := 1; i < len(response.Data); i++ {
+		if response.Data[i-1].Code >= response.Data[i].Code {
+			t.Fatalf("幣別未依代碼排序: %s, %s", response.Data[i-1].Code, response.Data[i].Code)
+		}
+	}
+
+	tests := []struct {
+		code        string
+		numericCode string
+		exponent    int
+	}{
+		{code: "TWD", numericCode: "901", exponent: 2},
+		{code: "JPY", numericCode: "392", exponent: 0},
+		{code: "KWD", numericCode: "414", exponent: 3},
+		{code: "ALL", numericCode: "008", exponent: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			for _, currency := range response.Data {
+				if currency.Code != tt.code {
+					continue
+				}
+				if currency.NumericCode != tt.numericCode {
+					t.Errorf("期望數字代碼 %s，得到 %s", tt.numericCode, currency.NumericCode)
+				}
+				if currency.Exponent != tt.exponent {
+					t.Errorf("期望小數位數 %d，得到 %d", tt.exponent, currency.Exponent)
+				}
+				if currency.Symbol == "" {
+					t.Error("幣別符號不應為空")
+				}
+				return
+			}
+			t.Errorf("幣別列表缺少 %s", tt.code)
+		})
+	}
+}
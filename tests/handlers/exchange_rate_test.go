@@ -0,0 +1,176 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"split-go/internal/handlers"
+	"split-go/internal/models"
+	"split-go/internal/services"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const testECBXML = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2024-01-03">
+			<Cube currency="USD" rate="1.0919"/>
+			<Cube currency="JPY" rate="155.52"/>
+		</Cube>
+		<Cube time="2024-01-02">
+			<Cube currency="USD" rate="1.0956"/>
+			<Cube currency="JPY" rate="155.09"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+const testRatesCSV = `date,base,quote,rate
+2024-01-02,USD,TWD,30.70
+`
+
+// 設置匯率測試資料庫並匯入測試匯率
+func setupExchangeRateTestDB(t *testing.T) *gorm.DB {
+	db := setupTestDB()
+
+	if err := db.AutoMigrate(&models.ExchangeRate{}); err != nil {
+		panic("無法執行匯率表遷移")
+	}
+
+	ecbRates, err := services.ParseECBXML(strings.NewReader(testECBXML))
+	if err != nil {
+		t.Fatalf("解析 ECB XML 失敗: %v", err)
+	}
+	csvRates, err := services.ParseExchangeRatesCSV(strings.NewReader(testRatesCSV), "csv")
+	if err != nil {
+		t.Fatalf("解析 CSV 失敗: %v", err)
+	}
+
+	service := services.NewExchangeRateService(db)
+	if _, err := service.Import(append(ecbRates, csvRates...)); err != nil {
+		t.Fatalf("匯入匯率失敗: %v", err)
+	}
+
+	// 重複匯入應覆寫而非新增，同一批資料中重複的組合只寫入一次
+	imported, err := service.Import(append(csvRates, csvRates...))
+	if err != nil {
+		t.Fatalf("重複匯入匯率失敗: %v", err)
+	}
+	if imported != len(csvRates) {
+		t.Fatalf("期望匯入 %d 筆不重複的匯率，得到 %d 筆", len(csvRates), imported)
+	}
+
+	var count int64
+	db.Model(&models.ExchangeRate{}).Count(&count)
+	if count != 5 {
+		t.Fatalf("期望 5 筆匯率，得到 %d 筆", count)
+	}
+
+	return db
+}
+
+func TestGetExchangeRate(t *testing.T) {
+	db := setupExchangeRateTestDB(t)
+	handler := handlers.NewExchangeRateHandler(db)
+
+	app := fiber.New()
+	app.Get("/exchange-rates", handler.GetExchangeRate)
+
+	tests := []struct {
+		name            string
+		query           string
+		expectedStatus  int
+		expectedRate    float64
+		expectedDate    string
+		expectedConvert string
+	}{
+		{
+			name:           "直接匯率",
+			query:          "base=EUR&quote=USD&date=2024-01-02",
+			expectedStatus: http.StatusOK,
+			expectedRate:   1.0956,
+			expectedDate:   "2024-01-02",
+		},
+		{
+			name:            "週末使用前一個交易日並預覽換算",
+			query:           "base=USD&quote=TWD&date=2024-01-06&amount=10.50",
+			expectedStatus:  http.StatusOK,
+			expectedRate:    30.70,
+			expectedDate:    "2024-01-02",
+			expectedConvert: "322.35",
+		},
+		{
+			name:           "反向匯率",
+			query:          "base=TWD&quote=USD&date=2024-01-02",
+			expectedStatus: http.StatusOK,
+			expectedRate:   1 / 30.70,
+			expectedDate:   "2024-01-02",
+		},
+		{
+			name:           "透過 EUR 的交叉匯率",
+			query:          "base=JPY&quote=USD&date=2024-01-03",
+			expectedStatus: http.StatusOK,
+			expectedRate:   1.0919 / 155.52,
+			expectedDate:   "2024-01-03",
+		},
+		{
+			name:           "早於所有資料的日期",
+			query:          "base=EUR&quote=USD&date=2023-12-31",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "缺少報價幣別",
+			query:          "base=EUR",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "無效的日期格式",
+			query:          "base=EUR&quote=USD&date=2024/01/02",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/exchange-rates?"+tt.query, nil)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("無法執行請求: %v", err)
+			}
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Fatalf("期望狀態碼 %d，得到 %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data struct {
+					Rate            float64     `json:"rate"`
+					Date            string      `json:"date"`
+					ConvertedAmount json.Number `json:"converted_amount"`
+				} `json:"data"`
+			}
+			json.NewDecoder(resp.Body).Decode(&response)
+
+			if math.Abs(response.Data.Rate-tt.expectedRate) > 1e-9 {
+				t.Errorf("期望匯率 %v，得到 %v", tt.expectedRate, response.Data.Rate)
+			}
+			if response.Data.Date != tt.expectedDate {
+				t.Errorf("期望匯率日期 %s，得到 %s", tt.expectedDate, response.Data.Date)
+			}
+			if tt.expectedConvert != "" && response.Data.ConvertedAmount.String() != tt.expectedConvert {
+				t.Errorf("期望換算金額 %s，得到 %s", tt.expectedConvert, response.Data.ConvertedAmount)
+			}
+		})
+	}
+
+	// 清理
+	db.Where("1 = 1").Delete(&models.ExchangeRate{})
+}
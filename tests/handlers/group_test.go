@@ -375,6 +375,7 @@ func TestUpdateGroup(t *testing.T) {
 		reqBody := map[string]interface{}{
 			"name":        "更新後的群組名",
 			"description": "更新後的描述",
+			"version":     group.Version,
 		}
 		jsonBody, _ := json.Marshal(reqBody)
 
@@ -454,6 +455,141 @@ func TestUpdateGroup(t *testing.T) {
 			t.Errorf("期望狀態碼 %d，得到 %d", http.StatusBadRequest, resp.StatusCode)
 		}
 	})
+
+	t.Run("版本檢查", func(t *testing.T) {
+		app := fiber.New()
+		app.Use("/groups/:id", func(c *fiber.Ctx) error {
+			c.Locals("user_id", user1.ID)
+			return c.Next()
+		})
+		app.Get("/groups/:id", handler.GetGroup)
+		app.Put("/groups/:id", handler.UpdateGroup)
+
+		update := func(ifMatch string, body map[string]interface{}) *http.Response {
+			t.Helper()
+			jsonBody, _ := json.Marshal(body)
+			req := httptest.NewRequest("PUT", fmt.Sprintf("/groups/%d", group.ID), bytes.NewBuffer(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+			if ifMatch != "" {
+				req.Header.Set("If-Match", ifMatch)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("無法執行請求: %v", err)
+			}
+			return resp
+		}
+
+		// GET 以 ETag 回傳目前的版本
+		resp, err := app.Test(httptest.NewRequest("GET", fmt.Sprintf("/groups/%d", group.ID), nil))
+		if err != nil {
+			t.Fatalf("無法執行請求: %v", err)
+		}
+		etag := resp.Header.Get("ETag")
+		if etag != `"2"` {
+			t.Fatalf("期望 ETag 為 \"2\"，得到 %s", etag)
+		}
+
+		// 未提供版本
+		if resp := update("", map[string]interface{}{"name": "沒有版本"}); resp.StatusCode != http.StatusPreconditionRequired {
+			t.Errorf("期望狀態碼 %d，得到 %d", http.StatusPreconditionRequired, resp.StatusCode)
+		}
+
+		// 使用 If-Match 更新後版本遞增
+		resp = update(etag, map[string]interface{}{"name": "第一支手機"})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("期望狀態碼 %d，得到 %d", http.StatusOK, resp.StatusCode)
+		}
+		if resp.Header.Get("ETag") != `"3"` {
+			t.Errorf("期望更新後 ETag 為 \"3\"，得到 %s", resp.Header.Get("ETag"))
+		}
+
+		// 另一支手機以舊版本更新時回傳 409 與目前的群組資訊
+		resp = update(etag, map[string]interface{}{"name": "第二支手機"})
+		if resp.StatusCode != http.StatusConflict {
+			t.Fatalf("期望狀態碼 %d，得到 %d", http.StatusConflict, resp.StatusCode)
+		}
+		var conflict struct {
+			Data struct {
+				Name    string `json:"name"`
+				Version uint   `json:"version"`
+			} `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&conflict)
+		if conflict.Data.Name != "第一支手機" || conflict.Data.Version != 3 {
+			t.Errorf("期望回傳目前的群組（第一支手機，版本 3），得到 %+v", conflict.Data)
+		}
+
+		var current models.Group
+		db.First(&current, group.ID)
+		if current.Name != "第一支手機" || current.Version != 3 {
+			t.Errorf("過期的修改不應覆寫群組，得到 %s（版本 %d）", current.Name, current.Version)
+		}
+	})
+}
+
+// 測試變更群組基準幣別
+func TestUpdateGroupBaseCurrency(t *testing.T) {
+	db := setupTransactionTestDB()
+	handler := handlers.NewGroupHandler(db)
+
+	user := createTestUser(db, "currency-admin@example.com", "currencyadmin")
+	app := fiber.New()
+	app.Use("/groups/:id", func(c *fiber.Ctx) error {
+		c.Locals("user_id", user.ID)
+		return c.Next()
+	})
+	app.Put("/groups/:id", handler.UpdateGroup)
+
+	update := func(group *models.Group, baseCurrency string) *http.Response {
+		t.Helper()
+		var current models.Group
+		db.First(&current, group.ID)
+		jsonBody, _ := json.Marshal(map[string]interface{}{
+			"name":          current.Name,
+			"base_currency": baseCurrency,
+			"version":       current.Version,
+		})
+		req := httptest.NewRequest("PUT", fmt.Sprintf("/groups/%d", group.ID), bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("無法執行請求: %v", err)
+		}
+		return resp
+	}
+
+	// 沒有帳務記錄時可以變更
+	empty := createTestGroup(db, "新群組", "測試描述", user.ID)
+	if resp := update(empty, "USD"); resp.StatusCode != http.StatusOK {
+		t.Errorf("期望狀態碼 %d，得到 %d", http.StatusOK, resp.StatusCode)
+	}
+
+	// 垃圾桶中的交易仍可還原，不能變更
+	trashed := createTestGroup(db, "有刪除交易的群組", "測試描述", user.ID)
+	transaction := createTestTransaction(db, trashed.ID, user.ID, user.ID, 10000)
+	db.Delete(transaction)
+	if resp := update(trashed, "USD"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("期望狀態碼 %d，得到 %d", http.StatusBadRequest, resp.StatusCode)
+	}
+	var unchanged models.Group
+	db.First(&unchanged, trashed.ID)
+	if unchanged.BaseCurrency != "TWD" {
+		t.Errorf("期望基準幣別維持 TWD，得到 %s", unchanged.BaseCurrency)
+	}
+
+	// 無法確認是否有帳務記錄時不變更
+	db.Migrator().DropTable(&models.SettlementEvent{}, &models.SettlementPayment{}, &models.Settlement{})
+	failing := createTestGroup(db, "查詢失敗的群組", "測試描述", user.ID)
+	if resp := update(failing, "USD"); resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("期望狀態碼 %d，得到 %d", http.StatusInternalServerError, resp.StatusCode)
+	}
+
+	// 清理
+	db.Unscoped().Where("1 = 1").Delete(&models.Transaction{})
+	db.Where("1 = 1").Delete(&models.GroupMember{})
+	db.Where("1 = 1").Delete(&models.Group{})
+	db.Delete(user)
 }
 
 // 測試刪除群組
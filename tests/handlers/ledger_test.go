@@ -0,0 +1,380 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"split-go/internal/handlers"
+	"split-go/internal/models"
+	"split-go/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// 測試交易與結算過帳至日記帳後的試算表與帳戶明細
+func TestGroupLedger(t *testing.T) {
+	db := setupTransactionTestDB()
+	transactionHandler := handlers.NewTransactionHandler(db)
+	ledgerHandler := handlers.NewLedgerHandler(db)
+	balanceService := services.NewBalanceService(db)
+
+	// 創建測試資料
+	user1 := createTestUser(db, "journal1@example.com", "journal1")
+	user2 := createTestUser(db, "journal2@example.com", "journal2")
+	user3 := createTestUser(db, "journal3@example.com", "journal3")
+	outsider := createTestUser(db, "journal4@example.com", "journal4")
+	group := createTestGroup(db, "帳簿測試群組", "測試描述", user1.ID)
+	addGroupMember(db, group.ID, user2.ID, "member")
+	addGroupMember(db, group.ID, user3.ID, "member")
+
+	testApp := fiber.New()
+	testApp.Use(func(c *fiber.Ctx) error {
+		switch c.Get("X-User") {
+		case "outsider":
+			c.Locals("user_id", outsider.ID)
+		case "user2":
+			c.Locals("user_id", user2.ID)
+		default:
+			c.Locals("user_id", user1.ID)
+		}
+		return c.Next()
+	})
+	testApp.Post("/transactions", transactionHandler.CreateTransaction)
+	testApp.Put("/transactions/:id", transactionHandler.UpdateTransaction)
+	testApp.Get("/groups/:id/ledger", ledgerHandler.GetTrialBalance)
+	testApp.Get("/groups/:id/ledger/members/:userId", ledgerHandler.GetAccountStatement)
+
+	send := func(method, url, actor string, body interface{}) *http.Response {
+		t.Helper()
+		var reader *bytes.Buffer
+		if body != nil {
+			jsonBody, _ := json.Marshal(body)
+			reader = bytes.NewBuffer(jsonBody)
+		} else {
+			reader = bytes.NewBuffer(nil)
+		}
+		req := httptest.NewRequest(method, url, reader)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User", actor)
+		resp, err := testApp.Test(req)
+		if err != nil {
+			t.Fatalf("無法執行請求: %v", err)
+		}
+		return resp
+	}
+	createTransaction := func(body map[string]interface{}) uint {
+		t.Helper()
+		resp := send("POST", "/transactions", "", body)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("建立交易期望狀態碼 %d，得到 %d", http.StatusCreated, resp.StatusCode)
+		}
+		var response struct {
+			Data struct {
+				ID uint `json:"id"`
+			} `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&response)
+		return response.Data.ID
+	}
+
+	// 1. 晚餐 900 由 user1 支付，三人平分後修改為 1200
+	dinnerID := createTransaction(map[string]interface{}{
+		"group_id":    group.ID,
+		"description": "晚餐",
+		"amount":      900,
+		"paid_by":     user1.ID,
+		"split_type":  "equal",
+		"splits":      []map[string]interface{}{{"user_id": user1.ID}, {"user_id": user2.ID}, {"user_id": user3.ID}},
+	})
+	if resp := send("PUT", fmt.Sprintf("/transactions/%d", dinnerID), "", map[string]interface{}{"amount": 1200, "version": 1}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("修改交易期望狀態碼 %d，得到 %d", http.StatusOK, resp.StatusCode)
+	}
+
+	// 2. 門票 10 USD（匯率 32）由 user2 支付，user2 與 user3 平分
+	createTransaction(map[string]interface{}{
+		"group_id":      group.ID,
+		"description":   "門票",
+		"amount":        10,
+		"currency":      "USD",
+		"exchange_rate": 32,
+		"paid_by":       user2.ID,
+		"split_type":    "equal",
+		"splits":        []map[string]interface{}{{"user_id": user2.ID}, {"user_id": user3.ID}},
+	})
+
+	// 3. user2 付給 user1 的結算，收款者確認收到 100
+	stateService := services.NewSettlementStateService(db)
+	settlement := &models.Settlement{
+		GroupID:    group.ID,
+		FromUserID: user2.ID,
+		ToUserID:   user1.ID,
+		Amount:     40000,
+		Currency:   "TWD",
+		Status:     models.SettlementPending,
+	}
+	if err := stateService.Create([]*models.Settlement{settlement}, user2.ID); err != nil {
+		t.Fatalf("建立結算失敗: %v", err)
+	}
+	if _, err := stateService.RecordPayment(settlement, 10000, user1.ID, ""); err != nil {
+		t.Fatalf("記錄付款失敗: %v", err)
+	}
+
+	t.Run("試算表借貸相等", func(t *testing.T) {
+		resp := send("GET", fmt.Sprintf("/groups/%d/ledger", group.ID), "", nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("期望狀態碼 %d，得到 %d", http.StatusOK, resp.StatusCode)
+		}
+
+		type amounts struct {
+			Debit   float64 `json:"debit"`
+			Credit  float64 `json:"credit"`
+			Balance float64 `json:"balance"`
+		}
+		var response struct {
+			Data struct {
+				BaseCurrency string `json:"base_currency"`
+				Accounts     []struct {
+					UserID   uint   `json:"user_id"`
+					Currency string `json:"currency"`
+					amounts
+				} `json:"accounts"`
+				Totals []struct {
+					Currency string `json:"currency"`
+					amounts
+				} `json:"totals"`
+				UnbalancedEntries []uint `json:"unbalanced_entries"`
+				Balanced          bool   `json:"balanced"`
+			} `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&response)
+		data := response.Data
+
+		if !data.Balanced || len(data.UnbalancedEntries) != 0 {
+			t.Errorf("期望試算表借貸相等，得到 balanced=%v unbalanced=%v", data.Balanced, data.UnbalancedEntries)
+		}
+		if data.BaseCurrency != "TWD" {
+			t.Errorf("期望基準幣別 TWD，得到 %s", data.BaseCurrency)
+		}
+
+		// 修改交易以沖銷分錄抵銷原本的過帳，借貸兩邊都會出現
+		expectedAccounts := map[string]amounts{
+			fmt.Sprintf("%d-TWD", user1.ID): {2400, 1700, 700},
+			fmt.Sprintf("%d-TWD", user2.ID): {400, 700, -300},
+			fmt.Sprintf("%d-TWD", user3.ID): {300, 700, -400},
+			fmt.Sprintf("%d-USD", user2.ID): {10, 5, 5},
+			fmt.Sprintf("%d-USD", user3.ID): {0, 5, -5},
+		}
+		if len(data.Accounts) != len(expectedAccounts) {
+			t.Fatalf("期望 %d 個帳戶，得到 %d 個", len(expectedAccounts), len(data.Accounts))
+		}
+		for _, account := range data.Accounts {
+			key := fmt.Sprintf("%d-%s", account.UserID, account.Currency)
+			if account.amounts != expectedAccounts[key] {
+				t.Errorf("帳戶 %s 期望 %+v，得到 %+v", key, expectedAccounts[key], account.amounts)
+			}
+		}
+
+		expectedTotals := map[string]float64{"TWD": 3100, "USD": 10}
+		if len(data.Totals) != len(expectedTotals) {
+			t.Fatalf("期望 %d 個幣別合計，得到 %d 個", len(expectedTotals), len(data.Totals))
+		}
+		for _, total := range data.Totals {
+			if total.Debit != expectedTotals[total.Currency] || total.Credit != expectedTotals[total.Currency] {
+				t.Errorf("%s 期望借貸合計 %v，得到借方 %v 貸方 %v", total.Currency, expectedTotals[total.Currency], total.Debit, total.Credit)
+			}
+		}
+	})
+
+	t.Run("帳戶明細與群組平衡一致", func(t *testing.T) {
+		resp := send("GET", fmt.Sprintf("/groups/%d/ledger/members/%d", group.ID, user2.ID), "user2", nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("期望狀態碼 %d，得到 %d", http.StatusOK, resp.StatusCode)
+		}
+
+		type line struct {
+			Kind           string  `json:"kind"`
+			Reversal       bool    `json:"reversal"`
+			Currency       string  `json:"currency"`
+			Amount         float64 `json:"amount"`
+			RunningBalance float64 `json:"running_balance"`
+		}
+		var response struct {
+			Data struct {
+				Lines   []line  `json:"lines"`
+				Balance float64 `json:"balance"`
+			} `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&response)
+
+		expected := []line{
+			{"share", false, "TWD", -300, -300},
+			{"share", true, "TWD", 300, 0},
+			{"share", false, "TWD", -400, -400},
+			{"payment", false, "USD", 10, -80},
+			{"share", false, "USD", -5, -240},
+			{"settlement", false, "TWD", 100, -140},
+		}
+		if len(response.Data.Lines) != len(expected) {
+			t.Fatalf("期望 %d 筆過帳，得到 %d 筆", len(expected), len(response.Data.Lines))
+		}
+		for i, want := range expected {
+			if response.Data.Lines[i] != want {
+				t.Errorf("第 %d 筆過帳期望 %+v，得到 %+v", i+1, want, response.Data.Lines[i])
+			}
+		}
+
+		balances, err := balanceService.CalculateGroupBalances(group.ID)
+		if err != nil {
+			t.Fatalf("計算群組平衡失敗: %v", err)
+		}
+		for _, balance := range balances {
+			if balance.UserID == user2.ID && balance.Balance != -14000 {
+				t.Errorf("期望群組平衡 -14000，得到 %d", balance.Balance)
+			}
+		}
+		if response.Data.Balance != -140 {
+			t.Errorf("期望帳戶平衡 -140，得到 %v", response.Data.Balance)
+		}
+	})
+
+	t.Run("沒有帳戶的用戶", func(t *testing.T) {
+		resp := send("GET", fmt.Sprintf("/groups/%d/ledger/members/%d", group.ID, outsider.ID), "", nil)
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("期望狀態碼 %d，得到 %d", http.StatusNotFound, resp.StatusCode)
+		}
+	})
+
+	t.Run("非群組成員無法查看", func(t *testing.T) {
+		resp := send("GET", fmt.Sprintf("/groups/%d/ledger", group.ID), "outsider", nil)
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("期望狀態碼 %d，得到 %d", http.StatusForbidden, resp.StatusCode)
+		}
+	})
+
+	t.Run("補登既有資料的分錄", func(t *testing.T) {
+		legacy := createTestGroup(db, "舊資料群組", "測試描述", user1.ID)
+		addGroupMember(db, legacy.ID, user2.ID, "member")
+		rent := createTestTransaction(db, legacy.ID, user1.ID, user1.ID, 20000)
+		createTestTransactionSplit(db, rent.ID, user1.ID, 10000)
+		createTestTransactionSplit(db, rent.ID, user2.ID, 10000)
+		paid := createTestSettlement(db, legacy.ID, user2.ID, user1.ID, 5000)
+		db.Model(paid).Update("status", models.SettlementConfirmed)
+
+		trialBalance, err := balanceService.TrialBalance(legacy.ID)
+		if err != nil {
+			t.Fatalf("產生試算表失敗: %v", err)
+		}
+		if !trialBalance.Balanced || len(trialBalance.Accounts) != 2 {
+			t.Fatalf("期望 2 個借貸相等的帳戶，得到 %+v", trialBalance)
+		}
+		if trialBalance.Accounts[0].Balance != 5000 || trialBalance.Accounts[1].Balance != -5000 {
+			t.Errorf("期望帳戶平衡 5000 與 -5000，得到 %d 與 %d", trialBalance.Accounts[0].Balance, trialBalance.Accounts[1].Balance)
+		}
+
+		// 補登只執行一次
+		if err := balanceService.RebuildLedger(legacy.ID); err != nil {
+			t.Fatalf("重建平衡表失敗: %v", err)
+		}
+		var entryCount int64
+		db.Model(&models.JournalEntry{}).Where("group_id = ?", legacy.ID).Count(&entryCount)
+		if entryCount != 2 {
+			t.Errorf("期望 2 筆分錄，得到 %d 筆", entryCount)
+		}
+	})
+
+	// 清理
+	db.Where("1 = 1").Delete(&models.Posting{})
+	db.Where("1 = 1").Delete(&models.JournalEntry{})
+	db.Where("1 = 1").Delete(&models.MemberBalance{})
+	db.Where("1 = 1").Delete(&models.SettlementPayment{})
+	db.Where("1 = 1").Delete(&models.SettlementEvent{})
+	db.Unscoped().Where("1 = 1").Delete(&models.Settlement{})
+	db.Where("1 = 1").Delete(&models.TransactionPayment{})
+	db.Where("1 = 1").Delete(&models.TransactionSplit{})
+	db.Unscoped().Where("1 = 1").Delete(&models.Transaction{})
+	db.Where("1 = 1").Delete(&models.GroupMember{})
+	db.Where("1 = 1").Delete(&models.Group{})
+	db.Delete(user1)
+	db.Delete(user2)
+	db.Delete(user3)
+	db.Delete(outsider)
+}
+
+// 測試第一次讀取平衡（建立平衡表）時同時新增交易，平衡表仍包含所有過帳
+func TestLedgerConcurrentPostingAndFirstRead(t *testing.T) {
+	db := setupTransactionTestDB()
+	// 記憶體資料庫的每個連線各自獨立，限制為單一連線讓並行的請求共用同一個資料庫
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	balanceService := services.NewBalanceService(db)
+
+	user1 := createTestUser(db, "concurrent1@example.com", "concurrent1")
+	user2 := createTestUser(db, "concurrent2@example.com", "concurrent2")
+	group := createTestGroup(db, "並行過帳群組", "測試描述", user1.ID)
+	addGroupMember(db, group.ID, user2.ID, "member")
+
+	const postings = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, postings+1)
+	for i := 0; i < postings; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// 與新增交易的處理相同，交易與過帳在同一個資料庫交易中寫入
+			errs <- db.Transaction(func(tx *gorm.DB) error {
+				transaction := createTestTransaction(tx, group.ID, user1.ID, user1.ID, 10000)
+				createTestTransactionSplit(tx, transaction.ID, user1.ID, 5000)
+				createTestTransactionSplit(tx, transaction.ID, user2.ID, 5000)
+				return services.NewBalanceService(tx).AddTransaction(transaction.ID)
+			})
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := balanceService.CalculateGroupBalances(group.ID)
+		errs <- err
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("並行過帳失敗: %v", err)
+		}
+	}
+
+	discrepancies, err := balanceService.CheckLedger(group.ID)
+	if err != nil {
+		t.Fatalf("比對平衡表失敗: %v", err)
+	}
+	if len(discrepancies) != 0 {
+		t.Errorf("期望平衡表與過帳一致，得到 %d 筆不一致", len(discrepancies))
+	}
+
+	balances, err := balanceService.CalculateGroupBalances(group.ID)
+	if err != nil {
+		t.Fatalf("取得平衡失敗: %v", err)
+	}
+	for _, balance := range balances {
+		if balance.UserID == user1.ID && balance.Balance != postings*5000 {
+			t.Errorf("期望付款者平衡 %d，得到 %d", postings*5000, balance.Balance)
+		}
+	}
+
+	// 清理
+	db.Where("1 = 1").Delete(&models.Posting{})
+	db.Where("1 = 1").Delete(&models.JournalEntry{})
+	db.Where("1 = 1").Delete(&models.MemberBalance{})
+	db.Where("1 = 1").Delete(&models.TransactionSplit{})
+	db.Unscoped().Where("1 = 1").Delete(&models.Transaction{})
+	db.Where("1 = 1").Delete(&models.GroupMember{})
+	db.Where("1 = 1").Delete(&models.Group{})
+	db.Delete(user1)
+	db.Delete(user2)
+}
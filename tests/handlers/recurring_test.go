@@ -0,0 +1,355 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"split-go/internal/handlers"
+	"split-go/internal/models"
+	"split-go/internal/money"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// 設置定期交易測試資料庫
+func setupRecurringTestDB() *gorm.DB {
+	db := setupTransactionTestDB()
+
+	if err := db.AutoMigrate(&models.RecurringTransaction{}); err != nil {
+		panic("無法執行定期交易表遷移")
+	}
+
+	return db
+}
+
+func TestCreateRecurringTransaction(t *testing.T) {
+	db := setupRecurringTestDB()
+	handler := handlers.NewRecurringTransactionHandler(db)
+
+	// 創建測試資料
+	user1 := createTestUser(db, "rec1@example.com", "rec1")
+	user2 := createTestUser(db, "rec2@example.com", "rec2")
+	outsider := createTestUser(db, "rec3@example.com", "rec3")
+	group := createTestGroup(db, "合租公寓", "測試描述", user1.ID)
+	addGroupMember(db, group.ID, user2.ID, "member")
+
+	testApp := fiber.New()
+	testApp.Use("/groups", func(c *fiber.Ctx) error {
+		c.Locals("user_id", user1.ID)
+		return c.Next()
+	})
+	testApp.Post("/groups/:id/recurring", handler.CreateRecurringTransaction)
+
+	splits := []map[string]interface{}{
+		{"user_id": user1.ID},
+		{"user_id": user2.ID},
+	}
+
+	tests := []struct {
+		name              string
+		requestBody       map[string]interface{}
+		expectedStatus    int
+		expectedError     string
+		expectedNextRunAt string
+	}{
+		{
+			name: "每月 31 日於短月份使用月底",
+			requestBody: map[string]interface{}{
+				"description":  "房租",
+				"amount":       30000,
+				"paid_by":      user1.ID,
+				"split_type":   "equal",
+				"splits":       splits,
+				"frequency":    "monthly",
+				"day_of_month": 31,
+				"start_date":   "2024-02-10",
+			},
+			expectedStatus:    http.StatusCreated,
+			expectedNextRunAt: "2024-02-29",
+		},
+		{
+			name: "每週以開始日期為第一次發生",
+			requestBody: map[string]interface{}{
+				"description": "清潔用品",
+				"amount":      300,
+				"paid_by":     user2.ID,
+				"split_type":  "equal",
+				"splits":      splits,
+				"frequency":   "weekly",
+				"start_date":  "2024-03-04",
+			},
+			expectedStatus:    http.StatusCreated,
+			expectedNextRunAt: "2024-03-04",
+		},
+		{
+			name: "無效的重複方式",
+			requestBody: map[string]interface{}{
+				"description": "網路費",
+				"amount":      999,
+				"paid_by":     user1.ID,
+				"split_type":  "equal",
+				"splits":      splits,
+				"frequency":   "yearly",
+				"start_date":  "2024-03-01",
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "無效的重複方式，請使用 monthly、weekly 或 custom",
+		},
+		{
+			name: "結束日期早於開始日期",
+			requestBody: map[string]interface{}{
+				"description": "網路費",
+				"amount":      999,
+				"paid_by":     user1.ID,
+				"split_type":  "equal",
+				"splits":      splits,
+				"frequency":   "monthly",
+				"start_date":  "2024-03-01",
+				"end_date":    "2024-02-01",
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "結束日期不能早於開始日期",
+		},
+		{
+			name: "分帳成員不在群組內",
+			requestBody: map[string]interface{}{
+				"description": "水電費",
+				"amount":      1200,
+				"paid_by":     user1.ID,
+				"split_type":  "equal",
+				"splits": []map[string]interface{}{
+					{"user_id": user1.ID},
+					{"user_id": outsider.ID},
+				},
+				"frequency":  "custom",
+				"interval":   10,
+				"start_date": "2024-03-01",
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "部分用戶不是群組成員",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonBody, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest("POST", fmt.Sprintf("/groups/%d/recurring", group.ID), bytes.NewBuffer(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := testApp.Test(req)
+			if err != nil {
+				t.Fatalf("無法執行請求: %v", err)
+			}
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("期望狀態碼 %d，得到 %d", tt.expectedStatus, resp.StatusCode)
+			}
+
+			var responseBody map[string]interface{}
+			json.NewDecoder(resp.Body).Decode(&responseBody)
+
+			if tt.expectedError != "" {
+				if message, _ := responseBody["message"].(string); message != tt.expectedError {
+					t.Errorf("期望錯誤訊息 '%s'，得到 '%s'", tt.expectedError, message)
+				}
+			}
+
+			if tt.expectedNextRunAt != "" {
+				data := responseBody["data"].(map[string]interface{})
+				if data["next_run_at"] != tt.expectedNextRunAt {
+					t.Errorf("期望下次執行日期 %s，得到 %v", tt.expectedNextRunAt, data["next_run_at"])
+				}
+			}
+		})
+	}
+
+	// 清理
+	db.Where("group_id = ?", group.ID).Delete(&models.RecurringTransaction{})
+	db.Delete(group)
+	db.Delete(user1)
+	db.Delete(user2)
+	db.Delete(outsider)
+}
+
+func TestProcessDueRecurringTransactions(t *testing.T) {
+	db := setupRecurringTestDB()
+
+	// 創建測試資料
+	user1 := createTestUser(db, "due1@example.com", "due1")
+	user2 := createTestUser(db, "due2@example.com", "due2")
+	group := createTestGroup(db, "合租公寓", "測試描述", user1.ID)
+	addGroupMember(db, group.ID, user2.ID, "member")
+
+	splits, _ := json.Marshal([]models.TransactionSplitRequest{
+		{UserID: user1.ID},
+		{UserID: user2.ID},
+	})
+	endDate := time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)
+
+	rent := models.RecurringTransaction{
+		GroupID:     group.ID,
+		Description: "房租",
+		Amount:      3000001,
+		Currency:    "TWD",
+		PaidBy:      user1.ID,
+		SplitType:   models.SplitEqual,
+		Splits:      splits,
+		Frequency:   models.RecurrenceMonthly,
+		Interval:    1,
+		DayOfMonth:  31,
+		StartDate:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:     &endDate,
+		CreatedBy:   user1.ID,
+	}
+	rent.NextRunAt = rent.FirstOccurrence()
+	rent.Active = true
+	db.Create(&rent)
+
+	// 第一次執行：補產生 1/31 與 2/29 兩次發生
+	now := time.Date(2024, 3, 5, 8, 0, 0, 0, time.UTC)
+	created, err := handlers.NewRecurringTransactionHandler(db).ProcessDueRecurringTransactions(now)
+	if err != nil {
+		t.Fatalf("執行排程失敗: %v", err)
+	}
+	if created != 2 {
+		t.Fatalf("期望產生 2 筆交易，得到 %d 筆", created)
+	}
+
+	// 模擬重新啟動：新的處理器不會重複產生相同的發生日期
+	created, err = handlers.NewRecurringTransactionHandler(db).ProcessDueRecurringTransactions(now)
+	if err != nil {
+		t.Fatalf("執行排程失敗: %v", err)
+	}
+	if created != 0 {
+		t.Fatalf("重新執行不應產生交易，得到 %d 筆", created)
+	}
+
+	var transactions []models.Transaction
+	db.Where("recurring_transaction_id = ?", rent.ID).Order("occurrence_date").Find(&transactions)
+	if len(transactions) != 2 {
+		t.Fatalf("期望 2 筆定期交易，得到 %d 筆", len(transactions))
+	}
+	for i, expectedDate := range []string{"2024-01-31", "2024-02-29"} {
+		if date := transactions[i].OccurrenceDate.Format("2006-01-02"); date != expectedDate {
+			t.Errorf("第 %d 筆期望發生日期 %s，得到 %s", i+1, expectedDate, date)
+		}
+	}
+
+	var splitRecords []models.TransactionSplit
+	db.Where("transaction_id = ?", transactions[0].ID).Order("id").Find(&splitRecords)
+	expectedAmounts := []money.Amount{1500001, 1500000}
+	if len(splitRecords) != len(expectedAmounts) {
+		t.Fatalf("期望 %d 筆分帳，得到 %d 筆", len(expectedAmounts), len(splitRecords))
+	}
+	for i, split := range splitRecords {
+		if split.Amount != expectedAmounts[i] {
+			t.Errorf("第 %d 筆分帳期望 %d，得到 %d", i+1, expectedAmounts[i], split.Amount)
+		}
+	}
+
+	// 最後一次發生在結束日期當天，之後停止排程
+	created, _ = handlers.NewRecurringTransactionHandler(db).ProcessDueRecurringTransactions(endDate.AddDate(0, 1, 0))
+	if created != 1 {
+		t.Fatalf("期望產生 1 筆交易，得到 %d 筆", created)
+	}
+	db.First(&rent, rent.ID)
+	if rent.Active {
+		t.Error("超過結束日期後應停止排程")
+	}
+
+	// 成員離開群組時暫停排程並記錄原因
+	utilities := rent
+	utilities.ID = 0
+	utilities.Description = "水電費"
+	utilities.EndDate = nil
+	utilities.LastRunAt = nil
+	utilities.NextRunAt = utilities.FirstOccurrence()
+	utilities.Active = true
+	db.Create(&utilities)
+	db.Where("group_id = ? AND user_id = ?", group.ID, user2.ID).Delete(&models.GroupMember{})
+
+	created, _ = handlers.NewRecurringTransactionHandler(db).ProcessDueRecurringTransactions(now)
+	if created != 0 {
+		t.Errorf("成員離開後不應產生交易，得到 %d 筆", created)
+	}
+	db.First(&utilities, utilities.ID)
+	if utilities.Active || utilities.LastError == "" {
+		t.Errorf("期望暫停排程並記錄錯誤，得到 active=%v last_error=%q", utilities.Active, utilities.LastError)
+	}
+
+	// 清理
+	db.Where("1 = 1").Delete(&models.TransactionSplit{})
+	db.Where("1 = 1").Delete(&models.TransactionPayment{})
+	db.Where("group_id = ?", group.ID).Delete(&models.Transaction{})
+	db.Where("group_id = ?", group.ID).Delete(&models.RecurringTransaction{})
+	db.Delete(group)
+	db.Delete(user1)
+	db.Delete(user2)
+}
+
+// 測試每次排程補產生的次數上限，其餘於下次排程繼續
+func TestProcessDueRecurringTransactionsLimit(t *testing.T) {
+	db := setupRecurringTestDB()
+
+	user1 := createTestUser(db, "limit1@example.com", "limit1")
+	user2 := createTestUser(db, "limit2@example.com", "limit2")
+	group := createTestGroup(db, "長期停機群組", "測試描述", user1.ID)
+	addGroupMember(db, group.ID, user2.ID, "member")
+
+	splits, _ := json.Marshal([]models.TransactionSplitRequest{
+		{UserID: user1.ID},
+		{UserID: user2.ID},
+	})
+	lunch := models.RecurringTransaction{
+		GroupID:     group.ID,
+		Description: "每週午餐",
+		Amount:      20000,
+		Currency:    "TWD",
+		PaidBy:      user1.ID,
+		SplitType:   models.SplitEqual,
+		Splits:      splits,
+		Frequency:   models.RecurrenceWeekly,
+		Interval:    1,
+		StartDate:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		CreatedBy:   user1.ID,
+	}
+	lunch.NextRunAt = lunch.FirstOccurrence()
+	lunch.Active = true
+	db.Create(&lunch)
+
+	// 1/1 至 3/25 共 13 次發生，每次排程最多補產生 5 次
+	now := time.Date(2024, 3, 31, 8, 0, 0, 0, time.UTC)
+	handler := handlers.NewRecurringTransactionHandler(db)
+	handler.SetMaxPerRun(5)
+	for i, expected := range []int{5, 5, 3, 0} {
+		created, err := handler.ProcessDueRecurringTransactions(now)
+		if err != nil {
+			t.Fatalf("執行排程失敗: %v", err)
+		}
+		if created != expected {
+			t.Errorf("第 %d 次排程期望產生 %d 筆交易，得到 %d 筆", i+1, expected, created)
+		}
+	}
+
+	var transactions []models.Transaction
+	db.Where("recurring_transaction_id = ?", lunch.ID).Order("occurrence_date").Find(&transactions)
+	if len(transactions) != 13 {
+		t.Fatalf("期望 13 筆定期交易，得到 %d 筆", len(transactions))
+	}
+	if date := transactions[12].OccurrenceDate.Format("2006-01-02"); date != "2024-03-25" {
+		t.Errorf("最後一筆期望發生日期 2024-03-25，得到 %s", date)
+	}
+
+	// 清理
+	db.Where("1 = 1").Delete(&models.TransactionSplit{})
+	db.Where("1 = 1").Delete(&models.TransactionPayment{})
+	db.Where("group_id = ?", group.ID).Delete(&models.Transaction{})
+	db.Where("group_id = ?", group.ID).Delete(&models.RecurringTransaction{})
+	db.Delete(group)
+	db.Delete(user1)
+	db.Delete(user2)
+}
@@ -7,7 +7,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"split-go/internal/handlers"
+	"split-go/internal/middleware"
 	"split-go/internal/models"
+	"split-go/internal/money"
+	"split-go/internal/services"
 	"testing"
 	"time"
 
@@ -24,8 +27,17 @@ func setupSettlementTestDB() *gorm.DB {
 		&models.Group{},
 		&models.GroupMember{},
 		&models.Settlement{},
+		&models.SettlementEvent{},
+		&models.SettlementPayment{},
+		&models.MemberBalance{},
+		&models.JournalEntry{},
+		&models.Posting{},
 		&models.Transaction{},
 		&models.TransactionSplit{},
+		&models.TransactionPayment{},
+		&models.TransactionRevision{},
+		&models.ExchangeRate{},
+		&models.IdempotencyKey{},
 	)
 	if err != nil {
 		panic("無法執行結算表遷移")
@@ -35,7 +47,7 @@ func setupSettlementTestDB() *gorm.DB {
 }
 
 // 創建測試結算記錄
-func createTestSettlement(db *gorm.DB, groupID, fromUserID, toUserID uint, amount float64) *models.Settlement {
+func createTestSettlement(db *gorm.DB, groupID, fromUserID, toUserID uint, amount money.Amount) *models.Settlement {
 	settlement := &models.Settlement{
 		GroupID:    groupID,
 		FromUserID: fromUserID,
@@ -53,7 +65,7 @@ func createTestSettlement(db *gorm.DB, groupID, fromUserID, toUserID uint, amoun
 }
 
 // 創建測試交易記錄（用於平衡計算）
-func createTestTransaction(db *gorm.DB, groupID, paidBy, createdBy uint, amount float64) *models.Transaction {
+func createTestTransaction(db *gorm.DB, groupID, paidBy, createdBy uint, amount money.Amount) *models.Transaction {
 	transaction := &models.Transaction{
 		GroupID:     groupID,
 		Description: "測試交易",
@@ -70,7 +82,7 @@ func createTestTransaction(db *gorm.DB, groupID, paidBy, createdBy uint, amount
 }
 
 // 創建測試分帳記錄
-func createTestTransactionSplit(db *gorm.DB, transactionID, userID uint, amount float64) {
+func createTestTransactionSplit(db *gorm.DB, transactionID, userID uint, amount money.Amount) {
 	split := &models.TransactionSplit{
 		TransactionID: transactionID,
 		UserID:        userID,
@@ -209,6 +221,11 @@ func TestCreateSettlement(t *testing.T) {
 	// 添加用戶到群組
 	addGroupMember(db, group.ID, user2.ID, "member")
 
+	// user2 付 300，兩人各 150：user1 應付 user2 150
+	transaction := createTestTransaction(db, group.ID, user2.ID, user2.ID, 30000)
+	createTestTransactionSplit(db, transaction.ID, user1.ID, 15000)
+	createTestTransactionSplit(db, transaction.ID, user2.ID, 15000)
+
 	tests := []struct {
 		name           string
 		userID         uint
@@ -228,6 +245,39 @@ func TestCreateSettlement(t *testing.T) {
 			},
 			expectedStatus: http.StatusCreated,
 		},
+		{
+			name:   "金額超過目前應付金額",
+			userID: user1.ID,
+			requestBody: map[string]interface{}{
+				"group_id":   group.ID,
+				"to_user_id": user2.ID,
+				"amount":     200.0,
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "結算金額超過目前應付金額：目前應付 150.00 TWD，如確定要結算請設定 force",
+		},
+		{
+			name:   "強制建立超額結算",
+			userID: user1.ID,
+			requestBody: map[string]interface{}{
+				"group_id":   group.ID,
+				"to_user_id": user2.ID,
+				"amount":     200.0,
+				"force":      true,
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:   "不欠款的一方付款",
+			userID: user2.ID,
+			requestBody: map[string]interface{}{
+				"group_id":   group.ID,
+				"to_user_id": user1.ID,
+				"amount":     50.0,
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "結算金額超過目前應付金額：目前應付 0.00 TWD，如確定要結算請設定 force",
+		},
 		{
 			name:   "收款者不是群組成員",
 			userID: user1.ID,
@@ -259,6 +309,19 @@ func TestCreateSettlement(t *testing.T) {
 			},
 			expectedStatus: http.StatusBadRequest,
 		},
+		{
+			name:   "不支援的幣別",
+			userID: user1.ID,
+			requestBody: map[string]interface{}{
+				"group_id":      group.ID,
+				"to_user_id":    user2.ID,
+				"amount":        100.0,
+				"currency":      "ABC",
+				"exchange_rate": 1,
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "不支援的幣別: ABC",
+		},
 		{
 			name:   "金額為零",
 			userID: user1.ID,
@@ -316,12 +379,23 @@ func TestCreateSettlement(t *testing.T) {
 				if count == 0 {
 					t.Error("結算記錄未正確創建")
 				}
+
+				// 回應包含預估平衡，強制建立時附上警告
+				data, _ := responseBody["data"].(map[string]interface{})
+				if balances, _ := data["projected_balances"].([]interface{}); len(balances) != 2 {
+					t.Errorf("期望 2 筆預估平衡，得到 %v", data["projected_balances"])
+				}
+				if warning, _ := data["warning"].(string); (warning != "") != (tt.requestBody["force"] == true) {
+					t.Errorf("警告訊息不符: '%s'", warning)
+				}
 			}
 		})
 	}
 
 	// 清理
 	db.Where("group_id = ?", group.ID).Delete(&models.Settlement{})
+	db.Where("transaction_id = ?", transaction.ID).Delete(&models.TransactionSplit{})
+	db.Delete(transaction)
 	db.Delete(group)
 	db.Delete(user1)
 	db.Delete(user2)
@@ -420,8 +494,8 @@ func TestMarkAsPaid(t *testing.T) {
 				// 驗證狀態是否已更新
 				var updatedSettlement models.Settlement
 				db.First(&updatedSettlement, settlement.ID)
-				if updatedSettlement.Status != "paid" {
-					t.Error("結算狀態未正確更新為 paid")
+				if updatedSettlement.Status != models.SettlementConfirmed {
+					t.Error("結算狀態未正確更新為 confirmed")
 				}
 				if updatedSettlement.SettledAt == nil {
 					t.Error("結算時間未設置")
@@ -495,7 +569,7 @@ func TestCancelSettlement(t *testing.T) {
 			name:             "無法取消已付款的結算",
 			userID:           user1.ID,
 			settlementID:     settlement.ID,
-			settlementStatus: "paid",
+			settlementStatus: "confirmed",
 			expectedStatus:   http.StatusBadRequest,
 			expectedError:    "只能取消待付款的結算記錄",
 		},
@@ -539,11 +613,11 @@ func TestCancelSettlement(t *testing.T) {
 			}
 
 			if tt.expectedStatus == http.StatusOK {
-				// 驗證記錄是否被軟刪除
-				var count int64
-				db.Model(&models.Settlement{}).Where("id = ?", freshSettlement.ID).Count(&count)
-				if count != 0 {
-					t.Error("結算記錄未正確刪除")
+				// 驗證記錄保留並標記為已取消
+				var cancelled models.Settlement
+				db.First(&cancelled, freshSettlement.ID)
+				if cancelled.Status != models.SettlementCancelled {
+					t.Errorf("期望狀態 cancelled，得到 %s", cancelled.Status)
 				}
 			}
 		})
@@ -640,7 +714,11 @@ func TestGetSettlementSuggestions(t *testing.T) {
 				var responseBody map[string]interface{}
 				json.NewDecoder(resp.Body).Decode(&responseBody)
 
-				data, ok := responseBody["data"].([]interface{})
+				plan, ok := responseBody["data"].(map[string]interface{})
+				if !ok {
+					t.Fatal("回應資料格式錯誤")
+				}
+				data, ok := plan["suggestions"].([]interface{})
 				if !ok {
 					t.Fatal("回應資料格式錯誤")
 				}
@@ -648,6 +726,9 @@ func TestGetSettlementSuggestions(t *testing.T) {
 				if len(data) != tt.expectedCount {
 					t.Errorf("期望 %d 個結算建議，得到 %d 個", tt.expectedCount, len(data))
 				}
+				if plan["transfer_count"] != float64(tt.expectedCount) {
+					t.Errorf("期望轉帳次數 %d，得到 %v", tt.expectedCount, plan["transfer_count"])
+				}
 
 				// 驗證結算建議內容
 				if len(data) > 0 {
@@ -668,3 +749,1109 @@ func TestGetSettlementSuggestions(t *testing.T) {
 	db.Delete(user2)
 	db.Delete(user3)
 }
+
+// 測試不同結算策略的轉帳次數
+func TestSettlementSuggestionStrategies(t *testing.T) {
+	db := setupSettlementTestDB()
+	handler := handlers.NewSettlementHandler(db)
+
+	// 創建測試資料
+	users := make([]*models.User, 5)
+	for i := range users {
+		users[i] = createTestUser(db, fmt.Sprintf("strategy%d@example.com", i+1), fmt.Sprintf("strategy%d", i+1))
+	}
+	group := createTestGroup(db, "策略測試群組", "測試描述", users[0].ID)
+	for _, user := range users[1:] {
+		addGroupMember(db, group.ID, user.ID, "member")
+	}
+
+	// 平衡為 +600、+500、-500、-300、-300：
+	// 依金額配對需要 4 次轉帳，分割為 {+500,-500} 與 {+600,-300,-300} 只需 3 次
+	dinner := createTestTransaction(db, group.ID, users[0].ID, users[0].ID, 60000)
+	createTestTransactionSplit(db, dinner.ID, users[3].ID, 30000)
+	createTestTransactionSplit(db, dinner.ID, users[4].ID, 30000)
+	taxi := createTestTransaction(db, group.ID, users[1].ID, users[1].ID, 50000)
+	createTestTransactionSplit(db, taxi.ID, users[2].ID, 50000)
+
+	testApp := fiber.New()
+	testApp.Use("/groups/:id/settlement-suggestions", func(c *fiber.Ctx) error {
+		c.Locals("user_id", users[0].ID)
+		return c.Next()
+	})
+	testApp.Get("/groups/:id/settlement-suggestions", handler.GetSettlementSuggestions)
+
+	tests := []struct {
+		name             string
+		query            string
+		expectedStatus   int
+		expectedStrategy string
+		expectedCount    int
+	}{
+		{
+			name:             "預設使用最少轉帳",
+			query:            "",
+			expectedStatus:   http.StatusOK,
+			expectedStrategy: "minimal",
+			expectedCount:    3,
+		},
+		{
+			name:             "貪心演算法",
+			query:            "?strategy=greedy",
+			expectedStatus:   http.StatusOK,
+			expectedStrategy: "greedy",
+			expectedCount:    4,
+		},
+		{
+			name:             "兩兩債務不跨人抵銷",
+			query:            "?strategy=pairwise",
+			expectedStatus:   http.StatusOK,
+			expectedStrategy: "pairwise",
+			expectedCount:    3,
+		},
+		{
+			name:           "無效的策略",
+			query:          "?strategy=random",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", fmt.Sprintf("/groups/%d/settlement-suggestions%s", group.ID, tt.query), nil)
+			resp, err := testApp.Test(req)
+			if err != nil {
+				t.Fatalf("無法執行請求: %v", err)
+			}
+			if resp.StatusCode != tt.expectedStatus {
+				t.Fatalf("期望狀態碼 %d，得到 %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var responseBody struct {
+				Data struct {
+					Strategy      string `json:"strategy"`
+					TransferCount int    `json:"transfer_count"`
+					Suggestions   []struct {
+						FromUserID uint        `json:"from_user_id"`
+						ToUserID   uint        `json:"to_user_id"`
+						Amount     json.Number `json:"amount"`
+					} `json:"suggestions"`
+				} `json:"data"`
+			}
+			json.NewDecoder(resp.Body).Decode(&responseBody)
+
+			if responseBody.Data.Strategy != tt.expectedStrategy {
+				t.Errorf("期望策略 %s，得到 %s", tt.expectedStrategy, responseBody.Data.Strategy)
+			}
+			if responseBody.Data.TransferCount != tt.expectedCount || len(responseBody.Data.Suggestions) != tt.expectedCount {
+				t.Errorf("期望 %d 次轉帳，得到 %d 次（%d 筆建議）", tt.expectedCount,
+					responseBody.Data.TransferCount, len(responseBody.Data.Suggestions))
+			}
+
+			// 套用所有轉帳後每個人都應結清
+			net := map[uint]float64{
+				users[0].ID: 600, users[1].ID: 500, users[2].ID: -500, users[3].ID: -300, users[4].ID: -300,
+			}
+			for _, suggestion := range responseBody.Data.Suggestions {
+				amount, _ := suggestion.Amount.Float64()
+				net[suggestion.FromUserID] += amount
+				net[suggestion.ToUserID] -= amount
+			}
+			for userID, remaining := range net {
+				if remaining != 0 {
+					t.Errorf("用戶 %d 結算後仍有餘額 %v", userID, remaining)
+				}
+			}
+		})
+	}
+
+	// 清理
+	db.Where("transaction_id IN ?", []uint{dinner.ID, taxi.ID}).Delete(&models.TransactionSplit{})
+	db.Delete(dinner)
+	db.Delete(taxi)
+	db.Delete(group)
+	for _, user := range users {
+		db.Delete(user)
+	}
+}
+
+// 測試兩兩債務明細
+func TestGetGroupDebts(t *testing.T) {
+	db := setupSettlementTestDB()
+	handler := handlers.NewSettlementHandler(db)
+
+	// 創建測試資料
+	alice := createTestUser(db, "debt1@example.com", "debt1")
+	bob := createTestUser(db, "debt2@example.com", "debt2")
+	carol := createTestUser(db, "debt3@example.com", "debt3")
+	outsider := createTestUser(db, "debt4@example.com", "debt4")
+	group := createTestGroup(db, "債務測試群組", "測試描述", alice.ID)
+	addGroupMember(db, group.ID, bob.ID, "member")
+	addGroupMember(db, group.ID, carol.ID, "member")
+
+	// Alice 付晚餐 900，三人各 300；Bob 付計程車 300，Alice 與 Bob 各 150
+	dinner := createTestTransaction(db, group.ID, alice.ID, alice.ID, 90000)
+	createTestTransactionSplit(db, dinner.ID, alice.ID, 30000)
+	createTestTransactionSplit(db, dinner.ID, bob.ID, 30000)
+	createTestTransactionSplit(db, dinner.ID, carol.ID, 30000)
+	taxi := createTestTransaction(db, group.ID, bob.ID, bob.ID, 30000)
+	createTestTransactionSplit(db, taxi.ID, alice.ID, 15000)
+	createTestTransactionSplit(db, taxi.ID, bob.ID, 15000)
+
+	// Carol 已還給 Alice 100，未付款的結算不影響債務
+	paid := createTestSettlement(db, group.ID, carol.ID, alice.ID, 10000)
+	db.Model(paid).Update("status", models.SettlementConfirmed)
+	pending := createTestSettlement(db, group.ID, carol.ID, alice.ID, 5000)
+
+	testApp := fiber.New()
+	testApp.Use("/groups/:id/debts", func(c *fiber.Ctx) error {
+		if c.Get("X-User") == "outsider" {
+			c.Locals("user_id", outsider.ID)
+		} else {
+			c.Locals("user_id", alice.ID)
+		}
+		return c.Next()
+	})
+	testApp.Get("/groups/:id/debts", handler.GetGroupDebts)
+
+	type contribution struct {
+		TransactionID *uint   `json:"transaction_id"`
+		SettlementID  *uint   `json:"settlement_id"`
+		Amount        float64 `json:"amount"`
+	}
+	type debt struct {
+		FromUserID    uint           `json:"from_user_id"`
+		ToUserID      uint           `json:"to_user_id"`
+		Amount        float64        `json:"amount"`
+		Contributions []contribution `json:"contributions"`
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		user           string
+		expectedStatus int
+		expectedDebts  []debt
+	}{
+		{
+			name:           "不含明細",
+			query:          "",
+			expectedStatus: http.StatusOK,
+			expectedDebts: []debt{
+				{FromUserID: bob.ID, ToUserID: alice.ID, Amount: 150},
+				{FromUserID: carol.ID, ToUserID: alice.ID, Amount: 200},
+			},
+		},
+		{
+			name:           "列出構成債務的交易與結算",
+			query:          "?details=true",
+			expectedStatus: http.StatusOK,
+			expectedDebts: []debt{
+				{FromUserID: bob.ID, ToUserID: alice.ID, Amount: 150, Contributions: []contribution{
+					{TransactionID: &dinner.ID, Amount: 300},
+					{TransactionID: &taxi.ID, Amount: -150},
+				}},
+				{FromUserID: carol.ID, ToUserID: alice.ID, Amount: 200, Contributions: []contribution{
+					{TransactionID: &dinner.ID, Amount: 300},
+					{SettlementID: &paid.ID, Amount: -100},
+				}},
+			},
+		},
+		{
+			name:           "篩選指定用戶",
+			query:          fmt.Sprintf("?user_id=%d", carol.ID),
+			expectedStatus: http.StatusOK,
+			expectedDebts: []debt{
+				{FromUserID: carol.ID, ToUserID: alice.ID, Amount: 200},
+			},
+		},
+		{
+			name:           "非群組成員",
+			user:           "outsider",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", fmt.Sprintf("/groups/%d/debts%s", group.ID, tt.query), nil)
+			req.Header.Set("X-User", tt.user)
+			resp, err := testApp.Test(req)
+			if err != nil {
+				t.Fatalf("無法執行請求: %v", err)
+			}
+			if resp.StatusCode != tt.expectedStatus {
+				t.Fatalf("期望狀態碼 %d，得到 %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var responseBody struct {
+				Data []debt `json:"data"`
+			}
+			json.NewDecoder(resp.Body).Decode(&responseBody)
+
+			if len(responseBody.Data) != len(tt.expectedDebts) {
+				t.Fatalf("期望 %d 筆債務，得到 %d 筆", len(tt.expectedDebts), len(responseBody.Data))
+			}
+			for i, expected := range tt.expectedDebts {
+				actual := responseBody.Data[i]
+				if actual.FromUserID != expected.FromUserID || actual.ToUserID != expected.ToUserID || actual.Amount != expected.Amount {
+					t.Errorf("第 %d 筆期望 %d 欠 %d %v，得到 %d 欠 %d %v", i+1,
+						expected.FromUserID, expected.ToUserID, expected.Amount,
+						actual.FromUserID, actual.ToUserID, actual.Amount)
+				}
+				if len(actual.Contributions) != len(expected.Contributions) {
+					t.Fatalf("第 %d 筆期望 %d 筆明細，得到 %d 筆", i+1, len(expected.Contributions), len(actual.Contributions))
+				}
+				for j, want := range expected.Contributions {
+					got := actual.Contributions[j]
+					if got.Amount != want.Amount ||
+						(want.TransactionID != nil && (got.TransactionID == nil || *got.TransactionID != *want.TransactionID)) ||
+						(want.SettlementID != nil && (got.SettlementID == nil || *got.SettlementID != *want.SettlementID)) {
+						t.Errorf("第 %d 筆債務的第 %d 筆明細不符: %+v", i+1, j+1, got)
+					}
+				}
+			}
+		})
+	}
+
+	// 清理
+	db.Where("transaction_id IN ?", []uint{dinner.ID, taxi.ID}).Delete(&models.TransactionSplit{})
+	db.Delete(dinner)
+	db.Delete(taxi)
+	db.Delete(paid)
+	db.Delete(pending)
+	db.Delete(group)
+	db.Delete(alice)
+	db.Delete(bob)
+	db.Delete(carol)
+	db.Delete(outsider)
+}
+
+// 測試跨群組抵銷債務
+func TestCrossGroupSettlementSuggestions(t *testing.T) {
+	db := setupSettlementTestDB()
+	handler := handlers.NewSettlementHandler(db)
+
+	// 創建測試資料
+	alice := createTestUser(db, "cross1@example.com", "cross1")
+	bob := createTestUser(db, "cross2@example.com", "cross2")
+
+	// 室友分帳群：Alice 欠 Bob 500
+	roommates := createTestGroup(db, "室友分帳群", "測試描述", bob.ID)
+	addGroupMember(db, roommates.ID, alice.ID, "member")
+	utilities := createTestTransaction(db, roommates.ID, bob.ID, bob.ID, 100000)
+	createTestTransactionSplit(db, utilities.ID, alice.ID, 50000)
+	createTestTransactionSplit(db, utilities.ID, bob.ID, 50000)
+
+	// 日本旅遊：Bob 欠 Alice 300
+	japan := createTestGroup(db, "日本旅遊", "測試描述", alice.ID)
+	addGroupMember(db, japan.ID, bob.ID, "member")
+	hotel := createTestTransaction(db, japan.ID, alice.ID, alice.ID, 60000)
+	createTestTransactionSplit(db, hotel.ID, alice.ID, 30000)
+	createTestTransactionSplit(db, hotel.ID, bob.ID, 30000)
+
+	testApp := fiber.New()
+	testApp.Use(func(c *fiber.Ctx) error {
+		if c.Get("X-User") == "bob" {
+			c.Locals("user_id", bob.ID)
+		} else {
+			c.Locals("user_id", alice.ID)
+		}
+		return c.Next()
+	})
+	testApp.Get("/users/me/settlement-suggestions", handler.GetCrossGroupSettlementSuggestions)
+	testApp.Post("/users/me/settlement-suggestions/accept", handler.AcceptCrossGroupSettlementSuggestion)
+	testApp.Put("/settlements/:id/paid", handler.MarkAsPaid)
+	testApp.Put("/settlements/:id/sent", handler.MarkAsSent)
+	testApp.Put("/settlements/:id/dispute", handler.DisputeSettlement)
+
+	request := func(method, url, user string, body interface{}) *http.Response {
+		var reader *bytes.Buffer
+		if body != nil {
+			jsonBody, _ := json.Marshal(body)
+			reader = bytes.NewBuffer(jsonBody)
+		} else {
+			reader = bytes.NewBuffer(nil)
+		}
+		req := httptest.NewRequest(method, url, reader)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User", user)
+		resp, err := testApp.Test(req)
+		if err != nil {
+			t.Fatalf("無法執行請求: %v", err)
+		}
+		return resp
+	}
+
+	// 1. 兩個群組的債務抵銷後只需 Alice 付 Bob 200
+	var suggestions struct {
+		Data []struct {
+			CounterpartyID uint    `json:"counterparty_id"`
+			FromUserID     uint    `json:"from_user_id"`
+			ToUserID       uint    `json:"to_user_id"`
+			Amount         float64 `json:"amount"`
+			TransfersSaved int     `json:"transfers_saved"`
+			Legs           []struct {
+				Amount float64 `json:"amount"`
+			} `json:"legs"`
+		} `json:"data"`
+	}
+	resp := request("GET", "/users/me/settlement-suggestions", "alice", nil)
+	json.NewDecoder(resp.Body).Decode(&suggestions)
+	if len(suggestions.Data) != 1 {
+		t.Fatalf("期望 1 筆跨群組建議，得到 %d 筆", len(suggestions.Data))
+	}
+	suggestion := suggestions.Data[0]
+	if suggestion.CounterpartyID != bob.ID || suggestion.FromUserID != alice.ID || suggestion.ToUserID != bob.ID ||
+		suggestion.Amount != 200 || suggestion.TransfersSaved != 1 || len(suggestion.Legs) != 2 {
+		t.Errorf("跨群組建議不符: %+v", suggestion)
+	}
+
+	// 2. 接受建議後在兩個群組各建立一筆連結的結算記錄
+	accept := map[string]interface{}{"counterparty_id": bob.ID, "currency": "twd"}
+	resp = request("POST", "/users/me/settlement-suggestions/accept", "alice", accept)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("期望狀態碼 %d，得到 %d", http.StatusCreated, resp.StatusCode)
+	}
+	var accepted struct {
+		Data struct {
+			LinkID      string `json:"link_id"`
+			Settlements []struct {
+				ID      uint    `json:"id"`
+				GroupID uint    `json:"group_id"`
+				Amount  float64 `json:"amount"`
+				LinkID  string  `json:"link_id"`
+			} `json:"settlements"`
+		} `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&accepted)
+	if accepted.Data.LinkID == "" || len(accepted.Data.Settlements) != 2 {
+		t.Fatalf("期望 2 筆連結的結算記錄，得到 %+v", accepted.Data)
+	}
+	for _, settlement := range accepted.Data.Settlements {
+		if settlement.LinkID != accepted.Data.LinkID {
+			t.Errorf("結算記錄 %d 未連結", settlement.ID)
+		}
+	}
+
+	// 3. 已有待付款的結算時不可重複建立
+	resp = request("POST", "/users/me/settlement-suggestions/accept", "alice", accept)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("重複接受期望狀態碼 %d，得到 %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	// 4. 連結的結算不能單筆標記為已送出，提出爭議時整批進入爭議
+	var alicePays models.Settlement
+	db.Where("link_id = ? AND from_user_id = ?", accepted.Data.LinkID, alice.ID).First(&alicePays)
+	resp = request("PUT", fmt.Sprintf("/settlements/%d/sent", alicePays.ID), "alice", nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("標記連結的結算為已送出期望狀態碼 %d，得到 %d", http.StatusBadRequest, resp.StatusCode)
+	}
+	resp = request("PUT", fmt.Sprintf("/settlements/%d/dispute", alicePays.ID), "alice", map[string]interface{}{"reason": "金額有誤"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("提出爭議期望狀態碼 %d，得到 %d", http.StatusOK, resp.StatusCode)
+	}
+	var disputedCount int64
+	db.Model(&models.Settlement{}).Where("link_id = ? AND status = ?", accepted.Data.LinkID, models.SettlementDisputed).Count(&disputedCount)
+	if disputedCount != 2 {
+		t.Errorf("期望 2 筆爭議中的結算，得到 %d 筆", disputedCount)
+	}
+
+	// 5. 只有收到淨額的 Bob 可以確認，確認後整批標記為已付款
+	firstID := accepted.Data.Settlements[0].ID
+	resp = request("PUT", fmt.Sprintf("/settlements/%d/paid", firstID), "alice", nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("付款者確認期望狀態碼 %d，得到 %d", http.StatusForbidden, resp.StatusCode)
+	}
+	resp = request("PUT", fmt.Sprintf("/settlements/%d/paid", firstID), "bob", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("收款者確認期望狀態碼 %d，得到 %d", http.StatusOK, resp.StatusCode)
+	}
+	var paidCount int64
+	db.Model(&models.Settlement{}).Where("link_id = ? AND status = ?", accepted.Data.LinkID, models.SettlementConfirmed).Count(&paidCount)
+	if paidCount != 2 {
+		t.Errorf("期望 2 筆已付款結算，得到 %d 筆", paidCount)
+	}
+
+	// 6. 兩個群組的債務皆已結清
+	resp = request("GET", "/users/me/settlement-suggestions", "alice", nil)
+	json.NewDecoder(resp.Body).Decode(&suggestions)
+	if len(suggestions.Data) != 0 {
+		t.Errorf("結清後不應有跨群組建議，得到 %d 筆", len(suggestions.Data))
+	}
+	resp = request("POST", "/users/me/settlement-suggestions/accept", "alice", accept)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("結清後接受期望狀態碼 %d，得到 %d", http.StatusNotFound, resp.StatusCode)
+	}
+
+	// 清理
+	db.Where("settlement_id IN (?)", db.Model(&models.Settlement{}).Select("id").Where("link_id = ?", accepted.Data.LinkID)).
+		Delete(&models.SettlementEvent{})
+	db.Where("link_id = ?", accepted.Data.LinkID).Delete(&models.Settlement{})
+	db.Where("transaction_id IN ?", []uint{utilities.ID, hotel.ID}).Delete(&models.TransactionSplit{})
+	db.Delete(&models.Transaction{}, []uint{utilities.ID, hotel.ID})
+	db.Where("group_id IN ?", []uint{roommates.ID, japan.ID}).Delete(&models.GroupMember{})
+	db.Delete(&models.Group{}, []uint{roommates.ID, japan.ID})
+	db.Delete(alice)
+	db.Delete(bob)
+}
+
+// 測試依結算建議批次建立結算記錄
+func TestCreateSettlementsFromSuggestions(t *testing.T) {
+	db := setupSettlementTestDB()
+	handler := handlers.NewSettlementHandler(db)
+
+	// 創建測試資料
+	admin := createTestUser(db, "batch1@example.com", "batch1")
+	member1 := createTestUser(db, "batch2@example.com", "batch2")
+	member2 := createTestUser(db, "batch3@example.com", "batch3")
+	group := createTestGroup(db, "批次結算群組", "測試描述", admin.ID)
+	addGroupMember(db, group.ID, member1.ID, "member")
+	addGroupMember(db, group.ID, member2.ID, "member")
+
+	dinner := createTestTransaction(db, group.ID, admin.ID, admin.ID, 90000)
+	createTestTransactionSplit(db, dinner.ID, admin.ID, 30000)
+	createTestTransactionSplit(db, dinner.ID, member1.ID, 30000)
+	createTestTransactionSplit(db, dinner.ID, member2.ID, 30000)
+
+	testApp := fiber.New()
+	testApp.Use(func(c *fiber.Ctx) error {
+		if c.Get("X-User") == "member" {
+			c.Locals("user_id", member1.ID)
+		} else {
+			c.Locals("user_id", admin.ID)
+		}
+		return c.Next()
+	})
+	testApp.Get("/groups/:id/settlement-suggestions", handler.GetSettlementSuggestions)
+	testApp.Post("/groups/:id/settlements/from-suggestions", handler.CreateSettlementsFromSuggestions)
+
+	fingerprint := func() string {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/groups/%d/settlement-suggestions?strategy=greedy", group.ID), nil)
+		resp, err := testApp.Test(req)
+		if err != nil {
+			t.Fatalf("無法執行請求: %v", err)
+		}
+		var responseBody struct {
+			Data struct {
+				Fingerprint string `json:"fingerprint"`
+			} `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&responseBody)
+		if responseBody.Data.Fingerprint == "" {
+			t.Fatal("結算建議缺少 fingerprint")
+		}
+		return responseBody.Data.Fingerprint
+	}
+	createBatch := func(user, fingerprint string) *http.Response {
+		jsonBody, _ := json.Marshal(map[string]interface{}{"strategy": "greedy", "fingerprint": fingerprint})
+		req := httptest.NewRequest("POST", fmt.Sprintf("/groups/%d/settlements/from-suggestions", group.ID), bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User", user)
+		resp, err := testApp.Test(req)
+		if err != nil {
+			t.Fatalf("無法執行請求: %v", err)
+		}
+		return resp
+	}
+
+	// 非管理員不可批次建立
+	stale := fingerprint()
+	if resp := createBatch("member", stale); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("非管理員期望狀態碼 %d，得到 %d", http.StatusForbidden, resp.StatusCode)
+	}
+
+	// 取得建議後群組平衡變更
+	taxi := createTestTransaction(db, group.ID, member1.ID, member1.ID, 30000)
+	createTestTransactionSplit(db, taxi.ID, member1.ID, 15000)
+	createTestTransactionSplit(db, taxi.ID, member2.ID, 15000)
+	services.NewBalanceService(db).AddTransaction(taxi.ID) // 直接寫入的交易需自行更新平衡表
+	if resp := createBatch("admin", stale); resp.StatusCode != http.StatusConflict {
+		t.Errorf("平衡變更後期望狀態碼 %d，得到 %d", http.StatusConflict, resp.StatusCode)
+	}
+	var count int64
+	db.Model(&models.Settlement{}).Where("group_id = ?", group.ID).Count(&count)
+	if count != 0 {
+		t.Fatalf("被拒絕的批次不應建立結算記錄，得到 %d 筆", count)
+	}
+
+	// 使用最新的建議建立所有結算記錄
+	resp := createBatch("admin", fingerprint())
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("期望狀態碼 %d，得到 %d", http.StatusCreated, resp.StatusCode)
+	}
+	var responseBody struct {
+		Data struct {
+			BatchID     string `json:"batch_id"`
+			Settlements []struct {
+				FromUserID uint    `json:"from_user_id"`
+				ToUserID   uint    `json:"to_user_id"`
+				Amount     float64 `json:"amount"`
+				Status     string  `json:"status"`
+				BatchID    string  `json:"batch_id"`
+			} `json:"settlements"`
+		} `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&responseBody)
+
+	// 平衡：管理員 +600、成員一 -150、成員二 -450
+	expected := map[uint]float64{member1.ID: 150, member2.ID: 450}
+	if len(responseBody.Data.Settlements) != len(expected) {
+		t.Fatalf("期望 %d 筆結算記錄，得到 %d 筆", len(expected), len(responseBody.Data.Settlements))
+	}
+	for _, settlement := range responseBody.Data.Settlements {
+		if settlement.ToUserID != admin.ID || settlement.Amount != expected[settlement.FromUserID] ||
+			settlement.Status != "pending" || settlement.BatchID != responseBody.Data.BatchID {
+			t.Errorf("結算記錄不符: %+v", settlement)
+		}
+	}
+
+	// 已有待付款結算時不可重複建立
+	if resp := createBatch("admin", fingerprint()); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("重複建立期望狀態碼 %d，得到 %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	// 清理
+	db.Where("group_id = ?", group.ID).Delete(&models.Settlement{})
+	db.Where("transaction_id IN ?", []uint{dinner.ID, taxi.ID}).Delete(&models.TransactionSplit{})
+	db.Delete(&models.Transaction{}, []uint{dinner.ID, taxi.ID})
+	db.Delete(group)
+	db.Delete(admin)
+	db.Delete(member1)
+	db.Delete(member2)
+}
+
+// 測試收款者發起的請款流程
+func TestPaymentRequests(t *testing.T) {
+	db := setupSettlementTestDB()
+	handler := handlers.NewSettlementHandler(db)
+
+	// 創建測試資料
+	payee := createTestUser(db, "request1@example.com", "request1")
+	debtor := createTestUser(db, "request2@example.com", "request2")
+	outsider := createTestUser(db, "request3@example.com", "request3")
+	group := createTestGroup(db, "請款測試群組", "測試描述", payee.ID)
+	addGroupMember(db, group.ID, debtor.ID, "member")
+
+	// 收款者付 2,000，兩人各 1,000
+	trip := createTestTransaction(db, group.ID, payee.ID, payee.ID, 200000)
+	createTestTransactionSplit(db, trip.ID, payee.ID, 100000)
+	createTestTransactionSplit(db, trip.ID, debtor.ID, 100000)
+
+	testApp := fiber.New()
+	testApp.Use(func(c *fiber.Ctx) error {
+		if c.Get("X-User") == "debtor" {
+			c.Locals("user_id", debtor.ID)
+		} else {
+			c.Locals("user_id", payee.ID)
+		}
+		return c.Next()
+	})
+	testApp.Get("/settlements", handler.GetSettlements)
+	testApp.Post("/settlements/requests", handler.CreatePaymentRequest)
+	testApp.Put("/settlements/:id/accept", handler.AcceptPaymentRequest)
+	testApp.Put("/settlements/:id/decline", handler.DeclinePaymentRequest)
+	testApp.Put("/settlements/:id/paid", handler.MarkAsPaid)
+	testApp.Delete("/settlements/:id", handler.CancelSettlement)
+
+	type settlementBody struct {
+		ID            uint    `json:"id"`
+		FromUserID    uint    `json:"from_user_id"`
+		ToUserID      uint    `json:"to_user_id"`
+		Amount        float64 `json:"amount"`
+		Status        string  `json:"status"`
+		Origin        string  `json:"origin"`
+		RequestedBy   *uint   `json:"requested_by"`
+		RespondedAt   *string `json:"responded_at"`
+		DeclineReason string  `json:"decline_reason"`
+	}
+	request := func(method, url, user string, body interface{}) (int, settlementBody) {
+		var buffer bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buffer).Encode(body)
+		}
+		req := httptest.NewRequest(method, url, &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User", user)
+		resp, err := testApp.Test(req)
+		if err != nil {
+			t.Fatalf("無法執行請求: %v", err)
+		}
+		var responseBody struct {
+			Data settlementBody `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&responseBody)
+		return resp.StatusCode, responseBody.Data
+	}
+	createRequest := func(fromUserID uint) settlementBody {
+		status, settlement := request("POST", "/settlements/requests", "payee", map[string]interface{}{
+			"group_id":     group.ID,
+			"from_user_id": fromUserID,
+			"amount":       420,
+			"notes":        "3 號的晚餐",
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("建立請款期望狀態碼 %d，得到 %d", http.StatusCreated, status)
+		}
+		return settlement
+	}
+
+	// 請款對象必須是群組成員
+	status, _ := request("POST", "/settlements/requests", "payee", map[string]interface{}{
+		"group_id": group.ID, "from_user_id": outsider.ID, "amount": 420,
+	})
+	if status != http.StatusBadRequest {
+		t.Errorf("向非成員請款期望狀態碼 %d，得到 %d", http.StatusBadRequest, status)
+	}
+
+	// 1. 收款者發起請款，付款者拒絕
+	declined := createRequest(debtor.ID)
+	if declined.Status != "requested" || declined.Origin != "request" || declined.FromUserID != debtor.ID ||
+		declined.ToUserID != payee.ID || declined.RequestedBy == nil || *declined.RequestedBy != payee.ID {
+		t.Errorf("請款記錄不符: %+v", declined)
+	}
+	if status, _ := request("PUT", fmt.Sprintf("/settlements/%d/accept", declined.ID), "payee", nil); status != http.StatusForbidden {
+		t.Errorf("收款者接受自己的請款期望狀態碼 %d，得到 %d", http.StatusForbidden, status)
+	}
+	status, declined = request("PUT", fmt.Sprintf("/settlements/%d/decline", declined.ID), "debtor",
+		map[string]interface{}{"reason": "已用現金付過"})
+	if status != http.StatusOK || declined.Status != "rejected" || declined.DeclineReason != "已用現金付過" || declined.RespondedAt == nil {
+		t.Errorf("拒絕請款結果不符: %d %+v", status, declined)
+	}
+	if status, _ := request("PUT", fmt.Sprintf("/settlements/%d/accept", declined.ID), "debtor", nil); status != http.StatusBadRequest {
+		t.Errorf("接受已拒絕的請款期望狀態碼 %d，得到 %d", http.StatusBadRequest, status)
+	}
+
+	// 2. 付款者接受請款後成為一般的待付款結算，由收款者確認收款
+	accepted := createRequest(debtor.ID)
+	status, accepted = request("PUT", fmt.Sprintf("/settlements/%d/accept", accepted.ID), "debtor", nil)
+	if status != http.StatusOK || accepted.Status != "pending" || accepted.RespondedAt == nil {
+		t.Errorf("接受請款結果不符: %d %+v", status, accepted)
+	}
+	status, accepted = request("PUT", fmt.Sprintf("/settlements/%d/paid", accepted.ID), "payee", nil)
+	if status != http.StatusOK || accepted.Status != "confirmed" {
+		t.Errorf("確認收款結果不符: %d %+v", status, accepted)
+	}
+
+	// 3. 尚未回覆的請款只能由發起者撤回
+	withdrawn := createRequest(debtor.ID)
+	if status, _ := request("DELETE", fmt.Sprintf("/settlements/%d", withdrawn.ID), "debtor", nil); status != http.StatusForbidden {
+		t.Errorf("付款者撤回請款期望狀態碼 %d，得到 %d", http.StatusForbidden, status)
+	}
+	if status, _ := request("DELETE", fmt.Sprintf("/settlements/%d", withdrawn.ID), "payee", nil); status != http.StatusOK {
+		t.Errorf("收款者撤回請款期望狀態碼 %d，得到 %d", http.StatusOK, status)
+	}
+
+	// 4. 依狀態篩選結算記錄
+	req := httptest.NewRequest("GET", "/settlements?status=rejected", nil)
+	req.Header.Set("X-User", "debtor")
+	resp, _ := testApp.Test(req)
+	var list struct {
+		Data []settlementBody `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&list)
+	if len(list.Data) != 1 || list.Data[0].ID != declined.ID {
+		t.Errorf("期望 1 筆已拒絕的請款，得到 %+v", list.Data)
+	}
+
+	// 清理
+	db.Unscoped().Where("group_id = ?", group.ID).Delete(&models.Settlement{})
+	db.Where("transaction_id = ?", trip.ID).Delete(&models.TransactionSplit{})
+	db.Delete(trip)
+	db.Delete(group)
+	db.Delete(payee)
+	db.Delete(debtor)
+	db.Delete(outsider)
+}
+
+// 測試結算狀態轉換與事件記錄
+func TestSettlementStateMachine(t *testing.T) {
+	db := setupSettlementTestDB()
+	handler := handlers.NewSettlementHandler(db)
+
+	// 創建測試資料
+	payee := createTestUser(db, "state1@example.com", "state1")
+	payer := createTestUser(db, "state2@example.com", "state2")
+	group := createTestGroup(db, "狀態測試群組", "測試描述", payee.ID)
+	addGroupMember(db, group.ID, payer.ID, "member")
+
+	// 收款者付 600，兩人各 300
+	dinner := createTestTransaction(db, group.ID, payee.ID, payee.ID, 60000)
+	createTestTransactionSplit(db, dinner.ID, payee.ID, 30000)
+	createTestTransactionSplit(db, dinner.ID, payer.ID, 30000)
+
+	testApp := fiber.New()
+	testApp.Use(func(c *fiber.Ctx) error {
+		if c.Get("X-User") == "payer" {
+			c.Locals("user_id", payer.ID)
+		} else {
+			c.Locals("user_id", payee.ID)
+		}
+		return c.Next()
+	})
+	testApp.Post("/settlements", handler.CreateSettlement)
+	testApp.Put("/settlements/:id/sent", handler.MarkAsSent)
+	testApp.Put("/settlements/:id/paid", handler.MarkAsPaid)
+	testApp.Put("/settlements/:id/dispute", handler.DisputeSettlement)
+	testApp.Get("/settlements/:id/events", handler.GetSettlementEvents)
+	testApp.Delete("/settlements/:id", handler.CancelSettlement)
+
+	request := func(method, url, user string, body interface{}) (int, json.RawMessage) {
+		var buffer bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buffer).Encode(body)
+		}
+		req := httptest.NewRequest(method, url, &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User", user)
+		resp, err := testApp.Test(req)
+		if err != nil {
+			t.Fatalf("無法執行請求: %v", err)
+		}
+		var responseBody struct {
+			Data json.RawMessage `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&responseBody)
+		return resp.StatusCode, responseBody.Data
+	}
+	transition := func(action, user string, id uint, body interface{}, expectedStatus int, expectedState string) {
+		t.Helper()
+		status, data := request("PUT", fmt.Sprintf("/settlements/%d/%s", id, action), user, body)
+		if status != expectedStatus {
+			t.Fatalf("%s 由 %s 執行期望狀態碼 %d，得到 %d", action, user, expectedStatus, status)
+		}
+		if expectedState == "" {
+			return
+		}
+		var settlement struct {
+			Status        string `json:"status"`
+			DisputeReason string `json:"dispute_reason"`
+		}
+		json.Unmarshal(data, &settlement)
+		if settlement.Status != expectedState {
+			t.Errorf("%s 後期望狀態 %s，得到 %s", action, expectedState, settlement.Status)
+		}
+	}
+
+	// 1. 付款者建立結算並標記已送出
+	status, data := request("POST", "/settlements", "payer", map[string]interface{}{
+		"group_id":   group.ID,
+		"to_user_id": payee.ID,
+		"amount":     300,
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("建立結算期望狀態碼 %d，得到 %d", http.StatusCreated, status)
+	}
+	var created struct {
+		ID     uint   `json:"id"`
+		Status string `json:"status"`
+	}
+	json.Unmarshal(data, &created)
+	if created.Status != "pending" {
+		t.Errorf("新結算期望狀態 pending，得到 %s", created.Status)
+	}
+
+	transition("sent", "payee", created.ID, nil, http.StatusForbidden, "")
+	transition("sent", "payer", created.ID, nil, http.StatusOK, "payer_marked_sent")
+	transition("sent", "payer", created.ID, nil, http.StatusBadRequest, "")
+
+	// 2. 收款者未收到款項而提出爭議，爭議必須附上原因
+	transition("dispute", "payee", created.ID, map[string]interface{}{}, http.StatusBadRequest, "")
+	transition("dispute", "payee", created.ID, map[string]interface{}{"reason": "尚未收到轉帳"}, http.StatusOK, "disputed")
+
+	// 爭議中的結算不計入平衡
+	var confirmedCount int64
+	db.Model(&models.Settlement{}).Where("id = ? AND status = ?", created.ID, models.SettlementConfirmed).Count(&confirmedCount)
+	if confirmedCount != 0 {
+		t.Error("爭議中的結算不應為已確認")
+	}
+
+	// 3. 付款者重新送出，只有收款者可以確認
+	transition("sent", "payer", created.ID, nil, http.StatusOK, "payer_marked_sent")
+	transition("paid", "payer", created.ID, nil, http.StatusForbidden, "")
+	transition("paid", "payee", created.ID, nil, http.StatusOK, "confirmed")
+
+	// 4. 已確認的結算不能再轉換
+	transition("dispute", "payer", created.ID, map[string]interface{}{"reason": "金額錯誤"}, http.StatusBadRequest, "")
+	if status, _ := request("DELETE", fmt.Sprintf("/settlements/%d", created.ID), "payer", nil); status != http.StatusBadRequest {
+		t.Errorf("取消已確認的結算期望狀態碼 %d，得到 %d", http.StatusBadRequest, status)
+	}
+
+	// 5. 事件記錄包含每次轉換的執行者與原因
+	status, data = request("GET", fmt.Sprintf("/settlements/%d/events", created.ID), "payer", nil)
+	if status != http.StatusOK {
+		t.Fatalf("查詢事件期望狀態碼 %d，得到 %d", http.StatusOK, status)
+	}
+	var events []struct {
+		ActorID    uint   `json:"actor_id"`
+		FromStatus string `json:"from_status"`
+		ToStatus   string `json:"to_status"`
+		Reason     string `json:"reason"`
+	}
+	json.Unmarshal(data, &events)
+
+	expected := []struct {
+		actorID  uint
+		from, to string
+	}{
+		{payer.ID, "", "pending"},
+		{payer.ID, "pending", "payer_marked_sent"},
+		{payee.ID, "payer_marked_sent", "disputed"},
+		{payer.ID, "disputed", "payer_marked_sent"},
+		{payee.ID, "payer_marked_sent", "confirmed"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("期望 %d 筆事件，得到 %d 筆: %+v", len(expected), len(events), events)
+	}
+	for i, want := range expected {
+		if events[i].ActorID != want.actorID || events[i].FromStatus != want.from || events[i].ToStatus != want.to {
+			t.Errorf("第 %d 筆事件不符: %+v", i+1, events[i])
+		}
+	}
+	if events[2].Reason != "尚未收到轉帳" {
+		t.Errorf("爭議事件期望原因 '尚未收到轉帳'，得到 '%s'", events[2].Reason)
+	}
+
+	// 清理
+	db.Where("settlement_id = ?", created.ID).Delete(&models.SettlementEvent{})
+	db.Unscoped().Where("group_id = ?", group.ID).Delete(&models.Settlement{})
+	db.Where("transaction_id = ?", dinner.ID).Delete(&models.TransactionSplit{})
+	db.Delete(dinner)
+	db.Delete(group)
+	db.Delete(payee)
+	db.Delete(payer)
+}
+
+// 測試結算的分期付款
+func TestSettlementPartialPayments(t *testing.T) {
+	db := setupSettlementTestDB()
+	handler := handlers.NewSettlementHandler(db)
+
+	// 創建測試資料：付款者欠收款者 6,000
+	payee := createTestUser(db, "partial1@example.com", "partial1")
+	payer := createTestUser(db, "partial2@example.com", "partial2")
+	outsider := createTestUser(db, "partial3@example.com", "partial3")
+	group := createTestGroup(db, "分期付款測試群組", "測試描述", payee.ID)
+	addGroupMember(db, group.ID, payer.ID, "member")
+
+	rent := createTestTransaction(db, group.ID, payee.ID, payee.ID, 1200000)
+	createTestTransactionSplit(db, rent.ID, payee.ID, 600000)
+	createTestTransactionSplit(db, rent.ID, payer.ID, 600000)
+	settlement := createTestSettlement(db, group.ID, payer.ID, payee.ID, 600000)
+
+	testApp := fiber.New()
+	testApp.Use(func(c *fiber.Ctx) error {
+		switch c.Get("X-User") {
+		case "payer":
+			c.Locals("user_id", payer.ID)
+		case "outsider":
+			c.Locals("user_id", outsider.ID)
+		default:
+			c.Locals("user_id", payee.ID)
+		}
+		return c.Next()
+	})
+	testApp.Get("/settlements/:id/payments", handler.GetSettlementPayments)
+	testApp.Post("/settlements/:id/payments", handler.RecordSettlementPayment)
+	testApp.Put("/settlements/:id/payments/:paymentId/confirm", handler.ConfirmSettlementPayment)
+	testApp.Delete("/settlements/:id", handler.CancelSettlement)
+	testApp.Get("/groups/:id/settlement-suggestions", handler.GetSettlementSuggestions)
+
+	type paymentResult struct {
+		Payment struct {
+			ID        uint    `json:"id"`
+			Amount    float64 `json:"amount"`
+			Confirmed bool    `json:"confirmed"`
+		} `json:"payment"`
+		Settlement struct {
+			Status          string  `json:"status"`
+			PaidAmount      float64 `json:"paid_amount"`
+			RemainingAmount float64 `json:"remaining_amount"`
+		} `json:"settlement"`
+	}
+	request := func(method, url, user string, body interface{}) (int, json.RawMessage) {
+		var buffer bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buffer).Encode(body)
+		}
+		req := httptest.NewRequest(method, url, &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User", user)
+		resp, err := testApp.Test(req)
+		if err != nil {
+			t.Fatalf("無法執行請求: %v", err)
+		}
+		var responseBody struct {
+			Data json.RawMessage `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&responseBody)
+		return resp.StatusCode, responseBody.Data
+	}
+	pay := func(user string, amount float64, expectedStatus int) paymentResult {
+		t.Helper()
+		status, data := request("POST", fmt.Sprintf("/settlements/%d/payments", settlement.ID), user,
+			map[string]interface{}{"amount": amount})
+		if status != expectedStatus {
+			t.Fatalf("%s 記錄付款 %.0f 期望狀態碼 %d，得到 %d", user, amount, expectedStatus, status)
+		}
+		var result paymentResult
+		json.Unmarshal(data, &result)
+		return result
+	}
+	remainingDebt := func() float64 {
+		t.Helper()
+		_, data := request("GET", fmt.Sprintf("/groups/%d/settlement-suggestions", group.ID), "payee", nil)
+		var plan struct {
+			Suggestions []struct {
+				Amount float64 `json:"amount"`
+			} `json:"suggestions"`
+		}
+		json.Unmarshal(data, &plan)
+		total := 0.0
+		for _, suggestion := range plan.Suggestions {
+			total += suggestion.Amount
+		}
+		return total
+	}
+
+	// 1. 非結算當事人不能記錄付款，金額必須大於零
+	pay("outsider", 1000, http.StatusForbidden)
+	pay("payer", 0, http.StatusBadRequest)
+
+	// 2. 收款者記錄第一期付款，直接確認並計入平衡
+	first := pay("payee", 2500, http.StatusCreated)
+	if !first.Payment.Confirmed || first.Settlement.Status != "partially_paid" ||
+		first.Settlement.PaidAmount != 2500 || first.Settlement.RemainingAmount != 3500 {
+		t.Errorf("第一期付款結果不符: %+v", first)
+	}
+	if debt := remainingDebt(); debt != 3500 {
+		t.Errorf("第一期付款後期望剩餘債務 3500，得到 %.0f", debt)
+	}
+
+	// 已收到部分付款的結算不能取消
+	if status, _ := request("DELETE", fmt.Sprintf("/settlements/%d", settlement.ID), "payer", nil); status != http.StatusBadRequest {
+		t.Errorf("取消部分付款的結算期望狀態碼 %d，得到 %d", http.StatusBadRequest, status)
+	}
+
+	// 3. 付款者記錄第二期付款，確認前不計入平衡，且不能超過剩餘金額
+	pay("payer", 4000, http.StatusBadRequest)
+	second := pay("payer", 3500, http.StatusCreated)
+	if second.Payment.Confirmed || second.Settlement.Status != "partially_paid" || second.Settlement.RemainingAmount != 3500 {
+		t.Errorf("第二期付款結果不符: %+v", second)
+	}
+	if debt := remainingDebt(); debt != 3500 {
+		t.Errorf("未確認的付款不應計入平衡，得到剩餘債務 %.0f", debt)
+	}
+	pay("payee", 1, http.StatusBadRequest)
+
+	// 4. 只有收款者可以確認，付清後結算變為 confirmed
+	confirmURL := fmt.Sprintf("/settlements/%d/payments/%d/confirm", settlement.ID, second.Payment.ID)
+	if status, _ := request("PUT", confirmURL, "payer", nil); status != http.StatusForbidden {
+		t.Errorf("付款者確認付款期望狀態碼 %d，得到 %d", http.StatusForbidden, status)
+	}
+	status, data := request("PUT", confirmURL, "payee", nil)
+	var confirmed paymentResult
+	json.Unmarshal(data, &confirmed)
+	if status != http.StatusOK || !confirmed.Payment.Confirmed || confirmed.Settlement.Status != "confirmed" ||
+		confirmed.Settlement.RemainingAmount != 0 {
+		t.Errorf("確認付款結果不符: %d %+v", status, confirmed)
+	}
+	if status, _ := request("PUT", confirmURL, "payee", nil); status != http.StatusBadRequest {
+		t.Errorf("重複確認付款期望狀態碼 %d，得到 %d", http.StatusBadRequest, status)
+	}
+	if debt := remainingDebt(); debt != 0 {
+		t.Errorf("付清後期望沒有剩餘債務，得到 %.0f", debt)
+	}
+
+	// 5. 列出付款記錄
+	status, data = request("GET", fmt.Sprintf("/settlements/%d/payments", settlement.ID), "payer", nil)
+	var payments []struct {
+		Amount    float64 `json:"amount"`
+		Confirmed bool    `json:"confirmed"`
+	}
+	json.Unmarshal(data, &payments)
+	if status != http.StatusOK || len(payments) != 2 || payments[0].Amount != 2500 || payments[1].Amount != 3500 {
+		t.Errorf("付款記錄不符: %d %+v", status, payments)
+	}
+
+	// 清理
+	db.Where("settlement_id = ?", settlement.ID).Delete(&models.SettlementPayment{})
+	db.Where("settlement_id = ?", settlement.ID).Delete(&models.SettlementEvent{})
+	db.Unscoped().Where("group_id = ?", group.ID).Delete(&models.Settlement{})
+	db.Where("transaction_id = ?", rent.ID).Delete(&models.TransactionSplit{})
+	db.Delete(rent)
+	db.Delete(group)
+	db.Delete(payee)
+	db.Delete(payer)
+	db.Delete(outsider)
+}
+
+func TestCreateSettlementIdempotency(t *testing.T) {
+	db := setupSettlementTestDB()
+	handler := handlers.NewSettlementHandler(db)
+
+	payer := createTestUser(db, "idem-payer@example.com", "idem-payer")
+	payee := createTestUser(db, "idem-payee@example.com", "idem-payee")
+	group := createTestGroup(db, "結算重試群組", "測試描述", payee.ID)
+	addGroupMember(db, group.ID, payer.ID, "member")
+
+	// payee 付 300，兩人各 150：payer 應付 payee 150
+	transaction := createTestTransaction(db, group.ID, payee.ID, payee.ID, 30000)
+	createTestTransactionSplit(db, transaction.ID, payer.ID, 15000)
+	createTestTransactionSplit(db, transaction.ID, payee.ID, 15000)
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", payer.ID)
+		return c.Next()
+	})
+	app.Post("/settlements", middleware.Idempotency(db, time.Hour), handler.CreateSettlement)
+
+	send := func(amount float64) *http.Response {
+		t.Helper()
+		jsonBody, _ := json.Marshal(map[string]interface{}{
+			"group_id":   group.ID,
+			"to_user_id": payee.ID,
+			"amount":     amount,
+		})
+		req := httptest.NewRequest("POST", "/settlements", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "settle-1")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("無法執行請求: %v", err)
+		}
+		return resp
+	}
+
+	if resp := send(100); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("期望狀態碼 %d，得到 %d", http.StatusCreated, resp.StatusCode)
+	}
+	if resp := send(100); resp.StatusCode != http.StatusCreated || resp.Header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("重送期望回傳原本的回應，得到 %d（%s）", resp.StatusCode, resp.Header.Get("Idempotent-Replayed"))
+	}
+	if resp := send(50); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("相同 key 不同內容期望狀態碼 %d，得到 %d", http.StatusUnprocessableEntity, resp.StatusCode)
+	}
+
+	var count int64
+	db.Model(&models.Settlement{}).Where("group_id = ?", group.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("期望只建立 1 筆結算，得到 %d", count)
+	}
+
+	// 清理
+	db.Where("user_id = ?", payer.ID).Delete(&models.IdempotencyKey{})
+	db.Where("settlement_id IN (?)", db.Model(&models.Settlement{}).Select("id").Where("group_id = ?", group.ID)).Delete(&models.SettlementEvent{})
+	db.Where("group_id = ?", group.ID).Delete(&models.Settlement{})
+	db.Where("transaction_id = ?", transaction.ID).Delete(&models.TransactionSplit{})
+	db.Delete(transaction)
+	db.Delete(group)
+	db.Delete(payer)
+	db.Delete(payee)
+}
@@ -1,12 +1,36 @@
 package handlers_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"split-go/internal/handlers"
+	"split-go/internal/middleware"
 	"split-go/internal/models"
+	"split-go/internal/money"
 	"split-go/internal/responses"
+	"split-go/internal/services"
+	"strconv"
 	"testing"
 	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
+// 設置交易測試資料庫
+func setupTransactionTestDB() *gorm.DB {
+	db := setupSettlementTestDB()
+
+	if err := db.AutoMigrate(&models.Category{}, &models.TransactionItem{}, &models.TransactionPayment{}, &models.ExchangeRate{}); err != nil {
+		panic("無法執行分類表遷移")
+	}
+
+	return db
+}
+
 func TestNewTransactionResponse(t *testing.T) {
 	// 模擬測試資料
 	now := time.Now()
@@ -15,7 +39,7 @@ func TestNewTransactionResponse(t *testing.T) {
 	transaction := models.Transaction{
 		ID:          123,
 		Description: "測試聚餐",
-		Amount:      1200.0,
+		Amount:      120000, // 1200.00 TWD（最小貨幣單位）
 		Currency:    "TWD",
 		PaidBy:      1, // Alice 付款
 		CreatedBy:   2, // Bob 創建
@@ -45,7 +69,7 @@ func TestNewTransactionResponse(t *testing.T) {
 			{
 				ID:         1,
 				UserID:     1, // Alice
-				Amount:     400.0,
+				Amount:     40000,
 				Percentage: 33.33,
 				SplitType:  models.SplitEqual,
 				User: models.User{
@@ -56,7 +80,7 @@ func TestNewTransactionResponse(t *testing.T) {
 			{
 				ID:         2,
 				UserID:     2, // Bob
-				Amount:     400.0,
+				Amount:     40000,
 				Percentage: 33.33,
 				SplitType:  models.SplitEqual,
 				User: models.User{
@@ -67,7 +91,7 @@ func TestNewTransactionResponse(t *testing.T) {
 			{
 				ID:         3,
 				UserID:     3, // Charlie
-				Amount:     400.0,
+				Amount:     40000,
 				Percentage: 33.34,
 				SplitType:  models.SplitEqual,
 				User: models.User{
@@ -90,16 +114,16 @@ func TestNewTransactionResponse(t *testing.T) {
 		if response.Description != "測試聚餐" {
 			t.Errorf("Expected description '測試聚餐', got %s", response.Description)
 		}
-		if response.Amount != 1200.0 {
-			t.Errorf("Expected amount 1200.0, got %f", response.Amount)
+		if response.Amount != "1200.00" {
+			t.Errorf("Expected amount 1200.00, got %s", response.Amount)
 		}
 
 		// 驗證個人化欄位
-		if response.MyAmount != 400.0 {
-			t.Errorf("Expected MyAmount 400.0, got %f", response.MyAmount)
+		if response.MyAmount != "400.00" {
+			t.Errorf("Expected MyAmount 400.00, got %s", response.MyAmount)
 		}
-		if response.MyBalance != 800.0 { // 1200 - 400 = 800 (我付了1200，但只需要付400)
-			t.Errorf("Expected MyBalance 800.0, got %f", response.MyBalance)
+		if response.MyBalance != "800.00" { // 1200 - 400 = 800 (我付了1200，但只需要付400)
+			t.Errorf("Expected MyBalance 800.00, got %s", response.MyBalance)
 		}
 		if !response.AmIPayer {
 			t.Error("Expected AmIPayer to be true")
@@ -131,11 +155,11 @@ func TestNewTransactionResponse(t *testing.T) {
 		response := responses.NewTransactionResponse(transaction, currentUserID)
 
 		// 驗證個人化欄位
-		if response.MyAmount != 400.0 {
-			t.Errorf("Expected MyAmount 400.0, got %f", response.MyAmount)
+		if response.MyAmount != "400.00" {
+			t.Errorf("Expected MyAmount 400.00, got %s", response.MyAmount)
 		}
-		if response.MyBalance != -400.0 { // 0 - 400 = -400 (我欠400)
-			t.Errorf("Expected MyBalance -400.0, got %f", response.MyBalance)
+		if response.MyBalance != "-400.00" { // 0 - 400 = -400 (我欠400)
+			t.Errorf("Expected MyBalance -400.00, got %s", response.MyBalance)
 		}
 		if response.AmIPayer {
 			t.Error("Expected AmIPayer to be false")
@@ -156,11 +180,11 @@ func TestNewTransactionResponse(t *testing.T) {
 		response := responses.NewTransactionResponse(transaction, currentUserID)
 
 		// 驗證個人化欄位
-		if response.MyAmount != 400.0 {
-			t.Errorf("Expected MyAmount 400.0, got %f", response.MyAmount)
+		if response.MyAmount != "400.00" {
+			t.Errorf("Expected MyAmount 400.00, got %s", response.MyAmount)
 		}
-		if response.MyBalance != -400.0 { // 0 - 400 = -400 (我欠400)
-			t.Errorf("Expected MyBalance -400.0, got %f", response.MyBalance)
+		if response.MyBalance != "-400.00" { // 0 - 400 = -400 (我欠400)
+			t.Errorf("Expected MyBalance -400.00, got %s", response.MyBalance)
 		}
 		if response.AmIPayer {
 			t.Error("Expected AmIPayer to be false")
@@ -181,7 +205,7 @@ func TestNewTransactionSimpleResponse(t *testing.T) {
 	transaction := models.Transaction{
 		ID:          456,
 		Description: "簡化測試",
-		Amount:      500.0,
+		Amount:      50000,
 		Currency:    "TWD",
 		PaidBy:      1,
 		CreatedAt:   time.Now(),
@@ -203,11 +227,11 @@ func TestNewTransactionSimpleResponse(t *testing.T) {
 		Splits: []models.TransactionSplit{
 			{
 				UserID: 2,
-				Amount: 250.0,
+				Amount: 25000,
 			},
 			{
 				UserID: 3,
-				Amount: 250.0,
+				Amount: 25000,
 			},
 		},
 	}
@@ -224,8 +248,8 @@ func TestNewTransactionSimpleResponse(t *testing.T) {
 	}
 
 	// 驗證簡化的個人化欄位
-	if response.MyAmount != 250.0 {
-		t.Errorf("Expected MyAmount 250.0, got %f", response.MyAmount)
+	if response.MyAmount != "250.00" {
+		t.Errorf("Expected MyAmount 250.00, got %s", response.MyAmount)
 	}
 	if response.AmIPayer {
 		t.Error("Expected AmIPayer to be false")
@@ -239,3 +263,1664 @@ func TestNewTransactionSimpleResponse(t *testing.T) {
 		t.Errorf("Expected group name '測試群組', got %s", response.Group.Name)
 	}
 }
+
+// 測試創建交易時的分帳計算（金額以最小貨幣單位精確分配）
+func TestCreateTransactionSplits(t *testing.T) {
+	db := setupTransactionTestDB()
+	handler := handlers.NewTransactionHandler(db)
+
+	// 創建測試資料
+	user1 := createTestUser(db, "split1@example.com", "split1")
+	user2 := createTestUser(db, "split2@example.com", "split2")
+	user3 := createTestUser(db, "split3@example.com", "split3")
+	group := createTestGroup(db, "分帳測試群組", "測試描述", user1.ID)
+	addGroupMember(db, group.ID, user2.ID, "member")
+	addGroupMember(db, group.ID, user3.ID, "member")
+
+	tests := []struct {
+		name            string
+		requestBody     map[string]interface{}
+		expectedStatus  int
+		expectedError   string
+		expectedAmounts []money.Amount
+	}{
+		{
+			name: "平均分攤無法整除時依最大餘數分配",
+			requestBody: map[string]interface{}{
+				"group_id":    group.ID,
+				"description": "晚餐",
+				"amount":      100,
+				"paid_by":     user1.ID,
+				"split_type":  "equal",
+				"splits": []map[string]interface{}{
+					{"user_id": user1.ID},
+					{"user_id": user2.ID},
+					{"user_id": user3.ID},
+				},
+			},
+			expectedStatus:  http.StatusCreated,
+			expectedAmounts: []money.Amount{3334, 3333, 3333},
+		},
+		{
+			name: "小數比例總和為 100%",
+			requestBody: map[string]interface{}{
+				"group_id":    group.ID,
+				"description": "電費",
+				"amount":      1000,
+				"paid_by":     user1.ID,
+				"split_type":  "percentage",
+				"splits": []map[string]interface{}{
+					{"user_id": user1.ID, "percentage": 33.3},
+					{"user_id": user2.ID, "percentage": 33.3},
+					{"user_id": user3.ID, "percentage": 33.4},
+				},
+			},
+			expectedStatus:  http.StatusCreated,
+			expectedAmounts: []money.Amount{33300, 33300, 33400},
+		},
+		{
+			name: "按份數分攤",
+			requestBody: map[string]interface{}{
+				"group_id":    group.ID,
+				"description": "房租",
+				"amount":      1000,
+				"paid_by":     user1.ID,
+				"split_type":  "shares",
+				"splits": []map[string]interface{}{
+					{"user_id": user1.ID, "shares": 2},
+					{"user_id": user2.ID, "shares": 1},
+					{"user_id": user3.ID, "shares": 1},
+				},
+			},
+			expectedStatus:  http.StatusCreated,
+			expectedAmounts: []money.Amount{50000, 25000, 25000},
+		},
+		{
+			name: "份數必須大於 0",
+			requestBody: map[string]interface{}{
+				"group_id":    group.ID,
+				"description": "網路費",
+				"amount":      900,
+				"paid_by":     user1.ID,
+				"split_type":  "shares",
+				"splits": []map[string]interface{}{
+					{"user_id": user1.ID, "shares": 1},
+					{"user_id": user2.ID, "shares": 0},
+				},
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "分帳份數必須大於 0",
+		},
+		{
+			name: "平均分攤加上個別調整金額",
+			requestBody: map[string]interface{}{
+				"group_id":    group.ID,
+				"description": "酒吧",
+				"amount":      1200,
+				"paid_by":     user1.ID,
+				"split_type":  "adjustment",
+				"splits": []map[string]interface{}{
+					{"user_id": user1.ID},
+					{"user_id": user2.ID, "adjustment": 300},
+					{"user_id": user3.ID, "adjustment": -0.01},
+				},
+			},
+			expectedStatus:  http.StatusCreated,
+			expectedAmounts: []money.Amount{30001, 60000, 29999},
+		},
+		{
+			name: "調整後分帳金額為負數",
+			requestBody: map[string]interface{}{
+				"group_id":    group.ID,
+				"description": "蛋糕",
+				"amount":      300,
+				"paid_by":     user1.ID,
+				"split_type":  "adjustment",
+				"splits": []map[string]interface{}{
+					{"user_id": user1.ID, "adjustment": 250},
+					{"user_id": user2.ID, "adjustment": -200},
+				},
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "調整後的分帳金額不能為負數",
+		},
+		{
+			name: "固定金額總和不等於交易金額",
+			requestBody: map[string]interface{}{
+				"group_id":    group.ID,
+				"description": "計程車",
+				"amount":      300,
+				"paid_by":     user1.ID,
+				"split_type":  "fixed",
+				"splits": []map[string]interface{}{
+					{"user_id": user1.ID, "amount": 100.01},
+					{"user_id": user2.ID, "amount": 200},
+				},
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "分帳金額總和必須等於交易金額",
+		},
+		{
+			name: "三位小數幣別依最小單位分配",
+			requestBody: map[string]interface{}{
+				"group_id":      group.ID,
+				"description":   "烤肉",
+				"amount":        10.001,
+				"currency":      "kwd",
+				"exchange_rate": 105.5,
+				"paid_by":       user1.ID,
+				"split_type":    "equal",
+				"splits": []map[string]interface{}{
+					{"user_id": user1.ID},
+					{"user_id": user2.ID},
+					{"user_id": user3.ID},
+				},
+			},
+			expectedStatus:  http.StatusCreated,
+			expectedAmounts: []money.Amount{3334, 3334, 3333},
+		},
+		{
+			name: "金額小數位數超過幣別精度",
+			requestBody: map[string]interface{}{
+				"group_id":    group.ID,
+				"description": "咖啡",
+				"amount":      10.005,
+				"paid_by":     user1.ID,
+				"split_type":  "equal",
+				"splits": []map[string]interface{}{
+					{"user_id": user1.ID},
+				},
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "金額小數位數超過幣別精度",
+		},
+		{
+			name: "明細分帳依品項分攤並按小計比例分攤稅金與小費",
+			requestBody: map[string]interface{}{
+				"group_id":    group.ID,
+				"description": "餐廳聚餐",
+				"paid_by":     user1.ID,
+				"split_type":  "itemized",
+				"items": []map[string]interface{}{
+					{"name": "牛排", "unit_price": 600, "consumer_ids": []uint{user1.ID}},
+					{"name": "義大利麵", "unit_price": 300, "consumer_ids": []uint{user2.ID}},
+					{"name": "沙拉", "unit_price": 300, "consumer_ids": []uint{user1.ID, user2.ID, user3.ID}},
+					{"name": "稅金", "kind": "tax", "unit_price": 120},
+					{"name": "小費", "kind": "tip", "unit_price": 60},
+				},
+			},
+			expectedStatus:  http.StatusCreated,
+			expectedAmounts: []money.Amount{80500, 46000, 11500},
+		},
+		{
+			name: "明細總額不等於交易金額",
+			requestBody: map[string]interface{}{
+				"group_id":    group.ID,
+				"description": "餐廳聚餐",
+				"amount":      1000,
+				"paid_by":     user1.ID,
+				"split_type":  "itemized",
+				"items": []map[string]interface{}{
+					{"name": "牛排", "unit_price": 600, "consumer_ids": []uint{user1.ID}},
+				},
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "明細總額必須等於交易金額",
+		},
+		{
+			name: "明細模式的交易金額為負數",
+			requestBody: map[string]interface{}{
+				"group_id":    group.ID,
+				"description": "餐廳聚餐",
+				"amount":      "-50",
+				"paid_by":     user1.ID,
+				"split_type":  "itemized",
+				"items": []map[string]interface{}{
+					{"name": "牛排", "unit_price": 600, "consumer_ids": []uint{user1.ID}},
+				},
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "交易金額必須大於 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testApp := fiber.New()
+			testApp.Use("/transactions", func(c *fiber.Ctx) error {
+				c.Locals("user_id", user1.ID)
+				return c.Next()
+			})
+			testApp.Post("/transactions", handler.CreateTransaction)
+
+			jsonBody, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest("POST", "/transactions", bytes.NewBuffer(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := testApp.Test(req)
+			if err != nil {
+				t.Fatalf("無法執行請求: %v", err)
+			}
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("期望狀態碼 %d，得到 %d", tt.expectedStatus, resp.StatusCode)
+			}
+
+			var responseBody map[string]interface{}
+			json.NewDecoder(resp.Body).Decode(&responseBody)
+
+			if tt.expectedError != "" {
+				message, ok := responseBody["message"].(string)
+				if !ok || message != tt.expectedError {
+					t.Errorf("期望錯誤訊息 '%s'，得到 '%s'", tt.expectedError, message)
+				}
+			}
+
+			if tt.expectedStatus == http.StatusCreated {
+				data := responseBody["data"].(map[string]interface{})
+
+				var splits []models.TransactionSplit
+				db.Where("transaction_id = ?", uint(data["id"].(float64))).Order("id").Find(&splits)
+
+				if len(splits) != len(tt.expectedAmounts) {
+					t.Fatalf("期望 %d 筆分帳，得到 %d 筆", len(tt.expectedAmounts), len(splits))
+				}
+				for i, split := range splits {
+					if split.Amount != tt.expectedAmounts[i] {
+						t.Errorf("第 %d 筆分帳期望 %d，得到 %d", i+1, tt.expectedAmounts[i], split.Amount)
+					}
+				}
+			}
+		})
+	}
+
+	// 清理
+	db.Exec("DELETE FROM transaction_item_consumers")
+	db.Where("1 = 1").Delete(&models.TransactionItem{})
+	db.Where("1 = 1").Delete(&models.TransactionSplit{})
+	db.Where("group_id = ?", group.ID).Delete(&models.Transaction{})
+	db.Delete(group)
+	db.Delete(user1)
+	db.Delete(user2)
+	db.Delete(user3)
+}
+
+// 測試更新交易金額時保留原有的分帳份數
+func TestUpdateTransactionKeepsShares(t *testing.T) {
+	db := setupTransactionTestDB()
+	handler := handlers.NewTransactionHandler(db)
+
+	// 創建測試資料
+	user1 := createTestUser(db, "shares1@example.com", "shares1")
+	user2 := createTestUser(db, "shares2@example.com", "shares2")
+	group := createTestGroup(db, "份數測試群組", "測試描述", user1.ID)
+	addGroupMember(db, group.ID, user2.ID, "member")
+
+	testApp := fiber.New()
+	testApp.Use("/transactions", func(c *fiber.Ctx) error {
+		c.Locals("user_id", user1.ID)
+		return c.Next()
+	})
+	testApp.Post("/transactions", handler.CreateTransaction)
+	testApp.Put("/transactions/:id", handler.UpdateTransaction)
+
+	// 先以 2:1 份數創建交易
+	createBody, _ := json.Marshal(map[string]interface{}{
+		"group_id":    group.ID,
+		"description": "水費",
+		"amount":      300,
+		"paid_by":     user1.ID,
+		"split_type":  "shares",
+		"splits": []map[string]interface{}{
+			{"user_id": user1.ID, "shares": 2},
+			{"user_id": user2.ID, "shares": 1},
+		},
+	})
+	req := httptest.NewRequest("POST", "/transactions", bytes.NewBuffer(createBody))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := testApp.Test(req)
+	if err != nil {
+		t.Fatalf("無法執行請求: %v", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("期望狀態碼 %d，得到 %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	var transaction models.Transaction
+	db.Where("group_id = ?", group.ID).First(&transaction)
+
+	// 只更新金額，分帳應依原有份數重新計算
+	updateBody, _ := json.Marshal(map[string]interface{}{
+		"amount":  600,
+		"version": transaction.Version,
+	})
+	req = httptest.NewRequest("PUT", "/transactions/"+strconv.Itoa(int(transaction.ID)), bytes.NewBuffer(updateBody))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = testApp.Test(req)
+	if err != nil {
+		t.Fatalf("無法執行請求: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("期望狀態碼 %d，得到 %d", http.StatusOK, resp.StatusCode)
+	}
+
+	var splits []models.TransactionSplit
+	db.Where("transaction_id = ?", transaction.ID).Order("user_id").Find(&splits)
+
+	expected := map[uint]struct {
+		amount money.Amount
+		shares int64
+	}{
+		user1.ID: {amount: 40000, shares: 2},
+		user2.ID: {amount: 20000, shares: 1},
+	}
+	if len(splits) != len(expected) {
+		t.Fatalf("期望 %d 筆分帳，得到 %d 筆", len(expected), len(splits))
+	}
+	for _, split := range splits {
+		want := expected[split.UserID]
+		if split.Amount != want.amount || split.Shares != want.shares {
+			t.Errorf("用戶 %d 期望 %d (%d 份)，得到 %d (%d 份)",
+				split.UserID, want.amount, want.shares, split.Amount, split.Shares)
+		}
+		if split.SplitType != models.SplitShares {
+			t.Errorf("期望分帳類型 %s，得到 %s", models.SplitShares, split.SplitType)
+		}
+	}
+
+	// 只變更幣別而未提供金額會改變金額的精度，應拒絕
+	updateBody, _ = json.Marshal(map[string]interface{}{
+		"currency": "JPY",
+		"version":  transaction.Version + 1,
+	})
+	req = httptest.NewRequest("PUT", "/transactions/"+strconv.Itoa(int(transaction.ID)), bytes.NewBuffer(updateBody))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = testApp.Test(req)
+	if err != nil {
+		t.Fatalf("無法執行請求: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("變更幣別未提供金額期望狀態碼 %d，得到 %d", http.StatusBadRequest, resp.StatusCode)
+	}
+	var unchanged models.Transaction
+	db.First(&unchanged, transaction.ID)
+	if unchanged.Currency != "TWD" || unchanged.Amount != 60000 {
+		t.Errorf("期望交易維持 60000 TWD，得到 %d %s", unchanged.Amount, unchanged.Currency)
+	}
+
+	// 變更幣別但未提供分帳時，原有的固定金額與調整金額以新幣別的精度重新表示
+	send := func(method, url string, body interface{}) *http.Response {
+		t.Helper()
+		jsonBody, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, url, bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := testApp.Test(req)
+		if err != nil {
+			t.Fatalf("無法執行請求: %v", err)
+		}
+		return resp
+	}
+	create := func(description, splitType string, splits []map[string]interface{}) models.Transaction {
+		t.Helper()
+		resp := send("POST", "/transactions", map[string]interface{}{
+			"group_id":    group.ID,
+			"description": description,
+			"amount":      100,
+			"paid_by":     user1.ID,
+			"split_type":  splitType,
+			"splits":      splits,
+		})
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("%s: 期望狀態碼 %d，得到 %d", description, http.StatusCreated, resp.StatusCode)
+		}
+		var created models.Transaction
+		db.Where("group_id = ? AND description = ?", group.ID, description).First(&created)
+		return created
+	}
+	changeToJPY := func(transaction models.Transaction) *http.Response {
+		return send("PUT", "/transactions/"+strconv.Itoa(int(transaction.ID)), map[string]interface{}{
+			"currency":      "JPY",
+			"amount":        100,
+			"exchange_rate": 0.21,
+			"version":       transaction.Version,
+		})
+	}
+	splitsOf := func(transaction models.Transaction) map[uint]models.TransactionSplit {
+		var splits []models.TransactionSplit
+		db.Where("transaction_id = ?", transaction.ID).Find(&splits)
+		result := make(map[uint]models.TransactionSplit)
+		for _, split := range splits {
+			result[split.UserID] = split
+		}
+		return result
+	}
+
+	fixed := create("固定金額", "fixed", []map[string]interface{}{
+		{"user_id": user1.ID, "amount": 60},
+		{"user_id": user2.ID, "amount": 40},
+	})
+	if resp := changeToJPY(fixed); resp.StatusCode != http.StatusOK {
+		t.Errorf("固定金額變更幣別期望狀態碼 %d，得到 %d", http.StatusOK, resp.StatusCode)
+	}
+	if splits := splitsOf(fixed); splits[user1.ID].Amount != 60 || splits[user2.ID].Amount != 40 {
+		t.Errorf("期望固定金額換算為 ¥60 / ¥40，得到 %d / %d", splits[user1.ID].Amount, splits[user2.ID].Amount)
+	}
+
+	adjusted := create("調整金額", "adjustment", []map[string]interface{}{
+		{"user_id": user1.ID, "adjustment": 10},
+		{"user_id": user2.ID},
+	})
+	if resp := changeToJPY(adjusted); resp.StatusCode != http.StatusOK {
+		t.Errorf("調整金額變更幣別期望狀態碼 %d，得到 %d", http.StatusOK, resp.StatusCode)
+	}
+	if splits := splitsOf(adjusted); splits[user1.ID].Adjustment != 10 || splits[user1.ID].Amount != 55 || splits[user2.ID].Amount != 45 {
+		t.Errorf("期望調整 ¥10 後分攤 ¥55 / ¥45，得到調整 %d，分攤 %d / %d",
+			splits[user1.ID].Adjustment, splits[user1.ID].Amount, splits[user2.ID].Amount)
+	}
+
+	// 無法以新幣別精度表示的金額需重新提供分帳
+	fractional := create("小數金額", "fixed", []map[string]interface{}{
+		{"user_id": user1.ID, "amount": 60.5},
+		{"user_id": user2.ID, "amount": 39.5},
+	})
+	if resp := changeToJPY(fractional); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("無法換算精度期望狀態碼 %d，得到 %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	// 清理
+	transactionIDs := []uint{transaction.ID, fixed.ID, adjusted.ID, fractional.ID}
+	db.Where("transaction_id IN ?", transactionIDs).Delete(&models.TransactionRevision{})
+	db.Where("transaction_id IN ?", transactionIDs).Delete(&models.TransactionPayment{})
+	db.Where("group_id = ?", group.ID).Delete(&models.Posting{})
+	db.Where("group_id = ?", group.ID).Delete(&models.JournalEntry{})
+	db.Where("group_id = ?", group.ID).Delete(&models.MemberBalance{})
+	db.Where("transaction_id IN ?", transactionIDs).Delete(&models.TransactionSplit{})
+	db.Delete(&models.Transaction{}, transactionIDs)
+	db.Delete(group)
+	db.Delete(user1)
+	db.Delete(user2)
+}
+
+// 測試多人付款的交易與平衡計算
+func TestCreateTransactionMultiplePayers(t *testing.T) {
+	db := setupTransactionTestDB()
+	handler := handlers.NewTransactionHandler(db)
+	balanceService := services.NewBalanceService(db)
+
+	// 創建測試資料
+	user1 := createTestUser(db, "payer1@example.com", "payer1")
+	user2 := createTestUser(db, "payer2@example.com", "payer2")
+	user3 := createTestUser(db, "payer3@example.com", "payer3")
+	group := createTestGroup(db, "多人付款測試群組", "測試描述", user1.ID)
+	addGroupMember(db, group.ID, user2.ID, "member")
+	addGroupMember(db, group.ID, user3.ID, "member")
+
+	testApp := fiber.New()
+	testApp.Use("/transactions", func(c *fiber.Ctx) error {
+		c.Locals("user_id", user1.ID)
+		return c.Next()
+	})
+	testApp.Post("/transactions", handler.CreateTransaction)
+
+	splits := []map[string]interface{}{
+		{"user_id": user1.ID},
+		{"user_id": user2.ID},
+		{"user_id": user3.ID},
+	}
+
+	// 付款總和不等於交易金額
+	invalidBody, _ := json.Marshal(map[string]interface{}{
+		"group_id":    group.ID,
+		"description": "飯店",
+		"amount":      1000,
+		"split_type":  "equal",
+		"splits":      splits,
+		"payments": []map[string]interface{}{
+			{"user_id": user1.ID, "amount": 600},
+			{"user_id": user2.ID, "amount": 300},
+		},
+	})
+	req := httptest.NewRequest("POST", "/transactions", bytes.NewBuffer(invalidBody))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := testApp.Test(req)
+	if err != nil {
+		t.Fatalf("無法執行請求: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("期望狀態碼 %d，得到 %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	// 兩人共同付款
+	createBody, _ := json.Marshal(map[string]interface{}{
+		"group_id":    group.ID,
+		"description": "飯店",
+		"amount":      1000,
+		"split_type":  "equal",
+		"splits":      splits,
+		"payments": []map[string]interface{}{
+			{"user_id": user1.ID, "amount": 600},
+			{"user_id": user2.ID, "amount": 400},
+		},
+	})
+	req = httptest.NewRequest("POST", "/transactions", bytes.NewBuffer(createBody))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = testApp.Test(req)
+	if err != nil {
+		t.Fatalf("無法執行請求: %v", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("期望狀態碼 %d，得到 %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	var response struct {
+		Data responses.TransactionResponse `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&response)
+
+	if response.Data.Payer.ID != user1.ID {
+		t.Errorf("期望主要付款者為 %d，得到 %d", user1.ID, response.Data.Payer.ID)
+	}
+	if len(response.Data.Payments) != 2 {
+		t.Fatalf("期望 2 筆付款明細，得到 %d 筆", len(response.Data.Payments))
+	}
+	if response.Data.MyBalance != "266.66" {
+		t.Errorf("期望我的平衡為 266.66，得到 %s", response.Data.MyBalance)
+	}
+
+	// 每位付款者依實際支付金額計入平衡
+	balances, err := balanceService.CalculateGroupBalances(group.ID)
+	if err != nil {
+		t.Fatalf("計算平衡失敗: %v", err)
+	}
+
+	expected := map[uint]money.Amount{
+		user1.ID: 26666,
+		user2.ID: 6667,
+		user3.ID: -33333,
+	}
+	for _, balance := range balances {
+		if balance.Balance != expected[balance.UserID] {
+			t.Errorf("用戶 %d 期望平衡 %d，得到 %d", balance.UserID, expected[balance.UserID], balance.Balance)
+		}
+	}
+
+	// 清理
+	db.Where("1 = 1").Delete(&models.TransactionPayment{})
+	db.Where("1 = 1").Delete(&models.TransactionSplit{})
+	db.Where("group_id = ?", group.ID).Delete(&models.Transaction{})
+	db.Delete(group)
+	db.Delete(user1)
+	db.Delete(user2)
+	db.Delete(user3)
+}
+
+// 測試不同幣別的交易以鎖定匯率換算為群組基準幣別計算平衡
+func TestMultiCurrencyBalances(t *testing.T) {
+	db := setupTransactionTestDB()
+	handler := handlers.NewTransactionHandler(db)
+	balanceService := services.NewBalanceService(db)
+
+	// 創建測試資料（群組基準幣別預設為 TWD）
+	user1 := createTestUser(db, "fx1@example.com", "fx1")
+	user2 := createTestUser(db, "fx2@example.com", "fx2")
+	group := createTestGroup(db, "日本旅遊", "測試描述", user1.ID)
+	addGroupMember(db, group.ID, user2.ID, "member")
+
+	testApp := fiber.New()
+	testApp.Use("/transactions", func(c *fiber.Ctx) error {
+		c.Locals("user_id", user1.ID)
+		return c.Next()
+	})
+	testApp.Post("/transactions", handler.CreateTransaction)
+
+	splits := []map[string]interface{}{
+		{"user_id": user1.ID},
+		{"user_id": user2.ID},
+	}
+
+	tests := []struct {
+		name           string
+		requestBody    map[string]interface{}
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name: "外幣交易未提供匯率且沒有匯率資料",
+			requestBody: map[string]interface{}{
+				"group_id":    group.ID,
+				"description": "拉麵",
+				"amount":      2000,
+				"currency":    "JPY",
+				"paid_by":     user1.ID,
+				"split_type":  "equal",
+				"splits":      splits,
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "找不到 JPY/TWD 的匯率，請提供匯率",
+		},
+		{
+			name: "不支援的幣別",
+			requestBody: map[string]interface{}{
+				"group_id":      group.ID,
+				"description":   "紀念品",
+				"amount":        100,
+				"currency":      "XYZ",
+				"exchange_rate": 1.5,
+				"paid_by":       user1.ID,
+				"split_type":    "equal",
+				"splits":        splits,
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "不支援的幣別: XYZ",
+		},
+		{
+			name: "日圓交易以鎖定匯率換算",
+			requestBody: map[string]interface{}{
+				"group_id":      group.ID,
+				"description":   "飯店",
+				"amount":        10000,
+				"currency":      "JPY",
+				"exchange_rate": 0.2134,
+				"paid_by":       user1.ID,
+				"split_type":    "equal",
+				"splits":        splits,
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "基準幣別交易",
+			requestBody: map[string]interface{}{
+				"group_id":    group.ID,
+				"description": "機場接送",
+				"amount":      1000,
+				"paid_by":     user2.ID,
+				"split_type":  "equal",
+				"splits":      splits,
+			},
+			expectedStatus: http.StatusCreated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonBody, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest("POST", "/transactions", bytes.NewBuffer(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := testApp.Test(req)
+			if err != nil {
+				t.Fatalf("無法執行請求: %v", err)
+			}
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("期望狀態碼 %d，得到 %d", tt.expectedStatus, resp.StatusCode)
+			}
+
+			if tt.expectedError != "" {
+				var responseBody map[string]interface{}
+				json.NewDecoder(resp.Body).Decode(&responseBody)
+				if message, _ := responseBody["message"].(string); message != tt.expectedError {
+					t.Errorf("期望錯誤訊息 '%s'，得到 '%s'", tt.expectedError, message)
+				}
+			}
+		})
+	}
+
+	// 日圓交易應保留原始金額並記錄換算後的基準幣別金額
+	var transaction models.Transaction
+	db.Where("group_id = ? AND currency = ?", group.ID, "JPY").First(&transaction)
+	if transaction.Amount != 10000 || transaction.BaseAmount != 213400 {
+		t.Errorf("期望原始金額 10000 JPY、基準金額 213400，得到 %d、%d", transaction.Amount, transaction.BaseAmount)
+	}
+
+	balances, err := balanceService.CalculateGroupBalances(group.ID)
+	if err != nil {
+		t.Fatalf("計算平衡失敗: %v", err)
+	}
+
+	expected := map[uint]money.Amount{
+		user1.ID: 56700,
+		user2.ID: -56700,
+	}
+	for _, balance := range balances {
+		if balance.Currency != "TWD" {
+			t.Errorf("期望平衡幣別為 TWD，得到 %s", balance.Currency)
+		}
+		if balance.Balance != expected[balance.UserID] {
+			t.Errorf("用戶 %d 期望平衡 %d，得到 %d", balance.UserID, expected[balance.UserID], balance.Balance)
+		}
+	}
+
+	// 清理
+	db.Where("1 = 1").Delete(&models.TransactionPayment{})
+	db.Where("1 = 1").Delete(&models.TransactionSplit{})
+	db.Where("group_id = ?", group.ID).Delete(&models.Transaction{})
+	db.Delete(group)
+	db.Delete(user1)
+	db.Delete(user2)
+}
+
+// 測試平衡表隨交易與結算增量更新，並可由完整重新計算檢查與重建
+func TestBalanceLedger(t *testing.T) {
+	db := setupTransactionTestDB()
+	handler := handlers.NewTransactionHandler(db)
+	balanceService := services.NewBalanceService(db)
+	stateService := services.NewSettlementStateService(db)
+
+	// 創建測試資料
+	user1 := createTestUser(db, "ledger1@example.com", "ledger1")
+	user2 := createTestUser(db, "ledger2@example.com", "ledger2")
+	user3 := createTestUser(db, "ledger3@example.com", "ledger3")
+	group := createTestGroup(db, "平衡表測試群組", "測試描述", user1.ID)
+	addGroupMember(db, group.ID, user2.ID, "member")
+	addGroupMember(db, group.ID, user3.ID, "member")
+
+	testApp := fiber.New()
+	testApp.Use("/transactions", func(c *fiber.Ctx) error {
+		c.Locals("user_id", user1.ID)
+		return c.Next()
+	})
+	testApp.Post("/transactions", handler.CreateTransaction)
+	testApp.Put("/transactions/:id", handler.UpdateTransaction)
+
+	send := func(method, url string, body map[string]interface{}) responses.TransactionResponse {
+		t.Helper()
+		jsonBody, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, url, bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := testApp.Test(req)
+		if err != nil {
+			t.Fatalf("無法執行請求: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+			t.Fatalf("%s %s 失敗，狀態碼 %d", method, url, resp.StatusCode)
+		}
+		var response struct {
+			Data responses.TransactionResponse `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&response)
+		return response.Data
+	}
+	// 平衡表必須與完整重新計算一致
+	verify := func(step string, expected map[uint]money.Amount) {
+		t.Helper()
+		discrepancies, err := balanceService.CheckLedger(group.ID)
+		if err != nil {
+			t.Fatalf("%s: 比對平衡表失敗: %v", step, err)
+		}
+		if len(discrepancies) != 0 {
+			t.Errorf("%s: 平衡表與重新計算不一致: %+v", step, discrepancies)
+		}
+		balances, err := balanceService.CalculateGroupBalances(group.ID)
+		if err != nil {
+			t.Fatalf("%s: 讀取平衡失敗: %v", step, err)
+		}
+		for _, balance := range balances {
+			if balance.Balance != expected[balance.UserID] {
+				t.Errorf("%s: 用戶 %d 期望平衡 %d，得到 %d", step, balance.UserID, expected[balance.UserID], balance.Balance)
+			}
+		}
+	}
+
+	// 1. 第一次讀取時建立平衡表
+	verify("建立平衡表", map[uint]money.Amount{})
+	var rowCount int64
+	db.Model(&models.MemberBalance{}).Where("group_id = ?", group.ID).Count(&rowCount)
+	if rowCount != 3 {
+		t.Errorf("期望 3 筆平衡表記錄，得到 %d 筆", rowCount)
+	}
+
+	// 2. 新增與修改交易時更新平衡表
+	transaction := send("POST", "/transactions", map[string]interface{}{
+		"group_id":    group.ID,
+		"description": "晚餐",
+		"amount":      900,
+		"paid_by":     user1.ID,
+		"split_type":  "equal",
+		"splits":      []map[string]interface{}{{"user_id": user1.ID}, {"user_id": user2.ID}, {"user_id": user3.ID}},
+	})
+	verify("新增交易", map[uint]money.Amount{user1.ID: 60000, user2.ID: -30000, user3.ID: -30000})
+
+	send("PUT", "/transactions/"+strconv.Itoa(int(transaction.ID)), map[string]interface{}{"amount": 1200, "version": transaction.Version})
+	verify("修改交易金額", map[uint]money.Amount{user1.ID: 80000, user2.ID: -40000, user3.ID: -40000})
+
+	// 3. 結算確認的付款計入平衡表
+	settlement := &models.Settlement{
+		GroupID:    group.ID,
+		FromUserID: user2.ID,
+		ToUserID:   user1.ID,
+		Amount:     40000,
+		Currency:   "TWD",
+		Status:     models.SettlementPending,
+	}
+	if err := stateService.Create([]*models.Settlement{settlement}, user2.ID); err != nil {
+		t.Fatalf("建立結算失敗: %v", err)
+	}
+	verify("待付款結算", map[uint]money.Amount{user1.ID: 80000, user2.ID: -40000, user3.ID: -40000})
+
+	if _, err := stateService.RecordPayment(settlement, 10000, user1.ID, ""); err != nil {
+		t.Fatalf("記錄付款失敗: %v", err)
+	}
+	verify("部分付款", map[uint]money.Amount{user1.ID: 70000, user2.ID: -30000, user3.ID: -40000})
+
+	if err := stateService.Transition(settlement, models.SettlementConfirmed, user1.ID, ""); err != nil {
+		t.Fatalf("確認結算失敗: %v", err)
+	}
+	verify("確認結算", map[uint]money.Amount{user1.ID: 40000, user2.ID: 0, user3.ID: -40000})
+
+	// 4. 平衡表被竄改時可以檢查出來並重建
+	db.Model(&models.MemberBalance{}).Where("group_id = ? AND user_id = ?", group.ID, user3.ID).Update("balance", 0)
+	discrepancies, err := balanceService.CheckLedger(group.ID)
+	if err != nil {
+		t.Fatalf("比對平衡表失敗: %v", err)
+	}
+	if len(discrepancies) != 1 || discrepancies[0].UserID != user3.ID || discrepancies[0].Expected.Balance != -40000 {
+		t.Errorf("期望檢查出用戶 %d 的不一致，得到 %+v", user3.ID, discrepancies)
+	}
+	if err := balanceService.RebuildLedger(group.ID); err != nil {
+		t.Fatalf("重建平衡表失敗: %v", err)
+	}
+	verify("重建平衡表", map[uint]money.Amount{user1.ID: 40000, user2.ID: 0, user3.ID: -40000})
+
+	// 清理
+	db.Where("group_id = ?", group.ID).Delete(&models.MemberBalance{})
+	db.Where("settlement_id = ?", settlement.ID).Delete(&models.SettlementPayment{})
+	db.Where("settlement_id = ?", settlement.ID).Delete(&models.SettlementEvent{})
+	db.Unscoped().Delete(settlement)
+	db.Where("transaction_id = ?", transaction.ID).Delete(&models.TransactionSplit{})
+	db.Where("transaction_id = ?", transaction.ID).Delete(&models.TransactionPayment{})
+	db.Delete(&models.Transaction{}, transaction.ID)
+	db.Delete(group)
+	db.Delete(user1)
+	db.Delete(user2)
+	db.Delete(user3)
+}
+
+// 測試刪除交易移至垃圾桶並在保留期限內還原
+func TestDeleteAndRestoreTransaction(t *testing.T) {
+	db := setupTransactionTestDB()
+	handler := handlers.NewTransactionHandler(db)
+	balanceService := services.NewBalanceService(db)
+
+	// 創建測試資料：user1 為群組管理員
+	user1 := createTestUser(db, "trash1@example.com", "trash1")
+	user2 := createTestUser(db, "trash2@example.com", "trash2")
+	user3 := createTestUser(db, "trash3@example.com", "trash3")
+	group := createTestGroup(db, "垃圾桶測試群組", "測試描述", user1.ID)
+	addGroupMember(db, group.ID, user2.ID, "member")
+	addGroupMember(db, group.ID, user3.ID, "member")
+
+	actors := map[string]uint{"user1": user1.ID, "user2": user2.ID, "user3": user3.ID}
+	testApp := fiber.New()
+	testApp.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", actors[c.Get("X-User")])
+		return c.Next()
+	})
+	testApp.Post("/transactions", handler.CreateTransaction)
+	testApp.Get("/transactions/:id", handler.GetTransaction)
+	testApp.Delete("/transactions/:id", handler.DeleteTransaction)
+	testApp.Post("/transactions/:id/restore", handler.RestoreTransaction)
+	testApp.Get("/groups/:id/transactions/deleted", handler.GetDeletedTransactions)
+
+	send := func(method, url, actor string, body interface{}) *http.Response {
+		t.Helper()
+		jsonBody, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, url, bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User", actor)
+		resp, err := testApp.Test(req)
+		if err != nil {
+			t.Fatalf("無法執行請求: %v", err)
+		}
+		return resp
+	}
+	expectStatus := func(step string, resp *http.Response, expected int) {
+		t.Helper()
+		if resp.StatusCode != expected {
+			t.Fatalf("%s: 期望狀態碼 %d，得到 %d", step, expected, resp.StatusCode)
+		}
+	}
+	checkBalances := func(step string, expected map[uint]money.Amount) {
+		t.Helper()
+		balances, err := balanceService.CalculateGroupBalances(group.ID)
+		if err != nil {
+			t.Fatalf("%s: 計算平衡失敗: %v", step, err)
+		}
+		for _, balance := range balances {
+			if balance.Balance != expected[balance.UserID] {
+				t.Errorf("%s: 用戶 %d 期望平衡 %d，得到 %d", step, balance.UserID, expected[balance.UserID], balance.Balance)
+			}
+		}
+		if discrepancies, _ := balanceService.CheckLedger(group.ID); len(discrepancies) != 0 {
+			t.Errorf("%s: 平衡表與日記帳不一致: %+v", step, discrepancies)
+		}
+	}
+	trash := func() []responses.DeletedTransactionResponse {
+		t.Helper()
+		resp := send("GET", "/groups/"+strconv.Itoa(int(group.ID))+"/transactions/deleted", "user3", nil)
+		expectStatus("查詢垃圾桶", resp, http.StatusOK)
+		var response struct {
+			Data struct {
+				Data []responses.DeletedTransactionResponse `json:"data"`
+			} `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&response)
+		return response.Data.Data
+	}
+
+	// user2 支付 900 三人平分
+	resp := send("POST", "/transactions", "user2", map[string]interface{}{
+		"group_id":    group.ID,
+		"description": "晚餐",
+		"amount":      900,
+		"paid_by":     user2.ID,
+		"split_type":  "equal",
+		"splits":      []map[string]interface{}{{"user_id": user1.ID}, {"user_id": user2.ID}, {"user_id": user3.ID}},
+	})
+	expectStatus("創建交易", resp, http.StatusCreated)
+	var created struct {
+		Data responses.TransactionResponse `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	transactionURL := "/transactions/" + strconv.Itoa(int(created.Data.ID))
+	withTransaction := map[uint]money.Amount{user1.ID: -30000, user2.ID: 60000, user3.ID: -30000}
+	checkBalances("創建交易", withTransaction)
+
+	// 1. 只有創建者、付款者或群組管理員可以刪除
+	expectStatus("非創建者刪除", send("DELETE", transactionURL, "user3", nil), http.StatusForbidden)
+
+	resp = send("DELETE", transactionURL, "user1", nil)
+	expectStatus("管理員刪除", resp, http.StatusOK)
+	checkBalances("刪除交易", map[uint]money.Amount{})
+	expectStatus("查詢已刪除的交易", send("GET", transactionURL, "user2", nil), http.StatusNotFound)
+	expectStatus("重複刪除", send("DELETE", transactionURL, "user1", nil), http.StatusNotFound)
+
+	// 2. 垃圾桶列出已刪除的交易及刪除者
+	deleted := trash()
+	if len(deleted) != 1 || deleted[0].ID != created.Data.ID {
+		t.Fatalf("期望垃圾桶中有交易 %d，得到 %+v", created.Data.ID, deleted)
+	}
+	if deleted[0].DeletedBy == nil || deleted[0].DeletedBy.ID != user1.ID {
+		t.Errorf("期望刪除者為用戶 %d，得到 %+v", user1.ID, deleted[0].DeletedBy)
+	}
+	if deleted[0].RestorableUntil.Sub(deleted[0].DeletedAt) != 30*24*time.Hour {
+		t.Errorf("期望保留 30 天，得到 %v", deleted[0].RestorableUntil.Sub(deleted[0].DeletedAt))
+	}
+
+	// 3. 還原後重新計入平衡
+	expectStatus("非創建者還原", send("POST", transactionURL+"/restore", "user3", nil), http.StatusForbidden)
+	expectStatus("付款者還原", send("POST", transactionURL+"/restore", "user2", nil), http.StatusOK)
+	checkBalances("還原交易", withTransaction)
+	if deleted := trash(); len(deleted) != 0 {
+		t.Errorf("還原後垃圾桶應為空，得到 %d 筆", len(deleted))
+	}
+	expectStatus("還原未刪除的交易", send("POST", transactionURL+"/restore", "user2", nil), http.StatusNotFound)
+
+	// 4. 超過保留期限後無法還原，也不再列於垃圾桶
+	expectStatus("再次刪除", send("DELETE", transactionURL, "user2", nil), http.StatusOK)
+	db.Unscoped().Model(&models.Transaction{}).Where("id = ?", created.Data.ID).
+		Update("deleted_at", time.Now().Add(-31*24*time.Hour))
+	if deleted := trash(); len(deleted) != 0 {
+		t.Errorf("超過保留期限的交易不應列於垃圾桶，得到 %d 筆", len(deleted))
+	}
+	expectStatus("超過保留期限還原", send("POST", transactionURL+"/restore", "user2", nil), http.StatusGone)
+	checkBalances("超過保留期限", map[uint]money.Amount{})
+
+	// 清理
+	db.Where("group_id = ?", group.ID).Delete(&models.Posting{})
+	db.Where("group_id = ?", group.ID).Delete(&models.JournalEntry{})
+	db.Where("group_id = ?", group.ID).Delete(&models.MemberBalance{})
+	db.Where("transaction_id = ?", created.Data.ID).Delete(&models.TransactionSplit{})
+	db.Where("transaction_id = ?", created.Data.ID).Delete(&models.TransactionPayment{})
+	db.Unscoped().Delete(&models.Transaction{}, created.Data.ID)
+	db.Delete(group)
+	db.Delete(user1)
+	db.Delete(user2)
+	db.Delete(user3)
+}
+
+func TestTransactionHistoryAndRevert(t *testing.T) {
+	db := setupTransactionTestDB()
+	handler := handlers.NewTransactionHandler(db)
+	balanceService := services.NewBalanceService(db)
+
+	// 創建測試資料：user1 為群組管理員
+	user1 := createTestUser(db, "history1@example.com", "history1")
+	user2 := createTestUser(db, "history2@example.com", "history2")
+	user3 := createTestUser(db, "history3@example.com", "history3")
+	group := createTestGroup(db, "修改記錄測試群組", "測試描述", user1.ID)
+	addGroupMember(db, group.ID, user2.ID, "member")
+	addGroupMember(db, group.ID, user3.ID, "member")
+
+	actors := map[string]uint{"user1": user1.ID, "user2": user2.ID, "user3": user3.ID}
+	testApp := fiber.New()
+	testApp.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", actors[c.Get("X-User")])
+		return c.Next()
+	})
+	testApp.Post("/transactions", handler.CreateTransaction)
+	testApp.Put("/transactions/:id", handler.UpdateTransaction)
+	testApp.Delete("/transactions/:id", handler.DeleteTransaction)
+	testApp.Post("/transactions/:id/restore", handler.RestoreTransaction)
+	testApp.Get("/transactions/:id/history", handler.GetTransactionHistory)
+	testApp.Post("/transactions/:id/revert", handler.RevertTransaction)
+
+	send := func(method, url, actor string, body interface{}) *http.Response {
+		t.Helper()
+		jsonBody, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, url, bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User", actor)
+		resp, err := testApp.Test(req)
+		if err != nil {
+			t.Fatalf("無法執行請求: %v", err)
+		}
+		return resp
+	}
+	expectStatus := func(step string, resp *http.Response, expected int) {
+		t.Helper()
+		if resp.StatusCode != expected {
+			t.Fatalf("%s: 期望狀態碼 %d，得到 %d", step, expected, resp.StatusCode)
+		}
+	}
+	checkBalances := func(step string, expected map[uint]money.Amount) {
+		t.Helper()
+		balances, err := balanceService.CalculateGroupBalances(group.ID)
+		if err != nil {
+			t.Fatalf("%s: 計算平衡失敗: %v", step, err)
+		}
+		for _, balance := range balances {
+			if balance.Balance != expected[balance.UserID] {
+				t.Errorf("%s: 用戶 %d 期望平衡 %d，得到 %d", step, balance.UserID, expected[balance.UserID], balance.Balance)
+			}
+		}
+	}
+
+	// user1 支付 900 三人平分
+	resp := send("POST", "/transactions", "user1", map[string]interface{}{
+		"group_id":    group.ID,
+		"description": "晚餐",
+		"amount":      900,
+		"paid_by":     user1.ID,
+		"split_type":  "equal",
+		"splits":      []map[string]interface{}{{"user_id": user1.ID}, {"user_id": user2.ID}, {"user_id": user3.ID}},
+	})
+	expectStatus("創建交易", resp, http.StatusCreated)
+	var created struct {
+		Data responses.TransactionResponse `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	transactionURL := "/transactions/" + strconv.Itoa(int(created.Data.ID))
+	original := map[uint]money.Amount{user1.ID: 60000, user2.ID: -30000, user3.ID: -30000}
+
+	history := func() []responses.TransactionRevisionResponse {
+		t.Helper()
+		resp := send("GET", transactionURL+"/history", "user3", nil)
+		expectStatus("查詢修改記錄", resp, http.StatusOK)
+		var response struct {
+			Data []responses.TransactionRevisionResponse `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&response)
+		return response.Data
+	}
+
+	// 1. 修改金額與描述後，修改記錄列出每個欄位與每位用戶的差異
+	expectStatus("修改交易", send("PUT", transactionURL, "user1", map[string]interface{}{
+		"description": "晚餐加點",
+		"amount":      1200,
+		"version":     created.Data.Version,
+	}), http.StatusOK)
+	checkBalances("修改交易", map[uint]money.Amount{user1.ID: 80000, user2.ID: -40000, user3.ID: -40000})
+
+	revisions := history()
+	if len(revisions) != 2 {
+		t.Fatalf("期望 2 個版本，得到 %d", len(revisions))
+	}
+	if revisions[0].Action != "created" || revisions[0].EditorID != user1.ID || len(revisions[0].Changes) != 0 {
+		t.Errorf("第一個版本應為 user1 建立且沒有差異，得到 %+v", revisions[0])
+	}
+	if revisions[1].Action != "updated" || revisions[1].EditorID != user1.ID {
+		t.Errorf("第二個版本應為 user1 修改，得到 %s / %d", revisions[1].Action, revisions[1].EditorID)
+	}
+	changes := make(map[string]int)
+	for _, change := range revisions[1].Changes {
+		changes[change.Field]++
+		if change.Field == "amount" && (change.From != float64(900) || change.To != float64(1200)) {
+			t.Errorf("期望金額由 900 改為 1200，得到 %v → %v", change.From, change.To)
+		}
+		if change.Field == "split" && (change.UserID == nil || change.From != float64(300) || change.To != float64(400)) {
+			t.Errorf("期望每人分攤由 300 改為 400，得到 %+v", change)
+		}
+	}
+	expectedChanges := map[string]int{"description": 1, "amount": 1, "payment": 1, "split": 3}
+	for field, count := range expectedChanges {
+		if changes[field] != count {
+			t.Errorf("期望 %s 有 %d 筆差異，得到 %d", field, count, changes[field])
+		}
+	}
+	if len(revisions[1].Changes) != 6 {
+		t.Errorf("期望 6 筆差異，得到 %+v", revisions[1].Changes)
+	}
+
+	// 2. 刪除與還原也會記錄版本
+	expectStatus("刪除交易", send("DELETE", transactionURL, "user1", nil), http.StatusOK)
+	if revisions := history(); len(revisions) != 3 || revisions[2].Action != "deleted" {
+		t.Fatalf("刪除後期望第 3 個版本為 deleted，得到 %+v", revisions)
+	}
+	expectStatus("還原交易", send("POST", transactionURL+"/restore", "user1", nil), http.StatusOK)
+
+	// 3. 回復為第一個版本（需帶目前的交易版本）
+	currentVersion := func() uint {
+		var transaction models.Transaction
+		db.First(&transaction, created.Data.ID)
+		return transaction.Version
+	}
+	revert := func(revision int, version uint) map[string]interface{} {
+		return map[string]interface{}{"revision": revision, "version": version}
+	}
+	version := currentVersion()
+	expectStatus("非創建者回復", send("POST", transactionURL+"/revert", "user3", revert(1, version)), http.StatusForbidden)
+	expectStatus("未提供版本", send("POST", transactionURL+"/revert", "user1", map[string]interface{}{"revision": 1}), http.StatusPreconditionRequired)
+	expectStatus("以過期的版本回復", send("POST", transactionURL+"/revert", "user1", revert(1, version-1)), http.StatusConflict)
+	expectStatus("回復不存在的版本", send("POST", transactionURL+"/revert", "user1", revert(99, version)), http.StatusNotFound)
+	resp = send("POST", transactionURL+"/revert", "user1", revert(1, version))
+	expectStatus("回復版本", resp, http.StatusOK)
+	if etag := resp.Header.Get("ETag"); etag != `"`+strconv.Itoa(int(version+1))+`"` {
+		t.Errorf("期望 ETag 為 %d，得到 %s", version+1, etag)
+	}
+	var reverted struct {
+		Data responses.TransactionResponse `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&reverted)
+	if reverted.Data.Description != "晚餐" || reverted.Data.Amount != "900.00" || len(reverted.Data.Splits) != 3 {
+		t.Errorf("期望回復為原本的交易，得到 %s %s（%d 筆分帳）", reverted.Data.Description, reverted.Data.Amount, len(reverted.Data.Splits))
+	}
+	checkBalances("回復版本", original)
+	if discrepancies, _ := balanceService.CheckLedger(group.ID); len(discrepancies) != 0 {
+		t.Errorf("平衡表與日記帳不一致: %+v", discrepancies)
+	}
+
+	revisions = history()
+	if len(revisions) != 5 {
+		t.Fatalf("期望 5 個版本，得到 %d", len(revisions))
+	}
+	latest := revisions[4]
+	if latest.Action != "reverted" || latest.RevertedFrom == nil || *latest.RevertedFrom != 1 {
+		t.Errorf("期望最新版本為回復自版本 1，得到 %+v", latest)
+	}
+	if latest.Snapshot.Description != "晚餐" || latest.Snapshot.Amount != "900.00" {
+		t.Errorf("期望快照為原本的內容，得到 %+v", latest.Snapshot)
+	}
+	expectStatus("回復為相同內容", send("POST", transactionURL+"/revert", "user1", revert(1, currentVersion())), http.StatusBadRequest)
+
+	// 4. 沒有版本記錄的舊交易以目前內容作為第一個版本
+	db.Where("transaction_id = ?", created.Data.ID).Delete(&models.TransactionRevision{})
+	if revisions := history(); len(revisions) != 1 || revisions[0].Action != "created" || revisions[0].Snapshot.Amount != "900.00" {
+		t.Errorf("期望舊交易只有一個建立版本，得到 %+v", revisions)
+	}
+
+	// 清理
+	db.Where("transaction_id = ?", created.Data.ID).Delete(&models.TransactionRevision{})
+	db.Where("group_id = ?", group.ID).Delete(&models.Posting{})
+	db.Where("group_id = ?", group.ID).Delete(&models.JournalEntry{})
+	db.Where("group_id = ?", group.ID).Delete(&models.MemberBalance{})
+	db.Where("transaction_id = ?", created.Data.ID).Delete(&models.TransactionSplit{})
+	db.Where("transaction_id = ?", created.Data.ID).Delete(&models.TransactionPayment{})
+	db.Unscoped().Delete(&models.Transaction{}, created.Data.ID)
+	db.Delete(group)
+	db.Delete(user1)
+	db.Delete(user2)
+	db.Delete(user3)
+}
+
+func TestUpdateTransactionVersionConflict(t *testing.T) {
+	db := setupTransactionTestDB()
+	handler := handlers.NewTransactionHandler(db)
+	balanceService := services.NewBalanceService(db)
+
+	// 兩位室友從不同手機編輯同一筆交易
+	user1 := createTestUser(db, "version1@example.com", "version1")
+	user2 := createTestUser(db, "version2@example.com", "version2")
+	group := createTestGroup(db, "版本測試群組", "測試描述", user1.ID)
+	addGroupMember(db, group.ID, user2.ID, "member")
+
+	actors := map[string]uint{"user1": user1.ID, "user2": user2.ID}
+	testApp := fiber.New()
+	testApp.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", actors[c.Get("X-User")])
+		return c.Next()
+	})
+	testApp.Post("/transactions", handler.CreateTransaction)
+	testApp.Get("/transactions/:id", handler.GetTransaction)
+	testApp.Put("/transactions/:id", handler.UpdateTransaction)
+
+	send := func(method, url, actor, ifMatch string, body interface{}) *http.Response {
+		t.Helper()
+		jsonBody, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, url, bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User", actor)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		resp, err := testApp.Test(req)
+		if err != nil {
+			t.Fatalf("無法執行請求: %v", err)
+		}
+		return resp
+	}
+
+	resp := send("POST", "/transactions", "user1", "", map[string]interface{}{
+		"group_id":    group.ID,
+		"description": "房租",
+		"amount":      1000,
+		"paid_by":     user1.ID,
+		"split_type":  "equal",
+		"splits":      []map[string]interface{}{{"user_id": user1.ID}, {"user_id": user2.ID}},
+	})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("創建交易期望狀態碼 %d，得到 %d", http.StatusCreated, resp.StatusCode)
+	}
+	var created struct {
+		Data responses.TransactionResponse `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	transactionURL := "/transactions/" + strconv.Itoa(int(created.Data.ID))
+	if created.Data.Version != 1 || resp.Header.Get("ETag") != `"1"` {
+		t.Errorf("新交易期望版本 1，得到 %d（ETag %s）", created.Data.Version, resp.Header.Get("ETag"))
+	}
+
+	// 1. 兩支手機都讀到相同的 ETag
+	etag := send("GET", transactionURL, "user1", "", nil).Header.Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("期望 ETag 為 \"1\"，得到 %s", etag)
+	}
+
+	// 2. 未提供版本時拒絕修改
+	if resp := send("PUT", transactionURL, "user1", "", map[string]interface{}{"amount": 1200}); resp.StatusCode != http.StatusPreconditionRequired {
+		t.Errorf("未提供版本期望狀態碼 %d，得到 %d", http.StatusPreconditionRequired, resp.StatusCode)
+	}
+	if resp := send("PUT", transactionURL, "user1", "abc", map[string]interface{}{"amount": 1200}); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("無效的 If-Match 期望狀態碼 %d，得到 %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	// 3. 第一支手機修改成功，版本遞增
+	resp = send("PUT", transactionURL, "user1", etag, map[string]interface{}{"amount": 1200})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("第一次修改期望狀態碼 %d，得到 %d", http.StatusOK, resp.StatusCode)
+	}
+	if resp.Header.Get("ETag") != `"2"` {
+		t.Errorf("修改後期望 ETag 為 \"2\"，得到 %s", resp.Header.Get("ETag"))
+	}
+
+	// 4. 第二支手機以舊版本修改時回傳 409 與目前的交易
+	resp = send("PUT", transactionURL, "user1", etag, map[string]interface{}{"amount": 800})
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("過期版本期望狀態碼 %d，得到 %d", http.StatusConflict, resp.StatusCode)
+	}
+	var conflict struct {
+		Error bool                          `json:"error"`
+		Data  responses.TransactionResponse `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&conflict)
+	if !conflict.Error || conflict.Data.Amount != "1200.00" || conflict.Data.Version != 2 {
+		t.Errorf("期望回傳目前的交易（1200.00，版本 2），得到 %s（版本 %d）", conflict.Data.Amount, conflict.Data.Version)
+	}
+	if resp.Header.Get("ETag") != `"2"` {
+		t.Errorf("衝突回應期望 ETag 為 \"2\"，得到 %s", resp.Header.Get("ETag"))
+	}
+
+	// 5. 以請求內容的 version 欄位帶入最新版本後可以修改
+	if resp := send("PUT", transactionURL, "user1", "", map[string]interface{}{"amount": 800, "version": conflict.Data.Version}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("以最新版本修改期望狀態碼 %d，得到 %d", http.StatusOK, resp.StatusCode)
+	}
+	balances, err := balanceService.CalculateGroupBalances(group.ID)
+	if err != nil {
+		t.Fatalf("計算平衡失敗: %v", err)
+	}
+	expected := map[uint]money.Amount{user1.ID: 40000, user2.ID: -40000}
+	for _, balance := range balances {
+		if balance.Balance != expected[balance.UserID] {
+			t.Errorf("用戶 %d 期望平衡 %d，得到 %d", balance.UserID, expected[balance.UserID], balance.Balance)
+		}
+	}
+
+	// 清理
+	db.Where("transaction_id = ?", created.Data.ID).Delete(&models.TransactionRevision{})
+	db.Where("group_id = ?", group.ID).Delete(&models.Posting{})
+	db.Where("group_id = ?", group.ID).Delete(&models.JournalEntry{})
+	db.Where("group_id = ?", group.ID).Delete(&models.MemberBalance{})
+	db.Where("transaction_id = ?", created.Data.ID).Delete(&models.TransactionSplit{})
+	db.Where("transaction_id = ?", created.Data.ID).Delete(&models.TransactionPayment{})
+	db.Unscoped().Delete(&models.Transaction{}, created.Data.ID)
+	db.Delete(group)
+	db.Delete(user1)
+	db.Delete(user2)
+}
+
+func TestCreateTransactionIdempotency(t *testing.T) {
+	db := setupTransactionTestDB()
+	handler := handlers.NewTransactionHandler(db)
+
+	user1 := createTestUser(db, "idem1@example.com", "idem1")
+	user2 := createTestUser(db, "idem2@example.com", "idem2")
+	group := createTestGroup(db, "重試測試群組", "測試描述", user1.ID)
+	addGroupMember(db, group.ID, user2.ID, "member")
+
+	actors := map[string]uint{"user1": user1.ID, "user2": user2.ID}
+	testApp := fiber.New()
+	testApp.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", actors[c.Get("X-User")])
+		return c.Next()
+	})
+	testApp.Post("/transactions", middleware.Idempotency(db, time.Hour), handler.CreateTransaction)
+
+	send := func(actor, key string, body interface{}) (*http.Response, []byte) {
+		t.Helper()
+		jsonBody, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", "/transactions", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User", actor)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		resp, err := testApp.Test(req)
+		if err != nil {
+			t.Fatalf("無法執行請求: %v", err)
+		}
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		return resp, buf.Bytes()
+	}
+	countTransactions := func() int64 {
+		var count int64
+		db.Model(&models.Transaction{}).Where("group_id = ?", group.ID).Count(&count)
+		return count
+	}
+	expense := func(description string) map[string]interface{} {
+		return map[string]interface{}{
+			"group_id":    group.ID,
+			"description": description,
+			"amount":      500,
+			"paid_by":     user1.ID,
+			"split_type":  "equal",
+			"splits":      []map[string]interface{}{{"user_id": user1.ID}, {"user_id": user2.ID}},
+		}
+	}
+
+	// 1. 重送相同的請求回傳原本的回應，不會重複建立
+	resp, original := send("user1", "retry-1", expense("計程車"))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("期望狀態碼 %d，得到 %d", http.StatusCreated, resp.StatusCode)
+	}
+	if resp.Header.Get("Idempotent-Replayed") != "" {
+		t.Errorf("第一次請求不應標記為重送")
+	}
+	resp, replayed := send("user1", "retry-1", expense("計程車"))
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("重送期望狀態碼 %d 且標記為重送，得到 %d（%s）", http.StatusCreated, resp.StatusCode, resp.Header.Get("Idempotent-Replayed"))
+	}
+	if !bytes.Equal(original, replayed) {
+		t.Errorf("重送應回傳原本的回應\n原本: %s\n重送: %s", original, replayed)
+	}
+	if etag := resp.Header.Get("ETag"); etag != `"1"` {
+		t.Errorf("重送期望還原 ETag \"1\"，得到 %q", etag)
+	}
+	if count := countTransactions(); count != 1 {
+		t.Fatalf("期望只建立 1 筆交易，得到 %d", count)
+	}
+
+	// 2. 相同的 key 用於不同的請求內容
+	if resp, _ := send("user1", "retry-1", expense("早餐")); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("期望狀態碼 %d，得到 %d", http.StatusUnprocessableEntity, resp.StatusCode)
+	}
+
+	// 3. key 以用戶為範圍
+	if resp, _ := send("user2", "retry-1", expense("計程車")); resp.StatusCode != http.StatusCreated {
+		t.Errorf("其他用戶使用相同的 key 期望狀態碼 %d，得到 %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	// 4. 失敗的請求不保存，修正後可以用相同的 key 重試
+	invalid := expense("午餐")
+	invalid["split_type"] = "unknown"
+	if resp, _ := send("user1", "retry-2", invalid); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("無效的請求期望狀態碼 %d，得到 %d", http.StatusBadRequest, resp.StatusCode)
+	}
+	if resp, _ := send("user1", "retry-2", expense("午餐")); resp.StatusCode != http.StatusCreated || resp.Header.Get("Idempotent-Replayed") != "" {
+		t.Errorf("失敗後重試期望建立新交易，得到 %d（%s）", resp.StatusCode, resp.Header.Get("Idempotent-Replayed"))
+	}
+
+	// 5. 過期的 key 視為新的請求
+	db.Model(&models.IdempotencyKey{}).Where("user_id = ? AND idempotency_key = ?", user1.ID, "retry-1").
+		Update("created_at", time.Now().Add(-2*time.Hour))
+	if resp, _ := send("user1", "retry-1", expense("早餐")); resp.StatusCode != http.StatusCreated {
+		t.Errorf("過期的 key 期望狀態碼 %d，得到 %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	// 6. 未提供 key 時不檢查重複
+	send("user1", "", expense("晚餐"))
+	send("user1", "", expense("晚餐"))
+	if count := countTransactions(); count != 6 {
+		t.Errorf("期望 6 筆交易，得到 %d", count)
+	}
+
+	// 7. 保存回應失敗時仍回傳成功的結果，記錄維持處理中
+	db.Callback().Update().Before("gorm:update").Register("test:fail_idempotency_update", func(tx *gorm.DB) {
+		if tx.Statement.Table == "idempotency_keys" {
+			tx.AddError(errors.New("模擬保存失敗"))
+		}
+	})
+	resp, _ = send("user1", "retry-3", expense("宵夜"))
+	db.Callback().Update().Remove("test:fail_idempotency_update")
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("保存回應失敗期望狀態碼 %d，得到 %d", http.StatusCreated, resp.StatusCode)
+	}
+	if resp, _ := send("user1", "retry-3", expense("宵夜")); resp.StatusCode != http.StatusConflict {
+		t.Errorf("處理中的 key 期望狀態碼 %d，得到 %d", http.StatusConflict, resp.StatusCode)
+	}
+
+	// 8. 超過處理時限仍未完成的 key 視為已放棄，重試可以重新執行
+	db.Model(&models.IdempotencyKey{}).Where("user_id = ? AND idempotency_key = ?", user1.ID, "retry-3").
+		Update("created_at", time.Now().Add(-2*time.Minute))
+	if resp, _ := send("user1", "retry-3", expense("宵夜")); resp.StatusCode != http.StatusCreated || resp.Header.Get("Idempotent-Replayed") != "" {
+		t.Errorf("已放棄的 key 期望重新執行，得到 %d（%s）", resp.StatusCode, resp.Header.Get("Idempotent-Replayed"))
+	}
+	if resp, _ := send("user1", "retry-3", expense("宵夜")); resp.Header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("重新執行後期望保存回應並重送，得到 %d", resp.StatusCode)
+	}
+	if count := countTransactions(); count != 8 {
+		t.Errorf("期望 8 筆交易，得到 %d", count)
+	}
+
+	// 清理
+	var transactionIDs []uint
+	db.Model(&models.Transaction{}).Where("group_id = ?", group.ID).Pluck("id", &transactionIDs)
+	db.Where("user_id IN ?", []uint{user1.ID, user2.ID}).Delete(&models.IdempotencyKey{})
+	db.Where("transaction_id IN ?", transactionIDs).Delete(&models.TransactionRevision{})
+	db.Where("group_id = ?", group.ID).Delete(&models.Posting{})
+	db.Where("group_id = ?", group.ID).Delete(&models.JournalEntry{})
+	db.Where("group_id = ?", group.ID).Delete(&models.MemberBalance{})
+	db.Where("transaction_id IN ?", transactionIDs).Delete(&models.TransactionSplit{})
+	db.Where("transaction_id IN ?", transactionIDs).Delete(&models.TransactionPayment{})
+	db.Unscoped().Where("group_id = ?", group.ID).Delete(&models.Transaction{})
+	db.Delete(group)
+	db.Delete(user1)
+	db.Delete(user2)
+}
+
+// 測試交易列表的篩選、排序與搜尋
+func TestListTransactionsFilters(t *testing.T) {
+	db := setupTransactionTestDB()
+	handler := handlers.NewTransactionHandler(db)
+
+	// 創建測試資料：user1 另外參與一個群組
+	user1 := createTestUser(db, "filter1@example.com", "filter1")
+	user2 := createTestUser(db, "filter2@example.com", "filter2")
+	user3 := createTestUser(db, "filter3@example.com", "filter3")
+	group := createTestGroup(db, "篩選測試群組", "測試描述", user1.ID)
+	otherGroup := createTestGroup(db, "其他群組", "測試描述", user1.ID)
+	addGroupMember(db, group.ID, user2.ID, "member")
+	addGroupMember(db, group.ID, user3.ID, "member")
+	food := createTestCategory(db, "篩選餐飲", "🍜", "#FF0000")
+	lodging := createTestCategory(db, "篩選住宿", "🏨", "#0000FF")
+
+	createTransaction := func(groupID uint, description, notes, currency string, amount, baseAmount money.Amount, paidBy, categoryID uint, day int, splitUserIDs ...uint) *models.Transaction {
+		date := time.Date(2026, 3, day, 12, 0, 0, 0, time.Local)
+		transaction := &models.Transaction{
+			GroupID:      groupID,
+			Description:  description,
+			Notes:        notes,
+			Amount:       amount,
+			Currency:     currency,
+			ExchangeRate: 1,
+			BaseAmount:   baseAmount,
+			CategoryID:   categoryID,
+			PaidBy:       paidBy,
+			CreatedBy:    paidBy,
+			CreatedAt:    date,
+			UpdatedAt:    date,
+		}
+		db.Create(transaction)
+		for _, userID := range splitUserIDs {
+			createTestTransactionSplit(db, transaction.ID, userID, amount/money.Amount(len(splitUserIDs)))
+		}
+		return transaction
+	}
+	dinner := createTransaction(group.ID, "晚餐 火鍋", "", "TWD", 90000, 90000, user1.ID, food.ID, 1, user1.ID, user2.ID)
+	db.Create(&[]models.TransactionPayment{
+		{TransactionID: dinner.ID, UserID: user1.ID, Amount: 60000},
+		{TransactionID: dinner.ID, UserID: user2.ID, Amount: 30000},
+	})
+	taxi := createTransaction(group.ID, "計程車", "機場_接送", "TWD", 30000, 0, user2.ID, 0, 5, user2.ID, user3.ID)
+	hotel := createTransaction(group.ID, "Hotel", "", "USD", 10000, 320000, user3.ID, lodging.ID, 10, user1.ID, user3.ID)
+	coffee := createTransaction(otherGroup.ID, "咖啡", "", "TWD", 15000, 15000, user1.ID, food.ID, 7, user1.ID)
+
+	actors := map[string]uint{"user1": user1.ID, "user3": user3.ID}
+	testApp := fiber.New()
+	testApp.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", actors[c.Get("X-User")])
+		return c.Next()
+	})
+	testApp.Get("/transactions", handler.GetTransactions)
+	testApp.Get("/groups/:id/transactions", handler.GetGroupTransactions)
+
+	type listResponse struct {
+		Data struct {
+			Data       []responses.TransactionSimpleResponse `json:"data"`
+			Pagination responses.PaginationMeta              `json:"pagination"`
+		} `json:"data"`
+	}
+	list := func(url, actor string, expectedStatus int) listResponse {
+		t.Helper()
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("X-User", actor)
+		resp, err := testApp.Test(req)
+		if err != nil {
+			t.Fatalf("無法執行請求: %v", err)
+		}
+		if resp.StatusCode != expectedStatus {
+			t.Fatalf("%s: 期望狀態碼 %d，得到 %d", url, expectedStatus, resp.StatusCode)
+		}
+		var response listResponse
+		json.NewDecoder(resp.Body).Decode(&response)
+		return response
+	}
+	expectIDs := func(url, actor string, expected ...*models.Transaction) {
+		t.Helper()
+		response := list(url, actor, http.StatusOK)
+		var ids, expectedIDs []uint
+		for _, transaction := range response.Data.Data {
+			ids = append(ids, transaction.ID)
+		}
+		for _, transaction := range expected {
+			expectedIDs = append(expectedIDs, transaction.ID)
+		}
+		if len(ids) != len(expectedIDs) || response.Data.Pagination.Total != int64(len(expectedIDs)) {
+			t.Errorf("%s: 期望交易 %v，得到 %v（總筆數 %d）", url, expectedIDs, ids, response.Data.Pagination.Total)
+			return
+		}
+		for i := range ids {
+			if ids[i] != expectedIDs[i] {
+				t.Errorf("%s: 期望交易 %v，得到 %v", url, expectedIDs, ids)
+				return
+			}
+		}
+	}
+	groupURL := "/groups/" + strconv.Itoa(int(group.ID)) + "/transactions"
+
+	t.Run("群組交易篩選", func(t *testing.T) {
+		expectIDs(groupURL, "user3", hotel, taxi, dinner)
+		expectIDs(groupURL+"?from=2026-03-05&to=2026-03-05", "user3", taxi)
+		expectIDs(groupURL+"?from=2026-03-02", "user3", hotel, taxi)
+		expectIDs(groupURL+"?category_id="+strconv.Itoa(int(food.ID)), "user3", dinner)
+		expectIDs(groupURL+"?paid_by="+strconv.Itoa(int(user2.ID)), "user3", taxi, dinner)
+		expectIDs(groupURL+"?participant_id="+strconv.Itoa(int(user1.ID)), "user3", hotel, dinner)
+		expectIDs(groupURL+"?currency=usd", "user3", hotel)
+	})
+
+	t.Run("金額範圍", func(t *testing.T) {
+		// 未指定幣別時以群組基準幣別比較，舊資料未記錄基準金額時視為原始金額
+		expectIDs(groupURL+"?min_amount=500", "user3", hotel, dinner)
+		expectIDs(groupURL+"?max_amount=500", "user3", taxi)
+		expectIDs(groupURL+"?min_amount=300&max_amount=900", "user3", taxi, dinner)
+		expectIDs(groupURL+"?currency=USD&min_amount=50", "user3", hotel)
+		expectIDs(groupURL+"?currency=USD&min_amount=500", "user3")
+	})
+
+	t.Run("搜尋描述與備註", func(t *testing.T) {
+		expectIDs(groupURL+"?q=火鍋", "user3", dinner)
+		expectIDs(groupURL+"?q=hotel", "user3", hotel)
+		expectIDs(groupURL+"?q=_", "user3", taxi)
+		expectIDs(groupURL+"?q=%25", "user3")
+	})
+
+	t.Run("排序與分頁", func(t *testing.T) {
+		expectIDs(groupURL+"?sort=amount&order=asc", "user3", taxi, dinner, hotel)
+		expectIDs(groupURL+"?sort=created_at&order=asc", "user3", dinner, taxi, hotel)
+
+		response := list(groupURL+"?sort=amount&page=2&limit=2", "user3", http.StatusOK)
+		if len(response.Data.Data) != 1 || response.Data.Data[0].ID != taxi.ID {
+			t.Errorf("第二頁期望只有交易 %d，得到 %+v", taxi.ID, response.Data.Data)
+		}
+		if response.Data.Pagination.Total != 3 || response.Data.Pagination.TotalPages != 2 {
+			t.Errorf("期望總筆數 3、總頁數 2，得到 %+v", response.Data.Pagination)
+		}
+	})
+
+	t.Run("用戶交易列表", func(t *testing.T) {
+		expectIDs("/transactions", "user1", hotel, coffee, dinner)
+		expectIDs("/transactions?q=咖啡", "user1", coffee)
+		expectIDs("/transactions?currency=TWD&min_amount=500", "user1", dinner)
+		expectIDs("/transactions?participant_id="+strconv.Itoa(int(user3.ID)), "user1", hotel)
+		expectIDs("/transactions?category_id="+strconv.Itoa(int(food.ID))+"&currency=TWD&sort=amount&order=asc", "user1", coffee, dinner)
+	})
+
+	t.Run("無效的查詢參數", func(t *testing.T) {
+		invalid := []string{
+			groupURL + "?sort=payer",
+			groupURL + "?order=up",
+			groupURL + "?from=2026/03/01",
+			groupURL + "?from=2026-03-10&to=2026-03-01",
+			groupURL + "?min_amount=abc",
+			groupURL + "?min_amount=900&max_amount=300",
+			groupURL + "?currency=XYZ",
+			"/transactions?min_amount=100", // 跨群組沒有共同的基準幣別
+			"/transactions?sort=amount",
+		}
+		for _, url := range invalid {
+			list(url, "user1", http.StatusBadRequest)
+		}
+	})
+
+	// 清理
+	transactionIDs := []uint{dinner.ID, taxi.ID, hotel.ID, coffee.ID}
+	db.Where("transaction_id IN ?", transactionIDs).Delete(&models.TransactionSplit{})
+	db.Where("transaction_id IN ?", transactionIDs).Delete(&models.TransactionPayment{})
+	db.Unscoped().Delete(&models.Transaction{}, transactionIDs)
+	db.Delete(food)
+	db.Delete(lodging)
+	db.Delete(otherGroup)
+	db.Delete(group)
+	db.Delete(user1)
+	db.Delete(user2)
+	db.Delete(user3)
+}
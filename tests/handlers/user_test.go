@@ -3,10 +3,13 @@ package handlers_test
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"split-go/internal/handlers"
+	"split-go/internal/models"
 	"testing"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"golang.org/x/crypto/bcrypt"
@@ -363,3 +366,156 @@ func TestCreateTestUser(t *testing.T) {
 		}
 	})
 }
+
+// 測試跨群組平衡摘要
+func TestGetBalances(t *testing.T) {
+	db := setupSettlementTestDB()
+	handler := handlers.NewUserHandler(db)
+
+	// 創建測試資料
+	alice := createTestUser(db, "summary1@example.com", "summary1")
+	bob := createTestUser(db, "summary2@example.com", "summary2")
+	carol := createTestUser(db, "summary3@example.com", "summary3")
+
+	// 合租群組 (TWD)：Alice 付 600，與 Bob 平分
+	home := createTestGroup(db, "合租", "測試描述", alice.ID)
+	addGroupMember(db, home.ID, bob.ID, "member")
+	rent := createTestTransaction(db, home.ID, alice.ID, alice.ID, 60000)
+	createTestTransactionSplit(db, rent.ID, alice.ID, 30000)
+	createTestTransactionSplit(db, rent.ID, bob.ID, 30000)
+	pending := createTestSettlement(db, home.ID, bob.ID, alice.ID, 10000)
+
+	// 旅行群組 (USD)：Bob 付 20 美元，與 Alice 平分
+	trip := createTestGroup(db, "旅行", "測試描述", bob.ID)
+	db.Model(trip).Update("base_currency", "USD")
+	addGroupMember(db, trip.ID, alice.ID, "member")
+	hotel := createTestTransaction(db, trip.ID, bob.ID, bob.ID, 2000)
+	db.Model(hotel).Update("currency", "USD")
+	createTestTransactionSplit(db, hotel.ID, alice.ID, 1000)
+	createTestTransactionSplit(db, hotel.ID, bob.ID, 1000)
+
+	// 社團群組 (TWD)：Carol 付 400，與 Alice 平分
+	club := createTestGroup(db, "社團", "測試描述", carol.ID)
+	addGroupMember(db, club.ID, alice.ID, "member")
+	dues := createTestTransaction(db, club.ID, carol.ID, carol.ID, 40000)
+	createTestTransactionSplit(db, dues.ID, alice.ID, 20000)
+	createTestTransactionSplit(db, dues.ID, carol.ID, 20000)
+
+	rate := models.ExchangeRate{Date: time.Now().UTC().Truncate(24 * time.Hour), Base: "USD", Quote: "TWD", Rate: 32, Source: "test"}
+	db.Create(&rate)
+
+	app := fiber.New()
+	app.Use("/users/me/balances", func(c *fiber.Ctx) error {
+		c.Locals("user_id", alice.ID)
+		return c.Next()
+	})
+	app.Get("/users/me/balances", handler.GetBalances)
+
+	type currencyBalance struct {
+		Currency string  `json:"currency"`
+		Balance  float64 `json:"balance"`
+	}
+	var summary struct {
+		Data struct {
+			Groups []struct {
+				Group struct {
+					ID uint `json:"id"`
+				} `json:"group"`
+				Currency string  `json:"currency"`
+				Balance  float64 `json:"balance"`
+			} `json:"groups"`
+			Counterparties []struct {
+				UserID   uint    `json:"user_id"`
+				Currency string  `json:"currency"`
+				Amount   float64 `json:"amount"`
+			} `json:"counterparties"`
+			Totals             []currencyBalance `json:"totals"`
+			ConvertedTotal     *currencyBalance  `json:"converted_total"`
+			PendingSettlements []struct {
+				ID        uint   `json:"id"`
+				Direction string `json:"direction"`
+			} `json:"pending_settlements"`
+		} `json:"data"`
+	}
+
+	req := httptest.NewRequest("GET", "/users/me/balances?currency=twd", nil)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("無法執行請求: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("期望狀態碼 %d，得到 %d", http.StatusOK, resp.StatusCode)
+	}
+	json.NewDecoder(resp.Body).Decode(&summary)
+	data := summary.Data
+
+	// 各群組以群組基準幣別計算
+	expectedGroups := []currencyBalance{{"TWD", 300}, {"USD", -10}, {"TWD", -200}}
+	if len(data.Groups) != len(expectedGroups) {
+		t.Fatalf("期望 %d 個群組，得到 %d 個", len(expectedGroups), len(data.Groups))
+	}
+	for i, expected := range expectedGroups {
+		if data.Groups[i].Currency != expected.Currency || data.Groups[i].Balance != expected.Balance {
+			t.Errorf("第 %d 個群組期望 %v，得到 %s %v", i+1, expected, data.Groups[i].Currency, data.Groups[i].Balance)
+		}
+	}
+
+	// 對象債務依幣別分開加總
+	expectedCounterparties := map[string]float64{
+		fmt.Sprintf("%d-TWD", bob.ID):   300,
+		fmt.Sprintf("%d-USD", bob.ID):   -10,
+		fmt.Sprintf("%d-TWD", carol.ID): -200,
+	}
+	if len(data.Counterparties) != len(expectedCounterparties) {
+		t.Fatalf("期望 %d 筆對象債務，得到 %d 筆", len(expectedCounterparties), len(data.Counterparties))
+	}
+	for _, counterparty := range data.Counterparties {
+		key := fmt.Sprintf("%d-%s", counterparty.UserID, counterparty.Currency)
+		if expectedCounterparties[key] != counterparty.Amount {
+			t.Errorf("對象 %s 期望 %v，得到 %v", key, expectedCounterparties[key], counterparty.Amount)
+		}
+	}
+
+	// 依幣別加總，並以 USD/TWD = 32 換算：100 - 10 × 32 = -220
+	expectedTotals := []currencyBalance{{"TWD", 100}, {"USD", -10}}
+	if len(data.Totals) != len(expectedTotals) {
+		t.Fatalf("期望 %d 個幣別總額，得到 %d 個", len(expectedTotals), len(data.Totals))
+	}
+	for i, expected := range expectedTotals {
+		if data.Totals[i] != expected {
+			t.Errorf("期望總額 %v，得到 %v", expected, data.Totals[i])
+		}
+	}
+	if data.ConvertedTotal == nil || *data.ConvertedTotal != (currencyBalance{"TWD", -220}) {
+		t.Errorf("期望換算總額 TWD -220，得到 %v", data.ConvertedTotal)
+	}
+
+	// 待付款結算標示收付方向
+	if len(data.PendingSettlements) != 1 || data.PendingSettlements[0].ID != pending.ID ||
+		data.PendingSettlements[0].Direction != "incoming" {
+		t.Errorf("期望一筆待收款結算，得到 %+v", data.PendingSettlements)
+	}
+
+	// 無法換算時回傳錯誤
+	for _, currency := range []string{"JPY", "XYZ"} {
+		req := httptest.NewRequest("GET", "/users/me/balances?currency="+currency, nil)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("無法執行請求: %v", err)
+		}
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("幣別 %s 期望狀態碼 %d，得到 %d", currency, http.StatusBadRequest, resp.StatusCode)
+		}
+	}
+
+	// 清理
+	db.Where("transaction_id IN ?", []uint{rent.ID, hotel.ID, dues.ID}).Delete(&models.TransactionSplit{})
+	db.Delete(&models.Transaction{}, []uint{rent.ID, hotel.ID, dues.ID})
+	db.Delete(pending)
+	db.Delete(&rate)
+	db.Where("group_id IN ?", []uint{home.ID, trip.ID, club.ID}).Delete(&models.GroupMember{})
+	db.Delete(&models.Group{}, []uint{home.ID, trip.ID, club.ID})
+	db.Delete(alice)
+	db.Delete(bob)
+	db.Delete(carol)
+}